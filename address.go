@@ -8,16 +8,14 @@
 package onionutil
 
 import (
-	"bytes"
 	"crypto"
 	"crypto/rsa"
 	"errors"
 	"io"
-	"reflect"
 
+	"github.com/nogoegst/onionutil/onionaddr"
 	"github.com/nogoegst/onionutil/pkcs1"
 	"golang.org/x/crypto/ed25519"
-	"golang.org/x/crypto/sha3"
 )
 
 // Generate private key for onion service using rand as the entropy source.
@@ -44,6 +42,8 @@ func OnionAddress(pk crypto.PublicKey) (string, error) {
 		return OnionAddressV3(pk)
 	case ed25519.PrivateKey:
 		return OnionAddressV3(pk.Public().(ed25519.PublicKey))
+	case OnionKey:
+		return pk.OnionAddress()
 	default:
 		return "", errors.New("Unrecognized type of public key")
 	}
@@ -51,46 +51,59 @@ func OnionAddress(pk crypto.PublicKey) (string, error) {
 
 // Check whether onion address is a valid one.
 func OnionAddressIsValid(onionAddress string) bool {
-	v2v := OnionAddressIsValidV2(onionAddress)
-	v3v := OnionAddressIsValidV3(onionAddress)
-	return v2v || v3v
+	return onionaddr.IsValid(onionAddress)
+}
+
+// OnionAddr is a parsed onion address.
+type OnionAddr = onionaddr.Addr
+
+// ParseOnionAddress parses and validates v2 or v3 onion address addr.
+// ".onion" suffix and subdomains are optional.
+func ParseOnionAddress(addr string) (*OnionAddr, error) {
+	return onionaddr.Parse(addr)
 }
 
 // v2 onion addresses
 var (
-	OnionAddressLengthV2 = 10
+	OnionAddressLengthV2 = onionaddr.LengthV2
 )
 
 // OnionAddress returns the Tor Onion Service address corresponding to a given
 // rsa.PublicKey.
 func OnionAddressV2(pk *rsa.PublicKey) (onionAddress string, err error) {
-	permID, err := CalcPermanentID(pk)
-	if err != nil {
-		return onionAddress, err
-	}
-	onionAddress = Base32Encode(permID)
-	return onionAddress, err
+	return onionaddr.V2(pk)
 }
 
 // Generate v2 onion service key (RSA-1024) using rand as the entropy source.
 func GenerateOnionKeyV2(rand io.Reader) (crypto.PrivateKey, error) {
-	sk, err := rsa.GenerateKey(rand, 1024)
+	sk, _, err := GenerateOnionKeyWithAddressV2(rand)
 	if err != nil {
 		return nil, err
 	}
 	return sk, nil
 }
 
-// Check whether onion address is a valid v2 one.
-func OnionAddressIsValidV2(onionAddress string) bool {
-	oa, err := Base32Decode(onionAddress)
+// GenerateOnionKeyWithAddressV2 generates v2 onion service key
+// (RSA-1024, e=65537) using rand as the entropy source and returns
+// it along with its onion address.
+func GenerateOnionKeyWithAddressV2(rand io.Reader) (*rsa.PrivateKey, string, error) {
+	sk, err := rsa.GenerateKey(rand, pkcs1.TorModulusBits)
 	if err != nil {
-		return false
+		return nil, "", err
 	}
-	if len(oa) != OnionAddressLengthV2 {
-		return false
+	if err := pkcs1.CheckTorKey(&sk.PublicKey); err != nil {
+		return nil, "", err
 	}
-	return true
+	onionAddress, err := OnionAddressV2(&sk.PublicKey)
+	if err != nil {
+		return nil, "", err
+	}
+	return sk, onionAddress, nil
+}
+
+// Check whether onion address is a valid v2 one.
+func OnionAddressIsValidV2(onionAddress string) bool {
+	return onionaddr.IsValidV2(onionAddress)
 }
 
 // Calculate hash (SHA1) of DER-encoded RSA public key pk.
@@ -103,65 +116,47 @@ func RSAPubkeyHash(pk *rsa.PublicKey) (derHash []byte, err error) {
 	return derHash, err
 }
 
-// Calculate permanent ID from RSA public key
+// PermanentID calculates permanent ID of v2 onion service
+// from its RSA public key pk.
+func PermanentID(pk *rsa.PublicKey) (permID []byte, err error) {
+	return onionaddr.PermanentID(pk)
+}
+
+// CalcPermanentID calculates permanent ID from RSA public key.
+//
+// Deprecated: use PermanentID.
 func CalcPermanentID(pk *rsa.PublicKey) (permId []byte, err error) {
-	derHash, err := RSAPubkeyHash(pk)
-	if err != nil {
-		return
-	}
-	permId = derHash[:10]
-	return
+	return PermanentID(pk)
+}
+
+// PermanentIDOnionAddress returns v2 onion address (without
+// ".onion") corresponding to permanent ID permID.
+func PermanentIDOnionAddress(permID []byte) (string, error) {
+	return onionaddr.FromPermanentID(permID)
 }
 
 // v3 onion addresses
 var (
-	OnionAddressChecksumLengthV3     = 2
-	OnionAddressVersionFieldV3       = []byte{0x03}
+	OnionAddressChecksumLengthV3     = onionaddr.ChecksumLengthV3
+	OnionAddressVersionFieldV3       = []byte{onionaddr.VersionV3}
 	OnionAddressVersionFieldLengthV3 = 1
-	OnionAddressLengthV3             = ed25519.PublicKeySize +
-		OnionAddressVersionFieldLengthV3 +
-		OnionAddressChecksumLengthV3
-	OnionChecksumPrefix = []byte(".onion checksum")
+	OnionAddressLengthV3             = onionaddr.LengthV3
+	OnionChecksumPrefix              = []byte(onionaddr.ChecksumPrefix)
 )
 
 // Calculate onion address v3 from public key pk.
 func OnionAddressV3(pk ed25519.PublicKey) (onionAddress string, err error) {
-	chksum := OnionAddressChecksumV3([]byte(pk))
-	oab := make([]byte, 0, OnionAddressLengthV3)
-	oa := bytes.NewBuffer(oab)
-	oa.Write([]byte(pk))
-	oa.Write(chksum)
-	oa.Write(OnionAddressVersionFieldV3)
-	onionAddress = Base32Encode(oa.Bytes())
-	return onionAddress, err
+	return onionaddr.V3(pk)
 }
 
 // Check whether onion address is a valid v3 one.
 func OnionAddressIsValidV3(onionAddress string) bool {
-	_, err := OnionAddressPublicKeyV3(onionAddress)
-	return err == nil
+	return onionaddr.IsValidV3(onionAddress)
 }
 
 // Extract Ed25519 public key from the onion address.
 func OnionAddressPublicKeyV3(onionAddress string) (ed25519.PublicKey, error) {
-	oa, err := Base32Decode(onionAddress)
-	if err != nil {
-		return nil, errors.New("Error while base32 decoding onion address")
-	}
-	if len(oa) != OnionAddressLengthV3 {
-		return nil, errors.New("Wrong onion address length")
-	}
-	oab := bytes.NewBuffer(oa)
-	pk := oab.Next(ed25519.PublicKeySize)
-	chksum := oab.Next(OnionAddressChecksumLengthV3)
-	ver := oab.Next(OnionAddressVersionFieldLengthV3)
-	if !reflect.DeepEqual(ver, OnionAddressVersionFieldV3) {
-		return nil, errors.New("Invalid onion address version value")
-	}
-	if !reflect.DeepEqual(chksum, OnionAddressChecksumV3(pk)) {
-		return nil, errors.New("Invalid onion address checksum")
-	}
-	return ed25519.PublicKey(pk), nil
+	return onionaddr.PublicKeyV3(onionAddress)
 }
 
 // Generate v3 onion address key (Ed25519) using rand as the entropy source
@@ -170,11 +165,20 @@ func GenerateOnionKeyV3(rand io.Reader) (crypto.PrivateKey, error) {
 	return sk, err
 }
 
+// OnionChecksum returns checksum of onion address with key material
+// pk and version byte version:
+// SHA3-256(".onion checksum" | pk | version)[:2].
+func OnionChecksum(pk []byte, version byte) []byte {
+	return onionaddr.Checksum(pk, version)
+}
+
+// VerifyOnionChecksum checks that checksum is the checksum
+// of onion address with key material pk and version byte version.
+func VerifyOnionChecksum(pk []byte, version byte, checksum []byte) bool {
+	return onionaddr.VerifyChecksum(pk, version, checksum)
+}
+
 // Calculate onion address checksum (v3) from byte-encoded Ed25519 key
 func OnionAddressChecksumV3(pk []byte) []byte {
-	h := sha3.New256()
-	h.Write(OnionChecksumPrefix)
-	h.Write([]byte(pk))
-	h.Write(OnionAddressVersionFieldV3)
-	return h.Sum(nil)[:2]
+	return OnionChecksum(pk, OnionAddressVersionFieldV3[0])
 }
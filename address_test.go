@@ -0,0 +1,141 @@
+package onionutil
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"testing"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+/* Test vector from little-t-tor's test_hs_common.c (RFC 8032 key) */
+const (
+	testPubkeyV3Hex = "d75a980182b10ab7d54bfed3c964073a0ee172f3daa62325af021a68f707511a"
+	testAddressV3   = "25njqamcweflpvkl73j4szahhihoc4xt3ktcgjnpaingr5yhkenl5sid"
+)
+
+func TestOnionAddressV3(t *testing.T) {
+	pk, _ := hex.DecodeString(testPubkeyV3Hex)
+	addr, err := OnionAddressV3(ed25519.PublicKey(pk))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addr != testAddressV3 {
+		t.Fatalf("got %s, expected %s", addr, testAddressV3)
+	}
+	extracted, err := OnionAddressPublicKeyV3(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(extracted, pk) {
+		t.Fatal("extracted public key differs from the original one")
+	}
+	if _, err := OnionAddressV3(ed25519.PublicKey(pk[:31])); err == nil {
+		t.Fatal("short public key is accepted")
+	}
+}
+
+func TestOnionAddressV3Checksum(t *testing.T) {
+	pk, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr, err := OnionAddressV3(pk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !OnionAddressIsValidV3(addr) {
+		t.Fatal("generated address is not valid")
+	}
+	/* Flip a character of the key part */
+	broken := []byte(addr)
+	if broken[0] == 'a' {
+		broken[0] = 'b'
+	} else {
+		broken[0] = 'a'
+	}
+	if OnionAddressIsValidV3(string(broken)) {
+		t.Fatal("address with broken checksum is valid")
+	}
+}
+
+func TestParseOnionAddress(t *testing.T) {
+	for _, addr := range []string{
+		testAddressV3,
+		testAddressV3 + ".onion",
+		"www." + testAddressV3 + ".onion",
+		"25NJQAMCWEFLPVKL73J4SZAHHIHOC4XT3KTCGJNPAINGR5YHKENL5SID.ONION",
+	} {
+		oa, err := ParseOnionAddress(addr)
+		if err != nil {
+			t.Fatalf("%s: %v", addr, err)
+		}
+		if oa.Version != 3 || oa.String() != testAddressV3 {
+			t.Fatalf("%s: parsed as %d %s", addr, oa.Version, oa)
+		}
+	}
+	oa, err := ParseOnionAddress("6iedtc4w36h35ln3.onion")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if oa.Version != 2 || len(oa.PermID) != OnionAddressLengthV2 {
+		t.Fatal("v2 address is parsed incorrectly")
+	}
+	for _, addr := range []string{"", "abc.onion", testAddressV3[1:], "6iedtc4w36h35ln1"} {
+		if _, err := ParseOnionAddress(addr); err == nil {
+			t.Fatalf("invalid address %q is accepted", addr)
+		}
+	}
+}
+
+func TestPermanentIDOnionAddress(t *testing.T) {
+	permID, err := Base32Decode("hartwellnogoegst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr, err := PermanentIDOnionAddress(permID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addr != "hartwellnogoegst" {
+		t.Fatalf("wrong onion address %s", addr)
+	}
+	if _, err := PermanentIDOnionAddress(permID[:9]); err == nil {
+		t.Fatal("short permanent ID is accepted")
+	}
+}
+
+func TestGenerateOnionKeyWithAddressV2(t *testing.T) {
+	sk, addr, err := GenerateOnionKeyWithAddressV2(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sk.PublicKey.E != 65537 || sk.N.BitLen() != 1024 {
+		t.Fatal("Generated key is not compatible with Tor")
+	}
+	if !OnionAddressIsValidV2(addr) {
+		t.Fatalf("Invalid onion address: %s", addr)
+	}
+	if want, _ := OnionAddressV2(&sk.PublicKey); addr != want {
+		t.Fatalf("Onion address %s does not match the key", addr)
+	}
+}
+
+func TestOnionChecksum(t *testing.T) {
+	pk, _ := hex.DecodeString(testPubkeyV3Hex)
+	oa, err := Base32Decode(testAddressV3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checksum := oa[ed25519.PublicKeySize : ed25519.PublicKeySize+2]
+	if !bytes.Equal(OnionChecksum(pk, 0x03), checksum) {
+		t.Fatalf("wrong checksum: %x", OnionChecksum(pk, 0x03))
+	}
+	if !VerifyOnionChecksum(pk, 0x03, checksum) {
+		t.Fatal("valid checksum is not verified")
+	}
+	if VerifyOnionChecksum(pk, 0x04, checksum) {
+		t.Fatal("checksum of another version is verified")
+	}
+}
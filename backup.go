@@ -0,0 +1,367 @@
+// backup.go - encrypted backups of onion service identities
+//
+// To the extent possible under law, Ivan Markin waived all copyright
+// and related or neighboring rights to this module of onionutil, using the creative
+// commons "cc0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package onionutil
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nogoegst/onionutil/pkcs1"
+)
+
+// Parameters of encrypted backups.
+const (
+	// BackupIterations is the number of PBKDF2-HMAC-SHA512
+	// iterations used to derive backup encryption keys.
+	BackupIterations = 1 << 20
+	backupSaltSize   = 16
+	backupMetadata   = "backup.json"
+)
+
+var backupMagic = []byte("onionutil-backup-v1\n")
+
+// BackupFile is a file of HiddenServiceDir.
+type BackupFile struct {
+	// Name is the path relative to HiddenServiceDir
+	// with "/" separators.
+	Name string
+	Data []byte
+}
+
+// Backup is an identity of an onion service: its keys, hostname
+// and client authorization files.
+type Backup struct {
+	Version      int       `json:"version"`
+	OnionAddress string    `json:"onion_address"`
+	Created      time.Time `json:"created"`
+	// Files are files of HiddenServiceDir. They aren't in the
+	// metadata.
+	Files []BackupFile `json:"-"`
+}
+
+// backupFileNames returns names of files of HiddenServiceDir dir
+// which make the identity of the service.
+func backupFileNames(dir string) ([]string, error) {
+	names := []string{HostnameFilename, PrivateKeyFilenameV2, ClientKeysFilenameV2,
+		SecretKeyFilenameV3, PublicKeyFilenameV3}
+	clients, err := ioutil.ReadDir(filepath.Join(dir, AuthorizedClientsDir))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, fi := range clients {
+		if fi.Mode().IsRegular() && strings.HasSuffix(fi.Name(), ClientAuthFileSuffixV3) {
+			names = append(names, path.Join(AuthorizedClientsDir, fi.Name()))
+		}
+	}
+	return names, nil
+}
+
+// NewBackup returns backup of v2 or v3 onion service
+// with HiddenServiceDir dir.
+func NewBackup(dir string) (*Backup, error) {
+	names, err := backupFileNames(dir)
+	if err != nil {
+		return nil, err
+	}
+	b := &Backup{Created: time.Now().UTC().Truncate(time.Second)}
+	for _, name := range names {
+		data, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		b.Files = append(b.Files, BackupFile{Name: name, Data: data})
+	}
+	var sk interface{}
+	if _, err := os.Stat(filepath.Join(dir, SecretKeyFilenameV3)); err == nil {
+		b.Version = 3
+		sk, err = LoadSecretKeyFileV3(filepath.Join(dir, SecretKeyFilenameV3))
+		if err != nil {
+			return nil, err
+		}
+	} else if _, err := os.Stat(filepath.Join(dir, PrivateKeyFilenameV2)); err == nil {
+		b.Version = 2
+		sk, err = LoadPrivateKeyFileV2(filepath.Join(dir, PrivateKeyFilenameV2))
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		return nil, errors.New("No onion service key")
+	}
+	key, err := NewOnionKey(rand.Reader, sk)
+	if err != nil {
+		return nil, err
+	}
+	defer key.Zeroize()
+	b.OnionAddress, err = key.OnionAddress()
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Zeroize wipes content of the files.
+func (b *Backup) Zeroize() {
+	for _, f := range b.Files {
+		Zeroize(f.Data)
+	}
+}
+
+// validBackupFileName reports whether name is a relative path
+// which stays inside HiddenServiceDir.
+func validBackupFileName(name string) bool {
+	return name != "" && name != backupMetadata && !path.IsAbs(name) &&
+		path.Clean(name) == name && name != ".." &&
+		!strings.HasPrefix(name, "../") && !strings.Contains(name, "\\")
+}
+
+// file returns content of the file name in the backup.
+func (b *Backup) file(name string) ([]byte, bool) {
+	for _, f := range b.Files {
+		if f.Name == name {
+			return f.Data, true
+		}
+	}
+	return nil, false
+}
+
+// keyOnionAddress returns onion address of the identity key
+// stored in the backup.
+func (b *Backup) keyOnionAddress() (string, error) {
+	var sk interface{}
+	switch b.Version {
+	case 3:
+		data, ok := b.file(SecretKeyFilenameV3)
+		if !ok {
+			return "", errors.New("No onion service key")
+		}
+		esk, err := DecodeSecretKeyV3(data)
+		if err != nil {
+			return "", err
+		}
+		sk = esk
+	case 2:
+		data, ok := b.file(PrivateKeyFilenameV2)
+		if !ok {
+			return "", errors.New("No onion service key")
+		}
+		rsk, err := pkcs1.DecodePrivateKeyPEM(data)
+		if err != nil {
+			return "", err
+		}
+		sk = rsk
+	default:
+		return "", fmt.Errorf("Unsupported onion service version %d", b.Version)
+	}
+	key, err := NewOnionKey(rand.Reader, sk)
+	if err != nil {
+		return "", err
+	}
+	defer key.Zeroize()
+	return key.OnionAddress()
+}
+
+// Restore writes files of the backup into HiddenServiceDir dir
+// which is created if it doesn't exist. Existing files are
+// not overwritten.
+func (b *Backup) Restore(dir string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	for _, f := range b.Files {
+		if !validBackupFileName(f.Name) {
+			return fmt.Errorf("Invalid file name in backup: %s", f.Name)
+		}
+		filename := filepath.Join(dir, filepath.FromSlash(f.Name))
+		if err := os.MkdirAll(filepath.Dir(filename), 0700); err != nil {
+			return err
+		}
+		w, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(f.Data)
+		if cerr := w.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *Backup) archive() ([]byte, error) {
+	metadata, err := json.Marshal(b)
+	if err != nil {
+		return nil, err
+	}
+	buf := new(bytes.Buffer)
+	tw := tar.NewWriter(buf)
+	files := append([]BackupFile(nil), b.Files...)
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+	files = append([]BackupFile{{Name: backupMetadata, Data: metadata}}, files...)
+	for _, f := range files {
+		hdr := &tar.Header{Name: f.Name, Mode: 0600, Size: int64(len(f.Data)), ModTime: b.Created}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return nil, err
+		}
+		if _, err := tw.Write(f.Data); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func parseBackupArchive(data []byte) (*Backup, error) {
+	b := new(Backup)
+	tr := tar.NewReader(bytes.NewReader(data))
+	for first := true; ; first = false {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		content, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		if first {
+			if hdr.Name != backupMetadata {
+				return nil, errors.New("No backup metadata")
+			}
+			if err := json.Unmarshal(content, b); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if !validBackupFileName(hdr.Name) {
+			return nil, fmt.Errorf("Invalid file name in backup: %s", hdr.Name)
+		}
+		b.Files = append(b.Files, BackupFile{Name: hdr.Name, Data: content})
+	}
+	if b.Version != 2 && b.Version != 3 {
+		return nil, fmt.Errorf("Unsupported onion service version %d", b.Version)
+	}
+	onionAddress, err := b.keyOnionAddress()
+	if err != nil {
+		return nil, err
+	}
+	if onionAddress != b.OnionAddress {
+		return nil, fmt.Errorf("Onion address %s doesn't match the key", b.OnionAddress)
+	}
+	return b, nil
+}
+
+func backupAEAD(passphrase string, salt []byte) (cipher.AEAD, error) {
+	if passphrase == "" {
+		return nil, errors.New("Empty passphrase")
+	}
+	key := pbkdf2([]byte(passphrase), salt, BackupIterations)
+	defer Zeroize(key)
+	block, err := aes.NewCipher(key[:32])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Encrypt returns the backup encrypted with AES-256-GCM using a key
+// derived from passphrase with PBKDF2-HMAC-SHA512. Anyone who knows
+// the passphrase gets the keys of the service, so it must be strong.
+func (b *Backup) Encrypt(passphrase string) ([]byte, error) {
+	plaintext, err := b.archive()
+	if err != nil {
+		return nil, err
+	}
+	defer Zeroize(plaintext)
+	salt := make([]byte, backupSaltSize)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+	aead, err := backupAEAD(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	out := append(append(append([]byte{}, backupMagic...), salt...), nonce...)
+	return aead.Seal(out, nonce, plaintext, backupMagic), nil
+}
+
+// DecryptBackup decrypts backup made by Backup.Encrypt.
+func DecryptBackup(data []byte, passphrase string) (*Backup, error) {
+	if !bytes.HasPrefix(data, backupMagic) {
+		return nil, errors.New("Not an onion service backup")
+	}
+	data = data[len(backupMagic):]
+	if len(data) < backupSaltSize {
+		return nil, ErrTruncated
+	}
+	salt, data := data[:backupSaltSize], data[backupSaltSize:]
+	aead, err := backupAEAD(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < aead.NonceSize()+aead.Overhead() {
+		return nil, ErrTruncated
+	}
+	nonce, data := data[:aead.NonceSize()], data[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, data, backupMagic)
+	if err != nil {
+		return nil, errors.New("Wrong passphrase or corrupted backup")
+	}
+	defer Zeroize(plaintext)
+	return parseBackupArchive(plaintext)
+}
+
+// ExportServiceDir returns encrypted backup of HiddenServiceDir dir.
+func ExportServiceDir(dir, passphrase string) ([]byte, error) {
+	b, err := NewBackup(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer b.Zeroize()
+	return b.Encrypt(passphrase)
+}
+
+// ImportServiceDir restores encrypted backup data into
+// HiddenServiceDir dir and returns the backup.
+func ImportServiceDir(data []byte, passphrase, dir string) (*Backup, error) {
+	b, err := DecryptBackup(data, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	if err := b.Restore(dir); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
@@ -0,0 +1,112 @@
+package onionutil
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+func TestBackup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "onionutil-backup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	pk, sk, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := filepath.Join(dir, "src")
+	os.MkdirAll(filepath.Join(src, AuthorizedClientsDir), 0700)
+	if err := SaveServiceDirV3(src, sk); err != nil {
+		t.Fatal(err)
+	}
+	auth := []byte("descriptor:x25519:N2NU7BSRL6YODZCYPN4CREB54TYLKGIE2KYOQWLFYC23ZJVCE5DQ\n")
+	authFile := filepath.Join(AuthorizedClientsDir, "alice"+ClientAuthFileSuffixV3)
+	if err := ioutil.WriteFile(filepath.Join(src, authFile), auth, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ExportServiceDir(src, "long enough backup passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DecryptBackup(data, "wrong passphrase"); err == nil {
+		t.Fatal("backup is decrypted with wrong passphrase")
+	}
+	dst := filepath.Join(dir, "dst")
+	b, err := ImportServiceDir(data, "long enough backup passphrase", dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	onionAddress, _ := OnionAddressV3(pk)
+	if b.Version != 3 || b.OnionAddress != onionAddress || len(b.Files) != 4 {
+		t.Fatalf("wrong backup: %+v", b)
+	}
+	for _, name := range []string{HostnameFilename, SecretKeyFilenameV3, PublicKeyFilenameV3, authFile} {
+		expected, _ := ioutil.ReadFile(filepath.Join(src, name))
+		restored, err := ioutil.ReadFile(filepath.Join(dst, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(restored, expected) {
+			t.Fatalf("%s differs", name)
+		}
+	}
+	if err := b.Restore(dst); err == nil {
+		t.Fatal("existing files are overwritten")
+	}
+}
+
+func TestBackupFileName(t *testing.T) {
+	for _, name := range []string{"", "..", "../x", "/x", "a/../b", "./x", "a\\b", backupMetadata} {
+		if validBackupFileName(name) {
+			t.Fatalf("%q is accepted", name)
+		}
+	}
+	for _, name := range []string{HostnameFilename, "..x", "authorized_clients/alice.auth"} {
+		if !validBackupFileName(name) {
+			t.Fatalf("%q is rejected", name)
+		}
+	}
+}
+
+func TestBackupWrongOnionAddress(t *testing.T) {
+	dir, err := ioutil.TempDir("", "onionutil-backup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	_, sk, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveServiceDirV3(dir, sk); err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewBackup(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPk, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.OnionAddress, _ = OnionAddressV3(otherPk)
+	data, err := b.Encrypt("long enough backup passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst := filepath.Join(dir, "dst")
+	if _, err := ImportServiceDir(data, "long enough backup passphrase", dst); err == nil {
+		t.Fatal("backup with wrong onion address is imported")
+	}
+	if _, err := os.Stat(dst); !os.IsNotExist(err) {
+		t.Fatal("backup with wrong onion address is restored")
+	}
+}
@@ -0,0 +1,141 @@
+// balance.go - merge descriptors of several backends (OnionBalance)
+//
+// To the extent possible under law, Ivan Markin waived all copyright
+// and related or neighboring rights to this module of onionutil, using the creative
+// commons "cc0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package onionutil
+
+import (
+	"crypto"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+// roundRobin picks up to max items from sets of sizes sizes taking
+// one item of each set in turn. It returns (set, index) pairs.
+func roundRobin(sizes []int, max int) (picks [][2]int) {
+	for i := 0; len(picks) < max; i++ {
+		picked := false
+		for set, size := range sizes {
+			if i < size && len(picks) < max {
+				picks = append(picks, [2]int{set, i})
+				picked = true
+			}
+		}
+		if !picked {
+			break
+		}
+	}
+	return picks
+}
+
+// BalanceDescriptors returns descriptors of all replicas of the
+// master service with key sk which contain introduction points of
+// backends. Introduction points are taken evenly from backends
+// up to MaxIntroPointsV2. Backends must not use client authorization.
+func BalanceDescriptors(sk crypto.Signer, backends []*OnionDescriptor, now time.Time) ([]*OnionDescriptor, error) {
+	var sets [][]IntroductionPoint
+	var sizes []int
+	for i, backend := range backends {
+		ips, err := backend.IntroPoints()
+		if err != nil {
+			return nil, fmt.Errorf("Backend %d: %w", i, err)
+		}
+		sets = append(sets, ips)
+		sizes = append(sizes, len(ips))
+	}
+	var ips []IntroductionPoint
+	for _, pick := range roundRobin(sizes, MaxIntroPointsV2) {
+		ips = append(ips, sets[pick[0]][pick[1]])
+	}
+	if len(ips) == 0 {
+		return nil, errors.New("Backends have no introduction points")
+	}
+	return GenerateDescriptorSet(sk, ips, now)
+}
+
+// recertify returns copy of cert signed with sk that expires
+// at expiration.
+func recertify(cert *Certificate, sk ed25519.PrivateKey, expiration time.Time) *Certificate {
+	c := NewCertificate(cert.CertType, cert.CertifiedKey, expiration,
+		sk.Public().(ed25519.PublicKey))
+	c.Sign(sk)
+	return c
+}
+
+// BalanceIntroPointsV3 merges introduction points of inner layers
+// of backends' descriptors into a single inner layer. Introduction
+// points are taken evenly from backends up to MaxIntroPointsV3 and
+// their certificates are reissued with descriptor signing key sk
+// of the master descriptor to expire at expiration.
+func BalanceIntroPointsV3(backends []*EncryptedLayerV3, sk ed25519.PrivateKey, expiration time.Time) (*EncryptedLayerV3, error) {
+	var sets [][]*IntroductionPointV3
+	var sizes []int
+	for i, backend := range backends {
+		ips, err := backend.IntroductionPoints()
+		if err != nil {
+			return nil, fmt.Errorf("Backend %d: %w", i, err)
+		}
+		sets = append(sets, ips)
+		sizes = append(sizes, len(ips))
+	}
+	var ips []*IntroductionPointV3
+	for _, pick := range roundRobin(sizes, MaxIntroPointsV3) {
+		ip := *sets[pick[0]][pick[1]]
+		if ip.AuthKeyCert == nil || ip.EncKeyCert == nil {
+			return nil, fmt.Errorf("Backend %d: missing introduction point certificates", pick[0])
+		}
+		ip.AuthKeyCert = recertify(ip.AuthKeyCert, sk, expiration)
+		ip.EncKeyCert = recertify(ip.EncKeyCert, sk, expiration)
+		ips = append(ips, &ip)
+	}
+	if len(ips) == 0 {
+		return nil, errors.New("Backends have no introduction points")
+	}
+	layer := &EncryptedLayerV3{Create2Formats: []int{Create2FormatNTor}}
+	if err := layer.SetIntroductionPoints(ips); err != nil {
+		return nil, err
+	}
+	return layer, nil
+}
+
+// BalanceDescriptorV3 returns signed master descriptor of onion
+// service with identity key esk for time period periodNum which
+// contains introduction points of decrypted inner layers of
+// backends' descriptors. A fresh descriptor signing key is used;
+// its certificate expires a time period after the end of periodNum.
+func BalanceDescriptorV3(rand io.Reader, esk *Ed25519ExpandedKey, backends []*EncryptedLayerV3, periodNum, revisionCounter uint64) (*OnionDescriptorV3, error) {
+	periodLength := uint64(TimePeriodLengthV3 / time.Minute)
+	blindedKey := BlindPrivateKey(*esk, periodNum, periodLength)
+	defer blindedKey.Zeroize()
+	signingPk, signingSk, err := ed25519.GenerateKey(rand)
+	if err != nil {
+		return nil, err
+	}
+	defer Zeroize(signingSk)
+	expiration := TimePeriodStart(periodNum + 2)
+	inner, err := BalanceIntroPointsV3(backends, signingSk, expiration)
+	if err != nil {
+		return nil, err
+	}
+	desc := &OnionDescriptorV3{
+		Version:         DescVersionV3,
+		Lifetime:        DescLifetimeV3,
+		RevisionCounter: revisionCounter,
+	}
+	desc.CertifySigningKey(&blindedKey, signingPk, expiration)
+	pk := esk.Public().(ed25519.PublicKey)
+	if err := desc.EncryptLayers(rand, pk, inner, nil); err != nil {
+		return nil, err
+	}
+	if err := desc.Sign(signingSk); err != nil {
+		return nil, err
+	}
+	return desc, nil
+}
@@ -0,0 +1,141 @@
+package onionutil
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"net"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+func TestRoundRobin(t *testing.T) {
+	picks := roundRobin([]int{3, 1, 2}, 5)
+	expected := [][2]int{{0, 0}, {1, 0}, {2, 0}, {0, 1}, {2, 1}}
+	if len(picks) != len(expected) {
+		t.Fatalf("wrong picks: %v", picks)
+	}
+	for i := range picks {
+		if picks[i] != expected[i] {
+			t.Fatalf("wrong picks: %v", picks)
+		}
+	}
+}
+
+func TestBalanceDescriptors(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC)
+	var backends []*OnionDescriptor
+	for i := 0; i < 2; i++ {
+		var ips []IntroductionPoint
+		for j := 0; j < 6; j++ {
+			ips = append(ips, IntroductionPoint{
+				Identity:        make([]byte, 10),
+				InternetAddress: net.IPv4(192, 0, 2, byte(10*i+j)),
+				OnionPort:       9001,
+				OnionKey:        &key.PublicKey,
+				ServiceKey:      &key.PublicKey,
+			})
+		}
+		descs, err := GenerateDescriptorSet(key, ips, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		backends = append(backends, descs[0])
+	}
+	master, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	descs, err := BalanceDescriptors(master, backends, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := descs[0].Verify(); err != nil {
+		t.Fatal(err)
+	}
+	ips, err := descs[0].IntroPoints()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ips) != MaxIntroPointsV2 || !ips[1].InternetAddress.Equal(net.IPv4(192, 0, 2, 10)) {
+		t.Fatalf("wrong introduction points: %v", ips)
+	}
+}
+
+func TestBalanceDescriptorV3(t *testing.T) {
+	backendPk, backendSk, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	relayKey, err := GenerateNTorKeypair(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var backends []*EncryptedLayerV3
+	for i := 0; i < 3; i++ {
+		var ips []*IntroductionPointV3
+		for j := 0; j < 8; j++ {
+			var authKey Ed25519Pubkey
+			rand.Read(authKey[:])
+			authKeyCert := NewCertificate(CertTypeHSIntroAuth, authKey, time.Now().Add(time.Hour), backendPk)
+			authKeyCert.Sign(backendSk)
+			encKeyCert := NewCertificate(CertTypeHSNTorEncCrosscert, authKey, time.Now().Add(time.Hour), backendPk)
+			encKeyCert.Sign(backendSk)
+			ips = append(ips, &IntroductionPointV3{
+				LinkSpecifiers: []LinkSpecifier{NewLinkSpecifierLegacyID(make([]byte, NTorIdentitySize))},
+				OnionKey:       relayKey.Public,
+				AuthKeyCert:    authKeyCert,
+				EncKey:         relayKey.Public,
+				EncKeyCert:     encKeyCert,
+			})
+		}
+		layer := new(EncryptedLayerV3)
+		if err := layer.SetIntroductionPoints(ips); err != nil {
+			t.Fatal(err)
+		}
+		backends = append(backends, layer)
+	}
+
+	_, sk, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	esk := ExpandEd25519Key(sk)
+	periodNum := GetTimePeriod(time.Now())
+	desc, err := BalanceDescriptorV3(rand.Reader, &esk, backends, periodNum, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blindedPk, err := BlindPublicKey(esk.Public().(ed25519.PublicKey), periodNum, uint64(TimePeriodLengthV3/time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := desc.VerifySignature(blindedPk, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	onionAddress, err := OnionAddressV3(esk.Public().(ed25519.PublicKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, inner, err := desc.DecryptLayers(onionAddress, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ips, err := inner.IntroductionPoints()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ips) != MaxIntroPointsV3 {
+		t.Fatalf("wrong number of introduction points: %d", len(ips))
+	}
+	for _, ip := range ips {
+		if err := ip.AuthKeyCert.Verify(desc.SigningKey()); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
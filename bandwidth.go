@@ -0,0 +1,40 @@
+// bandwidth.go - encode and format relay bandwidth
+//
+// To the extent possible under law, Ivan Markin waived all copyright
+// and related or neighboring rights to this module of onionutil, using the creative
+// commons "cc0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package onionutil
+
+import (
+	"fmt"
+)
+
+// String returns "bandwidth" line of router descriptors
+// without the trailing newline.
+func (bw Bandwidth) String() string {
+	return fmt.Sprintf("bandwidth %d %d %d", bw.Average, bw.Burst, bw.Observed)
+}
+
+// Bytes returns "bandwidth" line of router descriptors.
+func (bw Bandwidth) Bytes() []byte {
+	return []byte(bw.String() + "\n")
+}
+
+var bandwidthUnits = []string{"B/s", "KB/s", "MB/s", "GB/s"}
+
+// FormatBandwidth formats bandwidth of bytesPerSecond for display
+// like "1.5 MB/s". Units are powers of 1024 like in Tor.
+func FormatBandwidth(bytesPerSecond uint64) string {
+	if bytesPerSecond < 1024 {
+		return fmt.Sprintf("%d %s", bytesPerSecond, bandwidthUnits[0])
+	}
+	value := float64(bytesPerSecond)
+	unit := 0
+	for value >= 1024 && unit < len(bandwidthUnits)-1 {
+		value /= 1024
+		unit++
+	}
+	return fmt.Sprintf("%.1f %s", value, bandwidthUnits[unit])
+}
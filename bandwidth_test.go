@@ -0,0 +1,35 @@
+package onionutil
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestBandwidthBytes(t *testing.T) {
+	bw := Bandwidth{Average: 1073741824, Burst: 1073741824, Observed: 2469045}
+	line := bw.Bytes()
+	if string(line) != "bandwidth 1073741824 1073741824 2469045\n" {
+		t.Fatalf("wrong line: %q", line)
+	}
+	parsed, err := ParseBandwidthEntry(bytes.Fields(line)[1:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed != bw {
+		t.Fatalf("wrong parsed bandwidth: %+v", parsed)
+	}
+}
+
+func TestFormatBandwidth(t *testing.T) {
+	for bw, s := range map[uint64]string{
+		0:          "0 B/s",
+		1023:       "1023 B/s",
+		1536:       "1.5 KB/s",
+		2469045:    "2.4 MB/s",
+		1073741824: "1.0 GB/s",
+	} {
+		if FormatBandwidth(bw) != s {
+			t.Fatalf("%d formatted as %s", bw, FormatBandwidth(bw))
+		}
+	}
+}
@@ -0,0 +1,296 @@
+// binary.go - compact binary encoding of parsed Tor data
+//
+// To the extent possible under law, Ivan Markin waived all copyright
+// and related or neighboring rights to this module of onionutil, using the creative
+// commons "cc0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package onionutil
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/nogoegst/onionutil/pkcs1"
+)
+
+// binaryFormatVersion is the first byte of binary encodings.
+const binaryFormatVersion = 1
+
+var errBinaryTruncated = errors.New("Truncated binary encoding")
+
+type binaryWriter struct {
+	buf []byte
+}
+
+func newBinaryWriter() *binaryWriter {
+	return &binaryWriter{buf: []byte{binaryFormatVersion}}
+}
+
+func (w *binaryWriter) uvarint(v uint64) {
+	var b [binary.MaxVarintLen64]byte
+	w.buf = append(w.buf, b[:binary.PutUvarint(b[:], v)]...)
+}
+
+func (w *binaryWriter) varint(v int64) {
+	var b [binary.MaxVarintLen64]byte
+	w.buf = append(w.buf, b[:binary.PutVarint(b[:], v)]...)
+}
+
+func (w *binaryWriter) bytes(b []byte) {
+	w.uvarint(uint64(len(b)))
+	w.buf = append(w.buf, b...)
+}
+
+func (w *binaryWriter) string(s string) {
+	w.bytes([]byte(s))
+}
+
+func (w *binaryWriter) time(t time.Time) {
+	if t.IsZero() {
+		w.uvarint(0)
+		return
+	}
+	w.uvarint(1)
+	w.varint(t.Unix())
+}
+
+func (w *binaryWriter) ip(ip net.IP) {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	w.bytes(ip)
+}
+
+// binaryReader reads fields written by binaryWriter. After the
+// first error all reads return zero values and err is kept.
+type binaryReader struct {
+	buf []byte
+	err error
+}
+
+func newBinaryReader(data []byte) *binaryReader {
+	r := &binaryReader{buf: data}
+	if len(data) == 0 {
+		r.err = errBinaryTruncated
+	} else if data[0] != binaryFormatVersion {
+		r.err = errors.New("Unsupported binary encoding version")
+	} else {
+		r.buf = data[1:]
+	}
+	return r
+}
+
+func (r *binaryReader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(r.buf)
+	if n <= 0 {
+		r.err = errBinaryTruncated
+		return 0
+	}
+	r.buf = r.buf[n:]
+	return v
+}
+
+func (r *binaryReader) varint() int64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(r.buf)
+	if n <= 0 {
+		r.err = errBinaryTruncated
+		return 0
+	}
+	r.buf = r.buf[n:]
+	return v
+}
+
+func (r *binaryReader) bytes() []byte {
+	n := r.uvarint()
+	if r.err != nil {
+		return nil
+	}
+	if n > uint64(len(r.buf)) {
+		r.err = errBinaryTruncated
+		return nil
+	}
+	if n == 0 {
+		return nil
+	}
+	b := append([]byte(nil), r.buf[:n]...)
+	r.buf = r.buf[n:]
+	return b
+}
+
+func (r *binaryReader) string() string {
+	return string(r.bytes())
+}
+
+func (r *binaryReader) uint16() uint16 {
+	v := r.uvarint()
+	if v > 0xffff && r.err == nil {
+		r.err = errors.New("Value overflows uint16")
+	}
+	return uint16(v)
+}
+
+func (r *binaryReader) time() time.Time {
+	if r.uvarint() == 0 {
+		return time.Time{}
+	}
+	return time.Unix(r.varint(), 0).UTC()
+}
+
+func (r *binaryReader) ip() net.IP {
+	ip := r.bytes()
+	if len(ip) != 0 && len(ip) != net.IPv4len && len(ip) != net.IPv6len && r.err == nil {
+		r.err = errors.New("Malformed IP address")
+	}
+	return net.IP(ip)
+}
+
+func (r *binaryReader) finish() error {
+	if r.err == nil && len(r.buf) != 0 {
+		r.err = errors.New("Trailing data after binary encoding")
+	}
+	return r.err
+}
+
+func (rs *RouterStatus) MarshalBinary() ([]byte, error) {
+	w := newBinaryWriter()
+	w.string(rs.Nickname)
+	w.bytes(rs.Identity)
+	w.bytes(rs.Digest)
+	w.time(rs.Published)
+	w.ip(rs.Address)
+	w.uvarint(uint64(rs.ORPort))
+	w.uvarint(uint64(rs.DirPort))
+	w.uvarint(uint64(len(rs.ORAddrs)))
+	for _, addr := range rs.ORAddrs {
+		w.ip(addr.IP)
+		w.uvarint(uint64(addr.Port))
+	}
+	w.uvarint(uint64(rs.Flags))
+	w.string(rs.Version)
+	w.string(rs.Protocols.String())
+	w.uvarint(rs.Bandwidth)
+	if rs.PolicySummary != nil {
+		w.string(rs.PolicySummary.String())
+	} else {
+		w.string("")
+	}
+	w.bytes(rs.MicrodescDigest)
+	w.uvarint(rs.Measured)
+	if rs.Unmeasured {
+		w.uvarint(1)
+	} else {
+		w.uvarint(0)
+	}
+	return w.buf, nil
+}
+
+func (rs *RouterStatus) UnmarshalBinary(data []byte) error {
+	var s RouterStatus
+	r := newBinaryReader(data)
+	s.Nickname = r.string()
+	s.Identity = r.bytes()
+	s.Digest = r.bytes()
+	s.Published = r.time()
+	s.Address = r.ip()
+	s.ORPort = r.uint16()
+	s.DirPort = r.uint16()
+	n := r.uvarint()
+	if n > uint64(len(r.buf)) {
+		return errBinaryTruncated
+	}
+	for i := uint64(0); i < n; i++ {
+		ip := r.ip()
+		port := r.uint16()
+		s.ORAddrs = append(s.ORAddrs, net.TCPAddr{IP: ip, Port: int(port)})
+	}
+	s.Flags = Flags(r.uvarint())
+	s.Version = r.string()
+	if protocols := r.string(); protocols != "" && r.err == nil {
+		s.Protocols, r.err = ParseProtover(protocols)
+	}
+	s.Bandwidth = r.uvarint()
+	if summary := r.string(); summary != "" && r.err == nil {
+		s.PolicySummary, r.err = ParsePolicySummary(summary)
+	}
+	s.MicrodescDigest = r.bytes()
+	s.Measured = r.uvarint()
+	s.Unmeasured = r.uvarint() == 1
+	if err := r.finish(); err != nil {
+		return err
+	}
+	*rs = s
+	return nil
+}
+
+func (desc *OnionDescriptor) MarshalBinary() ([]byte, error) {
+	w := newBinaryWriter()
+	w.bytes(desc.DescID)
+	w.uvarint(uint64(desc.Version))
+	var pk []byte
+	if desc.PermanentKey != nil {
+		var err error
+		pk, err = pkcs1.EncodePublicKeyDER(desc.PermanentKey)
+		if err != nil {
+			return nil, err
+		}
+	}
+	w.bytes(pk)
+	w.bytes(desc.SecretIDPart)
+	w.time(desc.PublicationTime)
+	w.uvarint(uint64(len(desc.ProtocolVersions)))
+	for _, v := range desc.ProtocolVersions {
+		w.uvarint(uint64(v))
+	}
+	w.bytes(desc.IntropointsBlock)
+	w.bytes(desc.Signature)
+	w.uvarint(uint64(desc.Replica))
+	if desc.DescriptorCookie != nil {
+		w.bytes(desc.DescriptorCookie[:])
+	} else {
+		w.bytes(nil)
+	}
+	return w.buf, nil
+}
+
+func (desc *OnionDescriptor) UnmarshalBinary(data []byte) (err error) {
+	var d OnionDescriptor
+	r := newBinaryReader(data)
+	d.DescID = r.bytes()
+	d.Version = int(r.uvarint())
+	if pk := r.bytes(); len(pk) != 0 && r.err == nil {
+		d.PermanentKey, _, r.err = pkcs1.DecodePublicKeyDER(pk)
+	}
+	d.SecretIDPart = r.bytes()
+	d.PublicationTime = r.time()
+	n := r.uvarint()
+	if n > uint64(len(r.buf)) {
+		return errBinaryTruncated
+	}
+	for i := uint64(0); i < n; i++ {
+		d.ProtocolVersions = append(d.ProtocolVersions, int(r.uvarint()))
+	}
+	d.IntropointsBlock = r.bytes()
+	d.Signature = r.bytes()
+	d.Replica = int(r.uvarint())
+	if cookie := r.bytes(); len(cookie) != 0 {
+		if len(cookie) != DescriptorCookieSize {
+			return errors.New("Wrong descriptor cookie length")
+		}
+		d.DescriptorCookie = new(DescriptorCookie)
+		copy(d.DescriptorCookie[:], cookie)
+	}
+	if err := r.finish(); err != nil {
+		return err
+	}
+	*desc = d
+	return nil
+}
@@ -0,0 +1,56 @@
+// binary_test.go - tests for binary encoding
+//
+// To the extent possible under law, Ivan Markin waived all copyright
+// and related or neighboring rights to this module of onionutil, using the creative
+// commons "cc0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package onionutil
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/nogoegst/onionutil/testvectors"
+)
+
+func TestRouterStatusBinary(t *testing.T) {
+	c, err := ParseConsensus(testConsensus)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rs := range c.Routers {
+		data, err := rs.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var decoded RouterStatus
+		if err := decoded.UnmarshalBinary(data); err != nil {
+			t.Fatal(err)
+		}
+		encoded, _ := decoded.MarshalBinary()
+		if !bytes.Equal(encoded, data) || !decoded.Address.Equal(rs.Address) ||
+			decoded.Flags != rs.Flags || !decoded.Published.Equal(rs.Published) {
+			t.Fatalf("router status is changed:\n%+v\n%+v", decoded, rs)
+		}
+		if err := decoded.UnmarshalBinary(data[:len(data)-1]); err == nil {
+			t.Fatal("truncated encoding is accepted")
+		}
+	}
+}
+
+func TestOnionDescriptorBinary(t *testing.T) {
+	results, _ := ParseOnionDescriptors([]byte(testvectors.ServiceDescriptorV2.Data))
+	desc := results[0].Desc
+	data, err := desc.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded OnionDescriptor
+	if err := decoded.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decoded.Bytes(), desc.Bytes()) {
+		t.Fatal("descriptor is changed by binary round trip")
+	}
+}
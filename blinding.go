@@ -0,0 +1,194 @@
+// blinding.go - Ed25519 key blinding for v3 onion services
+//
+// To the extent possible under law, Ivan Markin waived all copyright
+// and related or neighboring rights to this module of onionutil, using the creative
+// commons "cc0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package onionutil
+
+import (
+	"crypto"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/nogoegst/onionutil/internal/edwards25519"
+	"github.com/nogoegst/onionutil/internal/ref10"
+	"golang.org/x/crypto/ed25519"
+	"golang.org/x/crypto/sha3"
+)
+
+// Key blinding constants (rend-spec-v3 A.2).
+var (
+	BlindString          = []byte("Derive temporary signing key\x00")
+	BlindPrefixString    = []byte("Derive temporary signing key hash input")
+	BlindNonceString     = []byte("key-blind")
+	Ed25519BasepointText = []byte("(15112221349535400772501151409588531511454012693041857206046113283949847762202, " +
+		"46316835694926478169428394003475163141307993866256225615783033603165251855960)")
+)
+
+const Ed25519ExpandedKeySize = 64
+
+// Ed25519ExpandedKey is an Ed25519 private key in the expanded
+// form: clamped secret scalar followed by the hash prefix.
+// This is the form of keys Tor stores on disk and the only
+// possible form of blinded private keys.
+type Ed25519ExpandedKey [Ed25519ExpandedKeySize]byte
+
+// ExpandEd25519Key expands seed-based private key sk.
+func ExpandEd25519Key(sk ed25519.PrivateKey) (esk Ed25519ExpandedKey) {
+	h := sha512.Sum512(sk[:ed25519.SeedSize])
+	h[0] &= 248
+	h[31] &= 127
+	h[31] |= 64
+	copy(esk[:], h[:])
+	return esk
+}
+
+// reducedScalar returns the secret scalar of esk reduced modulo
+// the group order as ref10.GeScalarMultBase requires.
+func (esk *Ed25519ExpandedKey) reducedScalar() (a [32]byte) {
+	var wide [64]byte
+	copy(wide[:], esk[:32])
+	ref10.ScReduce(&a, &wide)
+	Zeroize(wide[:])
+	return a
+}
+
+// scalarBaseMult returns encoding of a*B in constant time.
+func scalarBaseMult(a *[32]byte) []byte {
+	var A ref10.ExtendedGroupElement
+	var enc [32]byte
+	ref10.GeScalarMultBase(&A, a)
+	A.ToBytes(&enc)
+	return enc[:]
+}
+
+// Public returns ed25519.PublicKey corresponding to esk.
+func (esk *Ed25519ExpandedKey) Public() crypto.PublicKey {
+	a := esk.reducedScalar()
+	defer Zeroize(a[:])
+	return ed25519.PublicKey(scalarBaseMult(&a))
+}
+
+// Sign signs message with esk. opts.HashFunc() must be zero
+// since Ed25519 hashes messages itself.
+func (esk *Ed25519ExpandedKey) Sign(rand io.Reader, message []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if opts.HashFunc() != crypto.Hash(0) {
+		return nil, errors.New("ed25519: cannot sign hashed message")
+	}
+	return esk.sign(message), nil
+}
+
+func (esk *Ed25519ExpandedKey) sign(message []byte) []byte {
+	A := esk.Public().(ed25519.PublicKey)
+
+	var digest [64]byte
+	var r, k, a, S [32]byte
+	defer Zeroize(digest[:])
+	defer Zeroize(r[:])
+	defer Zeroize(a[:])
+	h := sha512.New()
+	h.Write(esk[32:])
+	h.Write(message)
+	h.Sum(digest[:0])
+	ref10.ScReduce(&r, &digest)
+	R := scalarBaseMult(&r)
+
+	h.Reset()
+	h.Write(R)
+	h.Write(A)
+	h.Write(message)
+	h.Sum(digest[:0])
+	ref10.ScReduce(&k, &digest)
+	copy(a[:], esk[:32])
+	ref10.ScMulAdd(&S, &k, &a, &r)
+
+	return append(R, S[:]...)
+}
+
+// BlindingFactor calculates clamped blinding factor h for
+// public key pk, number of time period periodNum which is
+// periodLength minutes long and optional secret.
+func BlindingFactor(pk ed25519.PublicKey, periodNum, periodLength uint64, secret []byte) []byte {
+	h := sha3.New256()
+	h.Write(BlindString)
+	h.Write(pk)
+	h.Write(secret)
+	h.Write(Ed25519BasepointText)
+	h.Write(BlindNonceString)
+	binary.Write(h, binary.BigEndian, periodNum)
+	binary.Write(h, binary.BigEndian, periodLength)
+	factor := h.Sum(nil)
+	clampBlindingFactor(factor)
+	return factor
+}
+
+func clampBlindingFactor(factor []byte) {
+	factor[0] &= 248
+	factor[31] &= 63
+	factor[31] |= 64
+}
+
+// BlindPublicKey calculates blinded public key for time period
+// periodNum which is periodLength minutes long.
+func BlindPublicKey(pk ed25519.PublicKey, periodNum, periodLength uint64) (ed25519.PublicKey, error) {
+	return blindPublicKey(pk, BlindingFactor(pk, periodNum, periodLength, nil))
+}
+
+// blindPublicKey blinds pk with blinding factor param clamped
+// the same way as by BlindingFactor. pk must be a valid key of
+// the prime-order subgroup. Everything here is public, so
+// variable time arithmetic is fine.
+func blindPublicKey(pk ed25519.PublicKey, param []byte) (ed25519.PublicKey, error) {
+	key, err := Ed25519PubkeyFromBytes(pk)
+	if err != nil {
+		return nil, err
+	}
+	if err := key.Validate(); err != nil {
+		return nil, err
+	}
+	A, err := new(edwards25519.Point).SetBytes(pk)
+	if err != nil {
+		return nil, err
+	}
+	factor := append([]byte{}, param...)
+	clampBlindingFactor(factor)
+	h := edwards25519.ScalarFromBytes(factor)
+	return ed25519.PublicKey(new(edwards25519.Point).ScalarMult(h, A).Bytes()), nil
+}
+
+// BlindPublicKeyAt calculates blinded public key for the default
+// length time period that t falls in.
+func BlindPublicKeyAt(pk ed25519.PublicKey, t time.Time) (ed25519.PublicKey, error) {
+	return BlindPublicKey(pk, TimePeriodNumV3(t), DefaultTimePeriodsV3.LengthMinutes())
+}
+
+// BlindPrivateKey calculates blinded private key for time period
+// periodNum which is periodLength minutes long.
+func BlindPrivateKey(esk Ed25519ExpandedKey, periodNum, periodLength uint64) Ed25519ExpandedKey {
+	pk := esk.Public().(ed25519.PublicKey)
+	return blindPrivateKey(esk, BlindingFactor(pk, periodNum, periodLength, nil))
+}
+
+// blindPrivateKey blinds esk with blinding factor param clamped
+// the same way as by BlindingFactor.
+func blindPrivateKey(esk Ed25519ExpandedKey, param []byte) (besk Ed25519ExpandedKey) {
+	var h, a, zero, blinded [32]byte
+	copy(h[:], param)
+	clampBlindingFactor(h[:])
+	copy(a[:], esk[:32])
+	ref10.ScMulAdd(&blinded, &h, &a, &zero)
+	copy(besk[:32], blinded[:])
+	Zeroize(a[:])
+	Zeroize(blinded[:])
+
+	prefix := sha512.New()
+	prefix.Write(BlindPrefixString)
+	prefix.Write(esk[32:])
+	copy(besk[32:], prefix.Sum(nil)[:32])
+	return besk
+}
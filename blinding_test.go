@@ -0,0 +1,167 @@
+package onionutil
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"testing"
+
+	"github.com/nogoegst/onionutil/internal/edwards25519"
+	"github.com/nogoegst/onionutil/testvectors"
+	"golang.org/x/crypto/ed25519"
+)
+
+func TestExpandedKeySign(t *testing.T) {
+	pk, sk, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	esk := ExpandEd25519Key(sk)
+	if !bytes.Equal(esk.Public().(ed25519.PublicKey), pk) {
+		t.Fatal("expanded key has a different public key")
+	}
+	msg := []byte("message")
+	sig, err := esk.Sign(rand.Reader, msg, crypto.Hash(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(sig, ed25519.Sign(sk, msg)) {
+		t.Fatal("signature differs from the one made by ed25519 package")
+	}
+}
+
+func TestBlinding(t *testing.T) {
+	pk, sk, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const periodNum, periodLength = 17000, 1440
+	blindedPk, err := BlindPublicKey(pk, periodNum, periodLength)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(blindedPk, pk) {
+		t.Fatal("blinded key is equal to the original one")
+	}
+	blindedSk := BlindPrivateKey(ExpandEd25519Key(sk), periodNum, periodLength)
+	if !bytes.Equal(blindedSk.Public().(ed25519.PublicKey), blindedPk) {
+		t.Fatal("blinded private key doesn't match blinded public key")
+	}
+	msg := []byte("descriptor")
+	sig, err := blindedSk.Sign(rand.Reader, msg, crypto.Hash(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ed25519.Verify(blindedPk, msg, sig) {
+		t.Fatal("signature made with blinded key is invalid")
+	}
+	other, err := BlindPublicKey(pk, periodNum+1, periodLength)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(other, blindedPk) {
+		t.Fatal("blinded keys of different periods are equal")
+	}
+}
+
+/* The first vector of src/test/ed25519_vectors.inc of tor */
+func TestBlindingVectors(t *testing.T) {
+	sk := ed25519.NewKeyFromSeed(mustDecodeHex(t, "26c76712d89d906e6672dafa614c42e5cb1caac8c6568e4d2493087db51f0d36"))
+	esk := ExpandEd25519Key(sk)
+	expandedHex := "c0a4de23cc64392d85aa1da82b3defddbea946d13bb053bf8489fa9296281f49" +
+		"5022f1f7ec0dcf52f07d4c7965c4eaed121d5d88d0a8ff546b06116a20e97755"
+	if !bytes.Equal(esk[:], mustDecodeHex(t, expandedHex)) {
+		t.Fatal("wrong expanded key")
+	}
+	pk := mustDecodeHex(t, "c2247870536a192d142d056abefca68d6193158e7c1a59c1654c954eccaff894")
+	if !bytes.Equal(esk.Public().(ed25519.PublicKey), pk) {
+		t.Fatal("wrong public key")
+	}
+	param := mustDecodeHex(t, "54a513898b471d1d448a2f3c55c1de2c0ef718c447b04497eeb999ed32027823")
+	blindedHex := "293c3acff4e902f6f63ddc5d5caa2a57e771db4f24de65d4c28df3232f47fa01" +
+		"171d43f24e3f53e70ec7ac280044ac77d4942dee5d6807118a59bdf3ee647e89"
+	besk := blindPrivateKey(esk, param)
+	if !bytes.Equal(besk[:], mustDecodeHex(t, blindedHex)) {
+		t.Fatalf("wrong blinded private key %x", besk[:])
+	}
+	blindedPk := mustDecodeHex(t, "1fc1fa4465bd9d4956fdbdc9d3acb3c7019bb8d5606b951c2e1dfe0b42eaeb41")
+	got, err := blindPublicKey(pk, param)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, blindedPk) {
+		t.Fatalf("wrong blinded public key %x", got)
+	}
+	if !bytes.Equal(besk.Public().(ed25519.PublicKey), blindedPk) {
+		t.Fatal("blinded private key doesn't match blinded public key")
+	}
+}
+
+/* test_blinding_basics of src/test/test_hs_common.c of tor */
+func TestBlindingTimePeriodVector(t *testing.T) {
+	var esk Ed25519ExpandedKey
+	copy(esk[:], mustDecodeHex(t, "D8C7FF0E31295B66540D789AF3E3DF992038A9592EEA01D8B7CBA06D6E66D159"+
+		"4D6167696320576F7264733A20737065697373636F62616C742062697669756D"))
+	pk := mustDecodeHex(t, "833990B085C1A688C1D4C8B1F6B56AFAF5A2ECA674449E1D704F83765CCB7BC6")
+	if !bytes.Equal(esk.Public().(ed25519.PublicKey), pk) {
+		t.Fatal("wrong public key")
+	}
+	blindedPk := mustDecodeHex(t, "3A50BF210E8F9EE955AE0014F7A6917FB65EBF098A86305ABB508D1A7291B6D5")
+	got, err := BlindPublicKey(pk, 1234, 1440)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, blindedPk) {
+		t.Fatalf("wrong blinded public key %x", got)
+	}
+	besk := BlindPrivateKey(esk, 1234, 1440)
+	if !bytes.Equal(besk.Public().(ed25519.PublicKey), blindedPk) {
+		t.Fatal("blinded private key doesn't match blinded public key")
+	}
+}
+
+/* TEST 1 of RFC 8032 section 7.1 */
+func TestExpandedKeySignVector(t *testing.T) {
+	sk := ed25519.NewKeyFromSeed(mustDecodeHex(t, "9d61b19deffd5a60ba844af492ec2cc44449c5697b326919703bac031cae7f60"))
+	esk := ExpandEd25519Key(sk)
+	sigHex := "e5564300c360ac729086e2cc806e828a84877f1eb8e5d974d873e06522490155" +
+		"5fb8821590a33bacc61e39701cf9b46bd25bf5f0595bbe24655141438e7a100b"
+	if !bytes.Equal(esk.sign(nil), mustDecodeHex(t, sigHex)) {
+		t.Fatal("wrong signature")
+	}
+}
+
+func TestBlindPublicKeyInvalid(t *testing.T) {
+	/* Point of order 8 */
+	torsion := mustDecodeHex(t, "26e8958fc2b227b045c3f489f2ef98f0d5dfac05d3c63339b13802886d53fc05")
+	T, err := new(edwards25519.Point).SetBytes(torsion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pk := mustDecodeHex(t, testvectors.Ed25519Vectors[0].PublicKey)
+	A, err := new(edwards25519.Point).SetBytes(pk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := BlindPublicKey(pk, 1, 1440); err != nil {
+		t.Fatal(err)
+	}
+	nonCanonical := append([]byte{0xee}, bytes.Repeat([]byte{0xff}, 30)...)
+	nonCanonical = append(nonCanonical, 0x7f)
+	for _, tt := range []struct {
+		pk  []byte
+		err error
+	}{
+		{new(edwards25519.Point).Add(A, T).Bytes(), ErrTorsionKey},
+		{torsion, ErrSmallOrderKey},
+		{make([]byte, 32), ErrZeroKey},
+		{nonCanonical, ErrNonCanonicalKey},
+	} {
+		if _, err := BlindPublicKey(tt.pk, 1, 1440); err != tt.err {
+			t.Fatalf("%x: expected %v, got %v", tt.pk, tt.err, err)
+		}
+	}
+	if _, err := BlindPublicKey(pk[:31], 1, 1440); err == nil {
+		t.Fatal("short key is blinded")
+	}
+}
@@ -0,0 +1,228 @@
+// bridge.go - bridge lines and pluggable transports
+//
+// To the extent possible under law, Ivan Markin waived all copyright
+// and related or neighboring rights to this module of onionutil, using the creative
+// commons "cc0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package onionutil
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// PTArg is an argument of a pluggable transport like "iat-mode=0".
+type PTArg struct {
+	Key   string
+	Value string
+}
+
+// PTArgs are arguments of a pluggable transport in their order.
+type PTArgs []PTArg
+
+// Get returns value of argument key.
+func (args PTArgs) Get(key string) (string, bool) {
+	for _, arg := range args {
+		if arg.Key == key {
+			return arg.Value, true
+		}
+	}
+	return "", false
+}
+
+func parsePTArg(s string) (PTArg, error) {
+	kv := strings.SplitN(s, "=", 2)
+	if len(kv) != 2 || kv[0] == "" {
+		return PTArg{}, fmt.Errorf("Malformed transport argument: %s", s)
+	}
+	return PTArg{Key: kv[0], Value: kv[1]}, nil
+}
+
+// isTransportName reports whether s is a valid transport name
+// (C identifier as in pt-spec).
+func isTransportName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, c := range s {
+		switch {
+		case c == '_', c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+		case c >= '0' && c <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// BridgeLine is a bridge configuration line like
+// "Bridge obfs4 192.0.2.1:443 <fingerprint> cert=... iat-mode=0".
+type BridgeLine struct {
+	// Transport is empty for vanilla bridges.
+	Transport string
+	Addr      *net.TCPAddr
+	// Fingerprint is nil if it's not given.
+	Fingerprint *Fingerprint
+	Args        PTArgs
+}
+
+// ParseBridgeLine parses a bridge line. "Bridge" keyword
+// is optional.
+func ParseBridgeLine(s string) (*BridgeLine, error) {
+	fields := strings.Fields(s)
+	if len(fields) > 0 && fields[0] == "Bridge" {
+		fields = fields[1:]
+	}
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("Empty bridge line")
+	}
+	bl := new(BridgeLine)
+	if !strings.ContainsAny(fields[0], ".:") {
+		if !isTransportName(fields[0]) {
+			return nil, fmt.Errorf("Malformed transport name: %s", fields[0])
+		}
+		bl.Transport = fields[0]
+		fields = fields[1:]
+	}
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("No bridge address")
+	}
+	addr, err := ParseORAddress(fields[0])
+	if err != nil {
+		return nil, err
+	}
+	bl.Addr = addr
+	fields = fields[1:]
+	if len(fields) > 0 && !strings.Contains(fields[0], "=") {
+		fp, err := ParseFingerprint(fields[0])
+		if err != nil {
+			return nil, err
+		}
+		bl.Fingerprint = &fp
+		fields = fields[1:]
+	}
+	for _, field := range fields {
+		arg, err := parsePTArg(field)
+		if err != nil {
+			return nil, err
+		}
+		bl.Args = append(bl.Args, arg)
+	}
+	if bl.Transport == "" && len(bl.Args) > 0 {
+		return nil, fmt.Errorf("Transport arguments of vanilla bridge")
+	}
+	return bl, nil
+}
+
+// String returns the bridge line without "Bridge" keyword
+// as in torrc and BridgeDB responses.
+func (bl *BridgeLine) String() string {
+	var fields []string
+	if bl.Transport != "" {
+		fields = append(fields, bl.Transport)
+	}
+	fields = append(fields, bl.Addr.String())
+	if bl.Fingerprint != nil {
+		fields = append(fields, bl.Fingerprint.String())
+	}
+	for _, arg := range bl.Args {
+		fields = append(fields, arg.Key+"="+arg.Value)
+	}
+	return strings.Join(fields, " ")
+}
+
+// Transport is a pluggable transport from "transport" line of bridge
+// extra-info descriptors like "transport obfs4 192.0.2.1:443 cert=...,iat-mode=0".
+type Transport struct {
+	Name string
+	Addr *net.TCPAddr
+	Args PTArgs
+}
+
+// splitEscaped splits s by sep which is not escaped with backslash.
+func splitEscaped(s string, sep byte) (parts []string) {
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case sep:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+func unescapePTArg(s string) string {
+	var b []byte
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+		}
+		b = append(b, s[i])
+	}
+	return string(b)
+}
+
+func escapePTArg(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `,`, `\,`, `=`, `\=`)
+	return r.Replace(s)
+}
+
+// ParseTransportLine parses arguments of "transport" line
+// (with or without the keyword).
+func ParseTransportLine(s string) (*Transport, error) {
+	fields := strings.Fields(s)
+	if len(fields) > 0 && fields[0] == "transport" {
+		fields = fields[1:]
+	}
+	if len(fields) != 2 && len(fields) != 3 {
+		return nil, fmt.Errorf("Malformed transport line: %s", s)
+	}
+	if !isTransportName(fields[0]) {
+		return nil, fmt.Errorf("Malformed transport name: %s", fields[0])
+	}
+	t := &Transport{Name: fields[0]}
+	addr, err := ParseORAddress(fields[1])
+	if err != nil {
+		return nil, err
+	}
+	t.Addr = addr
+	if len(fields) == 3 {
+		for _, field := range splitEscaped(fields[2], ',') {
+			kv := splitEscaped(field, '=')
+			if len(kv) != 2 || kv[0] == "" {
+				return nil, fmt.Errorf("Malformed transport argument: %s", field)
+			}
+			t.Args = append(t.Args, PTArg{Key: unescapePTArg(kv[0]), Value: unescapePTArg(kv[1])})
+		}
+	}
+	return t, nil
+}
+
+// Bytes returns "transport" line of the transport.
+func (t *Transport) Bytes() []byte {
+	line := "transport " + t.Name + " " + t.Addr.String()
+	var args []string
+	for _, arg := range t.Args {
+		args = append(args, escapePTArg(arg.Key)+"="+escapePTArg(arg.Value))
+	}
+	if len(args) > 0 {
+		line += " " + strings.Join(args, ",")
+	}
+	return []byte(line + "\n")
+}
+
+// BridgeLine returns bridge line to connect to bridge
+// with fingerprint fp using the transport.
+func (t *Transport) BridgeLine(fp Fingerprint) *BridgeLine {
+	return &BridgeLine{
+		Transport:   t.Name,
+		Addr:        t.Addr,
+		Fingerprint: &fp,
+		Args:        append(PTArgs(nil), t.Args...),
+	}
+}
@@ -0,0 +1,54 @@
+package onionutil
+
+import (
+	"testing"
+)
+
+func TestParseBridgeLine(t *testing.T) {
+	line := "obfs4 192.0.2.1:443 4352E58420E68F5E40BF7C74FADDCCD9D1349413 cert=ssH+9rP8dG2NLDN2XuFw63hIO/9MNNinLmxQDpVa+7kTOa9/m+tGWT1SmSYpQ9uTBGa6Hw iat-mode=0"
+	bl, err := ParseBridgeLine("Bridge " + line)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bl.Transport != "obfs4" || bl.Addr.Port != 443 || bl.Fingerprint == nil {
+		t.Fatalf("wrong bridge line: %+v", bl)
+	}
+	if mode, ok := bl.Args.Get("iat-mode"); !ok || mode != "0" {
+		t.Fatalf("wrong iat-mode: %q", mode)
+	}
+	if bl.String() != line {
+		t.Fatalf("wrong encoding: %s", bl)
+	}
+
+	bl, err = ParseBridgeLine("[2001:db8::1]:9001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bl.Transport != "" || bl.Fingerprint != nil || bl.String() != "[2001:db8::1]:9001" {
+		t.Fatalf("wrong bridge line: %+v", bl)
+	}
+	for _, line := range []string{"", "obfs4", "192.0.2.1:443 iat-mode=0", "obfs-4 192.0.2.1:443"} {
+		if _, err := ParseBridgeLine(line); err == nil {
+			t.Fatalf("malformed bridge line %q is accepted", line)
+		}
+	}
+}
+
+func TestParseTransportLine(t *testing.T) {
+	line := "transport obfs4 192.0.2.1:443 cert=a\\,b\\=c,iat-mode=0\n"
+	tr, err := ParseTransportLine(line)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert, _ := tr.Args.Get("cert"); tr.Name != "obfs4" || cert != "a,b=c" {
+		t.Fatalf("wrong transport: %+v", tr)
+	}
+	if string(tr.Bytes()) != line {
+		t.Fatalf("wrong encoding: %s", tr.Bytes())
+	}
+	var fp Fingerprint
+	bl := tr.BridgeLine(fp)
+	if bl.String() != "obfs4 192.0.2.1:443 "+fp.String()+" cert=a,b=c iat-mode=0" {
+		t.Fatalf("wrong bridge line: %s", bl)
+	}
+}
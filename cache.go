@@ -0,0 +1,259 @@
+// cache.go - onion service descriptor cache
+//
+// To the extent possible under law, Ivan Markin waived all copyright
+// and related or neighboring rights to this module of onionutil, using the creative
+// commons "cc0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package onionutil
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nogoegst/onionutil/torparse"
+)
+
+var ErrDescriptorNotNewer = errors.New("descriptor is not newer than the cached one")
+
+// Annotations of descriptors in cache files.
+const (
+	cacheTypeV2 = "hidden-service-descriptor 1.0"
+	cacheTypeV3 = "hidden-service-descriptor-3 1.0"
+)
+
+// cacheFileAD is associated data of encrypted cache files.
+const cacheFileAD = "onionutil descriptor cache"
+
+// DescriptorCache is an in-memory DescriptorStore which follows
+// replacement rules of rend-spec: a v2 descriptor replaces the
+// cached one only if it is published later, a v3 descriptor - only
+// if its revision counter is greater. Expired descriptors are
+// neither returned nor accepted.
+type DescriptorCache struct {
+	mu    sync.Mutex
+	descs map[string]*StoredDescriptor
+}
+
+func NewDescriptorCache() *DescriptorCache {
+	return &DescriptorCache{descs: make(map[string]*StoredDescriptor)}
+}
+
+func (c *DescriptorCache) Get(id string) (*StoredDescriptor, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	sd, ok := c.descs[id]
+	if !ok {
+		return nil, ErrDescriptorNotFound
+	}
+	if time.Now().After(sd.Expires) {
+		delete(c.descs, id)
+		return nil, ErrDescriptorNotFound
+	}
+	return sd, nil
+}
+
+func (c *DescriptorCache) Put(sd *StoredDescriptor) error {
+	if time.Now().After(sd.Expires) {
+		return errors.New("Descriptor has expired")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if old, ok := c.descs[sd.ID]; ok && !time.Now().After(old.Expires) {
+		if err := checkReplacement(old, sd); err != nil {
+			return err
+		}
+	}
+	c.descs[sd.ID] = sd
+	return nil
+}
+
+// checkReplacement returns ErrDescriptorNotNewer if sd must not
+// replace unexpired descriptor old with the same ID.
+func checkReplacement(old, sd *StoredDescriptor) error {
+	switch sd.Version {
+	case 2:
+		if !sd.Published.After(old.Published) {
+			return ErrDescriptorNotNewer
+		}
+	case 3:
+		if sd.RevisionCounter <= old.RevisionCounter {
+			return ErrDescriptorNotNewer
+		}
+	}
+	return nil
+}
+
+// AddV2 verifies v2 descriptor raw and puts it into the cache.
+// It expires DescriptorMaxAgeV2 after its publication.
+func (c *DescriptorCache) AddV2(raw []byte) error {
+	results, _ := ParseOnionDescriptors(raw)
+	if len(results) != 1 {
+		return errors.New("Expected exactly one descriptor")
+	}
+	if results[0].Err != nil {
+		return results[0].Err
+	}
+	desc := results[0].Desc
+	if err := desc.VerifySignature(); err != nil {
+		return err
+	}
+	return c.Put(&StoredDescriptor{
+		ID:        Base32Encode(desc.DescID),
+		Version:   2,
+		Published: desc.PublicationTime,
+		Expires:   desc.PublicationTime.Add(DescriptorMaxAgeV2),
+		Raw:       raw,
+	})
+}
+
+// AddV3 verifies v3 descriptor raw and puts it into the cache.
+// It expires after its lifetime since now.
+func (c *DescriptorCache) AddV3(raw []byte) error {
+	return c.addV3(raw, time.Time{})
+}
+
+func (c *DescriptorCache) addV3(raw []byte, expires time.Time) error {
+	desc, err := ParseOnionDescriptorV3(raw)
+	if err != nil {
+		return err
+	}
+	/* Descriptors are stored under the key they are signed with */
+	if err := desc.VerifySignature(desc.BlindedKey(), time.Now()); err != nil {
+		return err
+	}
+	if expires.IsZero() {
+		expires = time.Now().Add(desc.Lifetime)
+	}
+	return c.Put(&StoredDescriptor{
+		ID:              base64.StdEncoding.EncodeToString(desc.BlindedKey()),
+		Version:         3,
+		Expires:         expires,
+		Raw:             raw,
+		RevisionCounter: desc.RevisionCounter,
+	})
+}
+
+// Len returns number of descriptors in the cache including
+// expired ones.
+func (c *DescriptorCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.descs)
+}
+
+// Expire removes all expired descriptors from the cache.
+func (c *DescriptorCache) Expire(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for id, sd := range c.descs {
+		if now.After(sd.Expires) {
+			delete(c.descs, id)
+		}
+	}
+}
+
+// Bytes returns unexpired descriptors of the cache concatenated
+// like in Tor cache files. Each descriptor is preceded by "@type"
+// and "@expires" annotations.
+func (c *DescriptorCache) Bytes() []byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	var ids []string
+	for id, sd := range c.descs {
+		if !now.After(sd.Expires) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	b := new(bytes.Buffer)
+	for _, id := range ids {
+		sd := c.descs[id]
+		typ := cacheTypeV2
+		if sd.Version == 3 {
+			typ = cacheTypeV3
+		}
+		fmt.Fprintf(b, "@type %s\n", typ)
+		fmt.Fprintf(b, "@expires %s\n", sd.Expires.UTC().Format(PublicationTimeFormat))
+		b.Write(sd.Raw)
+	}
+	return b.Bytes()
+}
+
+// Save writes the cache to file filename.
+func (c *DescriptorCache) Save(filename string) error {
+	return ioutil.WriteFile(filename, c.Bytes(), 0600)
+}
+
+// SaveEncrypted writes the cache to file filename encrypted
+// with AES-256-GCM under 32-byte key.
+func (c *DescriptorCache) SaveEncrypted(filename string, key []byte) error {
+	aead, err := newStoreAEAD(key)
+	if err != nil {
+		return err
+	}
+	data, err := sealBlob(aead, c.Bytes(), []byte(cacheFileAD))
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, data, 0600)
+}
+
+// Load adds descriptors from file filename written by Save.
+// Expired and malformed descriptors are skipped.
+func (c *DescriptorCache) Load(filename string) error {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	return c.load(data)
+}
+
+// LoadEncrypted adds descriptors from file filename written
+// by SaveEncrypted with the same key.
+func (c *DescriptorCache) LoadEncrypted(filename string, key []byte) error {
+	aead, err := newStoreAEAD(key)
+	if err != nil {
+		return err
+	}
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	data, err = openBlob(aead, data, []byte(cacheFileAD))
+	if err != nil {
+		return err
+	}
+	return c.load(data)
+}
+
+func (c *DescriptorCache) load(data []byte) error {
+	docs, _ := torparse.ParseTorDocument(data)
+	for _, doc := range docs {
+		if len(doc.Items) < 3 || doc.Items[0].Keyword != "@type" ||
+			doc.Items[1].Keyword != "@expires" {
+			return errors.New("Malformed descriptor cache")
+		}
+		expires, err := parseDocumentTime(doc.Items[1].Content)
+		if err != nil {
+			return err
+		}
+		raw := doc.Raw[doc.Items[2].Offset:]
+		switch string(doc.Items[0].Content.Joined()) {
+		case cacheTypeV2:
+			c.AddV2(raw)
+		case cacheTypeV3:
+			c.addV3(raw, expires)
+		default:
+			return errors.New("Unknown descriptor type in cache")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+// cache_test.go - tests for onion service descriptor cache
+//
+// To the extent possible under law, Ivan Markin waived all copyright
+// and related or neighboring rights to this module of onionutil, using the creative
+// commons "cc0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package onionutil
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+func TestDescriptorCache(t *testing.T) {
+	sk, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	descs, err := GenerateDescriptorSet(sk, nil, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, identitySk, _ := ed25519.GenerateKey(rand.Reader)
+	blindedKey := BlindPrivateKey(ExpandEd25519Key(identitySk), 1, 1440)
+	signingPk, signingSk, _ := ed25519.GenerateKey(rand.Reader)
+	descV3 := func(revision uint64) []byte {
+		desc := &OnionDescriptorV3{
+			Version:         DescVersionV3,
+			Lifetime:        DescLifetimeV3,
+			RevisionCounter: revision,
+			Superencrypted:  []byte("superencrypted"),
+		}
+		desc.CertifySigningKey(&blindedKey, signingPk, time.Now().Add(time.Hour))
+		if err := desc.Sign(signingSk); err != nil {
+			t.Fatal(err)
+		}
+		return desc.Bytes()
+	}
+
+	c := NewDescriptorCache()
+	for _, desc := range descs {
+		if err := c.AddV2(desc.Bytes()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.AddV2(descs[0].Bytes()); err != ErrDescriptorNotNewer {
+		t.Fatalf("same v2 descriptor is not rejected: %v", err)
+	}
+	if err := c.AddV3(descV3(2)); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.AddV3(descV3(1)); err != ErrDescriptorNotNewer {
+		t.Fatalf("older v3 descriptor is not rejected: %v", err)
+	}
+	if err := c.AddV3(descV3(3)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Get(Base32Encode(descs[1].DescID)); err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "onionutil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "cache")
+	if err := c.Save(filename); err != nil {
+		t.Fatal(err)
+	}
+	loaded := NewDescriptorCache()
+	if err := loaded.Load(filename); err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Len() != len(descs)+1 {
+		t.Fatalf("wrong number of loaded descriptors: %d", loaded.Len())
+	}
+	sd, err := loaded.Get(base64.StdEncoding.EncodeToString(blindedKey.Public().(ed25519.PublicKey)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sd.RevisionCounter != 3 {
+		t.Fatalf("wrong revision counter: %d", sd.RevisionCounter)
+	}
+
+	key := newTestStoreKey(t)
+	encFilename := filepath.Join(dir, "cache.enc")
+	if err := c.SaveEncrypted(encFilename, key); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(encFilename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte(cacheTypeV2)) || bytes.Contains(data, descs[0].Bytes()[:40]) {
+		t.Fatal("encrypted cache contains plaintext")
+	}
+	if err := NewDescriptorCache().LoadEncrypted(encFilename, newTestStoreKey(t)); err == nil {
+		t.Fatal("cache is loaded with wrong key")
+	}
+	loaded = NewDescriptorCache()
+	if err := loaded.LoadEncrypted(encFilename, key); err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Len() != len(descs)+1 {
+		t.Fatalf("wrong number of loaded descriptors: %d", loaded.Len())
+	}
+}
@@ -0,0 +1,61 @@
+// cert.go - Ed25519 certificates
+//
+// To the extent possible under law, Ivan Markin waived all copyright
+// and related or neighboring rights to this module of onionutil, using the creative
+// commons "cc0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package onionutil
+
+import (
+	"time"
+
+	"github.com/nogoegst/onionutil/torcert"
+	"golang.org/x/crypto/ed25519"
+)
+
+/* Certificates live in torcert, these are kept for compatibility */
+
+type (
+	Certificate = torcert.Certificate
+	ExtType     = torcert.ExtType
+	Extension   = torcert.Extension
+)
+
+const (
+	ExtSignedWithEd25519Key  = torcert.ExtSignedWithEd25519Key
+	ExtFlagAffectsValidation = torcert.ExtFlagAffectsValidation
+	CertVersion              = torcert.CertVersion
+	CertKeyTypeEd25519       = torcert.CertKeyTypeEd25519
+)
+
+// Certificate types (cert-spec A.1).
+const (
+	CertTypeIdentitySigning    = torcert.CertTypeIdentitySigning
+	CertTypeSigningLink        = torcert.CertTypeSigningLink
+	CertTypeSigningAuth        = torcert.CertTypeSigningAuth
+	CertTypeHSDescSigning      = torcert.CertTypeHSDescSigning
+	CertTypeHSIntroAuth        = torcert.CertTypeHSIntroAuth
+	CertTypeNTorOnionCrosscert = torcert.CertTypeNTorOnionCrosscert
+	CertTypeHSNTorEncCrosscert = torcert.CertTypeHSNTorEncCrosscert
+)
+
+// ParseCertFromBytes parses certificate binCert ignoring any data
+// after the signature. It returns ErrTruncated if binCert is too short.
+func ParseCertFromBytes(binCert []byte) (Certificate, error) {
+	return torcert.Parse(binCert)
+}
+
+// ParseCertFromBytesStrict is like ParseCertFromBytes but returns
+// ErrTrailingData if there is data after the signature.
+func ParseCertFromBytesStrict(binCert []byte) (Certificate, error) {
+	return torcert.ParseStrict(binCert)
+}
+
+// NewCertificate returns unsigned certificate of type certType
+// for key certified that expires at expiration. If signingKey
+// is not nil it's included into the certificate as
+// signed-with-ed25519-key extension.
+func NewCertificate(certType byte, certified Ed25519Pubkey, expiration time.Time, signingKey ed25519.PublicKey) *Certificate {
+	return torcert.New(certType, certified, expiration, signingKey)
+}
@@ -0,0 +1,69 @@
+package onionutil
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+func TestCertificateRoundTrip(t *testing.T) {
+	identityPk, identitySk, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signingPk, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var certified Ed25519Pubkey
+	copy(certified[:], signingPk)
+	expiration := time.Unix(time.Now().Unix()/3600*3600, 0).Add(30 * 24 * time.Hour)
+	cert := NewCertificate(CertTypeIdentitySigning, certified, expiration, identityPk)
+	cert.Sign(identitySk)
+
+	parsed, err := ParseCertFromBytes(cert.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(parsed.Bytes(), cert.Bytes()) {
+		t.Fatal("re-encoded certificate differs from the original")
+	}
+	if !parsed.ExpirationDate.Equal(expiration) {
+		t.Fatalf("expiration date mismatch: %v != %v", parsed.ExpirationDate, expiration)
+	}
+	ext, ok := parsed.Extensions[ExtSignedWithEd25519Key]
+	if !ok || !bytes.Equal(ext.Data, identityPk) {
+		t.Fatal("signed-with-ed25519-key extension is lost")
+	}
+	if err := parsed.Verify(nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := parsed.Verify(signingPk); err == nil {
+		t.Fatal("certificate is verified with a wrong key")
+	}
+	parsed.Signature[0] ^= 0xff
+	if err := parsed.Verify(identityPk); err == nil {
+		t.Fatal("broken signature is valid")
+	}
+}
+
+func TestParseCertTruncated(t *testing.T) {
+	pk, sk, _ := ed25519.GenerateKey(rand.Reader)
+	cert := NewCertificate(CertTypeIdentitySigning, Ed25519Pubkey{}, time.Now(), pk)
+	cert.Sign(sk)
+	data := cert.Bytes()
+	for i := 0; i < len(data); i++ {
+		if _, err := ParseCertFromBytes(data[:i]); err != ErrTruncated {
+			t.Fatalf("truncated certificate (%d bytes) is parsed: %v", i, err)
+		}
+	}
+	if _, err := ParseCertFromBytes(append(data, 0)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseCertFromBytesStrict(append(data, 0)); err != ErrTrailingData {
+		t.Fatalf("trailing data is accepted: %v", err)
+	}
+}
@@ -0,0 +1,194 @@
+// clientauth.go - client authorization for v2 onion services
+//
+// To the extent possible under law, Ivan Markin waived all copyright
+// and related or neighboring rights to this module of onionutil, using the creative
+// commons "cc0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package onionutil
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rsa"
+	"crypto/sha1"
+	"errors"
+	"io"
+	"sort"
+)
+
+const (
+	DescriptorCookieSize = 16
+	// ClientAuthBasic and ClientAuthStealth are types of encryption
+	// of introduction points (rend-spec 2.1).
+	ClientAuthBasic   = 1
+	ClientAuthStealth = 2
+
+	basicAuthClientsPerBlock = 16
+	basicAuthClientIDSize    = 4
+	basicAuthEntrySize       = basicAuthClientIDSize + aes.BlockSize
+)
+
+// DescriptorCookie is a secret shared between an onion service
+// and its authorized clients.
+type DescriptorCookie [DescriptorCookieSize]byte
+
+func GenerateDescriptorCookie(rand io.Reader) (cookie DescriptorCookie, err error) {
+	_, err = io.ReadFull(rand, cookie[:])
+	return cookie, err
+}
+
+// ClientAuthV2 is a credential of a single authorized client.
+type ClientAuthV2 struct {
+	Name   string
+	Cookie DescriptorCookie
+	// Key is the client-specific permanent key of the service
+	// which is used with stealth authorization only.
+	Key *rsa.PrivateKey
+}
+
+// GenerateClientAuthV2 generates credential for client name. If stealth
+// is true the client-specific service key is generated too.
+func GenerateClientAuthV2(rand io.Reader, name string, stealth bool) (*ClientAuthV2, error) {
+	cookie, err := GenerateDescriptorCookie(rand)
+	if err != nil {
+		return nil, err
+	}
+	client := &ClientAuthV2{Name: name, Cookie: cookie}
+	if stealth {
+		client.Key, err = rsa.GenerateKey(rand, 1024)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return client, nil
+}
+
+func aesCTR(key, iv, data []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, len(data))
+	cipher.NewCTR(block, iv).XORKeyStream(out, data)
+	return out, nil
+}
+
+func basicAuthClientID(cookie DescriptorCookie, iv []byte) []byte {
+	h := sha1.New()
+	h.Write(cookie[:])
+	h.Write(iv)
+	return h.Sum(nil)[:basicAuthClientIDSize]
+}
+
+// EncryptIntroPointsBasic encrypts introduction points block ips
+// for clients with cookies using basic authorization.
+func EncryptIntroPointsBasic(rand io.Reader, ips []byte, cookies []DescriptorCookie) ([]byte, error) {
+	if len(cookies) == 0 {
+		return nil, errors.New("No clients to encrypt introduction points for")
+	}
+	nBlocks := 1 + (len(cookies)-1)/basicAuthClientsPerBlock
+	if nBlocks > 255 {
+		return nil, errors.New("Too many clients")
+	}
+	sessionKey := make([]byte, aes.BlockSize)
+	iv := make([]byte, aes.BlockSize)
+	defer Zeroize(sessionKey)
+	if _, err := io.ReadFull(rand, sessionKey); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(rand, iv); err != nil {
+		return nil, err
+	}
+	zeroIV := make([]byte, aes.BlockSize)
+	var entries [][]byte
+	for _, cookie := range cookies {
+		encKey, err := aesCTR(cookie[:], zeroIV, sessionKey)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, append(basicAuthClientID(cookie, iv), encKey...))
+	}
+	/* Pad with fake clients to hide the number of clients */
+	for len(entries) < nBlocks*basicAuthClientsPerBlock {
+		fake := make([]byte, basicAuthEntrySize)
+		if _, err := io.ReadFull(rand, fake); err != nil {
+			return nil, err
+		}
+		entries = append(entries, fake)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return bytes.Compare(entries[i], entries[j]) < 0
+	})
+	encIPs, err := aesCTR(sessionKey, iv, ips)
+	if err != nil {
+		return nil, err
+	}
+	w := new(bytes.Buffer)
+	w.WriteByte(ClientAuthBasic)
+	w.WriteByte(byte(nBlocks))
+	for _, entry := range entries {
+		w.Write(entry)
+	}
+	w.Write(iv)
+	w.Write(encIPs)
+	return w.Bytes(), nil
+}
+
+// EncryptIntroPointsStealth encrypts introduction points block ips
+// for a client with cookie using stealth authorization.
+func EncryptIntroPointsStealth(rand io.Reader, ips []byte, cookie DescriptorCookie) ([]byte, error) {
+	iv := make([]byte, aes.BlockSize)
+	if _, err := io.ReadFull(rand, iv); err != nil {
+		return nil, err
+	}
+	encIPs, err := aesCTR(cookie[:], iv, ips)
+	if err != nil {
+		return nil, err
+	}
+	enc := append([]byte{ClientAuthStealth}, iv...)
+	return append(enc, encIPs...), nil
+}
+
+// DecryptIntroPoints decrypts introduction points block encrypted
+// with either basic or stealth authorization using cookie.
+func DecryptIntroPoints(enc []byte, cookie DescriptorCookie) ([]byte, error) {
+	if len(enc) < 1 {
+		return nil, errors.New("Empty introduction points block")
+	}
+	switch enc[0] {
+	case ClientAuthBasic:
+		if len(enc) < 2 {
+			return nil, errors.New("Truncated introduction points block")
+		}
+		entriesLen := int(enc[1]) * basicAuthClientsPerBlock * basicAuthEntrySize
+		if len(enc) < 2+entriesLen+aes.BlockSize {
+			return nil, errors.New("Truncated introduction points block")
+		}
+		entries := enc[2 : 2+entriesLen]
+		iv := enc[2+entriesLen : 2+entriesLen+aes.BlockSize]
+		clientID := basicAuthClientID(cookie, iv)
+		for i := 0; i < len(entries); i += basicAuthEntrySize {
+			entry := entries[i : i+basicAuthEntrySize]
+			if !ConstantTimeEqual(entry[:basicAuthClientIDSize], clientID) {
+				continue
+			}
+			sessionKey, err := aesCTR(cookie[:], make([]byte, aes.BlockSize),
+				entry[basicAuthClientIDSize:])
+			if err != nil {
+				return nil, err
+			}
+			defer Zeroize(sessionKey)
+			return aesCTR(sessionKey, iv, enc[2+entriesLen+aes.BlockSize:])
+		}
+		return nil, errors.New("Client is not authorized")
+	case ClientAuthStealth:
+		if len(enc) < 1+aes.BlockSize {
+			return nil, errors.New("Truncated introduction points block")
+		}
+		return aesCTR(cookie[:], enc[1:1+aes.BlockSize], enc[1+aes.BlockSize:])
+	default:
+		return nil, errors.New("Unknown authorization type")
+	}
+}
@@ -0,0 +1,51 @@
+package onionutil
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+)
+
+func TestIntroPointsEncryption(t *testing.T) {
+	ips := []byte("introduction-point aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa\n")
+	var cookies []DescriptorCookie
+	for i := 0; i < 17; i++ {
+		cookie, err := GenerateDescriptorCookie(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cookies = append(cookies, cookie)
+	}
+	enc, err := EncryptIntroPointsBasic(rand.Reader, ips, cookies)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if enc[1] != 2 {
+		t.Fatalf("expected 2 client blocks, got %d", enc[1])
+	}
+	for _, cookie := range cookies {
+		dec, err := DecryptIntroPoints(enc, cookie)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(dec, ips) {
+			t.Fatal("decrypted introduction points differ")
+		}
+	}
+	stranger, _ := GenerateDescriptorCookie(rand.Reader)
+	if _, err := DecryptIntroPoints(enc, stranger); err == nil {
+		t.Fatal("unauthorized client decrypted introduction points")
+	}
+
+	enc, err = EncryptIntroPointsStealth(rand.Reader, ips, cookies[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	dec, err := DecryptIntroPoints(enc, cookies[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(dec, ips) {
+		t.Fatal("decrypted introduction points differ")
+	}
+}
@@ -0,0 +1,119 @@
+// clientauthv3.go - client authorization for v3 onion services
+//
+// To the extent possible under law, Ivan Markin waived all copyright
+// and related or neighboring rights to this module of onionutil, using the creative
+// commons "cc0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package onionutil
+
+import (
+	"encoding/base32"
+	"errors"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/curve25519"
+)
+
+// Files of v3 client authorization: authorized_clients/*.auth on the
+// service side and *.auth_private in ClientOnionAuthDir.
+const (
+	ClientAuthFileSuffixV3        = ".auth"
+	ClientAuthPrivateFileSuffixV3 = ".auth_private"
+)
+
+var clientAuthBase32 = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// ClientAuthKeyV3 is an x25519 keypair of a client authorized
+// to access a v3 onion service.
+type ClientAuthKeyV3 struct {
+	Private [32]byte
+	Public  Curve25519Pubkey
+}
+
+// NewClientAuthKeyV3 creates a keypair from private key sk.
+func NewClientAuthKeyV3(sk [32]byte) *ClientAuthKeyV3 {
+	key := &ClientAuthKeyV3{Private: sk}
+	curve25519.ScalarBaseMult((*[32]byte)(&key.Public), &key.Private)
+	return key
+}
+
+func GenerateClientAuthKeyV3(rand io.Reader) (*ClientAuthKeyV3, error) {
+	var sk [32]byte
+	if _, err := io.ReadFull(rand, sk[:]); err != nil {
+		return nil, err
+	}
+	sk[0] &= 248
+	sk[31] &= 127
+	sk[31] |= 64
+	return NewClientAuthKeyV3(sk), nil
+}
+
+func decodeClientAuthKey(data string) (key [32]byte, err error) {
+	b, err := clientAuthBase32.DecodeString(strings.ToUpper(data))
+	if err != nil {
+		return key, err
+	}
+	if len(b) != len(key) {
+		return key, errors.New("Wrong length of client authorization key")
+	}
+	copy(key[:], b)
+	return key, nil
+}
+
+// splitClientAuth splits "descriptor:x25519:<key>" into the key.
+func splitClientAuth(line string) (string, error) {
+	fields := strings.Split(strings.TrimSpace(line), ":")
+	if len(fields) != 3 || fields[0] != "descriptor" {
+		return "", errors.New("Malformed client authorization line")
+	}
+	if fields[1] != AuthTypeX25519 {
+		return "", errors.New("Unsupported client authorization type")
+	}
+	return fields[2], nil
+}
+
+// EncodeAuthorizedClientV3 returns the content of service side
+// authorized_clients file for client with public key pk.
+func EncodeAuthorizedClientV3(pk Curve25519Pubkey) string {
+	return "descriptor:" + AuthTypeX25519 + ":" +
+		clientAuthBase32.EncodeToString(pk[:]) + "\n"
+}
+
+func ParseAuthorizedClientV3(data []byte) (pk Curve25519Pubkey, err error) {
+	encodedKey, err := splitClientAuth(string(data))
+	if err != nil {
+		return pk, err
+	}
+	key, err := decodeClientAuthKey(encodedKey)
+	return Curve25519Pubkey(key), err
+}
+
+// EncodeClientAuthPrivateV3 returns the content of client side
+// auth_private file for onion service onionAddress.
+func EncodeClientAuthPrivateV3(onionAddress string, key *ClientAuthKeyV3) string {
+	onionAddress = strings.TrimSuffix(onionAddress, ".onion")
+	return onionAddress + ":descriptor:" + AuthTypeX25519 + ":" +
+		clientAuthBase32.EncodeToString(key.Private[:]) + "\n"
+}
+
+func ParseClientAuthPrivateV3(data []byte) (onionAddress string, key *ClientAuthKeyV3, err error) {
+	fields := strings.SplitN(string(data), ":", 2)
+	if len(fields) != 2 {
+		return "", nil, errors.New("Malformed client authorization line")
+	}
+	onionAddress = strings.TrimSuffix(fields[0], ".onion")
+	if !OnionAddressIsValidV3(onionAddress) {
+		return "", nil, ErrInvalidAddress
+	}
+	encodedKey, err := splitClientAuth(fields[1])
+	if err != nil {
+		return "", nil, err
+	}
+	sk, err := decodeClientAuthKey(encodedKey)
+	if err != nil {
+		return "", nil, err
+	}
+	return onionAddress, NewClientAuthKeyV3(sk), nil
+}
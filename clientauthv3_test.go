@@ -0,0 +1,38 @@
+package onionutil
+
+import (
+	"crypto/rand"
+	"strings"
+	"testing"
+)
+
+func TestClientAuthFilesV3(t *testing.T) {
+	key, err := GenerateClientAuthKeyV3(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	line := EncodeAuthorizedClientV3(key.Public)
+	if !strings.HasPrefix(line, "descriptor:x25519:") || len(line) != 18+52+1 {
+		t.Fatalf("wrong authorized client line: %q", line)
+	}
+	pk, err := ParseAuthorizedClientV3([]byte(line))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pk != key.Public {
+		t.Fatal("authorized client key differs")
+	}
+
+	onionAddress := "25njqamcweflpvkl73j4szahhihoc4xt3ktcgjnpaingr5yhkenl5sid"
+	line = EncodeClientAuthPrivateV3(onionAddress+".onion", key)
+	parsedAddress, parsedKey, err := ParseClientAuthPrivateV3([]byte(line))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsedAddress != onionAddress || *parsedKey != *key {
+		t.Fatal("client private key differs")
+	}
+	if _, err := ParseAuthorizedClientV3([]byte("descriptor:x448:AAAA")); err == nil {
+		t.Fatal("unsupported authorization type is accepted")
+	}
+}
@@ -0,0 +1,223 @@
+// collector.go - read documents from CollecTor files and archives
+//
+// To the extent possible under law, Ivan Markin waived all copyright
+// and related or neighboring rights to this module of onionutil, using the creative
+// commons "cc0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package onionutil
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrUnsupportedDocumentType is returned for documents of types
+// which are not parsed by CollecTorReader.
+var ErrUnsupportedDocumentType = errors.New("Unsupported document type")
+
+// collecTorParsers are parsers of CollecTor document types
+// ("@type" annotations without versions).
+var collecTorParsers = map[string]func(data []byte) (interface{}, error){
+	"server-descriptor": func(data []byte) (interface{}, error) {
+		return parseDocument(data, docRouterDescriptor)
+	},
+	"microdescriptor": func(data []byte) (interface{}, error) {
+		return parseDocument(data, docMicrodescriptor)
+	},
+	"hidden-service-descriptor": func(data []byte) (interface{}, error) {
+		return parseDocument(data, docOnionDescriptor)
+	},
+	"hidden-service-descriptor-3": func(data []byte) (interface{}, error) {
+		return parseDocument(data, docOnionDescriptorV3)
+	},
+	"network-status-consensus-3": func(data []byte) (interface{}, error) {
+		return ParseConsensus(data)
+	},
+	"network-status-microdesc-consensus-3": func(data []byte) (interface{}, error) {
+		return ParseConsensus(data)
+	},
+	"dir-key-certificate-3": func(data []byte) (interface{}, error) {
+		return ParseKeyCertificate(data)
+	},
+}
+
+// CollecTorDocument is a document read from CollecTor files.
+type CollecTorDocument struct {
+	// File is the name of the file or archive member.
+	File string
+	// Type and Version are from "@type" annotation like
+	// "@type server-descriptor 1.0".
+	Type    string
+	Version string
+	// Raw is the document along with its annotations.
+	Raw []byte
+	// Desc is *RouterDescriptor, *Microdescriptor, *OnionDescriptor,
+	// *OnionDescriptorV3, *Consensus or *KeyCertificate depending
+	// on Type. It's nil if Err is set.
+	Desc interface{}
+	Err  error
+}
+
+func parseCollecTorDocument(file string, raw []byte) *CollecTorDocument {
+	doc := &CollecTorDocument{File: file, Raw: raw}
+	line := raw
+	if i := bytes.IndexByte(raw, '\n'); i >= 0 {
+		line = raw[:i]
+	}
+	fields := strings.Fields(string(line))
+	if len(fields) != 3 || fields[0] != "@type" {
+		doc.Err = errors.New("No @type annotation")
+		return doc
+	}
+	doc.Type, doc.Version = fields[1], fields[2]
+	parse, ok := collecTorParsers[doc.Type]
+	if !ok {
+		doc.Err = ErrUnsupportedDocumentType
+		return doc
+	}
+	if !strings.HasPrefix(doc.Version, "1.") {
+		doc.Err = fmt.Errorf("Unsupported version of %s: %s", doc.Type, doc.Version)
+		return doc
+	}
+	desc, err := parse(stripAnnotations(raw))
+	if err != nil {
+		doc.Err = err
+		return doc
+	}
+	doc.Desc = desc
+	return doc
+}
+
+// splitCollecTorFile splits content of a file into documents
+// each starting with "@type" annotation.
+func splitCollecTorFile(data []byte) (docs [][]byte) {
+	sep := []byte("\n@type ")
+	for len(bytes.TrimSpace(data)) > 0 {
+		next := bytes.Index(data, sep)
+		if next < 0 {
+			docs = append(docs, data)
+			break
+		}
+		if len(bytes.TrimSpace(data[:next])) > 0 {
+			docs = append(docs, data[:next+1])
+		}
+		data = data[next+1:]
+	}
+	return docs
+}
+
+// CollecTorReader reads documents from a CollecTor file (like files
+// of "recent" directory) or a tar archive of such files (like
+// archives of "archive" directory) one by one.
+type CollecTorReader struct {
+	r    *bufio.Reader
+	tr   *tar.Reader
+	name string
+	file string
+	docs [][]byte
+	done bool
+	err  error
+}
+
+// NewCollecTorReader returns reader of documents from r. Tar archives
+// and compression (see Decompress) are detected automatically. name
+// is reported as the file name of documents which are not in an archive.
+func NewCollecTorReader(r io.Reader, name string) *CollecTorReader {
+	dr, err := Decompress(r)
+	if err != nil {
+		return &CollecTorReader{err: err}
+	}
+	cr := &CollecTorReader{r: bufio.NewReader(dr), name: name}
+	/* "ustar" magic is at offset 257 of tar headers */
+	if magic, err := cr.r.Peek(262); err == nil && string(magic[257:]) == "ustar" {
+		cr.tr = tar.NewReader(cr.r)
+	}
+	return cr
+}
+
+func (cr *CollecTorReader) nextFile() error {
+	if cr.tr == nil {
+		if cr.done {
+			return io.EOF
+		}
+		cr.done = true
+		data, err := ioutil.ReadAll(cr.r)
+		if err != nil {
+			return err
+		}
+		cr.file = cr.name
+		cr.docs = splitCollecTorFile(data)
+		return nil
+	}
+	for {
+		hdr, err := cr.tr.Next()
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		data, err := ioutil.ReadAll(cr.tr)
+		if err != nil {
+			return err
+		}
+		cr.file = hdr.Name
+		cr.docs = splitCollecTorFile(data)
+		return nil
+	}
+}
+
+// Next returns the next document. It returns io.EOF if there are
+// no documents left. Malformed documents and documents of unsupported
+// types are returned with Err set.
+func (cr *CollecTorReader) Next() (*CollecTorDocument, error) {
+	if cr.err != nil {
+		return nil, cr.err
+	}
+	for len(cr.docs) == 0 {
+		if err := cr.nextFile(); err != nil {
+			return nil, err
+		}
+	}
+	raw := cr.docs[0]
+	cr.docs = cr.docs[1:]
+	return parseCollecTorDocument(cr.file, raw), nil
+}
+
+// WalkCollecTor reads documents from all the files in the tree rooted
+// at root (like a directory with downloaded CollecTor files) and calls
+// fn for each of them. Walking stops if fn returns an error.
+func WalkCollecTor(root string, fn func(doc *CollecTorDocument) error) error {
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		cr := NewCollecTorReader(f, path)
+		for {
+			doc, err := cr.Next()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+			if err := fn(doc); err != nil {
+				return err
+			}
+		}
+	})
+}
@@ -0,0 +1,72 @@
+package onionutil
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nogoegst/onionutil/testvectors"
+)
+
+func TestCollecTorReader(t *testing.T) {
+	router, _ := makeRouterDescriptor(t, "router", "")
+	files := map[string]string{
+		"server-descriptors/a/1": "@type server-descriptor 1.0\n" + string(router),
+		"hs/2": "@type hidden-service-descriptor 1.0\n" + testvectors.ServiceDescriptorV2.Data +
+			"@type bridge-extra-info 1.3\nextra-info bridge 0000\n",
+	}
+	buf := new(bytes.Buffer)
+	tw := tar.NewWriter(buf)
+	for _, name := range []string{"server-descriptors/a/1", "hs/2"} {
+		tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(files[name])), Typeflag: tar.TypeReg})
+		tw.Write([]byte(files[name]))
+	}
+	tw.Close()
+
+	cr := NewCollecTorReader(buf, "archive.tar")
+	var docs []*CollecTorDocument
+	for {
+		doc, err := cr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		docs = append(docs, doc)
+	}
+	if len(docs) != 3 {
+		t.Fatalf("Wrong number of documents: %d", len(docs))
+	}
+	if desc, ok := docs[0].Desc.(*RouterDescriptor); !ok || desc.Nickname != "router" ||
+		docs[0].File != "server-descriptors/a/1" {
+		t.Fatalf("Wrong server descriptor: %v", docs[0].Err)
+	}
+	if _, ok := docs[1].Desc.(*OnionDescriptor); !ok || docs[1].Type != "hidden-service-descriptor" {
+		t.Fatalf("Wrong onion service descriptor: %v", docs[1].Err)
+	}
+	if docs[2].Err != ErrUnsupportedDocumentType || docs[2].Version != "1.3" {
+		t.Fatalf("Expected unsupported type, got %v", docs[2].Err)
+	}
+
+	dir, err := ioutil.TempDir("", "collector")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "recent"), []byte(files["hs/2"]), 0600); err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	err = WalkCollecTor(dir, func(doc *CollecTorDocument) error {
+		n++
+		return nil
+	})
+	if err != nil || n != 2 {
+		t.Fatalf("Walked %d documents: %v", n, err)
+	}
+}
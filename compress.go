@@ -0,0 +1,116 @@
+// compress.go - transparent decompression of documents
+//
+// To the extent possible under law, Ivan Markin waived all copyright
+// and related or neighboring rights to this module of onionutil, using the creative
+// commons "cc0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package onionutil
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/nogoegst/onionutil/internal/zstd"
+)
+
+// ErrUnsupportedCompression is returned for compressed data
+// which has no registered decompressor.
+var ErrUnsupportedCompression = errors.New("Unsupported compression")
+
+// Decompressor returns reader of decompressed data read from r.
+type Decompressor func(r io.Reader) (io.Reader, error)
+
+type compression struct {
+	name         string
+	magic        []byte
+	decompressor Decompressor
+}
+
+var (
+	compressionsMu sync.RWMutex
+	/* zlib ("deflate" of Tor directory protocol) is detected separately */
+	compressions = []*compression{
+		{name: "gzip", magic: []byte{0x1f, 0x8b}, decompressor: func(r io.Reader) (io.Reader, error) {
+			return gzip.NewReader(r)
+		}},
+		{name: "bzip2", magic: []byte("BZh"), decompressor: func(r io.Reader) (io.Reader, error) {
+			return bzip2.NewReader(r), nil
+		}},
+		{name: "xz", magic: []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}},
+		{name: "zstd", magic: []byte{0x28, 0xb5, 0x2f, 0xfd}, decompressor: func(r io.Reader) (io.Reader, error) {
+			return zstd.NewReader(r), nil
+		}},
+	}
+)
+
+// RegisterDecompressor sets decompressor of format name ("gzip",
+// "bzip2", "xz" or "zstd"). There is no built-in decompressor
+// of xz so callers have to register it to read such data,
+// e.g. using third-party packages.
+func RegisterDecompressor(name string, d Decompressor) error {
+	compressionsMu.Lock()
+	defer compressionsMu.Unlock()
+	for _, c := range compressions {
+		if c.name == name {
+			c.decompressor = d
+			return nil
+		}
+	}
+	return fmt.Errorf("Unknown compression format: %s", name)
+}
+
+func isZlibHeader(b []byte) bool {
+	return len(b) >= 2 && b[0]&0x0f == 8 && b[0]>>4 <= 7 &&
+		(uint16(b[0])<<8|uint16(b[1]))%31 == 0
+}
+
+// Compression returns name of compression format of data
+// or empty string if data is not compressed.
+func Compression(data []byte) string {
+	compressionsMu.RLock()
+	defer compressionsMu.RUnlock()
+	for _, c := range compressions {
+		if bytes.HasPrefix(data, c.magic) {
+			return c.name
+		}
+	}
+	if isZlibHeader(data) {
+		return "zlib"
+	}
+	return ""
+}
+
+// Decompress returns reader of data read from r decompressed
+// according to the detected compression format. Uncompressed data
+// is returned as is.
+func Decompress(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	magic, _ := br.Peek(6)
+	name := Compression(magic)
+	if name == "" {
+		return br, nil
+	}
+	if name == "zlib" {
+		return zlib.NewReader(br)
+	}
+	compressionsMu.RLock()
+	var d Decompressor
+	for _, c := range compressions {
+		if c.name == name {
+			d = c.decompressor
+		}
+	}
+	compressionsMu.RUnlock()
+	if d == nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedCompression, name)
+	}
+	return d(br)
+}
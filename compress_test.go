@@ -0,0 +1,98 @@
+package onionutil
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/nogoegst/onionutil/testvectors"
+)
+
+func TestDecompress(t *testing.T) {
+	data := []byte(testvectors.ServiceDescriptorV2.Data)
+	gz := new(bytes.Buffer)
+	gw := gzip.NewWriter(gz)
+	gw.Write(data)
+	gw.Close()
+	z := new(bytes.Buffer)
+	zw := zlib.NewWriter(z)
+	zw.Write(data)
+	zw.Close()
+	for name, compressed := range map[string][]byte{"": data, "gzip": gz.Bytes(), "zlib": z.Bytes()} {
+		if c := Compression(compressed); c != name {
+			t.Fatalf("Detected %q instead of %q", c, name)
+		}
+		r, err := Decompress(bytes.NewReader(compressed))
+		if err != nil {
+			t.Fatal(err)
+		}
+		decompressed, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(decompressed, data) {
+			t.Fatalf("Wrong %q decompression", name)
+		}
+	}
+
+	dr := NewDescriptorReader(bytes.NewReader(gz.Bytes()))
+	if _, err := dr.Next(); err != nil {
+		t.Fatal(err)
+	}
+
+	xz := []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}
+	if _, err := Decompress(bytes.NewReader(xz)); !errors.Is(err, ErrUnsupportedCompression) {
+		t.Fatalf("Expected ErrUnsupportedCompression, got %v", err)
+	}
+	if err := RegisterDecompressor("xz", func(r io.Reader) (io.Reader, error) {
+		return r, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	defer RegisterDecompressor("xz", nil)
+	if _, err := Decompress(bytes.NewReader(xz)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDecompressZstd(t *testing.T) {
+	data := []byte(testvectors.ServiceDescriptorV2.Data)
+	/* Compressed with zstd 1.5.6 at levels 19 and 3 */
+	for filename, expected := range map[string][]byte{
+		"testdata/descriptor-v2.zst":  data,
+		"testdata/descriptors-v2.zst": bytes.Repeat(data, 50),
+	} {
+		compressed, err := ioutil.ReadFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c := Compression(compressed); c != "zstd" {
+			t.Fatalf("Detected %q instead of zstd", c)
+		}
+		r, err := Decompress(bytes.NewReader(compressed))
+		if err != nil {
+			t.Fatal(err)
+		}
+		decompressed, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(decompressed, expected) {
+			t.Fatalf("Wrong decompression of %s", filename)
+		}
+
+		corrupted := append([]byte{}, compressed...)
+		corrupted[len(corrupted)-1] ^= 1
+		r, err = Decompress(bytes.NewReader(corrupted))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ioutil.ReadAll(r); err == nil {
+			t.Fatalf("Corrupted %s is decompressed", filename)
+		}
+	}
+}
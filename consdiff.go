@@ -0,0 +1,186 @@
+// consdiff.go - apply consensus diffs (network-status-diff-version 1)
+//
+// To the extent possible under law, Ivan Markin waived all copyright
+// and related or neighboring rights to this module of onionutil, using the creative
+// commons "cc0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package onionutil
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DiffFromConsensusHeader is the HTTP header listing hex digests
+// (ConsensusDigest) of consensuses which the client has. A directory
+// cache may respond with a diff from one of them.
+const DiffFromConsensusHeader = "X-Or-Diff-From-Consensus"
+
+// ConsensusDigest returns SHA3-256 digest of the whole consensus
+// as used in consensus diffs.
+func ConsensusDigest(consensus []byte) []byte {
+	return DigestSHA3_256.Sum(consensus)
+}
+
+// diffCommand is an ed command of a consensus diff.
+type diffCommand struct {
+	action     byte
+	start, end int /* end is -1 for "$" */
+	lines      [][]byte
+}
+
+// ConsensusDiff is a consensus diff (dir-spec appendix E): an ed
+// script which turns the base consensus into the target one.
+type ConsensusDiff struct {
+	BaseDigest   []byte
+	TargetDigest []byte
+	commands     []diffCommand
+}
+
+func parseDiffLineNum(s string) (int, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 || strconv.Itoa(n) != s {
+		return 0, fmt.Errorf("Malformed line number: %s", s)
+	}
+	return n, nil
+}
+
+func parseDiffCommand(line string) (cmd diffCommand, err error) {
+	if len(line) < 2 {
+		return cmd, fmt.Errorf("Malformed diff command: %s", line)
+	}
+	cmd.action = line[len(line)-1]
+	lineRange := strings.SplitN(line[:len(line)-1], ",", 2)
+	cmd.start, err = parseDiffLineNum(lineRange[0])
+	if err != nil {
+		return cmd, err
+	}
+	cmd.end = cmd.start
+	if len(lineRange) == 2 {
+		if lineRange[1] == "$" {
+			cmd.end = -1
+		} else if cmd.end, err = parseDiffLineNum(lineRange[1]); err != nil {
+			return cmd, err
+		}
+		if cmd.end != -1 && cmd.end < cmd.start {
+			return cmd, fmt.Errorf("Wrong line range: %s", line)
+		}
+	}
+	switch cmd.action {
+	case 'a':
+		if len(lineRange) == 2 {
+			return cmd, fmt.Errorf("Line range in append command: %s", line)
+		}
+	case 'c', 'd':
+		if cmd.start == 0 {
+			return cmd, fmt.Errorf("Zero line number: %s", line)
+		}
+	default:
+		return cmd, fmt.Errorf("Unknown diff command: %s", line)
+	}
+	return cmd, nil
+}
+
+// ParseConsensusDiff parses consensus diff data.
+func ParseConsensusDiff(data []byte) (*ConsensusDiff, error) {
+	if len(data) == 0 || data[len(data)-1] != '\n' {
+		return nil, errors.New("Diff doesn't end with newline")
+	}
+	lines := bytes.Split(data[:len(data)-1], []byte("\n"))
+	if len(lines) < 2 || string(lines[0]) != "network-status-diff-version 1" {
+		return nil, errors.New("Not a network-status-diff-version 1 document")
+	}
+	hashes := strings.Fields(string(lines[1]))
+	if len(hashes) != 3 || hashes[0] != "hash" {
+		return nil, errors.New("Malformed hash line")
+	}
+	d := new(ConsensusDiff)
+	var err error
+	if d.BaseDigest, err = hex.DecodeString(hashes[1]); err != nil || len(d.BaseDigest) != 32 {
+		return nil, errors.New("Malformed base digest")
+	}
+	if d.TargetDigest, err = hex.DecodeString(hashes[2]); err != nil || len(d.TargetDigest) != 32 {
+		return nil, errors.New("Malformed target digest")
+	}
+	/* Commands must go from the end of the document to its start */
+	limit := -1
+	for i := 2; i < len(lines); i++ {
+		cmd, err := parseDiffCommand(string(lines[i]))
+		if err != nil {
+			return nil, err
+		}
+		last := cmd.end
+		if last == -1 {
+			if limit != -1 {
+				return nil, errors.New("Diff commands are not in decreasing order")
+			}
+		} else if limit != -1 && last >= limit {
+			return nil, errors.New("Diff commands are not in decreasing order")
+		}
+		limit = cmd.start
+		if cmd.action != 'd' {
+			for i++; ; i++ {
+				if i == len(lines) {
+					return nil, errors.New("Unterminated lines of diff command")
+				}
+				if string(lines[i]) == "." {
+					break
+				}
+				cmd.lines = append(cmd.lines, lines[i])
+			}
+		}
+		d.commands = append(d.commands, cmd)
+	}
+	return d, nil
+}
+
+// Apply returns the target consensus of the diff. base must be
+// the base consensus of the diff.
+func (d *ConsensusDiff) Apply(base []byte) ([]byte, error) {
+	if !bytes.Equal(ConsensusDigest(base), d.BaseDigest) {
+		return nil, errors.New("Consensus is not the base of diff")
+	}
+	if len(base) == 0 || base[len(base)-1] != '\n' {
+		return nil, errors.New("Consensus doesn't end with newline")
+	}
+	lines := bytes.Split(base[:len(base)-1], []byte("\n"))
+	for _, cmd := range d.commands {
+		end := cmd.end
+		if end == -1 {
+			end = len(lines)
+		}
+		if end > len(lines) {
+			return nil, fmt.Errorf("Line %d is out of consensus", end)
+		}
+		/* Lines from start to end (1-based) are replaced with cmd.lines */
+		from, to := cmd.start-1, end
+		if cmd.action == 'a' {
+			from, to = cmd.start, cmd.start
+		}
+		rest := append(append([][]byte{}, cmd.lines...), lines[to:]...)
+		lines = append(lines[:from], rest...)
+	}
+	target := append(bytes.Join(lines, []byte("\n")), '\n')
+	if len(lines) == 0 {
+		target = nil
+	}
+	if !bytes.Equal(ConsensusDigest(target), d.TargetDigest) {
+		return nil, errors.New("Digest of result doesn't match target digest")
+	}
+	return target, nil
+}
+
+// ApplyConsensusDiff applies consensus diff diff to consensus base
+// and returns the resulting consensus.
+func ApplyConsensusDiff(base, diff []byte) ([]byte, error) {
+	d, err := ParseConsensusDiff(diff)
+	if err != nil {
+		return nil, err
+	}
+	return d.Apply(base)
+}
@@ -0,0 +1,35 @@
+package onionutil
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestApplyConsensusDiff(t *testing.T) {
+	base := []byte("network-status-version 3\nvalid-after 2019-01-02 03:00:00\nr a\nr b\nr c\ndirectory-footer\n")
+	target := []byte("network-status-version 3\nvalid-after 2019-01-02 04:00:00\nr b\nr c\nr d\ndirectory-footer\n")
+	diff := "network-status-diff-version 1\n" +
+		"hash " + strings.ToUpper(hex.EncodeToString(ConsensusDigest(base))) + " " +
+		strings.ToUpper(hex.EncodeToString(ConsensusDigest(target))) + "\n" +
+		"5a\nr d\n.\n" +
+		"3d\n" +
+		"2c\nvalid-after 2019-01-02 04:00:00\n.\n"
+	result, err := ApplyConsensusDiff(base, []byte(diff))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(result, target) {
+		t.Fatalf("wrong result:\n%s", result)
+	}
+	if _, err := ApplyConsensusDiff(target, []byte(diff)); err == nil {
+		t.Fatal("diff is applied to another consensus")
+	}
+
+	/* Commands must be in decreasing order */
+	unordered := strings.Replace(diff, "5a\nr d\n.\n3d\n", "3d\n5a\nr d\n.\n", 1)
+	if _, err := ParseConsensusDiff([]byte(unordered)); err == nil {
+		t.Fatal("unordered diff is accepted")
+	}
+}
@@ -0,0 +1,268 @@
+// consensus.go - deal with network status documents (consensuses and votes)
+//
+// To the extent possible under law, Ivan Markin waived all copyright
+// and related or neighboring rights to this module of onionutil, using the creative
+// commons "cc0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package onionutil
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nogoegst/onionutil/torparse"
+)
+
+// PackageEntry is a recommended software package from a historical
+// "package" line of a consensus or a vote.
+type PackageEntry struct {
+	Name    string
+	Version string
+	URL     string
+	// Digests maps digest algorithm names to digest values.
+	Digests map[string]string
+}
+
+func ParsePackageEntry(packageE torparse.TorEntry) (pkg PackageEntry, err error) {
+	if len(packageE) < 3 {
+		return pkg, fmt.Errorf("Package entry is too short")
+	}
+	pkg.Name = string(packageE[0])
+	pkg.Version = string(packageE[1])
+	pkg.URL = string(packageE[2])
+	pkg.Digests = make(map[string]string)
+	for _, digest := range packageE[3:] {
+		kv := strings.SplitN(string(digest), "=", 2)
+		if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+			return pkg, fmt.Errorf("Malformed package digest: %s", digest)
+		}
+		pkg.Digests[kv[0]] = kv[1]
+	}
+	return pkg, nil
+}
+
+func ParsePackageEntries(packageEs torparse.TorEntries) (pkgs []PackageEntry, err error) {
+	for _, packageE := range packageEs {
+		pkg, err := ParsePackageEntry(packageE)
+		if err != nil {
+			return nil, err
+		}
+		pkgs = append(pkgs, pkg)
+	}
+	return pkgs, nil
+}
+
+// SharedRandomValue is a shared random value from
+// "shared-rand-previous-value" or "shared-rand-current-value" line.
+type SharedRandomValue struct {
+	NumReveals int
+	Value      []byte
+}
+
+func ParseSharedRandomValueEntry(srvE torparse.TorEntry) (*SharedRandomValue, error) {
+	if len(srvE) != 2 {
+		return nil, fmt.Errorf("Wrong number of shared random value arguments")
+	}
+	numReveals, err := strconv.Atoi(string(srvE[0]))
+	if err != nil {
+		return nil, err
+	}
+	value, err := base64.StdEncoding.DecodeString(string(srvE[1]))
+	if err != nil {
+		return nil, err
+	}
+	if len(value) != srDigestLength {
+		return nil, fmt.Errorf("Wrong shared random value length")
+	}
+	return &SharedRandomValue{NumReveals: numReveals, Value: value}, nil
+}
+
+// DirectorySignature is a signature of a directory authority
+// on a network status document.
+type DirectorySignature struct {
+	Algorithm string
+	// Identity is the digest of authority's v3 identity key.
+	Identity []byte
+	// SigningKeyDigest is the digest of authority's signing key.
+	SigningKeyDigest []byte
+	Signature        []byte
+}
+
+// Consensus is a network status consensus document (dir-spec 3.4.1).
+type Consensus struct {
+	// Flavor is "microdesc" for microdescriptor consensuses and
+	// empty for full ones.
+	Flavor             string
+	VoteStatus         string
+	ConsensusMethod    int
+	ValidAfter         time.Time
+	FreshUntil         time.Time
+	ValidUntil         time.Time
+	ClientVersions     []string
+	ServerVersions     []string
+	Packages           []PackageEntry
+	KnownFlags         []string
+	Params             map[string]int
+	SharedRandPrevious *SharedRandomValue
+	SharedRandCurrent  *SharedRandomValue
+	Routers            []RouterStatus
+	BandwidthWeights   map[string]int
+	Signatures         []DirectorySignature
+
+	// Raw is the encoded document.
+	Raw []byte
+}
+
+func parseKeywordArgs(args torparse.TorEntry) (map[string]int, error) {
+	params := make(map[string]int)
+	for _, arg := range args {
+		kv := strings.SplitN(string(arg), "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("Malformed keyword argument: %s", arg)
+		}
+		value, err := strconv.Atoi(kv[1])
+		if err != nil {
+			return nil, err
+		}
+		params[kv[0]] = value
+	}
+	return params, nil
+}
+
+func parseDocumentTime(entry torparse.TorEntry) (time.Time, error) {
+	return time.Parse(PublicationTimeFormat, string(entry.Joined()))
+}
+
+func splitList(entry torparse.TorEntry) []string {
+	if len(entry) == 0 {
+		return nil
+	}
+	return strings.Split(string(entry.Joined()), ",")
+}
+
+// ParseConsensus parses a full or microdescriptor consensus.
+// Signatures are not verified.
+func ParseConsensus(data []byte) (*Consensus, error) {
+	c := &Consensus{Raw: data}
+	var rs *RouterStatus
+	first := true
+	line := 1 /* line where the next item begins */
+	for {
+		field, content, rest, err := torparse.ParseOutNextField(data)
+		if err != nil {
+			break
+		}
+		itemLine := line
+		line += bytes.Count(data[:len(data)-len(rest)], []byte("\n"))
+		data = rest
+		if first {
+			if field != "network-status-version" || len(content) < 1 ||
+				string(content[0]) != "3" {
+				return nil, fmt.Errorf("Not a network status version 3 document")
+			}
+			if len(content) > 1 {
+				c.Flavor = string(content[1])
+			}
+			first = false
+			continue
+		}
+		if rs != nil && field != "r" && field != "directory-footer" {
+			if err := parseRouterStatusItem(rs, field, content); err != nil {
+				return nil, &ParseError{Line: itemLine, Keyword: field, Err: err}
+			}
+			continue
+		}
+		switch field {
+		case "vote-status":
+			c.VoteStatus = string(content.Joined())
+		case "consensus-method":
+			c.ConsensusMethod, err = strconv.Atoi(string(content.Joined()))
+		case "valid-after":
+			c.ValidAfter, err = parseDocumentTime(content)
+		case "fresh-until":
+			c.FreshUntil, err = parseDocumentTime(content)
+		case "valid-until":
+			c.ValidUntil, err = parseDocumentTime(content)
+		case "client-versions":
+			c.ClientVersions = splitList(content)
+		case "server-versions":
+			c.ServerVersions = splitList(content)
+		case "package":
+			var pkg PackageEntry
+			pkg, err = ParsePackageEntry(content)
+			c.Packages = append(c.Packages, pkg)
+		case "known-flags":
+			for _, flag := range content {
+				c.KnownFlags = append(c.KnownFlags, string(flag))
+			}
+		case "params":
+			c.Params, err = parseKeywordArgs(content)
+		case "shared-rand-previous-value":
+			c.SharedRandPrevious, err = ParseSharedRandomValueEntry(content)
+		case "shared-rand-current-value":
+			c.SharedRandCurrent, err = ParseSharedRandomValueEntry(content)
+		case "r":
+			var status RouterStatus
+			status, err = parseRouterStatusEntry(content, c.Flavor == "microdesc")
+			c.Routers = append(c.Routers, status)
+			rs = &c.Routers[len(c.Routers)-1]
+		case "directory-footer":
+			rs = nil
+		case "bandwidth-weights":
+			c.BandwidthWeights, err = parseKeywordArgs(content)
+		case "directory-signature":
+			var sig DirectorySignature
+			sig, err = parseDirectorySignature(content)
+			c.Signatures = append(c.Signatures, sig)
+		}
+		if err != nil {
+			return nil, &ParseError{Line: itemLine, Keyword: field, Err: err}
+		}
+	}
+	if first {
+		return nil, fmt.Errorf("Empty document")
+	}
+	return c, nil
+}
+
+func parseDirectorySignature(content torparse.TorEntry) (sig DirectorySignature, err error) {
+	/* [algorithm] identity signing-key-digest SIGNATURE */
+	switch len(content) {
+	case 3:
+		sig.Algorithm = "sha1"
+	case 4:
+		sig.Algorithm = string(content[0])
+		content = content[1:]
+	default:
+		return sig, fmt.Errorf("Wrong number of directory-signature arguments")
+	}
+	sig.Identity, err = hex.DecodeString(string(content[0]))
+	if err != nil {
+		return sig, err
+	}
+	sig.SigningKeyDigest, err = hex.DecodeString(string(content[1]))
+	if err != nil {
+		return sig, err
+	}
+	sig.Signature = content[2]
+	return sig, nil
+}
+
+// HSDirs returns routers with HSDir flag.
+func (c *Consensus) HSDirs() (hsdirs []HSDir) {
+	for _, rs := range c.Routers {
+		if rs.Flags.Has(FlagHSDir) {
+			hsdirs = append(hsdirs, HSDir{
+				Nickname:    rs.Nickname,
+				Fingerprint: rs.Identity,
+			})
+		}
+	}
+	return hsdirs
+}
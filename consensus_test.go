@@ -0,0 +1,140 @@
+package onionutil
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/nogoegst/onionutil/torparse"
+)
+
+var testConsensus = []byte(`network-status-version 3 microdesc
+vote-status consensus
+consensus-method 28
+valid-after 2019-01-02 03:00:00
+fresh-until 2019-01-02 04:00:00
+valid-until 2019-01-02 06:00:00
+voting-delay 300 300
+client-versions 0.3.5.7,0.4.0.1-alpha
+known-flags Authority Exit Fast Guard HSDir Running Stable V2Dir Valid
+params CircuitPriorityHalflifeMsec=30000 NumNTorsPerTAP=100
+shared-rand-previous-value 8 qVYuaJtoGs1rfSShiv8v8BzLAvg3cLzIs+ZgJtCwrQk=
+shared-rand-current-value 8 Y21ZRz6bz/P68ZHCWGAvFxQqJQlnxN6rJMuJWrFuBbw=
+dir-source dannenberg 0232AF901C31A04EE9848595AF9BB7620D4C5B2E dannenberg.torauth.de 193.23.244.244 80 443
+r seele AAoQ1DAR6kkoo19hBAX5K0QztNw 2019-01-02 00:20:24 67.174.243.193 9001 0
+m 4OKNG3aMNVaRhHj/e6Ag5vn8s0+CgXmxbUWmqN/U4Cc
+s Running Stable V2Dir Valid
+v Tor 0.3.5.7
+pr Cons=1-2 Desc=1-2 HSDir=1-2
+w Bandwidth=30
+r CalyxInstitute14 ABG9JIWtRdmE7EFZyI/AZuXjMA4 2019-01-02 02:42:37 162.247.74.201 443 80
+a [2620:18c:0:192::201]:443
+m 8ufHyjrelQdkOk9G2hA8ZzuV9ZrvKPmJzPyMdnrGfdc
+s Exit Fast Guard HSDir Running Stable V2Dir Valid
+v Tor 0.3.4.9
+w Bandwidth=8770
+directory-footer
+bandwidth-weights Wbd=0 Wbe=0 Wbg=4149 Wbm=10000
+directory-signature sha256 0232AF901C31A04EE9848595AF9BB7620D4C5B2E 0C7A6B6E1E3D1E8FCB6A1B2A3C4D5E6F7A8B9C0D
+-----BEGIN SIGNATURE-----
+AQID
+-----END SIGNATURE-----
+`)
+
+func TestParseConsensus(t *testing.T) {
+	c, err := ParseConsensus(testConsensus)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Flavor != "microdesc" || c.ConsensusMethod != 28 {
+		t.Fatalf("wrong header: %+v", c)
+	}
+	if !c.ValidAfter.Equal(time.Date(2019, 1, 2, 3, 0, 0, 0, time.UTC)) {
+		t.Fatalf("wrong valid-after: %v", c.ValidAfter)
+	}
+	if c.SharedRandCurrent == nil || c.SharedRandCurrent.NumReveals != 8 {
+		t.Fatal("shared-rand-current-value is not parsed")
+	}
+	if len(c.Routers) != 2 {
+		t.Fatalf("wrong number of routers: %d", len(c.Routers))
+	}
+	r := c.Routers[1]
+	if r.Nickname != "CalyxInstitute14" || r.ORPort != 443 || r.DirPort != 80 ||
+		len(r.ORAddrs) != 2 || r.Flags.Count() != 8 || r.Bandwidth != 8770 ||
+		len(r.MicrodescDigest) != 32 {
+		t.Fatalf("wrong router status: %+v", r)
+	}
+	if c.Routers[0].Protocols.String() != "Cons=1-2 Desc=1-2 HSDir=1-2" {
+		t.Fatalf("wrong protocols: %q", c.Routers[0].Protocols)
+	}
+	if c.BandwidthWeights["Wbg"] != 4149 {
+		t.Fatal("bandwidth-weights are not parsed")
+	}
+	if len(c.Signatures) != 1 || c.Signatures[0].Algorithm != "sha256" ||
+		!bytes.Equal(c.Signatures[0].Signature, []byte{1, 2, 3}) {
+		t.Fatalf("wrong signatures: %+v", c.Signatures)
+	}
+	if hsdirs := c.HSDirs(); len(hsdirs) != 1 || hsdirs[0].Nickname != "CalyxInstitute14" {
+		t.Fatalf("wrong HSDirs: %+v", hsdirs)
+	}
+}
+
+func parsePackageLine(line string) (PackageEntry, error) {
+	return ParsePackageEntry(torparse.TorEntry(bytes.Fields([]byte(line))))
+}
+
+func TestParsePackageEntry(t *testing.T) {
+	for _, tt := range []struct {
+		line    string
+		digests map[string]string
+	}{
+		{"tor 0.2.5.9 https://www.torproject.org/download/ sha256=abcdef",
+			map[string]string{"sha256": "abcdef"}},
+		{"tor 0.2.5.9 https://www.torproject.org/download/ sha256=abcdef sha512=fedcba",
+			map[string]string{"sha256": "abcdef", "sha512": "fedcba"}},
+		/* Digest values are base64 and may contain "=" */
+		{"tor 0.2.5.9 https://www.torproject.org/download/ sha256=q83vEjRWeJA= sha3-256=ASNF",
+			map[string]string{"sha256": "q83vEjRWeJA=", "sha3-256": "ASNF"}},
+	} {
+		pkg, err := parsePackageLine(tt.line)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.line, err)
+		}
+		if pkg.Name != "tor" || pkg.Version != "0.2.5.9" ||
+			pkg.URL != "https://www.torproject.org/download/" ||
+			!reflect.DeepEqual(pkg.Digests, tt.digests) {
+			t.Fatalf("wrong package: %+v", pkg)
+		}
+	}
+	for _, line := range []string{
+		"",
+		"tor",
+		"tor 0.2.5.9",
+		"tor 0.2.5.9 https://www.torproject.org/download/ sha256",
+		"tor 0.2.5.9 https://www.torproject.org/download/ =abcdef",
+		"tor 0.2.5.9 https://www.torproject.org/download/ sha256=",
+		"tor 0.2.5.9 https://www.torproject.org/download/ sha256=abcdef sha512",
+	} {
+		if _, err := parsePackageLine(line); err == nil {
+			t.Fatalf("malformed package line is parsed: %q", line)
+		}
+	}
+
+	pkgs, err := ParsePackageEntries(torparse.TorEntries{
+		torparse.TorEntry(bytes.Fields([]byte("tor 0.2.5.9 https://www.torproject.org/ sha256=abcdef"))),
+		torparse.TorEntry(bytes.Fields([]byte("tor-browser 5.0 https://www.torproject.org/ sha256=fedcba"))),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pkgs) != 2 || pkgs[1].Name != "tor-browser" {
+		t.Fatalf("wrong packages: %+v", pkgs)
+	}
+	if _, err := ParsePackageEntries(torparse.TorEntries{
+		torparse.TorEntry(bytes.Fields([]byte("tor 0.2.5.9 https://www.torproject.org/ sha256=abcdef"))),
+		torparse.TorEntry(bytes.Fields([]byte("tor-browser 5.0"))),
+	}); err == nil {
+		t.Fatal("malformed package line is parsed")
+	}
+}
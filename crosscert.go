@@ -0,0 +1,179 @@
+// crosscert.go - cross-certificates of relay keys
+//
+// To the extent possible under law, Ivan Markin waived all copyright
+// and related or neighboring rights to this module of onionutil, using the creative
+// commons "cc0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package onionutil
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"time"
+
+	"github.com/nogoegst/onionutil/internal/edwards25519"
+	"golang.org/x/crypto/ed25519"
+)
+
+var (
+	// RSACrosscertPrefix is prepended to RSA->Ed25519 cross-certificates
+	// before signing (cert-spec 2.3).
+	RSACrosscertPrefix = []byte("Tor TLS RSA/Ed25519 cross-certificate")
+	// ntorEd25519String derives the upper half of Ed25519 key
+	// equivalent to a curve25519 key.
+	ntorEd25519String = []byte("Derive high part of ed25519 key from curve25519 key\x00")
+)
+
+// RSACrosscert is an RSA->Ed25519 cross-certificate: Ed25519 key
+// signed with RSA key (cert-spec 2.3).
+type RSACrosscert struct {
+	Ed25519Key Ed25519Pubkey
+	Expiration time.Time
+	Signature  []byte
+}
+
+func NewRSACrosscert(key Ed25519Pubkey, expiration time.Time) *RSACrosscert {
+	return &RSACrosscert{Ed25519Key: key, Expiration: expiration}
+}
+
+func ParseRSACrosscert(b []byte) (*RSACrosscert, error) {
+	if len(b) < Ed25519PubkeySize+4+1 {
+		return nil, errors.New("Truncated RSA cross-certificate")
+	}
+	cc := new(RSACrosscert)
+	copy(cc.Ed25519Key[:], b)
+	b = b[Ed25519PubkeySize:]
+	hours := binary.BigEndian.Uint32(b)
+	cc.Expiration = time.Unix(int64(hours)*3600, 0)
+	sigLen := int(b[4])
+	b = b[5:]
+	if len(b) != sigLen {
+		return nil, errors.New("Wrong length of RSA cross-certificate signature")
+	}
+	cc.Signature = append([]byte{}, b...)
+	return cc, nil
+}
+
+// Body returns encoding of the cross-certificate without
+// the signature length and the signature.
+func (cc *RSACrosscert) Body() []byte {
+	w := new(bytes.Buffer)
+	w.Write(cc.Ed25519Key[:])
+	binary.Write(w, binary.BigEndian, uint32(cc.Expiration.Unix()/3600))
+	return w.Bytes()
+}
+
+func (cc *RSACrosscert) Bytes() []byte {
+	b := append(cc.Body(), byte(len(cc.Signature)))
+	return append(b, cc.Signature...)
+}
+
+func (cc *RSACrosscert) digest() []byte {
+	h := sha256.New()
+	h.Write(RSACrosscertPrefix)
+	h.Write(cc.Body())
+	return h.Sum(nil)
+}
+
+// Sign signs the cross-certificate with RSA key sk.
+func (cc *RSACrosscert) Sign(sk *rsa.PrivateKey) (err error) {
+	cc.Signature, err = rsa.SignPKCS1v15(nil, sk, crypto.Hash(0), cc.digest())
+	return err
+}
+
+// Verify checks signature of the cross-certificate with RSA key pk.
+func (cc *RSACrosscert) Verify(pk *rsa.PublicKey) error {
+	if len(cc.Signature) > 255 {
+		return errors.New("RSA cross-certificate signature is too long")
+	}
+	return verifyPKCS1v15(pk, crypto.Hash(0), cc.digest(), cc.Signature)
+}
+
+// onionKeyCrosscertData returns SHA1(DER(identity)) | edIdentity.
+func onionKeyCrosscertData(identity *rsa.PublicKey, edIdentity Ed25519Pubkey) ([]byte, error) {
+	idHash, err := RSAPubkeyHash(identity)
+	if err != nil {
+		return nil, err
+	}
+	return append(idHash, edIdentity[:]...), nil
+}
+
+// SignOnionKeyCrosscert returns "onion-key-crosscert" of router
+// descriptors: signature of RSA identity key digest and Ed25519
+// identity key with RSA onion key (dir-spec 2.1.1).
+func SignOnionKeyCrosscert(onionKey *rsa.PrivateKey, identity *rsa.PublicKey, edIdentity Ed25519Pubkey) ([]byte, error) {
+	data, err := onionKeyCrosscertData(identity, edIdentity)
+	if err != nil {
+		return nil, err
+	}
+	return rsa.SignPKCS1v15(nil, onionKey, crypto.Hash(0), data)
+}
+
+// VerifyOnionKeyCrosscert checks "onion-key-crosscert" sig.
+func VerifyOnionKeyCrosscert(onionKey, identity *rsa.PublicKey, edIdentity Ed25519Pubkey, sig []byte) error {
+	data, err := onionKeyCrosscertData(identity, edIdentity)
+	if err != nil {
+		return err
+	}
+	return verifyPKCS1v15(onionKey, crypto.Hash(0), data, sig)
+}
+
+// Ed25519Key returns Ed25519 key equivalent to the curve25519 key
+// and the sign bit of its public part. The secret scalar is only
+// handled by constant time code (see Ed25519ExpandedKey.Public).
+func (kp *NTorKeypair) Ed25519Key() (esk Ed25519ExpandedKey, signBit byte) {
+	copy(esk[:32], kp.Private[:])
+	h := sha512.New()
+	h.Write(kp.Private[:])
+	h.Write(ntorEd25519String)
+	var digest [sha512.Size]byte
+	h.Sum(digest[:0])
+	copy(esk[32:], digest[:])
+	Zeroize(digest[:])
+	pk := esk.Public().(ed25519.PublicKey)
+	return esk, pk[31] >> 7
+}
+
+// Ed25519Key returns Ed25519 public key equivalent to key
+// with sign bit signBit.
+func (key NTorOnionKey) Ed25519Key(signBit byte) (ed25519.PublicKey, error) {
+	p, err := new(edwards25519.Point).SetMontgomery(key[:], signBit)
+	if err != nil {
+		return nil, err
+	}
+	return ed25519.PublicKey(p.Bytes()), nil
+}
+
+// NewNTorOnionKeyCrosscert returns "ntor-onion-key-crosscert" of router
+// descriptors: Ed25519 identity certified with Ed25519 equivalent of
+// ntor onion key kp. The sign bit is to be published along with
+// the certificate.
+func NewNTorOnionKeyCrosscert(kp *NTorKeypair, identity Ed25519Pubkey, expiration time.Time) (cert *Certificate, signBit byte) {
+	esk, signBit := kp.Ed25519Key()
+	defer esk.Zeroize()
+	cert = NewCertificate(CertTypeNTorOnionCrosscert, identity, expiration, nil)
+	copy(cert.Signature[:], esk.sign(cert.Body()))
+	return cert, signBit
+}
+
+// VerifyNTorOnionKeyCrosscert checks that cert certifies Ed25519
+// identity with ntor onion key key.
+func VerifyNTorOnionKeyCrosscert(cert *Certificate, key NTorOnionKey, signBit byte, identity Ed25519Pubkey) error {
+	if cert.CertType != CertTypeNTorOnionCrosscert {
+		return errors.New("Not an ntor onion key cross-certificate")
+	}
+	if cert.CertifiedKey != identity {
+		return errors.New("Cross-certificate certifies another identity")
+	}
+	pk, err := key.Ed25519Key(signBit)
+	if err != nil {
+		return err
+	}
+	return cert.Verify(pk)
+}
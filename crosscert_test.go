@@ -0,0 +1,87 @@
+package onionutil
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+func TestRSACrosscert(t *testing.T) {
+	sk, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var edKey Ed25519Pubkey
+	rand.Read(edKey[:])
+	cc := NewRSACrosscert(edKey, time.Now().Add(time.Hour))
+	if err := cc.Sign(sk); err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := ParseRSACrosscert(cc.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := parsed.Verify(&sk.PublicKey); err != nil {
+		t.Fatal(err)
+	}
+	parsed.Ed25519Key[0] ^= 1
+	if parsed.Verify(&sk.PublicKey) == nil {
+		t.Fatal("tampered cross-certificate verified")
+	}
+
+	identity, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := SignOnionKeyCrosscert(sk, &identity.PublicKey, edKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyOnionKeyCrosscert(&sk.PublicKey, &identity.PublicKey, edKey, sig); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNTorOnionKeyCrosscert(t *testing.T) {
+	var identity Ed25519Pubkey
+	rand.Read(identity[:])
+	for i := 0; i < 4; i++ {
+		kp, err := GenerateNTorKeypair(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert, signBit := NewNTorOnionKeyCrosscert(kp, identity, time.Now().Add(time.Hour))
+		parsed, err := ParseCertFromBytes(cert.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := VerifyNTorOnionKeyCrosscert(&parsed, kp.Public, signBit, identity); err != nil {
+			t.Fatal(err)
+		}
+		if VerifyNTorOnionKeyCrosscert(&parsed, kp.Public, signBit^1, identity) == nil {
+			t.Fatal("cross-certificate verified with wrong sign bit")
+		}
+	}
+}
+
+func TestNTorEd25519Key(t *testing.T) {
+	kp, err := GenerateNTorKeypair(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	esk, signBit := kp.Ed25519Key()
+	if !bytes.Equal(esk[:32], kp.Private[:]) {
+		t.Fatal("secret scalar differs from the curve25519 one")
+	}
+	pk, err := kp.Public.Ed25519Key(signBit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(esk.Public().(ed25519.PublicKey), pk) {
+		t.Fatal("Ed25519 key is not equivalent to the curve25519 key")
+	}
+}
@@ -0,0 +1,93 @@
+// descreader.go - read onion service descriptors from a stream
+//
+// To the extent possible under law, Ivan Markin waived all copyright
+// and related or neighboring rights to this module of onionutil, using the creative
+// commons "cc0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package onionutil
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+
+	"github.com/nogoegst/onionutil/torparse"
+)
+
+var descriptorStart = []byte("rendezvous-service-descriptor ")
+
+// DescriptorReader reads v2 onion service descriptors one by one
+// without loading the whole input into memory.
+type DescriptorReader struct {
+	r    *bufio.Reader
+	next []byte
+	raw  []byte
+	err  error
+}
+
+// NewDescriptorReader returns reader of descriptors from r which
+// may be compressed (see Decompress).
+func NewDescriptorReader(r io.Reader) *DescriptorReader {
+	dr, err := Decompress(r)
+	if err != nil {
+		return &DescriptorReader{err: err}
+	}
+	return &DescriptorReader{r: bufio.NewReader(dr)}
+}
+
+// readLine returns the next line including the newline.
+func (dr *DescriptorReader) readLine() ([]byte, error) {
+	if dr.next != nil {
+		line := dr.next
+		dr.next = nil
+		return line, nil
+	}
+	line, err := dr.r.ReadBytes('\n')
+	if err == io.EOF && len(line) > 0 {
+		return line, nil
+	}
+	return line, err
+}
+
+// Next returns the next descriptor. It returns io.EOF if there
+// are no descriptors left. Malformed descriptors are reported with
+// an error and reading may be continued.
+func (dr *DescriptorReader) Next() (*OnionDescriptor, error) {
+	if dr.err != nil {
+		return nil, dr.err
+	}
+	var raw []byte
+	for {
+		line, err := dr.readLine()
+		if err != nil {
+			dr.err = err
+			break
+		}
+		if bytes.HasPrefix(line, descriptorStart) {
+			if raw != nil {
+				dr.next = line
+				break
+			}
+		} else if raw == nil {
+			/* Skip everything before the first descriptor */
+			continue
+		}
+		raw = append(raw, line...)
+	}
+	if raw == nil {
+		return nil, dr.err
+	}
+	dr.raw = raw
+	docs, _ := torparse.ParseTorDocument(raw)
+	if len(docs) != 1 {
+		return nil, errors.New("Malformed descriptor")
+	}
+	return parseOnionDescriptor(docs[0])
+}
+
+// Raw returns encoding of the descriptor last read by Next.
+func (dr *DescriptorReader) Raw() []byte {
+	return dr.raw
+}
@@ -0,0 +1,37 @@
+package onionutil
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/nogoegst/onionutil/testvectors"
+)
+
+func TestDescriptorReader(t *testing.T) {
+	desc := []byte(testvectors.ServiceDescriptorV2.Data)
+	data := append([]byte("@type hidden-service-descriptor 1.0\n"), desc...)
+	data = append(data, []byte("rendezvous-service-descriptor garbage\n")...)
+	data = append(data, desc...)
+
+	dr := NewDescriptorReader(bytes.NewReader(data))
+	if _, err := dr.Next(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(dr.Raw(), desc) {
+		t.Fatal("wrong raw descriptor")
+	}
+	if _, err := dr.Next(); err == nil {
+		t.Fatal("malformed descriptor is accepted")
+	}
+	parsed, err := dr.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := parsed.Verify(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dr.Next(); err != io.EOF {
+		t.Fatalf("expected io.EOF, got %v", err)
+	}
+}
@@ -0,0 +1,108 @@
+// describe.go - diagnostic reports on onion addresses
+//
+// To the extent possible under law, Ivan Markin waived all copyright
+// and related or neighboring rights to this module of onionutil, using the creative
+// commons "cc0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package onionutil
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+// AddressInfo is a report on an onion address made by DescribeAddress.
+type AddressInfo struct {
+	// Address is the onion address without subdomains
+	// and ".onion" suffix.
+	Address string
+	// Version is 2 or 3 as guessed by the length of the address
+	// or 0 if the length is wrong.
+	Version int
+	Valid   bool
+	// Err tells why the address is not valid.
+	Err error
+	// PermID is the permanent ID embedded in v2 address.
+	PermID []byte
+	// Pubkey and Checksum are embedded in v3 address. They are
+	// set even if the checksum is wrong.
+	Pubkey   ed25519.PublicKey
+	Checksum []byte
+	// HSDirProtocol is the version of HSDir subprotocol which
+	// relays storing descriptors of the service support.
+	HSDirProtocol int
+	// Deprecated is set for v2 addresses: Tor doesn't support
+	// them since 0.4.6.
+	Deprecated bool
+}
+
+// DescribeAddress reports what addr is and why it's invalid if it is.
+// ".onion" suffix and subdomains are optional like in ParseOnionAddress.
+func DescribeAddress(addr string) *AddressInfo {
+	addr = strings.ToLower(addr)
+	addr = strings.TrimSuffix(addr, ".onion")
+	if i := strings.LastIndex(addr, "."); i >= 0 {
+		addr = addr[i+1:]
+	}
+	info := &AddressInfo{Address: addr}
+	switch len(addr) {
+	case Base32EncodedLen(OnionAddressLengthV2):
+		info.Version = 2
+		info.HSDirProtocol = ProtoHSDirV2
+		info.Deprecated = true
+	case Base32EncodedLen(OnionAddressLengthV3):
+		info.Version = 3
+		info.HSDirProtocol = ProtoHSDirV3
+	default:
+		info.Err = addressError("wrong length")
+		return info
+	}
+	oa, err := Base32Decode(addr)
+	if err != nil {
+		info.Err = addressError("malformed base32")
+		return info
+	}
+	if info.Version == 2 {
+		info.PermID = oa
+		info.Valid = true
+		return info
+	}
+	info.Pubkey = ed25519.PublicKey(oa[:ed25519.PublicKeySize])
+	info.Checksum = oa[ed25519.PublicKeySize : ed25519.PublicKeySize+OnionAddressChecksumLengthV3]
+	version := oa[len(oa)-OnionAddressVersionFieldLengthV3:]
+	switch {
+	case !bytes.Equal(version, OnionAddressVersionFieldV3):
+		info.Err = addressError(fmt.Sprintf("wrong version %d", version[0]))
+	case !VerifyOnionChecksum(info.Pubkey, version[0], info.Checksum):
+		info.Err = addressError("wrong checksum")
+	default:
+		info.Valid = true
+	}
+	return info
+}
+
+func (info *AddressInfo) String() string {
+	if info.Version == 0 {
+		return fmt.Sprintf("%s: %v", info.Address, info.Err)
+	}
+	s := fmt.Sprintf("%s: v%d", info.Address, info.Version)
+	if info.Deprecated {
+		s += " (deprecated)"
+	}
+	if info.Valid {
+		s += ", valid"
+	} else {
+		s += fmt.Sprintf(", %v", info.Err)
+	}
+	switch {
+	case info.PermID != nil:
+		s += fmt.Sprintf(", permanent ID %x", info.PermID)
+	case info.Pubkey != nil:
+		s += fmt.Sprintf(", key %x, checksum %x", []byte(info.Pubkey), info.Checksum)
+	}
+	return s + fmt.Sprintf(", HSDir=%d", info.HSDirProtocol)
+}
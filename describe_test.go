@@ -0,0 +1,35 @@
+package onionutil
+
+import (
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+func TestDescribeAddress(t *testing.T) {
+	info := DescribeAddress("www." + testAddressV3 + ".onion")
+	if !info.Valid || info.Version != 3 || info.Deprecated || info.HSDirProtocol != ProtoHSDirV3 {
+		t.Fatalf("wrong info: %v", info)
+	}
+	if hex.EncodeToString(info.Pubkey) != testPubkeyV3Hex {
+		t.Fatalf("wrong key: %x", []byte(info.Pubkey))
+	}
+
+	info = DescribeAddress("6iedtc4w36h35ln3")
+	if !info.Valid || info.Version != 2 || !info.Deprecated || info.HSDirProtocol != ProtoHSDirV2 {
+		t.Fatalf("wrong info: %v", info)
+	}
+
+	/* Change the last character of the key part */
+	broken := []byte(testAddressV3)
+	broken[51] = 'a'
+	info = DescribeAddress(string(broken))
+	if info.Valid || info.Version != 3 || info.Pubkey == nil || !errors.Is(info.Err, ErrInvalidAddress) {
+		t.Fatalf("wrong info: %v", info)
+	}
+
+	info = DescribeAddress("abc.onion")
+	if info.Valid || info.Version != 0 || info.Err == nil {
+		t.Fatalf("wrong info: %v", info)
+	}
+}
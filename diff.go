@@ -0,0 +1,245 @@
+// diff.go - compare versions of descriptors
+//
+// To the extent possible under law, Ivan Markin waived all copyright
+// and related or neighboring rights to this module of onionutil, using the creative
+// commons "cc0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package onionutil
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Change is a changed field of a descriptor.
+type Change struct {
+	Field string
+	Old   string
+	New   string
+}
+
+func (c Change) String() string {
+	return fmt.Sprintf("%s: %q -> %q", c.Field, c.Old, c.New)
+}
+
+// DescriptorDiff is a difference between two versions of a descriptor.
+type DescriptorDiff struct {
+	Changes []Change
+	// IntroPointsAdded and IntroPointsRemoved are identities of
+	// introduction points in base32 (v2) or their authentication
+	// keys in base64 (v3).
+	IntroPointsAdded   []string
+	IntroPointsRemoved []string
+}
+
+// Empty reports whether the versions are the same.
+func (d *DescriptorDiff) Empty() bool {
+	return len(d.Changes) == 0 && len(d.IntroPointsAdded) == 0 &&
+		len(d.IntroPointsRemoved) == 0
+}
+
+func (d *DescriptorDiff) String() string {
+	var lines []string
+	for _, c := range d.Changes {
+		lines = append(lines, c.String())
+	}
+	for _, id := range d.IntroPointsAdded {
+		lines = append(lines, "introduction point added: "+id)
+	}
+	for _, id := range d.IntroPointsRemoved {
+		lines = append(lines, "introduction point removed: "+id)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (d *DescriptorDiff) compare(field, prev, next string) {
+	if prev != next {
+		d.Changes = append(d.Changes, Change{Field: field, Old: prev, New: next})
+	}
+}
+
+// compareIntroPoints records added and removed introduction points
+// of maps from identities to keys and changes of their keys.
+func (d *DescriptorDiff) compareIntroPoints(keyField string, prev, next map[string]string) {
+	var ids []string
+	for id := range prev {
+		ids = append(ids, id)
+	}
+	for id := range next {
+		if _, ok := prev[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		prevKey, inPrev := prev[id]
+		nextKey, inNext := next[id]
+		switch {
+		case !inPrev:
+			d.IntroPointsAdded = append(d.IntroPointsAdded, id)
+		case !inNext:
+			d.IntroPointsRemoved = append(d.IntroPointsRemoved, id)
+		default:
+			d.compare(keyField+" "+id, prevKey, nextKey)
+		}
+	}
+}
+
+// rsaKeyID returns hex fingerprint of pk or empty string.
+func rsaKeyID(pk *rsa.PublicKey) string {
+	if pk == nil {
+		return ""
+	}
+	hash, err := RSAPubkeyHash(pk)
+	if err != nil {
+		return ""
+	}
+	return HexFingerprint(hash)
+}
+
+func formatInts(ints []int) string {
+	strs := make([]string, len(ints))
+	for i, n := range ints {
+		strs[i] = strconv.Itoa(n)
+	}
+	return strings.Join(strs, ",")
+}
+
+// DiffOnionDescriptors compares versions of v2 descriptor. Rotation
+// of the permanent key is reported as a change of onion address.
+// Introduction points must not be encrypted.
+func DiffOnionDescriptors(prev, next *OnionDescriptor) (*DescriptorDiff, error) {
+	d := new(DescriptorDiff)
+	prevAddr, _ := OnionAddressV2(prev.PermanentKey)
+	nextAddr, _ := OnionAddressV2(next.PermanentKey)
+	d.compare("onion-address", prevAddr, nextAddr)
+	d.compare("publication-time", prev.PublicationTime.UTC().Format(PublicationTimeFormat),
+		next.PublicationTime.UTC().Format(PublicationTimeFormat))
+	d.compare("protocol-versions", formatInts(prev.ProtocolVersions), formatInts(next.ProtocolVersions))
+	prevIPs, err := introPointKeys(prev)
+	if err != nil {
+		return nil, err
+	}
+	nextIPs, err := introPointKeys(next)
+	if err != nil {
+		return nil, err
+	}
+	d.compareIntroPoints("service-key", prevIPs, nextIPs)
+	return d, nil
+}
+
+func introPointKeys(desc *OnionDescriptor) (map[string]string, error) {
+	ips, err := desc.IntroPoints()
+	if err != nil {
+		return nil, err
+	}
+	keys := make(map[string]string)
+	for _, ip := range ips {
+		keys[Base32Encode(ip.Identity)] = rsaKeyID(ip.ServiceKey)
+	}
+	return keys, nil
+}
+
+// DiffOnionDescriptorsV3 compares outer layers of versions of v3
+// descriptor. Rotation of the descriptor signing key is reported
+// as a change of signing-key.
+func DiffOnionDescriptorsV3(prev, next *OnionDescriptorV3) *DescriptorDiff {
+	d := new(DescriptorDiff)
+	d.compare("descriptor-lifetime", prev.Lifetime.String(), next.Lifetime.String())
+	d.compare("revision-counter", strconv.FormatUint(prev.RevisionCounter, 10),
+		strconv.FormatUint(next.RevisionCounter, 10))
+	d.compare("signing-key", base64.StdEncoding.EncodeToString(prev.SigningKey()),
+		base64.StdEncoding.EncodeToString(next.SigningKey()))
+	return d
+}
+
+// DiffEncryptedLayersV3 compares decrypted inner layers of versions
+// of v3 descriptor. Rotation of encryption keys of introduction
+// points is reported as a change of enc-key.
+func DiffEncryptedLayersV3(prev, next *EncryptedLayerV3) (*DescriptorDiff, error) {
+	d := new(DescriptorDiff)
+	d.compare("create2-formats", formatInts(prev.Create2Formats), formatInts(next.Create2Formats))
+	d.compare("intro-auth-required", strings.Join(prev.IntroAuthRequired, " "),
+		strings.Join(next.IntroAuthRequired, " "))
+	d.compare("single-onion-service", strconv.FormatBool(prev.SingleOnionService),
+		strconv.FormatBool(next.SingleOnionService))
+	prevIPs, err := introPointKeysV3(prev)
+	if err != nil {
+		return nil, err
+	}
+	nextIPs, err := introPointKeysV3(next)
+	if err != nil {
+		return nil, err
+	}
+	d.compareIntroPoints("enc-key", prevIPs, nextIPs)
+	return d, nil
+}
+
+func introPointKeysV3(layer *EncryptedLayerV3) (map[string]string, error) {
+	ips, err := layer.IntroductionPoints()
+	if err != nil {
+		return nil, err
+	}
+	keys := make(map[string]string)
+	for _, ip := range ips {
+		if ip.AuthKeyCert == nil {
+			return nil, errors.New("Introduction point has no auth-key")
+		}
+		keys[base64.StdEncoding.EncodeToString(ip.AuthKeyCert.CertifiedKey[:])] = ip.EncKey.String()
+	}
+	return keys, nil
+}
+
+// DiffRouterDescriptors compares versions of router descriptor.
+// Keys are compared by their fingerprints or encodings.
+func DiffRouterDescriptors(prev, next *RouterDescriptor) *DescriptorDiff {
+	d := new(DescriptorDiff)
+	d.compare("nickname", prev.Nickname, next.Nickname)
+	d.compare("address", prev.InternetAddress.String(), next.InternetAddress.String())
+	d.compare("or-port", strconv.Itoa(int(prev.ORPort)), strconv.Itoa(int(next.ORPort)))
+	d.compare("dir-port", strconv.Itoa(int(prev.DirPort)), strconv.Itoa(int(next.DirPort)))
+	d.compare("or-address", formatORAddrs(prev), formatORAddrs(next))
+	d.compare("bandwidth", prev.Bandwidth.String(), next.Bandwidth.String())
+	d.compare("platform", prev.Platform.String(), next.Platform.String())
+	d.compare("proto", prev.Protocols.String(), next.Protocols.String())
+	d.compare("contact", prev.Contact, next.Contact)
+	d.compare("hibernating", strconv.FormatBool(prev.Hibernating), strconv.FormatBool(next.Hibernating))
+	d.compare("signing-key", rsaKeyID(prev.SigningKey), rsaKeyID(next.SigningKey))
+	d.compare("onion-key", rsaKeyID(prev.OnionKey), rsaKeyID(next.OnionKey))
+	d.compare("ntor-onion-key", prev.NTorOnionKey.String(), next.NTorOnionKey.String())
+	d.compare("master-key-ed25519", base64.RawStdEncoding.EncodeToString(prev.MasterKeyEd25519[:]),
+		base64.RawStdEncoding.EncodeToString(next.MasterKeyEd25519[:]))
+	d.compare("family", familyString(prev), familyString(next))
+	d.compare("exit-policy", prev.Policy.String(), next.Policy.String())
+	d.compare("ipv6-policy", exit6PolicyString(prev), exit6PolicyString(next))
+	return d
+}
+
+func formatORAddrs(desc *RouterDescriptor) string {
+	addrs := make([]string, len(desc.ORAddrs))
+	for i, addr := range desc.ORAddrs {
+		addrs[i] = addr.String()
+	}
+	return strings.Join(addrs, " ")
+}
+
+func familyString(desc *RouterDescriptor) string {
+	family, err := desc.FamilyMembers()
+	if err != nil {
+		return strings.Join(desc.Family, " ")
+	}
+	return family.String()
+}
+
+func exit6PolicyString(desc *RouterDescriptor) string {
+	if desc.Exit6Policy == nil {
+		return ""
+	}
+	return desc.Exit6Policy.String()
+}
@@ -0,0 +1,70 @@
+// diff_test.go - tests for descriptor diffing
+//
+// To the extent possible under law, Ivan Markin waived all copyright
+// and related or neighboring rights to this module of onionutil, using the creative
+// commons "cc0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package onionutil
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestDiffOnionDescriptors(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotated, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ip := func(id byte, serviceKey *rsa.PrivateKey) IntroductionPoint {
+		return IntroductionPoint{
+			Identity:        []byte{id, 0, 0, 0, 0, 0, 0, 0, 0, 0},
+			InternetAddress: net.IPv4(192, 0, 2, id),
+			OnionPort:       9001,
+			OnionKey:        &key.PublicKey,
+			ServiceKey:      &serviceKey.PublicKey,
+		}
+	}
+	now := time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC)
+	prev, err := GenerateDescriptorSet(key, []IntroductionPoint{ip(1, key), ip(2, key)}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	next, err := GenerateDescriptorSet(key, []IntroductionPoint{ip(2, rotated), ip(3, key)}, now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := DiffOnionDescriptors(prev[0], next[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(d.IntroPointsAdded) != 1 || d.IntroPointsAdded[0] != Base32Encode(ip(3, key).Identity) ||
+		len(d.IntroPointsRemoved) != 1 || d.IntroPointsRemoved[0] != Base32Encode(ip(1, key).Identity) {
+		t.Fatalf("wrong introduction points diff:\n%s", d)
+	}
+	if len(d.Changes) != 2 || d.Changes[0].Field != "publication-time" ||
+		d.Changes[1].Field != "service-key "+Base32Encode(ip(2, key).Identity) {
+		t.Fatalf("wrong changes:\n%s", d)
+	}
+	if d, _ := DiffOnionDescriptors(prev[0], prev[0]); !d.Empty() {
+		t.Fatalf("same descriptor differs:\n%s", d)
+	}
+}
+
+func TestDiffRouterDescriptors(t *testing.T) {
+	prev := &RouterDescriptor{Nickname: "relay", Bandwidth: Bandwidth{1, 2, 3}}
+	next := &RouterDescriptor{Nickname: "relay", Bandwidth: Bandwidth{1, 2, 4}}
+	d := DiffRouterDescriptors(prev, next)
+	if len(d.Changes) != 1 || d.Changes[0].Field != "bandwidth" ||
+		d.Changes[0].New != "bandwidth 1 2 4" {
+		t.Fatalf("wrong changes:\n%s", d)
+	}
+}
@@ -0,0 +1,78 @@
+// digest.go - digest algorithms of Tor documents
+//
+// To the extent possible under law, Ivan Markin waived all copyright
+// and related or neighboring rights to this module of onionutil, using the creative
+// commons "cc0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package onionutil
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"fmt"
+	"hash"
+
+	"golang.org/x/crypto/sha3"
+)
+
+// DigestAlgorithm is a hash function used to digest Tor documents
+// and keys. SHA-1 is used in legacy (v2 and RSA) paths only.
+type DigestAlgorithm int
+
+const (
+	DigestSHA1 DigestAlgorithm = iota
+	DigestSHA256
+	DigestSHA3_256
+)
+
+var digestAlgorithmNames = []string{
+	DigestSHA1:     "sha1",
+	DigestSHA256:   "sha256",
+	DigestSHA3_256: "sha3-256",
+}
+
+// ParseDigestAlgorithm returns algorithm named name as in Tor
+// documents (like in "directory-signature" or "shared-rand-commit"
+// lines).
+func ParseDigestAlgorithm(name string) (DigestAlgorithm, error) {
+	for alg, algName := range digestAlgorithmNames {
+		if algName == name {
+			return DigestAlgorithm(alg), nil
+		}
+	}
+	return 0, fmt.Errorf("Unknown digest algorithm %s", name)
+}
+
+func (alg DigestAlgorithm) String() string {
+	if alg < 0 || int(alg) >= len(digestAlgorithmNames) {
+		return fmt.Sprintf("DigestAlgorithm(%d)", int(alg))
+	}
+	return digestAlgorithmNames[alg]
+}
+
+// New returns a new hash computing alg. It panics
+// if alg is unknown.
+func (alg DigestAlgorithm) New() hash.Hash {
+	switch alg {
+	case DigestSHA1:
+		return sha1.New()
+	case DigestSHA256:
+		return sha256.New()
+	case DigestSHA3_256:
+		return sha3.New256()
+	}
+	panic("onionutil: unknown digest algorithm")
+}
+
+// Size returns length of digests in bytes.
+func (alg DigestAlgorithm) Size() int {
+	return alg.New().Size()
+}
+
+// Sum returns digest of data.
+func (alg DigestAlgorithm) Sum(data []byte) []byte {
+	h := alg.New()
+	h.Write(data)
+	return h.Sum(nil)
+}
@@ -0,0 +1,33 @@
+package onionutil
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestDigestAlgorithm(t *testing.T) {
+	vectors := []struct {
+		name   string
+		digest string
+	}{
+		{"sha1", "a9993e364706816aba3e25717850c26c9cd0d89d"},
+		{"sha256", "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"},
+		{"sha3-256", "3a985da74fe225b2045c172d6bd390bd855f086e3e9d525b46bfe24511431532"},
+	}
+	for _, v := range vectors {
+		alg, err := ParseDigestAlgorithm(v.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if alg.String() != v.name {
+			t.Fatalf("Wrong name of %s: %s", v.name, alg)
+		}
+		digest := alg.Sum([]byte("abc"))
+		if hex.EncodeToString(digest) != v.digest || len(digest) != alg.Size() {
+			t.Fatalf("Wrong %s digest: %x", v.name, digest)
+		}
+	}
+	if _, err := ParseDigestAlgorithm("md5"); err == nil {
+		t.Fatal("Unknown algorithm has been accepted")
+	}
+}
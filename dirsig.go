@@ -0,0 +1,81 @@
+// dirsig.go - verify directory signatures of network status documents
+//
+// To the extent possible under law, Ivan Markin waived all copyright
+// and related or neighboring rights to this module of onionutil, using the creative
+// commons "cc0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package onionutil
+
+import (
+	"bytes"
+	"crypto"
+	"errors"
+	"fmt"
+)
+
+var directorySignatureKeyword = []byte("\ndirectory-signature ")
+
+// SignedDigest returns digest of the signed part of the document
+// (from its beginning through the space after the first
+// "directory-signature" keyword) using algorithm.
+func (c *Consensus) SignedDigest(algorithm string) ([]byte, error) {
+	end := bytes.Index(c.Raw, directorySignatureKeyword)
+	if end < 0 {
+		return nil, errors.New("Document is not signed")
+	}
+	signed := c.Raw[:end+len(directorySignatureKeyword)]
+	alg, err := ParseDigestAlgorithm(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	return alg.Sum(signed), nil
+}
+
+// VerifySignature checks signature sig of the document made with
+// signing key certified by key certificate kc.
+func (c *Consensus) VerifySignature(sig DirectorySignature, kc *KeyCertificate) error {
+	if !bytes.Equal(sig.Identity, kc.Fingerprint[:]) {
+		return signatureError("made by another authority")
+	}
+	signingKeyDigest, err := kc.SigningKeyDigest()
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(sig.SigningKeyDigest, signingKeyDigest) {
+		return signatureError("made with another signing key")
+	}
+	digest, err := c.SignedDigest(sig.Algorithm)
+	if err != nil {
+		return err
+	}
+	/* The digest is signed without DigestInfo (dir-spec 1.3) */
+	return verifyPKCS1v15(kc.SigningKey, crypto.Hash(0), digest, sig.Signature)
+}
+
+// VerifySignatures checks signatures of the document with key
+// certificates kcs and returns an error unless at least threshold
+// distinct authorities have signed it. Certificates which are
+// invalid at the time the document becomes valid are ignored.
+func (c *Consensus) VerifySignatures(kcs []*KeyCertificate, threshold int) error {
+	var valid []*KeyCertificate
+	for _, kc := range kcs {
+		if kc.Validate(c.ValidAfter) == nil {
+			valid = append(valid, kc)
+		}
+	}
+	signed := make(map[Fingerprint]bool)
+	for _, sig := range c.Signatures {
+		for _, kc := range valid {
+			if c.VerifySignature(sig, kc) == nil {
+				signed[kc.Fingerprint] = true
+				break
+			}
+		}
+	}
+	if len(signed) < threshold {
+		return fmt.Errorf("Document is signed by %d of %d required authorities",
+			len(signed), threshold)
+	}
+	return nil
+}
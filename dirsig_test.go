@@ -0,0 +1,57 @@
+package onionutil
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestConsensusVerifySignatures(t *testing.T) {
+	identity, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signing, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kc, err := ParseKeyCertificate(testKeyCertificate(t, identity, signing,
+		time.Date(2018, 12, 1, 0, 0, 0, 0, time.UTC)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	signingKeyDigest, _ := kc.SigningKeyDigest()
+
+	end := bytes.Index(testConsensus, []byte("directory-signature "))
+	w := bytes.NewBuffer(append([]byte{}, testConsensus[:end]...))
+	w.WriteString("directory-signature ")
+	digest := sha256.Sum256(w.Bytes())
+	sig, err := rsa.SignPKCS1v15(nil, signing, crypto.Hash(0), digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Fprintf(w, "sha256 %s %s\n", kc.Fingerprint, hex.EncodeToString(signingKeyDigest))
+	pem.Encode(w, &pem.Block{Type: "SIGNATURE", Bytes: sig})
+
+	c, err := ParseConsensus(w.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.VerifySignatures([]*KeyCertificate{kc}, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.VerifySignatures([]*KeyCertificate{kc}, 2); err == nil {
+		t.Fatal("threshold is not enforced")
+	}
+	c.Raw = bytes.Replace(c.Raw, []byte("Wbd=0"), []byte("Wbd=1"), 1)
+	if err := c.VerifySignatures([]*KeyCertificate{kc}, 1); err == nil {
+		t.Fatal("tampered consensus verified")
+	}
+}
@@ -0,0 +1,91 @@
+// dirurl.go - build resource paths of the Tor directory protocol
+//
+// To the extent possible under law, Ivan Markin waived all copyright
+// and related or neighboring rights to this module of onionutil, using the creative
+// commons "cc0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package onionutil
+
+import (
+	"encoding/base64"
+	"sort"
+	"strings"
+)
+
+// Resource paths which don't depend on any identifiers (see dir-spec).
+const (
+	ConsensusPath          = "/tor/status-vote/current/consensus"
+	MicrodescConsensusPath = "/tor/status-vote/current/consensus-microdesc"
+	AllServerDescsPath     = "/tor/server/all"
+	RendezvousPublishPath  = "/tor/rendezvous2/publish"
+	HSPublishPathV3        = "/tor/hs/3/publish"
+)
+
+// Batching limits that little-t-tor uses when it requests many
+// documents at once. Directory caches may refuse longer requests.
+var (
+	MaxServerDescsPerRequest = 96
+	MaxMicrodescsPerRequest  = 92
+)
+
+// batchPaths joins ids with sep into paths starting with prefix.
+// Each path contains at most max ids. ids are sorted in the
+// same manner as little-t-tor does to increase cache hits.
+func batchPaths(prefix, sep string, ids []string, max int) (paths []string) {
+	ids = append([]string(nil), ids...)
+	sort.Strings(ids)
+	for len(ids) > 0 {
+		n := len(ids)
+		if max > 0 && n > max {
+			n = max
+		}
+		paths = append(paths, prefix+strings.Join(ids[:n], sep))
+		ids = ids[n:]
+	}
+	return paths
+}
+
+// ServerDescriptorPaths returns paths to fetch server descriptors
+// of relays with identity fingerprints fps
+// (/tor/server/fp/<F1>+<F2>+...).
+func ServerDescriptorPaths(fps [][]byte) []string {
+	ids := make([]string, 0, len(fps))
+	for _, fp := range fps {
+		ids = append(ids, HexFingerprint(fp))
+	}
+	return batchPaths("/tor/server/fp/", "+", ids, MaxServerDescsPerRequest)
+}
+
+// ServerDescriptorDigestPaths returns paths to fetch server descriptors
+// by their SHA1 digests (/tor/server/d/<D1>+<D2>+...).
+func ServerDescriptorDigestPaths(digests [][]byte) []string {
+	ids := make([]string, 0, len(digests))
+	for _, d := range digests {
+		ids = append(ids, HexFingerprint(d))
+	}
+	return batchPaths("/tor/server/d/", "+", ids, MaxServerDescsPerRequest)
+}
+
+// MicrodescriptorPaths returns paths to fetch microdescriptors by
+// their SHA256 digests (/tor/micro/d/<D1>-<D2>-...). Digests are
+// encoded in base64 without trailing "=".
+func MicrodescriptorPaths(digests [][]byte) []string {
+	ids := make([]string, 0, len(digests))
+	for _, d := range digests {
+		ids = append(ids, base64.RawStdEncoding.EncodeToString(d))
+	}
+	return batchPaths("/tor/micro/d/", "-", ids, MaxMicrodescsPerRequest)
+}
+
+// RendezvousDescriptorPath returns path to fetch v2 onion service
+// descriptor with descriptor ID descID.
+func RendezvousDescriptorPath(descID []byte) string {
+	return "/tor/rendezvous2/" + Base32Encode(descID)
+}
+
+// HSDescriptorPathV3 returns path to fetch v3 onion service
+// descriptor with blinded public key blindedKey.
+func HSDescriptorPathV3(blindedKey []byte) string {
+	return "/tor/hs/3/" + base64.StdEncoding.EncodeToString(blindedKey)
+}
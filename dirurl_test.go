@@ -0,0 +1,126 @@
+package onionutil
+
+import (
+	"bytes"
+	"encoding/base64"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestBatchPaths(t *testing.T) {
+	for _, tt := range []struct {
+		ids   []string
+		max   int
+		paths []string
+	}{
+		{nil, 2, nil},
+		{[]string{"a"}, 2, []string{"/p/a"}},
+		{[]string{"b", "a"}, 2, []string{"/p/a+b"}},
+		{[]string{"c", "b", "a"}, 2, []string{"/p/a+b", "/p/c"}},
+		{[]string{"d", "c", "b", "a"}, 2, []string{"/p/a+b", "/p/c+d"}},
+		{[]string{"e", "d", "c", "b", "a"}, 2, []string{"/p/a+b", "/p/c+d", "/p/e"}},
+		{[]string{"c", "b", "a"}, 1, []string{"/p/a", "/p/b", "/p/c"}},
+		{[]string{"c", "b", "a"}, 0, []string{"/p/a+b+c"}},
+	} {
+		ids := append([]string(nil), tt.ids...)
+		paths := batchPaths("/p/", "+", tt.ids, tt.max)
+		if !reflect.DeepEqual(paths, tt.paths) {
+			t.Fatalf("%v by %d: wrong paths %v", tt.ids, tt.max, paths)
+		}
+		if !reflect.DeepEqual(ids, tt.ids) {
+			t.Fatal("batchPaths modifies ids")
+		}
+	}
+}
+
+func testDigests(n, size int) [][]byte {
+	digests := make([][]byte, n)
+	for i := range digests {
+		digests[i] = bytes.Repeat([]byte{byte(n - i)}, size)
+	}
+	return digests
+}
+
+func TestServerDescriptorPaths(t *testing.T) {
+	max := MaxServerDescsPerRequest
+	for _, tt := range []struct {
+		n       int
+		batches []int
+	}{
+		{0, nil},
+		{1, []int{1}},
+		{max - 1, []int{max - 1}},
+		{max, []int{max}},
+		{max + 1, []int{max, 1}},
+		{2 * max, []int{max, max}},
+		{2*max + 1, []int{max, max, 1}},
+	} {
+		fps := testDigests(tt.n, 20)
+		for _, f := range []struct {
+			prefix string
+			paths  func([][]byte) []string
+		}{
+			{"/tor/server/fp/", ServerDescriptorPaths},
+			{"/tor/server/d/", ServerDescriptorDigestPaths},
+		} {
+			paths := f.paths(fps)
+			if len(paths) != len(tt.batches) {
+				t.Fatalf("%d ids: %d paths, expected %d", tt.n, len(paths), len(tt.batches))
+			}
+			var all []string
+			for i, path := range paths {
+				if !strings.HasPrefix(path, f.prefix) {
+					t.Fatalf("wrong path prefix: %s", path)
+				}
+				ids := strings.Split(strings.TrimPrefix(path, f.prefix), "+")
+				if len(ids) != tt.batches[i] {
+					t.Fatalf("%d ids: batch %d has %d ids", tt.n, i, len(ids))
+				}
+				all = append(all, ids...)
+			}
+			for i, id := range all {
+				if id != HexFingerprint(fps[len(fps)-1-i]) {
+					t.Fatalf("%d ids: wrong id %d: %s", tt.n, i, id)
+				}
+			}
+		}
+	}
+}
+
+func TestMicrodescriptorPaths(t *testing.T) {
+	max := MaxMicrodescsPerRequest
+	for _, tt := range []struct {
+		n       int
+		batches []int
+	}{
+		{0, nil},
+		{1, []int{1}},
+		{max, []int{max}},
+		{max + 1, []int{max, 1}},
+		{2*max + 1, []int{max, max, 1}},
+	} {
+		digests := testDigests(tt.n, 32)
+		paths := MicrodescriptorPaths(digests)
+		if len(paths) != len(tt.batches) {
+			t.Fatalf("%d ids: %d paths, expected %d", tt.n, len(paths), len(tt.batches))
+		}
+		var all []string
+		for i, path := range paths {
+			ids := strings.Split(strings.TrimPrefix(path, "/tor/micro/d/"), "-")
+			if len(ids) != tt.batches[i] {
+				t.Fatalf("%d ids: batch %d has %d ids", tt.n, i, len(ids))
+			}
+			all = append(all, ids...)
+		}
+		var expected []string
+		for _, d := range digests {
+			expected = append(expected, base64.RawStdEncoding.EncodeToString(d))
+		}
+		sort.Strings(expected)
+		if !reflect.DeepEqual(all, expected) {
+			t.Fatalf("%d ids: wrong ids", tt.n)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package onionutil
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/nogoegst/onionutil/torparse"
+)
+
+const testDocument = "doc 1\n" +
+	"item a b\n" +
+	"object\n" +
+	"-----BEGIN MESSAGE-----\n" +
+	"AQID\n" +
+	"-----END MESSAGE-----\n" +
+	"item c\n" +
+	"signature sig\n"
+
+func parseTestDocument(t *testing.T) torparse.TorDocument {
+	docs, _ := torparse.ParseTorDocument([]byte(testDocument))
+	if len(docs) != 1 {
+		t.Fatalf("parsed %d documents", len(docs))
+	}
+	return docs[0]
+}
+
+func TestTorDocumentItems(t *testing.T) {
+	doc := parseTestDocument(t)
+	var keywords []string
+	for _, item := range doc.Items {
+		keywords = append(keywords, item.Keyword)
+	}
+	if !reflect.DeepEqual(keywords, []string{"doc", "item", "object", "item", "signature"}) {
+		t.Fatalf("wrong order of items: %v", keywords)
+	}
+	if string(doc.Items[2].Content[0]) != "\x01\x02\x03" {
+		t.Fatal("wrong object")
+	}
+	if kws := doc.Keywords(); !reflect.DeepEqual(kws, []string{"doc", "item", "object", "signature"}) {
+		t.Fatalf("wrong keywords: %v", kws)
+	}
+	items := doc.Get("item")
+	if len(items) != 2 || string(items[0].Joined()) != "a b" || string(items[1].Joined()) != "c" {
+		t.Fatalf("wrong repeated items: %q", items)
+	}
+	if first, ok := doc.First("item"); !ok || string(first.Joined()) != "a b" {
+		t.Fatal("wrong first item")
+	}
+	if _, ok := doc.First("none"); ok {
+		t.Fatal("found missing item")
+	}
+}
+
+func TestTorDocumentRaw(t *testing.T) {
+	doc := parseTestDocument(t)
+	if string(doc.Raw) != testDocument {
+		t.Fatal("wrong raw document")
+	}
+	for _, item := range doc.Items {
+		if string(doc.Raw[item.Offset:item.Offset+len(item.Raw)]) != string(item.Raw) {
+			t.Fatalf("wrong offset of %s", item.Keyword)
+		}
+	}
+	if string(doc.Items[2].Raw) != testDocument[len("doc 1\nitem a b\n"):len(testDocument)-len("item c\nsignature sig\n")] {
+		t.Fatal("wrong raw item with object")
+	}
+	for kw, line := range map[string]int{"doc": 1, "item": 2, "object": 3, "signature": 8, "none": 0} {
+		if got := doc.Line(kw); got != line {
+			t.Fatalf("%s is at line %d, expected %d", kw, got, line)
+		}
+	}
+	signatureOffset := len(testDocument) - len("signature sig\n")
+	if got := string(doc.SignedPart("signature")); got != testDocument[:signatureOffset]+"signature " {
+		t.Fatalf("wrong signed part %q", got)
+	}
+	if got := string(doc.Preceding("signature")); got != testDocument[:signatureOffset] {
+		t.Fatalf("wrong preceding part %q", got)
+	}
+	if doc.SignedPart("none") != nil || doc.Preceding("none") != nil {
+		t.Fatal("signed part of missing item")
+	}
+}
@@ -0,0 +1,109 @@
+// encoding.go - base32, base64 and hex encodings used by Tor
+//
+// To the extent possible under law, Ivan Markin waived all copyright
+// and related or neighboring rights to this module of onionutil, using the creative
+// commons "cc0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package onionutil
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/nogoegst/onionutil/internal/encoding"
+)
+
+// Base32Encode returns lowercase padded base32 encoding of binary.
+// Padding appears only if the length of binary is not a multiple
+// of 5 bytes (onion addresses never have it).
+func Base32Encode(binary []byte) string {
+	return encoding.Base32Encode(binary)
+}
+
+// Base32Decode decodes case-insensitive padded base32 string.
+func Base32Decode(b32 string) (binary []byte, err error) {
+	return encoding.Base32Decode(b32)
+}
+
+// Base32EncodeUnpadded returns lowercase base32 encoding of binary
+// without padding.
+func Base32EncodeUnpadded(binary []byte) string {
+	return encoding.Base32EncodeUnpadded(binary)
+}
+
+// Base32DecodeUnpadded decodes case-insensitive base32 string
+// without padding.
+func Base32DecodeUnpadded(b32 string) ([]byte, error) {
+	return encoding.Base32DecodeUnpadded(b32)
+}
+
+// Base32EncodedLen returns length of base32 encoding (without
+// padding) of n bytes.
+func Base32EncodedLen(n int) int {
+	return encoding.Base32EncodedLen(n)
+}
+
+// Base32DecodeStrict decodes case-insensitive base32 string with
+// or without padding which must encode exactly n bytes. Encodings
+// with non-zero trailing bits are rejected.
+func Base32DecodeStrict(b32 string, n int) ([]byte, error) {
+	return encoding.Base32DecodeStrict(b32, n)
+}
+
+// Base64EncodeUnpadded returns base64 encoding of binary without
+// padding as used in most Tor documents.
+func Base64EncodeUnpadded(binary []byte) string {
+	return base64.RawStdEncoding.EncodeToString(binary)
+}
+
+// Base64DecodeStrict decodes base64 string with or without padding
+// which must encode exactly n bytes. Encodings with non-zero
+// trailing bits are rejected.
+func Base64DecodeStrict(b64 string, n int) ([]byte, error) {
+	s := strings.TrimRight(b64, "=")
+	if len(s) != base64.RawStdEncoding.EncodedLen(n) {
+		return nil, fmt.Errorf("Wrong length of base64 value: %d", len(s))
+	}
+	return base64.RawStdEncoding.Strict().DecodeString(s)
+}
+
+// HexFingerprint returns uppercase hex encoding of fingerprint fp
+// like in "fingerprint" lines of consensus votes and in URLs.
+func HexFingerprint(fp []byte) string {
+	return strings.ToUpper(hex.EncodeToString(fp))
+}
+
+// HexFingerprintSpaced returns uppercase hex encoding of fp in groups
+// of 4 characters separated by spaces like in "fingerprint" lines
+// of router descriptors.
+func HexFingerprintSpaced(fp []byte) string {
+	s := HexFingerprint(fp)
+	w := new(bytes.Buffer)
+	for i := 0; i < len(s); i += 4 {
+		if i > 0 {
+			w.WriteByte(' ')
+		}
+		end := i + 4
+		if end > len(s) {
+			end = len(s)
+		}
+		w.WriteString(s[i:end])
+	}
+	return w.String()
+}
+
+// ParseHexFingerprint parses case-insensitive hex encoded fingerprint
+// of n bytes with optional "$" prefix and optional spaces between
+// groups of characters.
+func ParseHexFingerprint(s string, n int) ([]byte, error) {
+	s = strings.TrimPrefix(s, "$")
+	s = strings.Replace(s, " ", "", -1)
+	if len(s) != hex.EncodedLen(n) {
+		return nil, fmt.Errorf("Wrong length of hex fingerprint: %d", len(s))
+	}
+	return hex.DecodeString(s)
+}
@@ -0,0 +1,59 @@
+package onionutil
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestBase32Strict(t *testing.T) {
+	b := []byte{0xde, 0xad, 0xbe, 0xef}
+	padded := Base32Encode(b)
+	unpadded := Base32EncodeUnpadded(b)
+	if padded != "32w353y=" || unpadded != "32w353y" {
+		t.Fatalf("unexpected encodings %q %q", padded, unpadded)
+	}
+	for _, s := range []string{padded, unpadded, "32W353Y"} {
+		dec, err := Base32DecodeStrict(s, len(b))
+		if err != nil || !bytes.Equal(dec, b) {
+			t.Fatalf("failed to decode %q: %v", s, err)
+		}
+	}
+	if _, err := Base32DecodeStrict("32w353z", len(b)); err == nil {
+		t.Fatal("non-canonical base32 accepted")
+	}
+	if _, err := Base32DecodeStrict(unpadded, len(b)+1); err == nil {
+		t.Fatal("wrong length accepted")
+	}
+}
+
+func TestBase64Strict(t *testing.T) {
+	b := []byte{0xde, 0xad, 0xbe, 0xef}
+	if Base64EncodeUnpadded(b) != "3q2+7w" {
+		t.Fatal("unexpected base64 encoding")
+	}
+	for _, s := range []string{"3q2+7w", "3q2+7w=="} {
+		if dec, err := Base64DecodeStrict(s, len(b)); err != nil || !bytes.Equal(dec, b) {
+			t.Fatalf("failed to decode %q: %v", s, err)
+		}
+	}
+	if _, err := Base64DecodeStrict("3q2+7x", len(b)); err == nil {
+		t.Fatal("non-canonical base64 accepted")
+	}
+}
+
+func TestHexFingerprint(t *testing.T) {
+	fp := bytes.Repeat([]byte{0xab, 0xcd}, 10)
+	spaced := HexFingerprintSpaced(fp)
+	if spaced != "ABCD ABCD ABCD ABCD ABCD ABCD ABCD ABCD ABCD ABCD" {
+		t.Fatalf("unexpected spaced fingerprint %q", spaced)
+	}
+	for _, s := range []string{spaced, "$" + HexFingerprint(fp), "abcd" + HexFingerprint(fp)[4:]} {
+		parsed, err := ParseHexFingerprint(s, len(fp))
+		if err != nil || !bytes.Equal(parsed, fp) {
+			t.Fatalf("failed to parse %q: %v", s, err)
+		}
+	}
+	if _, err := ParseHexFingerprint(HexFingerprint(fp[1:]), len(fp)); err == nil {
+		t.Fatal("short fingerprint accepted")
+	}
+}
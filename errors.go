@@ -0,0 +1,70 @@
+// errors.go - errors which callers can distinguish
+//
+// To the extent possible under law, Ivan Markin waived all copyright
+// and related or neighboring rights to this module of onionutil, using the creative
+// commons "cc0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package onionutil
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+
+	"github.com/nogoegst/onionutil/internal/torerr"
+	"github.com/nogoegst/onionutil/torparse"
+)
+
+// Errors which are wrapped by returned errors. Check them with errors.Is.
+var (
+	ErrInvalidAddress = torerr.ErrInvalidAddress
+	ErrBadSignature   = torerr.ErrBadSignature
+	ErrTruncated      = torerr.ErrTruncated
+	ErrTrailingData   = torerr.ErrTrailingData
+)
+
+// ParseError is an error in an item of a document.
+type ParseError struct {
+	// Line is the number of the line (starting from 1) where
+	// the item begins or 0 if it is unknown.
+	Line    int
+	Keyword string
+	Err     error
+}
+
+func (e *ParseError) Error() string {
+	if e.Line == 0 {
+		return fmt.Sprintf("Error parsing %s: %v", e.Keyword, e.Err)
+	}
+	return fmt.Sprintf("Line %d: error parsing %s: %v", e.Line, e.Keyword, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// parseError returns ParseError for the first item with keyword of doc.
+func parseError(doc torparse.TorDocument, keyword string, err error) *ParseError {
+	return &ParseError{Line: doc.Line(keyword), Keyword: keyword, Err: err}
+}
+
+func addressError(msg string) error {
+	return torerr.Address(msg)
+}
+
+func signatureError(what string) error {
+	return torerr.Signature(what)
+}
+
+// verifyPKCS1v15 is rsa.VerifyPKCS1v15 which returns ErrBadSignature.
+func verifyPKCS1v15(pk *rsa.PublicKey, hash crypto.Hash, digest, sig []byte) error {
+	if pk == nil {
+		return errors.New("No RSA public key")
+	}
+	if err := rsa.VerifyPKCS1v15(pk, hash, digest, sig); err != nil {
+		return fmt.Errorf("%w: %w", ErrBadSignature, err)
+	}
+	return nil
+}
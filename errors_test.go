@@ -0,0 +1,36 @@
+// errors_test.go - tests for distinguishable errors
+//
+// To the extent possible under law, Ivan Markin waived all copyright
+// and related or neighboring rights to this module of onionutil, using the creative
+// commons "cc0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package onionutil
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/nogoegst/onionutil/testvectors"
+)
+
+func TestErrors(t *testing.T) {
+	if _, err := ParseOnionAddress("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"); !errors.Is(err, ErrInvalidAddress) {
+		t.Fatalf("wrong error for invalid address: %v", err)
+	}
+
+	results, _ := ParseOnionDescriptors([]byte(testvectors.ServiceDescriptorV2.Data))
+	desc := results[0].Desc
+	desc.Signature[0] ^= 0xff
+	if err := desc.VerifySignature(); !errors.Is(err, ErrBadSignature) {
+		t.Fatalf("wrong error for bad signature: %v", err)
+	}
+
+	broken := bytes.Replace(testConsensus, []byte("valid-after 2019"), []byte("valid-after 20x9"), 1)
+	_, err := ParseConsensus(broken)
+	var perr *ParseError
+	if !errors.As(err, &perr) || perr.Keyword != "valid-after" || perr.Line != 4 {
+		t.Fatalf("wrong parse error: %v", err)
+	}
+}
@@ -0,0 +1,283 @@
+// establish.go - cells which set up introduction and rendezvous points
+//
+// To the extent possible under law, Ivan Markin waived all copyright
+// and related or neighboring rights to this module of onionutil, using the creative
+// commons "cc0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package onionutil
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/nogoegst/onionutil/pkcs1"
+	"golang.org/x/crypto/ed25519"
+)
+
+// introduceSessionSuffix is appended to KH in session hash
+// of legacy ESTABLISH_INTRO cells.
+var introduceSessionSuffix = []byte("INTRODUCE")
+
+// EstablishIntroV2 is ESTABLISH_INTRO cell of v2 onion services
+// (rend-spec 1.3).
+type EstablishIntroV2 struct {
+	ServiceKey *rsa.PublicKey
+	// SessionHash is SHA1(KH | "INTRODUCE").
+	SessionHash [sha1.Size]byte
+	Signature   []byte
+}
+
+func introduceSessionHash(kh []byte) (hash [sha1.Size]byte) {
+	copy(hash[:], Hash(append(append([]byte{}, kh...), introduceSessionSuffix...)))
+	return hash
+}
+
+// NewEstablishIntroV2 returns ESTABLISH_INTRO cell for circuit with
+// nonce kh signed with service key sk of the introduction point.
+// The nonce KH is derived along with keys of the circuit (the last
+// 20 bytes of key material of CREATE2 handshake).
+func NewEstablishIntroV2(sk *rsa.PrivateKey, kh []byte) (*EstablishIntroV2, error) {
+	cell := &EstablishIntroV2{
+		ServiceKey:  &sk.PublicKey,
+		SessionHash: introduceSessionHash(kh),
+	}
+	body, err := cell.body()
+	if err != nil {
+		return nil, err
+	}
+	cell.Signature, err = rsa.SignPKCS1v15(nil, sk, crypto.Hash(0), Hash(body))
+	if err != nil {
+		return nil, err
+	}
+	return cell, nil
+}
+
+func (cell *EstablishIntroV2) body() ([]byte, error) {
+	der, err := pkcs1.EncodePublicKeyDER(cell.ServiceKey)
+	if err != nil {
+		return nil, err
+	}
+	w := new(bytes.Buffer)
+	binary.Write(w, binary.BigEndian, uint16(len(der)))
+	w.Write(der)
+	w.Write(cell.SessionHash[:])
+	return w.Bytes(), nil
+}
+
+// Encode returns the cell body.
+func (cell *EstablishIntroV2) Encode() ([]byte, error) {
+	body, err := cell.body()
+	if err != nil {
+		return nil, err
+	}
+	return append(body, cell.Signature...), nil
+}
+
+// ParseEstablishIntroV2 parses body of legacy ESTABLISH_INTRO cell.
+func ParseEstablishIntroV2(data []byte) (*EstablishIntroV2, error) {
+	if len(data) < 2 {
+		return nil, ErrTruncated
+	}
+	keyLen := int(binary.BigEndian.Uint16(data))
+	if len(data) < 2+keyLen+sha1.Size {
+		return nil, ErrTruncated
+	}
+	pk, rest, err := pkcs1.DecodePublicKeyDER(data[2 : 2+keyLen])
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, errors.New("Trailing data after service key")
+	}
+	cell := &EstablishIntroV2{ServiceKey: pk}
+	copy(cell.SessionHash[:], data[2+keyLen:])
+	cell.Signature = append([]byte{}, data[2+keyLen+sha1.Size:]...)
+	return cell, nil
+}
+
+// Verify checks that the cell is sent over circuit with nonce kh
+// and is signed with its service key.
+func (cell *EstablishIntroV2) Verify(kh []byte) error {
+	expected := introduceSessionHash(kh)
+	if !ConstantTimeEqual(cell.SessionHash[:], expected[:]) {
+		return errors.New("Wrong session hash of ESTABLISH_INTRO cell")
+	}
+	body, err := cell.body()
+	if err != nil {
+		return err
+	}
+	return verifyPKCS1v15(cell.ServiceKey, crypto.Hash(0), Hash(body), cell.Signature)
+}
+
+// EstablishIntroV3 is ESTABLISH_INTRO cell of v3 onion services
+// with Ed25519 authentication key (rend-spec-v3 3.1.1).
+type EstablishIntroV3 struct {
+	AuthKey    Ed25519Pubkey
+	Extensions []CellExtension
+	// HandshakeAuth is MAC of the preceding fields keyed with KH.
+	HandshakeAuth [hsntorMACLen]byte
+	Signature     []byte
+}
+
+// NewEstablishIntroV3 returns ESTABLISH_INTRO cell for circuit with
+// nonce kh signed with introduction point authentication key authKey.
+func NewEstablishIntroV3(authKey crypto.Signer, kh []byte, exts []CellExtension) (*EstablishIntroV3, error) {
+	pk, ok := authKey.Public().(ed25519.PublicKey)
+	if !ok {
+		return nil, errors.New("Authentication key is not an Ed25519 key")
+	}
+	cell := &EstablishIntroV3{Extensions: exts}
+	copy(cell.AuthKey[:], pk)
+	head, err := cell.head()
+	if err != nil {
+		return nil, err
+	}
+	copy(cell.HandshakeAuth[:], hsMAC(kh, head))
+	cell.Signature, err = SignWithPrefix(authKey, SigPrefixEstablishIntro, cell.signedPart(head))
+	if err != nil {
+		return nil, err
+	}
+	return cell, nil
+}
+
+// head returns encoding of the fields covered by HandshakeAuth.
+func (cell *EstablishIntroV3) head() ([]byte, error) {
+	w := new(bytes.Buffer)
+	w.WriteByte(IntroAuthKeyTypeEd25519)
+	binary.Write(w, binary.BigEndian, uint16(Ed25519PubkeySize))
+	w.Write(cell.AuthKey[:])
+	if err := encodeCellExtensions(w, cell.Extensions); err != nil {
+		return nil, err
+	}
+	return w.Bytes(), nil
+}
+
+// signedPart returns head | HANDSHAKE_AUTH | SIG_LEN.
+func (cell *EstablishIntroV3) signedPart(head []byte) []byte {
+	w := bytes.NewBuffer(append([]byte{}, head...))
+	w.Write(cell.HandshakeAuth[:])
+	binary.Write(w, binary.BigEndian, uint16(ed25519.SignatureSize))
+	return w.Bytes()
+}
+
+// Encode returns the cell body.
+func (cell *EstablishIntroV3) Encode() ([]byte, error) {
+	head, err := cell.head()
+	if err != nil {
+		return nil, err
+	}
+	if len(cell.Signature) != ed25519.SignatureSize {
+		return nil, errors.New("Wrong signature length")
+	}
+	return append(cell.signedPart(head), cell.Signature...), nil
+}
+
+// ParseEstablishIntroV3 parses body of ESTABLISH_INTRO cell
+// with Ed25519 authentication key.
+func ParseEstablishIntroV3(data []byte) (*EstablishIntroV3, error) {
+	r := bytes.NewReader(data)
+	keyType, err := r.ReadByte()
+	if err != nil {
+		return nil, ErrTruncated
+	}
+	if keyType != IntroAuthKeyTypeEd25519 {
+		return nil, fmt.Errorf("Unsupported authentication key type %d", keyType)
+	}
+	var keyLen uint16
+	if err := binary.Read(r, binary.BigEndian, &keyLen); err != nil {
+		return nil, ErrTruncated
+	}
+	if keyLen != Ed25519PubkeySize {
+		return nil, fmt.Errorf("Wrong length of authentication key: %d", keyLen)
+	}
+	cell := new(EstablishIntroV3)
+	if _, err := io.ReadFull(r, cell.AuthKey[:]); err != nil {
+		return nil, ErrTruncated
+	}
+	if cell.Extensions, err = decodeCellExtensions(r); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(r, cell.HandshakeAuth[:]); err != nil {
+		return nil, ErrTruncated
+	}
+	var sigLen uint16
+	if err := binary.Read(r, binary.BigEndian, &sigLen); err != nil {
+		return nil, ErrTruncated
+	}
+	if sigLen != ed25519.SignatureSize {
+		return nil, fmt.Errorf("Wrong signature length: %d", sigLen)
+	}
+	cell.Signature = make([]byte, sigLen)
+	if _, err := io.ReadFull(r, cell.Signature); err != nil {
+		return nil, ErrTruncated
+	}
+	if r.Len() != 0 {
+		return nil, ErrTrailingData
+	}
+	return cell, nil
+}
+
+// Verify checks that the cell is sent over circuit with nonce kh
+// and is signed with its authentication key.
+func (cell *EstablishIntroV3) Verify(kh []byte) error {
+	head, err := cell.head()
+	if err != nil {
+		return err
+	}
+	if !ConstantTimeEqual(cell.HandshakeAuth[:], hsMAC(kh, head)) {
+		return errors.New("Wrong handshake auth of ESTABLISH_INTRO cell")
+	}
+	return VerifyWithPrefix(cell.AuthKey.PublicKey(), SigPrefixEstablishIntro,
+		cell.signedPart(head), cell.Signature)
+}
+
+// EstablishRendezvous returns body of ESTABLISH_RENDEZVOUS cell
+// which sets up a rendezvous point with cookie.
+func EstablishRendezvous(cookie RendCookie) []byte {
+	return append([]byte{}, cookie[:]...)
+}
+
+// ParseEstablishRendezvous returns rendezvous cookie
+// of ESTABLISH_RENDEZVOUS cell body data.
+func ParseEstablishRendezvous(data []byte) (cookie RendCookie, err error) {
+	if len(data) < RendCookieSize {
+		return cookie, ErrTruncated
+	}
+	if len(data) > RendCookieSize {
+		return cookie, ErrTrailingData
+	}
+	copy(cookie[:], data)
+	return cookie, nil
+}
+
+// Rendezvous1 is RENDEZVOUS1 cell which a service sends to
+// the rendezvous point of a client.
+type Rendezvous1 struct {
+	Cookie RendCookie
+	// HandshakeInfo is g^y | KH for v2 services or reply of
+	// HSNTorServiceHandshake for v3 ones. The rendezvous point
+	// passes it to the client in RENDEZVOUS2 cell.
+	HandshakeInfo []byte
+}
+
+// Encode returns the cell body.
+func (cell *Rendezvous1) Encode() []byte {
+	return append(append([]byte{}, cell.Cookie[:]...), cell.HandshakeInfo...)
+}
+
+// ParseRendezvous1 parses body of RENDEZVOUS1 cell.
+func ParseRendezvous1(data []byte) (*Rendezvous1, error) {
+	if len(data) < RendCookieSize {
+		return nil, ErrTruncated
+	}
+	cell := &Rendezvous1{HandshakeInfo: append([]byte{}, data[RendCookieSize:]...)}
+	copy(cell.Cookie[:], data)
+	return cell, nil
+}
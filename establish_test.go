@@ -0,0 +1,85 @@
+package onionutil
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+func TestEstablishIntro(t *testing.T) {
+	kh := make([]byte, 20)
+	rand.Read(kh)
+	otherKH := append([]byte{}, kh...)
+	otherKH[0] ^= 1
+
+	sk, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v2, err := NewEstablishIntroV2(sk, kh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := v2.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsedV2, err := ParseEstablishIntroV2(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := parsedV2.Verify(kh); err != nil {
+		t.Fatal(err)
+	}
+	if err := parsedV2.Verify(otherKH); err == nil {
+		t.Fatal("cell is valid for another circuit")
+	}
+
+	_, authSk, _ := ed25519.GenerateKey(rand.Reader)
+	exts := []CellExtension{{Type: 0x01, Data: []byte{0x01, 0x02}}}
+	v3, err := NewEstablishIntroV3(authSk, kh, exts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err = v3.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsedV3, err := ParseEstablishIntroV3(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := parsedV3.Verify(kh); err != nil {
+		t.Fatal(err)
+	}
+	if err := parsedV3.Verify(otherKH); err == nil {
+		t.Fatal("cell is valid for another circuit")
+	}
+	parsedV3.Signature[0] ^= 1
+	if err := parsedV3.Verify(kh); err == nil {
+		t.Fatal("broken signature is valid")
+	}
+	if _, err := ParseEstablishIntroV3(append(data, 0)); err != ErrTrailingData {
+		t.Fatalf("trailing data: %v", err)
+	}
+}
+
+func TestRendezvousCells(t *testing.T) {
+	cookie, _ := NewRendCookie(rand.Reader)
+	got, err := ParseEstablishRendezvous(EstablishRendezvous(cookie))
+	if err != nil || got != cookie {
+		t.Fatalf("ESTABLISH_RENDEZVOUS round trip: %v", err)
+	}
+	info := make([]byte, HSNTorReplySize)
+	rand.Read(info)
+	cell, err := ParseRendezvous1((&Rendezvous1{Cookie: cookie, HandshakeInfo: info}).Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cell.Cookie != cookie || !bytes.Equal(cell.HandshakeInfo, info) {
+		t.Fatal("RENDEZVOUS1 round trip failed")
+	}
+}
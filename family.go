@@ -0,0 +1,166 @@
+// family.go - relay families
+//
+// To the extent possible under law, Ivan Markin waived all copyright
+// and related or neighboring rights to this module of onionutil, using the creative
+// commons "cc0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package onionutil
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// MaxNicknameLength is the maximum length of relay nickname.
+const MaxNicknameLength = 19
+
+// Family is a normalized set of members of "family" line of
+// a router descriptor or a microdescriptor.
+type Family struct {
+	// Fingerprints are identity fingerprints of members
+	// specified as "$fingerprint" with optional "=nickname"
+	// or "~nickname" suffix, in ascending order.
+	Fingerprints []Fingerprint
+	// Nicknames are lowercased nicknames of members specified
+	// by nickname only, in ascending order.
+	Nicknames []string
+}
+
+func validNickname(nickname string) bool {
+	if len(nickname) < 1 || len(nickname) > MaxNicknameLength {
+		return false
+	}
+	for _, c := range nickname {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseFamily parses members of "family" line. Duplicate
+// members are removed.
+func ParseFamily(members []string) (*Family, error) {
+	family := new(Family)
+	fps := make(map[Fingerprint]bool)
+	nicknames := make(map[string]bool)
+	for _, member := range members {
+		if !strings.HasPrefix(member, "$") {
+			if !validNickname(member) {
+				return nil, fmt.Errorf("Malformed family member: %s", member)
+			}
+			nicknames[strings.ToLower(member)] = true
+			continue
+		}
+		hexFP := member
+		if i := strings.IndexAny(member, "=~"); i >= 0 {
+			if !validNickname(member[i+1:]) {
+				return nil, fmt.Errorf("Malformed family member: %s", member)
+			}
+			hexFP = member[:i]
+		}
+		if strings.Contains(hexFP, " ") {
+			return nil, fmt.Errorf("Malformed family member: %s", member)
+		}
+		fp, err := ParseFingerprint(hexFP)
+		if err != nil {
+			return nil, err
+		}
+		fps[fp] = true
+	}
+	for fp := range fps {
+		family.Fingerprints = append(family.Fingerprints, fp)
+	}
+	sort.Slice(family.Fingerprints, func(i, j int) bool {
+		return bytes.Compare(family.Fingerprints[i][:], family.Fingerprints[j][:]) < 0
+	})
+	for nickname := range nicknames {
+		family.Nicknames = append(family.Nicknames, nickname)
+	}
+	sort.Strings(family.Nicknames)
+	return family, nil
+}
+
+// Contains reports whether a relay with fingerprint fp and
+// nickname nickname is a member of family.
+func (family *Family) Contains(fp Fingerprint, nickname string) bool {
+	for _, member := range family.Fingerprints {
+		if member == fp {
+			return true
+		}
+	}
+	nickname = strings.ToLower(nickname)
+	for _, member := range family.Nicknames {
+		if member == nickname {
+			return true
+		}
+	}
+	return false
+}
+
+// Members returns normalized family members: "$"-prefixed
+// fingerprints followed by nicknames.
+func (family *Family) Members() (members []string) {
+	for _, fp := range family.Fingerprints {
+		members = append(members, fp.Dollar())
+	}
+	return append(members, family.Nicknames...)
+}
+
+func (family *Family) String() string {
+	return strings.Join(family.Members(), " ")
+}
+
+// FamilyMembers returns parsed family of the descriptor.
+func (desc *RouterDescriptor) FamilyMembers() (*Family, error) {
+	return ParseFamily(desc.Family)
+}
+
+// FamilyMismatch is a non-mutual family declaration: relay From
+// declares relay To as a family member but not vice versa.
+type FamilyMismatch struct {
+	From Fingerprint
+	To   Fingerprint
+}
+
+func (m FamilyMismatch) String() string {
+	return fmt.Sprintf("%s declares %s which does not declare it back", m.From.Dollar(), m.To.Dollar())
+}
+
+// CheckFamilies checks that family declarations of descs are mutual.
+// Members which are not among descs are ignored. Mismatches are
+// returned in order of descs.
+func CheckFamilies(descs []RouterDescriptor) ([]FamilyMismatch, error) {
+	type relay struct {
+		fp       Fingerprint
+		nickname string
+		family   *Family
+	}
+	relays := make([]relay, len(descs))
+	for i := range descs {
+		fp, err := ParseFingerprint(descs[i].Fingerprint)
+		if err != nil {
+			return nil, fmt.Errorf("Descriptor %d: %w", i, err)
+		}
+		family, err := descs[i].FamilyMembers()
+		if err != nil {
+			return nil, fmt.Errorf("Descriptor %d: %w", i, err)
+		}
+		relays[i] = relay{fp: fp, nickname: descs[i].Nickname, family: family}
+	}
+	var mismatches []FamilyMismatch
+	for _, r := range relays {
+		for _, other := range relays {
+			if other.fp == r.fp || !r.family.Contains(other.fp, other.nickname) {
+				continue
+			}
+			if !other.family.Contains(r.fp, r.nickname) {
+				mismatches = append(mismatches, FamilyMismatch{From: r.fp, To: other.fp})
+			}
+		}
+	}
+	return mismatches, nil
+}
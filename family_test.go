@@ -0,0 +1,53 @@
+// family_test.go - tests for relay families
+//
+// To the extent possible under law, Ivan Markin waived all copyright
+// and related or neighboring rights to this module of onionutil, using the creative
+// commons "cc0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package onionutil
+
+import (
+	"testing"
+)
+
+const (
+	familyFP1 = "38233B116B6B8CE21A53327212DDCA249C1AC8FB"
+	familyFP2 = "0011223344556677889900112233445566778899"
+	familyFP3 = "AABBCCDDEEFF00112233445566778899AABBCCDD"
+)
+
+func TestParseFamily(t *testing.T) {
+	family, err := ParseFamily([]string{
+		"$38233b116b6b8ce21a53327212ddca249c1ac8fb=hartwell",
+		"$" + familyFP1,
+		"$" + familyFP2 + "~foo",
+		"Bar", "bar",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "$" + familyFP2 + " $" + familyFP1 + " bar"
+	if family.String() != expected {
+		t.Fatalf("wrong family: %q", family.String())
+	}
+	if _, err := ParseFamily([]string{"$" + familyFP1 + "=bad-nick"}); err == nil {
+		t.Fatal("malformed member is accepted")
+	}
+}
+
+func TestCheckFamilies(t *testing.T) {
+	descs := []RouterDescriptor{
+		{Nickname: "a", Fingerprint: familyFP1, Family: []string{"$" + familyFP2, "c"}},
+		{Nickname: "b", Fingerprint: familyFP2, Family: []string{"$" + familyFP1}},
+		{Nickname: "c", Fingerprint: familyFP3},
+	}
+	mismatches, err := CheckFamilies(descs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mismatches) != 1 || mismatches[0].From.String() != familyFP1 ||
+		mismatches[0].To.String() != familyFP3 {
+		t.Fatalf("wrong mismatches: %v", mismatches)
+	}
+}
@@ -0,0 +1,171 @@
+// fetcher.go - fetch documents via the Tor directory protocol
+//
+// To the extent possible under law, Ivan Markin waived all copyright
+// and related or neighboring rights to this module of onionutil, using the creative
+// commons "cc0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package onionutil
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/nogoegst/onionutil/internal/zstd"
+)
+
+// ErrNotModified is returned if a document has not been modified
+// since the time given to the fetcher.
+var ErrNotModified = errors.New("Document is not modified")
+
+// DirAcceptEncoding lists compression methods DirClient
+// understands. lzma is not supported.
+const DirAcceptEncoding = "deflate, gzip, x-zstd, identity"
+
+// DirClient fetches documents from a directory server over HTTP.
+// Tunneling over ORPort (BEGIN_DIR) is possible by providing
+// HTTPClient with a suitable transport.
+type DirClient struct {
+	// BaseURL is the URL of directory server like
+	// "http://128.31.0.34:9131".
+	BaseURL string
+	// HTTPClient is used to make requests. If nil,
+	// http.DefaultClient is used.
+	HTTPClient *http.Client
+}
+
+func (dc *DirClient) httpClient() *http.Client {
+	if dc.HTTPClient != nil {
+		return dc.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+// decompressBody returns reader of decompressed body of resp.
+func decompressBody(resp *http.Response) (io.Reader, error) {
+	switch strings.ToLower(resp.Header.Get("Content-Encoding")) {
+	case "", "identity":
+		return resp.Body, nil
+	case "deflate":
+		/* Tor's "deflate" is zlib stream */
+		return zlib.NewReader(resp.Body)
+	case "gzip", "x-gzip":
+		return gzip.NewReader(resp.Body)
+	case "x-zstd", "zstd":
+		return zstd.NewReader(resp.Body), nil
+	default:
+		return nil, fmt.Errorf("Unsupported content encoding: %s",
+			resp.Header.Get("Content-Encoding"))
+	}
+}
+
+// Fetch fetches document at path. If ifModifiedSince is not zero
+// and the document has not been modified since then,
+// ErrNotModified is returned.
+func (dc *DirClient) Fetch(ctx context.Context, path string, ifModifiedSince time.Time) ([]byte, error) {
+	req, err := http.NewRequest("GET", strings.TrimRight(dc.BaseURL, "/")+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept-Encoding", DirAcceptEncoding)
+	if !ifModifiedSince.IsZero() {
+		req.Header.Set("If-Modified-Since", ifModifiedSince.UTC().Format(http.TimeFormat))
+	}
+	resp, err := dc.httpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotModified:
+		return nil, ErrNotModified
+	default:
+		return nil, fmt.Errorf("Unable to fetch %s: %s", path, resp.Status)
+	}
+	body, err := decompressBody(resp)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(body)
+}
+
+// FetchConsensus fetches the current consensus. If microdesc is true
+// microdescriptor consensus is fetched.
+func (dc *DirClient) FetchConsensus(ctx context.Context, microdesc bool, ifModifiedSince time.Time) (*Consensus, error) {
+	path := ConsensusPath
+	if microdesc {
+		path = MicrodescConsensusPath
+	}
+	data, err := dc.Fetch(ctx, path, ifModifiedSince)
+	if err != nil {
+		return nil, err
+	}
+	return ParseConsensus(data)
+}
+
+// FetchServerDescriptors fetches server descriptors of relays with
+// identity fingerprints fps. Malformed descriptors are skipped.
+func (dc *DirClient) FetchServerDescriptors(ctx context.Context, fps [][]byte) (descs []RouterDescriptor, err error) {
+	for _, path := range ServerDescriptorPaths(fps) {
+		data, err := dc.Fetch(ctx, path, time.Time{})
+		if err != nil {
+			return nil, err
+		}
+		batch, err := ParseRouterDescriptorsContext(ctx, data)
+		if err != nil {
+			return nil, err
+		}
+		descs = append(descs, batch...)
+	}
+	return descs, nil
+}
+
+// FetchMicrodescriptors fetches microdescriptors by their digests.
+func (dc *DirClient) FetchMicrodescriptors(ctx context.Context, digests [][]byte) (mds []*Microdescriptor, err error) {
+	for _, path := range MicrodescriptorPaths(digests) {
+		data, err := dc.Fetch(ctx, path, time.Time{})
+		if err != nil {
+			return nil, err
+		}
+		batch, err := ParseMicrodescriptorsContext(ctx, data)
+		if err != nil {
+			return nil, err
+		}
+		mds = append(mds, batch...)
+	}
+	return mds, nil
+}
+
+// FetchOnionDescriptor fetches v2 onion service descriptor with
+// descriptor ID descID from an HSDir.
+func (dc *DirClient) FetchOnionDescriptor(ctx context.Context, descID []byte) (*OnionDescriptor, error) {
+	data, err := dc.Fetch(ctx, RendezvousDescriptorPath(descID), time.Time{})
+	if err != nil {
+		return nil, err
+	}
+	results, _ := ParseOnionDescriptors(data)
+	if len(results) != 1 {
+		return nil, errors.New("Expected exactly one descriptor")
+	}
+	return results[0].Desc, results[0].Err
+}
+
+// FetchOnionDescriptorV3 fetches v3 onion service descriptor with
+// blinded key blindedKey from an HSDir.
+func (dc *DirClient) FetchOnionDescriptorV3(ctx context.Context, blindedKey []byte) (*OnionDescriptorV3, error) {
+	data, err := dc.Fetch(ctx, HSDescriptorPathV3(blindedKey), time.Time{})
+	if err != nil {
+		return nil, err
+	}
+	return ParseOnionDescriptorV3(data)
+}
@@ -0,0 +1,75 @@
+package onionutil
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nogoegst/onionutil/testvectors"
+)
+
+func TestDirClientFetch(t *testing.T) {
+	modified := time.Date(2019, 1, 2, 3, 0, 0, 0, time.UTC)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != MicrodescConsensusPath {
+			http.NotFound(w, r)
+			return
+		}
+		if ims, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil && !ims.Before(modified) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Content-Encoding", "deflate")
+		zw := zlib.NewWriter(w)
+		zw.Write(testConsensus)
+		zw.Close()
+	}))
+	defer srv.Close()
+
+	dc := &DirClient{BaseURL: srv.URL}
+	ctx := context.Background()
+	c, err := dc.FetchConsensus(ctx, true, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(c.Raw, testConsensus) {
+		t.Fatal("wrong consensus")
+	}
+	if _, err := dc.FetchConsensus(ctx, true, modified); err != ErrNotModified {
+		t.Fatalf("expected ErrNotModified, got %v", err)
+	}
+	if _, err := dc.FetchConsensus(ctx, false, time.Time{}); err == nil {
+		t.Fatal("missing document fetched")
+	}
+}
+
+func TestDirClientFetchZstd(t *testing.T) {
+	compressed, err := ioutil.ReadFile("testdata/descriptor-v2.zst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.Header.Get("Accept-Encoding"), "x-zstd") {
+			http.Error(w, "zstd is not accepted", http.StatusNotAcceptable)
+			return
+		}
+		w.Header().Set("Content-Encoding", "x-zstd")
+		w.Write(compressed)
+	}))
+	defer srv.Close()
+
+	dc := &DirClient{BaseURL: srv.URL}
+	body, err := dc.Fetch(context.Background(), "/tor/rendezvous2/6iedtc4w36h35ln3ntklmbiawjhgdjud", time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(body, []byte(testvectors.ServiceDescriptorV2.Data)) {
+		t.Fatal("wrong descriptor")
+	}
+}
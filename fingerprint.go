@@ -0,0 +1,95 @@
+// fingerprint.go - relay identity fingerprints
+//
+// To the extent possible under law, Ivan Markin waived all copyright
+// and related or neighboring rights to this module of onionutil, using the creative
+// commons "cc0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package onionutil
+
+import (
+	"crypto/rsa"
+	"crypto/subtle"
+	"fmt"
+	"strings"
+)
+
+const FingerprintSize = 20
+
+// Fingerprint is SHA1 digest of DER-encoded RSA identity key.
+type Fingerprint [FingerprintSize]byte
+
+// NewFingerprint returns fingerprint of RSA identity key pk.
+func NewFingerprint(pk *rsa.PublicKey) (fp Fingerprint, err error) {
+	hash, err := RSAPubkeyHash(pk)
+	if err != nil {
+		return fp, err
+	}
+	copy(fp[:], hash)
+	return fp, nil
+}
+
+// FingerprintFromBytes returns fingerprint with the value b.
+func FingerprintFromBytes(b []byte) (fp Fingerprint, err error) {
+	if len(b) != FingerprintSize {
+		return fp, fmt.Errorf("Wrong length of fingerprint: %d", len(b))
+	}
+	copy(fp[:], b)
+	return fp, nil
+}
+
+// ParseFingerprint parses hex-encoded fingerprint with optional
+// "$" prefix. Spaced fingerprints like in "fingerprint" lines of
+// router descriptors must consist of groups of 4 characters.
+func ParseFingerprint(s string) (fp Fingerprint, err error) {
+	s = strings.TrimPrefix(s, "$")
+	if strings.Contains(s, " ") {
+		groups := strings.Split(s, " ")
+		if len(groups) != FingerprintSize/2 {
+			return fp, fmt.Errorf("Malformed fingerprint: %s", s)
+		}
+		for _, group := range groups {
+			if len(group) != 4 {
+				return fp, fmt.Errorf("Malformed fingerprint: %s", s)
+			}
+		}
+	}
+	b, err := ParseHexFingerprint(s, FingerprintSize)
+	if err != nil {
+		return fp, err
+	}
+	copy(fp[:], b)
+	return fp, nil
+}
+
+// String returns uppercase hex encoding of fp.
+func (fp Fingerprint) String() string {
+	return HexFingerprint(fp[:])
+}
+
+// Spaced returns fp in groups of 4 hex characters as in
+// "fingerprint" lines of router descriptors.
+func (fp Fingerprint) Spaced() string {
+	return HexFingerprintSpaced(fp[:])
+}
+
+// Dollar returns "$"-prefixed hex encoding of fp as used
+// in family lines and by controllers.
+func (fp Fingerprint) Dollar() string {
+	return "$" + fp.String()
+}
+
+// Base64 returns base64 encoding of fp as in consensus "r" lines.
+func (fp Fingerprint) Base64() string {
+	return Base64EncodeUnpadded(fp[:])
+}
+
+// Base32 returns base32 encoding of fp as in v2 introduction points.
+func (fp Fingerprint) Base32() string {
+	return Base32Encode(fp[:])
+}
+
+// Equal reports whether fp and other are equal in constant time.
+func (fp Fingerprint) Equal(other Fingerprint) bool {
+	return subtle.ConstantTimeCompare(fp[:], other[:]) == 1
+}
@@ -0,0 +1,40 @@
+package onionutil
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+)
+
+func TestFingerprint(t *testing.T) {
+	sk, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fp, err := NewFingerprint(&sk.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	permID, err := PermanentID(&sk.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fp.Base32()[:16] != Base32Encode(permID) {
+		t.Fatal("fingerprint disagrees with permanent ID")
+	}
+	for _, s := range []string{fp.String(), fp.Spaced(), fp.Dollar()} {
+		parsed, err := ParseFingerprint(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !parsed.Equal(fp) {
+			t.Fatalf("%q parsed to another fingerprint", s)
+		}
+	}
+	if _, err := ParseFingerprint(fp.String()[:6] + " " + fp.String()[6:]); err == nil {
+		t.Fatal("misgrouped fingerprint accepted")
+	}
+	if _, err := FingerprintFromBytes(fp[1:]); err == nil {
+		t.Fatal("short fingerprint accepted")
+	}
+}
@@ -0,0 +1,111 @@
+// flags.go - router status flags
+//
+// To the extent possible under law, Ivan Markin waived all copyright
+// and related or neighboring rights to this module of onionutil, using the creative
+// commons "cc0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package onionutil
+
+import (
+	"strings"
+)
+
+// Flags is a set of router status flags from "s" line
+// of a consensus (dir-spec 3.4.1).
+type Flags uint32
+
+const (
+	FlagAuthority Flags = 1 << iota
+	FlagBadExit
+	FlagExit
+	FlagFast
+	FlagGuard
+	FlagHSDir
+	FlagMiddleOnly
+	FlagNoEdConsensus
+	FlagRunning
+	FlagStable
+	FlagStaleDesc
+	FlagSybil
+	FlagV2Dir
+	FlagValid
+)
+
+// flagNames are names of flags in order of their bits
+// which is also the order of flags in "s" lines.
+var flagNames = []string{
+	"Authority",
+	"BadExit",
+	"Exit",
+	"Fast",
+	"Guard",
+	"HSDir",
+	"MiddleOnly",
+	"NoEdConsensus",
+	"Running",
+	"Stable",
+	"StaleDesc",
+	"Sybil",
+	"V2Dir",
+	"Valid",
+}
+
+// ParseFlags parses flag names. Unknown flags are returned
+// separately.
+func ParseFlags(names []string) (flags Flags, unknown []string) {
+	for _, name := range names {
+		flag, ok := FlagByName(name)
+		if !ok {
+			unknown = append(unknown, name)
+			continue
+		}
+		flags |= flag
+	}
+	return flags, unknown
+}
+
+// FlagByName returns flag with name name.
+func FlagByName(name string) (Flags, bool) {
+	for i, flagName := range flagNames {
+		if flagName == name {
+			return 1 << uint(i), true
+		}
+	}
+	return 0, false
+}
+
+// Has reports whether all the flags of flag are set.
+func (flags Flags) Has(flag Flags) bool {
+	return flags&flag == flag
+}
+
+// Count returns number of flags set.
+func (flags Flags) Count() (n int) {
+	for ; flags != 0; flags &= flags - 1 {
+		n++
+	}
+	return n
+}
+
+// Names returns names of the flags in order of "s" lines.
+func (flags Flags) Names() (names []string) {
+	for i, name := range flagNames {
+		if flags.Has(1 << uint(i)) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func (flags Flags) String() string {
+	return strings.Join(flags.Names(), " ")
+}
+
+// Bytes returns "s" line of router status entry.
+func (flags Flags) Bytes() []byte {
+	if flags == 0 {
+		return []byte("s\n")
+	}
+	return []byte("s " + flags.String() + "\n")
+}
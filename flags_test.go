@@ -0,0 +1,25 @@
+// flags_test.go - tests for router status flags
+//
+// To the extent possible under law, Ivan Markin waived all copyright
+// and related or neighboring rights to this module of onionutil, using the creative
+// commons "cc0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package onionutil
+
+import (
+	"testing"
+)
+
+func TestFlags(t *testing.T) {
+	flags, unknown := ParseFlags([]string{"Valid", "Guard", "Exit", "Foo", "Running"})
+	if len(unknown) != 1 || unknown[0] != "Foo" {
+		t.Fatalf("wrong unknown flags: %v", unknown)
+	}
+	if !flags.Has(FlagGuard|FlagExit) || flags.Has(FlagHSDir) || flags.Count() != 4 {
+		t.Fatalf("wrong flags: %v", flags)
+	}
+	if s := string(flags.Bytes()); s != "s Exit Guard Running Valid\n" {
+		t.Fatalf("wrong encoding: %q", s)
+	}
+}
@@ -0,0 +1,121 @@
+// fuzz_test.go - fuzz targets for parsers
+//
+// To the extent possible under law, Ivan Markin waived all copyright
+// and related or neighboring rights to this module of onionutil, using the creative
+// commons "cc0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package onionutil
+
+import (
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/nogoegst/onionutil/testvectors"
+	"github.com/nogoegst/onionutil/torparse"
+	"golang.org/x/crypto/ed25519"
+)
+
+func FuzzParseCertFromBytes(f *testing.F) {
+	pk, sk, _ := ed25519.GenerateKey(rand.Reader)
+	cert := NewCertificate(CertTypeIdentitySigning, Ed25519Pubkey{}, time.Now(), pk)
+	cert.Sign(sk)
+	f.Add(cert.Bytes())
+	f.Fuzz(func(t *testing.T, data []byte) {
+		cert, err := ParseCertFromBytesStrict(data)
+		if err != nil {
+			return
+		}
+		cert.Verify(nil)
+		if len(cert.Bytes()) != len(data) && len(cert.Extensions) == int(cert.NExtensions) {
+			t.Fatal("certificate is not encoded back")
+		}
+	})
+}
+
+func FuzzParseTorDocument(f *testing.F) {
+	f.Add([]byte(testvectors.ServiceDescriptorV2.Data))
+	f.Add(testConsensus)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		torparse.ParseTorDocument(data)
+		torparse.ParseTorDocumentStrict(data, OnionDescriptorGrammar)
+	})
+}
+
+func FuzzParseOnionDescriptors(f *testing.F) {
+	f.Add([]byte(testvectors.ServiceDescriptorV2.Data))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		results, _ := ParseOnionDescriptors(data)
+		for _, result := range results {
+			if result.Err != nil {
+				continue
+			}
+			result.Desc.Verify()
+			result.Desc.IntroPoints()
+		}
+	})
+}
+
+func FuzzParseOnionDescriptorV3(f *testing.F) {
+	pk, sk, _ := ed25519.GenerateKey(rand.Reader)
+	cert := NewCertificate(CertTypeHSDescSigning, Ed25519Pubkey{}, time.Now(), pk)
+	cert.Sign(sk)
+	desc := &OnionDescriptorV3{
+		Version:         DescVersionV3,
+		Lifetime:        DescLifetimeV3,
+		SigningKeyCert:  cert,
+		RevisionCounter: 1,
+		Superencrypted:  []byte("superencrypted"),
+	}
+	f.Add(desc.Bytes())
+	f.Fuzz(func(t *testing.T, data []byte) {
+		desc, err := ParseOnionDescriptorV3(data)
+		if err != nil {
+			return
+		}
+		desc.VerifySignature(pk, time.Now())
+	})
+}
+
+func FuzzParseLayersV3(f *testing.F) {
+	middle := &SuperencryptedLayerV3{
+		AuthType:    AuthTypeX25519,
+		AuthClients: make([]AuthClientV3, 2),
+		Encrypted:   []byte("encrypted"),
+	}
+	inner := &EncryptedLayerV3{
+		Create2Formats: []int{Create2FormatNTor},
+		IntroPoints: [][]byte{
+			[]byte("introduction-point AAAA\nonion-key ntor BBBB\n"),
+		},
+	}
+	f.Add(middle.Bytes())
+	f.Add(inner.Bytes())
+	f.Fuzz(func(t *testing.T, data []byte) {
+		ParseSuperencryptedLayerV3(data)
+		if layer, err := ParseEncryptedLayerV3(data); err == nil {
+			layer.IntroductionPoints()
+		}
+	})
+}
+
+func FuzzParseConsensus(f *testing.F) {
+	f.Add(testConsensus)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		c, err := ParseConsensus(data)
+		if err != nil {
+			return
+		}
+		c.Weights()
+		c.HSDirs()
+	})
+}
+
+func FuzzParseRouterDescriptors(f *testing.F) {
+	f.Fuzz(func(t *testing.T, data []byte) {
+		for _, desc := range ParseRouterDescriptors(data) {
+			desc.Verify()
+		}
+	})
+}
@@ -0,0 +1,127 @@
+// hashring.go - locate HSDirs responsible for onion service descriptors
+//
+// To the extent possible under law, Ivan Markin waived all copyright
+// and related or neighboring rights to this module of onionutil, using the creative
+// commons "cc0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package onionutil
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sort"
+
+	"golang.org/x/crypto/ed25519"
+	"golang.org/x/crypto/sha3"
+)
+
+// Hashring parameters (rend-spec 1.4 and rend-spec-v3 2.2.3).
+var (
+	HSDirsPerReplicaV2 = 3
+	HSDirNReplicasV3   = 2
+	HSDirSpreadStoreV3 = 4
+	HSDirSpreadFetchV3 = 3
+
+	HSIndexPrefixV3    = []byte("store-at-idx")
+	HSDirIndexPrefixV3 = []byte("node-idx")
+)
+
+// HSDir is a relay with HSDir flag.
+type HSDir struct {
+	Nickname string
+	// Fingerprint is RSA identity digest of the relay.
+	Fingerprint []byte
+	// Ed25519ID is Ed25519 identity of the relay (used for v3).
+	Ed25519ID Ed25519Pubkey
+}
+
+// ringSuccessors returns n distinct items of ring (which must be
+// sorted by keys) that follow position pos wrapping around.
+func ringSuccessors(ring []HSDir, keys [][]byte, pos []byte, n int, exclude map[int]bool) (picked []int) {
+	start := sort.Search(len(keys), func(i int) bool {
+		return bytes.Compare(keys[i], pos) >= 0
+	})
+	for i := 0; i < len(ring) && len(picked) < n; i++ {
+		idx := (start + i) % len(ring)
+		if exclude[idx] {
+			continue
+		}
+		picked = append(picked, idx)
+	}
+	return picked
+}
+
+// ResponsibleHSDirsV2 returns HSDirs responsible for v2 descriptor
+// with descriptor ID descID.
+func ResponsibleHSDirsV2(hsdirs []HSDir, descID []byte) (responsible []HSDir) {
+	ring := append([]HSDir(nil), hsdirs...)
+	sort.Slice(ring, func(i, j int) bool {
+		return bytes.Compare(ring[i].Fingerprint, ring[j].Fingerprint) < 0
+	})
+	keys := make([][]byte, len(ring))
+	for i := range ring {
+		keys[i] = ring[i].Fingerprint
+	}
+	for _, idx := range ringSuccessors(ring, keys, descID, HSDirsPerReplicaV2, nil) {
+		responsible = append(responsible, ring[idx])
+	}
+	return responsible
+}
+
+// HSIndexV3 calculates position of a descriptor replica on
+// the hashring.
+func HSIndexV3(blindedKey ed25519.PublicKey, replica, periodNum, periodLength uint64) []byte {
+	h := sha3.New256()
+	h.Write(HSIndexPrefixV3)
+	h.Write(blindedKey)
+	binary.Write(h, binary.BigEndian, replica)
+	binary.Write(h, binary.BigEndian, periodLength)
+	binary.Write(h, binary.BigEndian, periodNum)
+	return h.Sum(nil)
+}
+
+// HSDirIndexV3 calculates position of HSDir with identity id on
+// the hashring.
+func HSDirIndexV3(id Ed25519Pubkey, srv []byte, periodNum, periodLength uint64) []byte {
+	h := sha3.New256()
+	h.Write(HSDirIndexPrefixV3)
+	h.Write(id[:])
+	h.Write(srv)
+	binary.Write(h, binary.BigEndian, periodNum)
+	binary.Write(h, binary.BigEndian, periodLength)
+	return h.Sum(nil)
+}
+
+// ResponsibleHSDirsV3 returns HSDirs responsible for v3 descriptor
+// with blinded key blindedKey in time period periodNum which is
+// periodLength minutes long using shared random value srv.
+// spread is the number of HSDirs per replica: HSDirSpreadStoreV3
+// for services and HSDirSpreadFetchV3 for clients.
+func ResponsibleHSDirsV3(hsdirs []HSDir, blindedKey ed25519.PublicKey, srv []byte, periodNum, periodLength uint64, spread int) (responsible []HSDir) {
+	type node struct {
+		hsdir HSDir
+		index []byte
+	}
+	nodes := make([]node, len(hsdirs))
+	for i, hsdir := range hsdirs {
+		nodes[i] = node{hsdir, HSDirIndexV3(hsdir.Ed25519ID, srv, periodNum, periodLength)}
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		return bytes.Compare(nodes[i].index, nodes[j].index) < 0
+	})
+	ring := make([]HSDir, len(nodes))
+	keys := make([][]byte, len(nodes))
+	for i := range nodes {
+		ring[i], keys[i] = nodes[i].hsdir, nodes[i].index
+	}
+	picked := make(map[int]bool)
+	for replica := 1; replica <= HSDirNReplicasV3; replica++ {
+		pos := HSIndexV3(blindedKey, uint64(replica), periodNum, periodLength)
+		for _, idx := range ringSuccessors(ring, keys, pos, spread, picked) {
+			picked[idx] = true
+			responsible = append(responsible, ring[idx])
+		}
+	}
+	return responsible
+}
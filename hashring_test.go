@@ -0,0 +1,116 @@
+package onionutil
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+/*
+ * Inputs are the ones of test_hs_indexes of tor: keys of 42s,
+ * shared random value of 43s, time period 42 of 1440 minutes.
+ * Outputs are calculated with hashlib of Python from formulas
+ * of rend-spec-v3 2.2.3.
+ */
+func TestHSIndexV3Vectors(t *testing.T) {
+	var id Ed25519Pubkey
+	copy(id[:], bytes.Repeat([]byte{42}, len(id)))
+	srv := bytes.Repeat([]byte{43}, 32)
+	for replica, expected := range map[uint64]string{
+		1: "b1a61fa67525d5f47f77e52012a130eaf08ac1eccd2dd65c1a92bdaa5e6f7a27",
+		2: "1518af69fe23923c5247402251b0b1ee1fab0a9b1d47e0a7791cc8a061766387",
+	} {
+		if !bytes.Equal(HSIndexV3(id[:], replica, 42, 1440), mustDecodeHex(t, expected)) {
+			t.Fatalf("wrong hs_index of replica %d", replica)
+		}
+	}
+	expected := mustDecodeHex(t, "3876a9f7ddca5cefc9e190a3639c93d2741f6fa9c4cc0af37750cddc89ec8b16")
+	if !bytes.Equal(HSDirIndexV3(id, srv, 42, 1440), expected) {
+		t.Fatal("wrong hsdir_index")
+	}
+}
+
+func testFingerprint(b byte) []byte {
+	return bytes.Repeat([]byte{b}, 20)
+}
+
+func TestResponsibleHSDirsV2(t *testing.T) {
+	var hsdirs []HSDir
+	for _, b := range []byte{0x50, 0x10, 0x40, 0x20, 0x30} {
+		hsdirs = append(hsdirs, HSDir{Fingerprint: testFingerprint(b)})
+	}
+	for _, c := range []struct {
+		descID   []byte
+		expected []byte
+	}{
+		{testFingerprint(0x05), []byte{0x10, 0x20, 0x30}},
+		/* HSDir with ID equal to the descriptor ID is responsible */
+		{testFingerprint(0x20), []byte{0x20, 0x30, 0x40}},
+		{testFingerprint(0x41), []byte{0x50, 0x10, 0x20}},
+		{testFingerprint(0x60), []byte{0x10, 0x20, 0x30}},
+	} {
+		var got []byte
+		for _, hsdir := range ResponsibleHSDirsV2(hsdirs, c.descID) {
+			got = append(got, hsdir.Fingerprint[0])
+		}
+		if !bytes.Equal(got, c.expected) {
+			t.Fatalf("responsible for %x: %x, expected %x", c.descID[0], got, c.expected)
+		}
+	}
+	if n := len(ResponsibleHSDirsV2(hsdirs[:2], testFingerprint(0))); n != 2 {
+		t.Fatalf("%d HSDirs out of 2 are responsible", n)
+	}
+}
+
+func TestRingSuccessors(t *testing.T) {
+	ring := make([]HSDir, 4)
+	keys := [][]byte{{0x10}, {0x20}, {0x30}, {0x40}}
+	if got := ringSuccessors(ring, keys, []byte{0x35}, 3, nil); !reflect.DeepEqual(got, []int{3, 0, 1}) {
+		t.Fatalf("wrong successors with wrap-around: %v", got)
+	}
+	exclude := map[int]bool{3: true, 1: true}
+	if got := ringSuccessors(ring, keys, []byte{0x35}, 3, exclude); !reflect.DeepEqual(got, []int{0, 2}) {
+		t.Fatalf("wrong successors with exclusion: %v", got)
+	}
+}
+
+func TestResponsibleHSDirsV3(t *testing.T) {
+	blindedKey := bytes.Repeat([]byte{1}, 32)
+	srv := bytes.Repeat([]byte{2}, 32)
+	var hsdirs []HSDir
+	for i := 0; i < 20; i++ {
+		var id Ed25519Pubkey
+		id[0] = byte(i)
+		hsdirs = append(hsdirs, HSDir{Ed25519ID: id})
+	}
+	responsible := ResponsibleHSDirsV3(hsdirs, blindedKey, srv, 42, 1440, HSDirSpreadStoreV3)
+	if len(responsible) != HSDirNReplicasV3*HSDirSpreadStoreV3 {
+		t.Fatalf("%d HSDirs are responsible", len(responsible))
+	}
+	seen := make(map[Ed25519Pubkey]bool)
+	for _, hsdir := range responsible {
+		if seen[hsdir.Ed25519ID] {
+			t.Fatal("HSDir is picked twice")
+		}
+		seen[hsdir.Ed25519ID] = true
+	}
+	/* The first HSDir follows hs_index of the first replica */
+	pos := HSIndexV3(blindedKey, 1, 42, 1440)
+	var first []byte
+	for _, hsdir := range hsdirs {
+		index := HSDirIndexV3(hsdir.Ed25519ID, srv, 42, 1440)
+		if bytes.Compare(index, pos) >= 0 && (first == nil || bytes.Compare(index, first) < 0) {
+			first = index
+		}
+	}
+	got := HSDirIndexV3(responsible[0].Ed25519ID, srv, 42, 1440)
+	if first != nil && !bytes.Equal(got, first) {
+		t.Fatal("wrong first responsible HSDir")
+	}
+
+	/* With few HSDirs every one is picked once */
+	responsible = ResponsibleHSDirsV3(hsdirs[:3], blindedKey, srv, 42, 1440, HSDirSpreadStoreV3)
+	if len(responsible) != 3 {
+		t.Fatalf("%d HSDirs out of 3 are responsible", len(responsible))
+	}
+}
@@ -0,0 +1,172 @@
+// hidservauth.go - descriptor cookies in hostname files and HidServAuth lines
+//
+// To the extent possible under law, Ivan Markin waived all copyright
+// and related or neighboring rights to this module of onionutil, using the creative
+// commons "cc0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package onionutil
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// DescriptorCookieEncodedLen is the length of base64-encoded
+// descriptor cookie along with its authorization type.
+const DescriptorCookieEncodedLen = 22
+
+// EncodeDescriptorCookie encodes cookie along with authorization
+// type authType (ClientAuthBasic or ClientAuthStealth) like Tor does
+// in hostname files and HidServAuth lines.
+func EncodeDescriptorCookie(cookie DescriptorCookie, authType int) string {
+	buf := make([]byte, DescriptorCookieSize+1)
+	copy(buf, cookie[:])
+	buf[DescriptorCookieSize] = byte(authType-1) << 4
+	return base64.StdEncoding.EncodeToString(buf)[:DescriptorCookieEncodedLen]
+}
+
+// ParseDescriptorCookie parses descriptor cookie encoded by
+// EncodeDescriptorCookie.
+func ParseDescriptorCookie(s string) (cookie DescriptorCookie, authType int, err error) {
+	if len(s) != DescriptorCookieEncodedLen {
+		return cookie, 0, fmt.Errorf("Wrong length of descriptor cookie: %d", len(s))
+	}
+	buf, err := base64.StdEncoding.DecodeString(s + "AA")
+	if err != nil {
+		return cookie, 0, err
+	}
+	authType = int(buf[DescriptorCookieSize]>>4) + 1
+	if authType != ClientAuthBasic && authType != ClientAuthStealth {
+		return cookie, 0, fmt.Errorf("Unknown authorization type of descriptor cookie: %d", authType)
+	}
+	copy(cookie[:], buf)
+	Zeroize(buf)
+	return cookie, authType, nil
+}
+
+// OnionAddress returns onion address the client has to use to access
+// service with permanent key pk: the address of pk for basic
+// authorization and the address of the client-specific key for
+// stealth one.
+func (client *ClientAuthV2) OnionAddress(pk *rsa.PublicKey) (string, error) {
+	if client.Key != nil {
+		return OnionAddressV2(&client.Key.PublicKey)
+	}
+	return OnionAddressV2(pk)
+}
+
+// AuthType returns ClientAuthStealth if the client has
+// client-specific key and ClientAuthBasic otherwise.
+func (client *ClientAuthV2) AuthType() int {
+	if client.Key != nil {
+		return ClientAuthStealth
+	}
+	return ClientAuthBasic
+}
+
+// HidServAuth returns the line clients put into their torrc
+// to access the service with permanent key pk.
+func (client *ClientAuthV2) HidServAuth(pk *rsa.PublicKey) (*HidServAuth, error) {
+	onionAddress, err := client.OnionAddress(pk)
+	if err != nil {
+		return nil, err
+	}
+	return &HidServAuth{
+		OnionAddress: onionAddress,
+		Cookie:       client.Cookie,
+		AuthType:     client.AuthType(),
+		ServiceName:  client.Name,
+	}, nil
+}
+
+// EncodeHostnameV2 returns the content of hostname file of v2
+// onion service with permanent key pk and authorized clients
+// like "<onion>.onion <cookie> # client: <name>" lines.
+func EncodeHostnameV2(pk *rsa.PublicKey, clients []*ClientAuthV2) ([]byte, error) {
+	if len(clients) == 0 {
+		onionAddress, err := OnionAddressV2(pk)
+		if err != nil {
+			return nil, err
+		}
+		return []byte(onionAddress + ".onion\n"), nil
+	}
+	b := new(bytes.Buffer)
+	for _, client := range clients {
+		onionAddress, err := client.OnionAddress(pk)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(b, "%s.onion %s # client: %s\n", onionAddress,
+			EncodeDescriptorCookie(client.Cookie, client.AuthType()), client.Name)
+	}
+	return b.Bytes(), nil
+}
+
+// SaveHostnameFileV2 writes hostname file of v2 onion service with
+// permanent key pk and authorized clients.
+func SaveHostnameFileV2(filename string, pk *rsa.PublicKey, clients []*ClientAuthV2) error {
+	data, err := EncodeHostnameV2(pk, clients)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, data, 0600)
+}
+
+// HidServAuth is client side authorization data of v2 onion
+// service (HidServAuth option of Tor).
+type HidServAuth struct {
+	// OnionAddress is without ".onion" suffix.
+	OnionAddress string
+	Cookie       DescriptorCookie
+	AuthType     int
+	// ServiceName is optional.
+	ServiceName string
+}
+
+// ParseHidServAuth parses value of HidServAuth option like
+// "<onion>.onion <cookie> [service-name]". "HidServAuth" keyword
+// and comments (like in hostname files) are allowed.
+func ParseHidServAuth(s string) (*HidServAuth, error) {
+	if i := strings.Index(s, "#"); i >= 0 {
+		s = s[:i]
+	}
+	fields := strings.Fields(s)
+	if len(fields) > 0 && strings.EqualFold(fields[0], "HidServAuth") {
+		fields = fields[1:]
+	}
+	if len(fields) != 2 && len(fields) != 3 {
+		return nil, errors.New("Malformed HidServAuth line")
+	}
+	onionAddress := strings.TrimSuffix(strings.ToLower(fields[0]), ".onion")
+	if !OnionAddressIsValidV2(onionAddress) {
+		return nil, addressError("not a v2 onion address")
+	}
+	cookie, authType, err := ParseDescriptorCookie(fields[1])
+	if err != nil {
+		return nil, err
+	}
+	auth := &HidServAuth{
+		OnionAddress: onionAddress,
+		Cookie:       cookie,
+		AuthType:     authType,
+	}
+	if len(fields) == 3 {
+		auth.ServiceName = fields[2]
+	}
+	return auth, nil
+}
+
+// String returns the value of HidServAuth option.
+func (auth *HidServAuth) String() string {
+	s := auth.OnionAddress + ".onion " + EncodeDescriptorCookie(auth.Cookie, auth.AuthType)
+	if auth.ServiceName != "" {
+		s += " " + auth.ServiceName
+	}
+	return s
+}
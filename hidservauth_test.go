@@ -0,0 +1,79 @@
+package onionutil
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"strings"
+	"testing"
+)
+
+func TestDescriptorCookieEncoding(t *testing.T) {
+	cookie, err := GenerateDescriptorCookie(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, authType := range []int{ClientAuthBasic, ClientAuthStealth} {
+		s := EncodeDescriptorCookie(cookie, authType)
+		parsed, parsedType, err := ParseDescriptorCookie(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if parsed != cookie || parsedType != authType {
+			t.Fatalf("Round trip of %s failed", s)
+		}
+	}
+	if _, _, err := ParseDescriptorCookie(strings.Repeat("A", 21) + "D"); err == nil {
+		t.Fatal("Unknown authorization type has been accepted")
+	}
+}
+
+func TestHostnameV2(t *testing.T) {
+	sk, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	basic, err := GenerateClientAuthV2(rand.Reader, "alice", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stealth, err := GenerateClientAuthV2(rand.Reader, "bob", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := EncodeHostnameV2(&sk.PublicKey, []*ClientAuthV2{basic, stealth})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if len(lines) != 2 || !strings.HasSuffix(lines[1], " # client: bob") {
+		t.Fatalf("Malformed hostname file:\n%s", data)
+	}
+	for i, client := range []*ClientAuthV2{basic, stealth} {
+		auth, err := ParseHidServAuth(lines[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := client.HidServAuth(&sk.PublicKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want.ServiceName = ""
+		if *auth != *want {
+			t.Fatalf("Line %q is parsed as %v", lines[i], auth)
+		}
+	}
+	auth, err := ParseHidServAuth("HidServAuth " + lines[1][:strings.Index(lines[1], " #")] + " bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if auth.AuthType != ClientAuthStealth || auth.ServiceName != "bob" {
+		t.Fatal("Wrong HidServAuth line has been parsed")
+	}
+	if bytes.HasPrefix(data, []byte(auth.OnionAddress)) {
+		t.Fatal("Stealth client got onion address of the service")
+	}
+	if reparsed, err := ParseHidServAuth(auth.String()); err != nil || *reparsed != *auth {
+		t.Fatalf("Round trip of %q failed: %v", auth.String(), err)
+	}
+}
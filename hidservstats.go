@@ -0,0 +1,131 @@
+// hidservstats.go - onion service statistics of extra-info descriptors
+//
+// To the extent possible under law, Ivan Markin waived all copyright
+// and related or neighboring rights to this module of onionutil, using the creative
+// commons "cc0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package onionutil
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nogoegst/onionutil/torparse"
+)
+
+// HidServStat is a value reported by a relay with noise added to it
+// (proposal 238): the real value is rounded up to a multiple
+// of BinSize and Laplace noise with scale DeltaF/Epsilon is added.
+type HidServStat struct {
+	Value   int64
+	DeltaF  float64
+	Epsilon float64
+	BinSize int64
+}
+
+// NoiseScale returns scale of the Laplace noise added to the value.
+func (s *HidServStat) NoiseScale() float64 {
+	return s.DeltaF / s.Epsilon
+}
+
+// HidServStats are onion service statistics of a relay over
+// the Interval ending at End.
+type HidServStats struct {
+	End      time.Time
+	Interval time.Duration
+	// RendRelayedCells is the number of cells on rendezvous
+	// circuits relayed by the relay.
+	RendRelayedCells *HidServStat
+	// DirOnionsSeen is the number of unique onion services
+	// which descriptors the relay stored as an HSDir.
+	DirOnionsSeen *HidServStat
+}
+
+// Keywords of v2 and v3 statistics lines.
+var hidServStatsKeywords = map[int][3]string{
+	2: {"hidserv-stats-end", "hidserv-rend-relayed-cells", "hidserv-dir-onions-seen"},
+	3: {"hidserv-v3-stats-end", "hidserv-rend-v3-relayed-cells", "hidserv-dir-v3-onions-seen"},
+}
+
+// parseStatsEnd parses arguments of "*-stats-end" lines
+// like "2016-12-31 13:17:32 (86400 s)".
+func parseStatsEnd(entry torparse.TorEntry) (end time.Time, interval time.Duration, err error) {
+	if len(entry) != 4 || string(entry[3]) != "s)" || !strings.HasPrefix(string(entry[2]), "(") {
+		return end, interval, fmt.Errorf("Malformed statistics interval")
+	}
+	end, err = parseDocumentTime(entry[:2])
+	if err != nil {
+		return end, interval, err
+	}
+	seconds, err := strconv.ParseUint(string(entry[2][1:]), 10, 32)
+	if err != nil {
+		return end, interval, err
+	}
+	return end, time.Duration(seconds) * time.Second, nil
+}
+
+func parseHidServStat(entry torparse.TorEntry) (*HidServStat, error) {
+	if len(entry) < 1 {
+		return nil, fmt.Errorf("No statistic value")
+	}
+	s := new(HidServStat)
+	var err error
+	if s.Value, err = strconv.ParseInt(string(entry[0]), 10, 64); err != nil {
+		return nil, err
+	}
+	for _, arg := range entry[1:] {
+		kv := strings.SplitN(string(arg), "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("Malformed statistic parameter: %s", arg)
+		}
+		switch kv[0] {
+		case "delta_f":
+			s.DeltaF, err = strconv.ParseFloat(kv[1], 64)
+		case "epsilon":
+			s.Epsilon, err = strconv.ParseFloat(kv[1], 64)
+		case "bin_size":
+			s.BinSize, err = strconv.ParseInt(kv[1], 10, 64)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// ParseHidServStats parses onion service statistics of version
+// (2 or 3) from extra-info descriptor data. It returns nil if the
+// descriptor has no such statistics.
+func ParseHidServStats(data []byte, version int) (*HidServStats, error) {
+	keywords, ok := hidServStatsKeywords[version]
+	if !ok {
+		return nil, fmt.Errorf("Unknown onion service version %d", version)
+	}
+	doc, err := singleTorDocument(data)
+	if err != nil {
+		return nil, err
+	}
+	endEntry, ok := doc.First(keywords[0])
+	if !ok {
+		return nil, nil
+	}
+	stats := new(HidServStats)
+	stats.End, stats.Interval, err = parseStatsEnd(endEntry)
+	if err != nil {
+		return nil, parseError(doc, keywords[0], err)
+	}
+	if entry, ok := doc.First(keywords[1]); ok {
+		if stats.RendRelayedCells, err = parseHidServStat(entry); err != nil {
+			return nil, parseError(doc, keywords[1], err)
+		}
+	}
+	if entry, ok := doc.First(keywords[2]); ok {
+		if stats.DirOnionsSeen, err = parseHidServStat(entry); err != nil {
+			return nil, parseError(doc, keywords[2], err)
+		}
+	}
+	return stats, nil
+}
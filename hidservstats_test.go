@@ -0,0 +1,41 @@
+package onionutil
+
+import (
+	"testing"
+	"time"
+)
+
+var testExtraInfo = []byte(`extra-info moria1 9695DFC35FFEB861329B9F1AB04C46397020CE31
+published 2017-01-01 13:17:33
+hidserv-stats-end 2016-12-31 13:17:32 (86400 s)
+hidserv-rend-relayed-cells 18936 delta_f=2048 epsilon=0.30 bin_size=1024
+hidserv-dir-onions-seen -22 delta_f=8 epsilon=0.30 bin_size=8
+router-signature
+-----BEGIN SIGNATURE-----
+AQID
+-----END SIGNATURE-----
+`)
+
+func TestParseHidServStats(t *testing.T) {
+	stats, err := ParseHidServStats(testExtraInfo, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !stats.End.Equal(time.Date(2016, 12, 31, 13, 17, 32, 0, time.UTC)) || stats.Interval != 24*time.Hour {
+		t.Fatalf("wrong interval: %v %v", stats.End, stats.Interval)
+	}
+	cells := stats.RendRelayedCells
+	if cells == nil || cells.Value != 18936 || cells.DeltaF != 2048 || cells.BinSize != 1024 {
+		t.Fatalf("wrong relayed cells: %+v", cells)
+	}
+	if stats.DirOnionsSeen == nil || stats.DirOnionsSeen.Value != -22 {
+		t.Fatalf("wrong onions seen: %+v", stats.DirOnionsSeen)
+	}
+	if scale := stats.DirOnionsSeen.NoiseScale(); scale < 26.66 || scale > 26.67 {
+		t.Fatalf("wrong noise scale: %v", scale)
+	}
+	stats, err = ParseHidServStats(testExtraInfo, 3)
+	if err != nil || stats != nil {
+		t.Fatalf("v3 statistics are found: %+v, %v", stats, err)
+	}
+}
@@ -0,0 +1,393 @@
+// hsdescv3.go - deal with v3 onion service descriptors
+//
+// To the extent possible under law, Ivan Markin waived all copyright
+// and related or neighboring rights to this module of onionutil, using the creative
+// commons "cc0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package onionutil
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/nogoegst/onionutil/internal/encoding"
+	"github.com/nogoegst/onionutil/torparse"
+	"golang.org/x/crypto/ed25519"
+)
+
+var (
+	DescVersionV3 = 3
+	// DescLifetimeV3 is the default descriptor lifetime.
+	DescLifetimeV3 = 180 * time.Minute
+	// AuthTypeX25519 is the only supported client authorization type.
+	AuthTypeX25519 = "x25519"
+	// Create2FormatNTor is the ntor handshake type of CREATE2 cells.
+	Create2FormatNTor = 2
+)
+
+// OnionDescriptorV3 is the outer (plaintext) layer of v3 onion
+// service descriptor (rend-spec-v3 2.4).
+type OnionDescriptorV3 struct {
+	Version  int
+	Lifetime time.Duration
+	// SigningKeyCert certifies descriptor signing key with the
+	// blinded key of the service.
+	SigningKeyCert  *Certificate
+	RevisionCounter uint64
+	// Superencrypted is the encrypted middle layer.
+	Superencrypted []byte
+	Signature      Ed25519Signature
+
+	// Raw is the encoded descriptor if it's parsed.
+	Raw []byte
+	// parsedBody is Body() at the moment of parsing which
+	// tells whether the fields still correspond to Raw.
+	parsedBody []byte
+}
+
+// AuthClientV3 is an "auth-client" entry of the middle layer.
+type AuthClientV3 struct {
+	ClientID        [8]byte
+	IV              [16]byte
+	EncryptedCookie [32]byte
+}
+
+// SuperencryptedLayerV3 is the plaintext of the middle layer
+// of v3 descriptor (rend-spec-v3 2.5.1.2).
+type SuperencryptedLayerV3 struct {
+	AuthType     string
+	EphemeralKey Curve25519Pubkey
+	AuthClients  []AuthClientV3
+	// Encrypted is the encrypted inner layer.
+	Encrypted []byte
+}
+
+// EncryptedLayerV3 is the plaintext of the inner layer
+// of v3 descriptor (rend-spec-v3 2.5.2.2).
+type EncryptedLayerV3 struct {
+	Create2Formats     []int
+	IntroAuthRequired  []string
+	SingleOnionService bool
+	// IntroPoints are raw "introduction-point" sections.
+	IntroPoints [][]byte
+}
+
+// BlindedKey returns the blinded public key which signs the
+// descriptor signing key. It is used as the descriptor identifier.
+func (desc *OnionDescriptorV3) BlindedKey() ed25519.PublicKey {
+	if desc.SigningKeyCert == nil {
+		return nil
+	}
+	return desc.SigningKeyCert.SigningKey()
+}
+
+// SigningKey returns the descriptor signing key.
+func (desc *OnionDescriptorV3) SigningKey() ed25519.PublicKey {
+	if desc.SigningKeyCert == nil {
+		return nil
+	}
+	return ed25519.PublicKey(desc.SigningKeyCert.CertifiedKey[:])
+}
+
+func singleTorDocument(data []byte) (torparse.TorDocument, error) {
+	docs, _ := torparse.ParseTorDocument(data)
+	if len(docs) != 1 {
+		return torparse.TorDocument{}, errors.New("Expected exactly one document")
+	}
+	return docs[0], nil
+}
+
+func decodeBase64(data []byte) ([]byte, error) {
+	return encoding.DecodeBase64(data)
+}
+
+func decodeBase64Fixed(dst, data []byte) error {
+	return encoding.DecodeBase64Fixed(dst, data)
+}
+
+func ParseOnionDescriptorV3(data []byte) (*OnionDescriptorV3, error) {
+	doc, err := singleTorDocument(data)
+	if err != nil {
+		return nil, err
+	}
+	for _, kw := range []string{"hs-descriptor", "descriptor-lifetime",
+		"descriptor-signing-key-cert", "revision-counter",
+		"superencrypted", "signature"} {
+		if !torparse.ExactlyOnce(doc.Entries[kw]) {
+			return nil, fmt.Errorf("%s must appear exactly once", kw)
+		}
+	}
+	if doc.Items[len(doc.Items)-1].Keyword != "signature" {
+		return nil, errors.New("signature must be the last item")
+	}
+	desc := &OnionDescriptorV3{Raw: doc.Raw}
+	desc.Version, err = strconv.Atoi(string(doc.Entries["hs-descriptor"].FJoined()))
+	if err != nil {
+		return nil, err
+	}
+	if desc.Version != DescVersionV3 {
+		return nil, fmt.Errorf("Unsupported descriptor version %d", desc.Version)
+	}
+	lifetime, err := strconv.ParseUint(string(doc.Entries["descriptor-lifetime"].FJoined()), 10, 32)
+	if err != nil {
+		return nil, err
+	}
+	desc.Lifetime = time.Duration(lifetime) * time.Minute
+	cert, err := ParseCertFromBytes(doc.Entries["descriptor-signing-key-cert"].FJoined())
+	if err != nil {
+		return nil, err
+	}
+	desc.SigningKeyCert = &cert
+	desc.RevisionCounter, err = strconv.ParseUint(string(doc.Entries["revision-counter"].FJoined()), 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	desc.Superencrypted = doc.Entries["superencrypted"].FJoined()
+	if err := decodeBase64Fixed(desc.Signature[:], doc.Entries["signature"].FJoined()); err != nil {
+		return nil, err
+	}
+	desc.parsedBody = desc.Body()
+	return desc, nil
+}
+
+func (desc *OnionDescriptorV3) body() *torparse.Document {
+	d := torparse.NewDocument()
+	d.Item("hs-descriptor", strconv.Itoa(desc.Version))
+	d.Item("descriptor-lifetime", strconv.FormatInt(int64(desc.Lifetime/time.Minute), 10))
+	var cert []byte
+	if desc.SigningKeyCert != nil {
+		cert = desc.SigningKeyCert.Bytes()
+	}
+	d.ItemObject("descriptor-signing-key-cert", "ED25519 CERT", cert)
+	d.Item("revision-counter", strconv.FormatUint(desc.RevisionCounter, 10))
+	d.ItemObject("superencrypted", "MESSAGE", desc.Superencrypted)
+	return d
+}
+
+// Body returns encoding of the descriptor up to the signature.
+func (desc *OnionDescriptorV3) Body() []byte {
+	b, _ := desc.body().Bytes()
+	return b
+}
+
+func (desc *OnionDescriptorV3) Bytes() []byte {
+	d := desc.body()
+	d.Item("signature", base64.RawStdEncoding.EncodeToString(desc.Signature[:]))
+	b, _ := d.Bytes()
+	return b
+}
+
+func ParseSuperencryptedLayerV3(data []byte) (*SuperencryptedLayerV3, error) {
+	doc, err := singleTorDocument(data)
+	if err != nil {
+		return nil, err
+	}
+	for _, kw := range []string{"desc-auth-type", "desc-auth-ephemeral-key", "encrypted"} {
+		if !torparse.ExactlyOnce(doc.Entries[kw]) {
+			return nil, fmt.Errorf("%s must appear exactly once", kw)
+		}
+	}
+	layer := &SuperencryptedLayerV3{
+		AuthType: string(doc.Entries["desc-auth-type"].FJoined()),
+	}
+	if err := decodeBase64Fixed(layer.EphemeralKey[:],
+		doc.Entries["desc-auth-ephemeral-key"].FJoined()); err != nil {
+		return nil, err
+	}
+	for _, entry := range doc.Entries["auth-client"] {
+		if len(entry) != 3 {
+			return nil, errors.New("Malformed auth-client entry")
+		}
+		var client AuthClientV3
+		if err := decodeBase64Fixed(client.ClientID[:], entry[0]); err != nil {
+			return nil, err
+		}
+		if err := decodeBase64Fixed(client.IV[:], entry[1]); err != nil {
+			return nil, err
+		}
+		if err := decodeBase64Fixed(client.EncryptedCookie[:], entry[2]); err != nil {
+			return nil, err
+		}
+		layer.AuthClients = append(layer.AuthClients, client)
+	}
+	layer.Encrypted = doc.Entries["encrypted"].FJoined()
+	return layer, nil
+}
+
+// Bytes returns encoding of the layer. It returns nil if
+// the auth type is malformed.
+func (layer *SuperencryptedLayerV3) Bytes() []byte {
+	d := torparse.NewDocument()
+	d.Item("desc-auth-type", layer.AuthType)
+	d.Item("desc-auth-ephemeral-key",
+		base64.StdEncoding.EncodeToString(layer.EphemeralKey[:]))
+	for _, client := range layer.AuthClients {
+		d.Item("auth-client",
+			base64.RawStdEncoding.EncodeToString(client.ClientID[:]),
+			base64.RawStdEncoding.EncodeToString(client.IV[:]),
+			base64.RawStdEncoding.EncodeToString(client.EncryptedCookie[:]))
+	}
+	d.ItemObject("encrypted", "MESSAGE", layer.Encrypted)
+	b, _ := d.Bytes()
+	return b
+}
+
+// splitSections splits data into the part before the first line
+// starting with keyword and sections each starting with such line.
+func splitSections(data []byte, keyword string) (head []byte, sections [][]byte) {
+	sep := []byte("\n" + keyword + " ")
+	start := bytes.Index(data, sep)
+	if bytes.HasPrefix(data, sep[1:]) {
+		start = -1
+	} else if start < 0 {
+		return data, nil
+	}
+	head = data[:start+1]
+	data = data[start+1:]
+	for len(data) > 0 {
+		next := bytes.Index(data[1:], sep)
+		if next < 0 {
+			sections = append(sections, data)
+			break
+		}
+		sections = append(sections, data[:next+2])
+		data = data[next+2:]
+	}
+	return head, sections
+}
+
+func ParseEncryptedLayerV3(data []byte) (*EncryptedLayerV3, error) {
+	head, intros := splitSections(data, "introduction-point")
+	doc, err := singleTorDocument(head)
+	if err != nil {
+		return nil, err
+	}
+	if !torparse.ExactlyOnce(doc.Entries["create2-formats"]) {
+		return nil, errors.New("create2-formats must appear exactly once")
+	}
+	layer := &EncryptedLayerV3{IntroPoints: intros}
+	for _, f := range doc.Entries["create2-formats"][0] {
+		format, err := strconv.Atoi(string(f))
+		if err != nil {
+			return nil, err
+		}
+		layer.Create2Formats = append(layer.Create2Formats, format)
+	}
+	if value, ok := doc.Entries["intro-auth-required"]; ok {
+		if !torparse.AtMostOnce(value) {
+			return nil, errors.New("intro-auth-required must appear at most once")
+		}
+		for _, authType := range value[0] {
+			layer.IntroAuthRequired = append(layer.IntroAuthRequired, string(authType))
+		}
+	}
+	if value, ok := doc.Entries["single-onion-service"]; ok {
+		if !torparse.AtMostOnce(value) {
+			return nil, errors.New("single-onion-service must appear at most once")
+		}
+		layer.SingleOnionService = true
+	}
+	return layer, nil
+}
+
+// Bytes returns encoding of the layer. It returns nil if
+// the layer contains malformed items.
+func (layer *EncryptedLayerV3) Bytes() []byte {
+	var formats []string
+	for _, f := range layer.Create2Formats {
+		formats = append(formats, strconv.Itoa(f))
+	}
+	d := torparse.NewDocument()
+	d.Item("create2-formats", formats...)
+	if len(layer.IntroAuthRequired) > 0 {
+		d.Item("intro-auth-required", layer.IntroAuthRequired...)
+	}
+	if layer.SingleOnionService {
+		d.Item("single-onion-service")
+	}
+	for _, ip := range layer.IntroPoints {
+		d.AppendRaw(ip)
+	}
+	b, _ := d.Bytes()
+	return b
+}
+
+// DescSigPrefixV3 is prepended to the descriptor body before signing.
+var DescSigPrefixV3 = []byte("Tor onion service descriptor sig v3")
+
+// CertifySigningKey embeds certificate of descriptor signing key pk
+// signed with blinded key blindedKey into desc.
+func (desc *OnionDescriptorV3) CertifySigningKey(blindedKey *Ed25519ExpandedKey, pk ed25519.PublicKey, expiration time.Time) {
+	var certified Ed25519Pubkey
+	copy(certified[:], pk)
+	blindedPk := blindedKey.Public().(ed25519.PublicKey)
+	cert := NewCertificate(CertTypeHSDescSigning, certified, expiration, blindedPk)
+	copy(cert.Signature[:], blindedKey.sign(cert.Body()))
+	desc.SigningKeyCert = cert
+}
+
+// Sign signs desc with descriptor signing key sk. The signing key
+// must be certified beforehand.
+func (desc *OnionDescriptorV3) Sign(sk ed25519.PrivateKey) error {
+	if !bytes.Equal(desc.SigningKey(), sk.Public().(ed25519.PublicKey)) {
+		return errors.New("Signing key is not certified")
+	}
+	sig, err := SignWithPrefix(sk, SigPrefixDescriptorV3, desc.Body())
+	if err != nil {
+		return err
+	}
+	copy(desc.Signature[:], sig)
+	desc.Raw, desc.parsedBody = nil, nil
+	return nil
+}
+
+// signedPart returns the part of the encoded descriptor up to
+// the signature line as it was parsed. Descriptors which are
+// not parsed or have been changed since are encoded anew.
+func (desc *OnionDescriptorV3) signedPart() []byte {
+	body := desc.Body()
+	if desc.Raw == nil || !bytes.Equal(body, desc.parsedBody) {
+		return body
+	}
+	doc, err := singleTorDocument(desc.Raw)
+	if err != nil {
+		return body
+	}
+	return doc.Preceding("signature")
+}
+
+// VerifySignature checks that the signing key certificate is
+// signed with blinded key blindedKey and isn't expired at time now,
+// and checks the signature of desc. blindedKey is the one the
+// descriptor is fetched with or derived from the onion address
+// (see BlindPublicKeyAt).
+func (desc *OnionDescriptorV3) VerifySignature(blindedKey ed25519.PublicKey, now time.Time) error {
+	cert := desc.SigningKeyCert
+	if cert == nil {
+		return errors.New("Descriptor has no signing key certificate")
+	}
+	if cert.CertType != CertTypeHSDescSigning {
+		return fmt.Errorf("Wrong signing key certificate type %d", cert.CertType)
+	}
+	if len(blindedKey) != ed25519.PublicKeySize {
+		return errors.New("No blinded key to verify descriptor")
+	}
+	if desc.BlindedKey() == nil {
+		return errors.New("Signing key certificate has no blinded key")
+	}
+	if err := cert.Verify(blindedKey); err != nil {
+		return err
+	}
+	if cert.Expired(now) {
+		return errors.New("Signing key certificate is expired")
+	}
+	if VerifyWithPrefix(desc.SigningKey(), SigPrefixDescriptorV3, desc.signedPart(), desc.Signature[:]) != nil {
+		return signatureError("descriptor")
+	}
+	return nil
+}
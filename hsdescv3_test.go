@@ -0,0 +1,164 @@
+package onionutil
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+func TestOnionDescriptorV3RoundTrip(t *testing.T) {
+	inner := &EncryptedLayerV3{
+		Create2Formats:    []int{Create2FormatNTor},
+		IntroAuthRequired: []string{"ed25519"},
+		IntroPoints: [][]byte{
+			[]byte("introduction-point AAAA\nonion-key ntor BBBB\n"),
+			[]byte("introduction-point CCCC\nonion-key ntor DDDD\n"),
+		},
+	}
+	parsedInner, err := ParseEncryptedLayerV3(inner.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parsedInner.IntroPoints) != 2 ||
+		!bytes.Equal(parsedInner.Bytes(), inner.Bytes()) {
+		t.Fatal("inner layer round-trip failed")
+	}
+
+	middle := &SuperencryptedLayerV3{
+		AuthType:    AuthTypeX25519,
+		AuthClients: make([]AuthClientV3, 16),
+		Encrypted:   []byte("encrypted"),
+	}
+	parsedMiddle, err := ParseSuperencryptedLayerV3(middle.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(parsedMiddle.Bytes(), middle.Bytes()) {
+		t.Fatal("middle layer round-trip failed")
+	}
+
+	blindedPk, blindedSk, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var signingKey Ed25519Pubkey
+	cert := NewCertificate(CertTypeHSDescSigning, signingKey,
+		time.Now().Add(time.Hour), blindedPk)
+	cert.Sign(blindedSk)
+	desc := &OnionDescriptorV3{
+		Version:         DescVersionV3,
+		Lifetime:        DescLifetimeV3,
+		SigningKeyCert:  cert,
+		RevisionCounter: 42,
+		Superencrypted:  []byte("superencrypted"),
+	}
+	parsed, err := ParseOnionDescriptorV3(desc.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(parsed.Bytes(), desc.Bytes()) {
+		t.Fatal("outer layer round-trip failed")
+	}
+	if !bytes.Equal(parsed.BlindedKey(), blindedPk) {
+		t.Fatal("blinded key is lost")
+	}
+}
+
+func TestOnionDescriptorV3Sign(t *testing.T) {
+	_, identitySk, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blindedKey := BlindPrivateKey(ExpandEd25519Key(identitySk), 1, 1440)
+	signingPk, signingSk, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	desc := &OnionDescriptorV3{
+		Version:         DescVersionV3,
+		Lifetime:        DescLifetimeV3,
+		RevisionCounter: 1,
+		Superencrypted:  []byte("superencrypted"),
+	}
+	if err := desc.Sign(signingSk); err == nil {
+		t.Fatal("signed without signing key certificate")
+	}
+	desc.CertifySigningKey(&blindedKey, signingPk, time.Now().Add(time.Hour))
+	if err := desc.Sign(signingSk); err != nil {
+		t.Fatal(err)
+	}
+	if err := LintOnionDescriptorV3(desc.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := ParseOnionDescriptorV3(desc.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	blindedPk := blindedKey.Public().(ed25519.PublicKey)
+	if err := parsed.VerifySignature(blindedPk, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(parsed.BlindedKey(), blindedPk) {
+		t.Fatal("wrong blinded key")
+	}
+	parsed.RevisionCounter++
+	if parsed.VerifySignature(blindedPk, time.Now()) == nil {
+		t.Fatal("tampered descriptor verified")
+	}
+}
+
+func TestOnionDescriptorV3Tampering(t *testing.T) {
+	_, identitySk, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blindedKey := BlindPrivateKey(ExpandEd25519Key(identitySk), 1, 1440)
+	blindedPk := blindedKey.Public().(ed25519.PublicKey)
+	signingPk, signingSk, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	desc := &OnionDescriptorV3{
+		Version:         DescVersionV3,
+		Lifetime:        DescLifetimeV3,
+		RevisionCounter: 1,
+		Superencrypted:  []byte("superencrypted"),
+	}
+	expiration := time.Now().Add(time.Hour)
+	desc.CertifySigningKey(&blindedKey, signingPk, expiration)
+	if err := desc.Sign(signingSk); err != nil {
+		t.Fatal(err)
+	}
+	data := desc.Bytes()
+
+	sigLine := bytes.Index(data, []byte("\nsignature ")) + 1
+	inserted := append(append(append([]byte{}, data[:sigLine]...), "unknown-item\n"...), data[sigLine:]...)
+	parsed, err := ParseOnionDescriptorV3(inserted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.VerifySignature(blindedPk, time.Now()) == nil {
+		t.Fatal("descriptor with inserted line verified")
+	}
+
+	parsed, err = ParseOnionDescriptorV3(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPk, _, _ := ed25519.GenerateKey(rand.Reader)
+	if parsed.VerifySignature(otherPk, time.Now()) == nil {
+		t.Fatal("descriptor verified with another blinded key")
+	}
+	if parsed.VerifySignature(nil, time.Now()) == nil {
+		t.Fatal("descriptor verified without blinded key")
+	}
+	if parsed.VerifySignature(blindedPk, expiration.Add(time.Hour)) == nil {
+		t.Fatal("descriptor with expired certificate verified")
+	}
+	if err := parsed.VerifySignature(blindedPk, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+}
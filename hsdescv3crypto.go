@@ -0,0 +1,316 @@
+// hsdescv3crypto.go - encryption of v3 onion service descriptor layers
+//
+// To the extent possible under law, Ivan Markin waived all copyright
+// and related or neighboring rights to this module of onionutil, using the creative
+// commons "cc0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package onionutil
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/ed25519"
+	"golang.org/x/crypto/sha3"
+)
+
+// Parameters of descriptor encryption (rend-spec-v3 2.5).
+var (
+	SuperencryptedConstantV3 = []byte("hsdir-superencrypted-data")
+	EncryptedConstantV3      = []byte("hsdir-encrypted-data")
+	CredentialPrefixV3       = []byte("credential")
+	SubcredentialPrefixV3    = []byte("subcredential")
+	// SuperencryptedPadMultipleV3 is the length the middle layer
+	// plaintext is padded to a multiple of.
+	SuperencryptedPadMultipleV3 = 10000
+	// FakeAuthClientsV3 is the number of fake auth-client entries
+	// added when client authorization is disabled.
+	FakeAuthClientsV3 = 16
+)
+
+const (
+	descSaltLen            = 16
+	descKeyLen             = 32
+	descIVLen              = 16
+	descMACLen             = 32
+	DescriptorCookieSizeV3 = 32
+)
+
+// CredentialV3 calculates credential of onion service with
+// identity key pk.
+func CredentialV3(pk ed25519.PublicKey) []byte {
+	h := sha3.New256()
+	h.Write(CredentialPrefixV3)
+	h.Write(pk)
+	return h.Sum(nil)
+}
+
+// SubcredentialV3 calculates subcredential of onion service with
+// identity key pk for the time period of blinded key blindedKey.
+func SubcredentialV3(pk, blindedKey ed25519.PublicKey) []byte {
+	h := sha3.New256()
+	h.Write(SubcredentialPrefixV3)
+	h.Write(CredentialV3(pk))
+	h.Write(blindedKey)
+	return h.Sum(nil)
+}
+
+func descriptorLayerKeys(secretData, subcredential []byte, revisionCounter uint64, salt, constant []byte) (key, iv, macKey []byte) {
+	kdf := sha3.NewShake256()
+	kdf.Write(secretData)
+	kdf.Write(subcredential)
+	binary.Write(kdf, binary.BigEndian, revisionCounter)
+	kdf.Write(salt)
+	kdf.Write(constant)
+	keys := make([]byte, descKeyLen+descIVLen+descMACLen)
+	kdf.Read(keys)
+	return keys[:descKeyLen], keys[descKeyLen : descKeyLen+descIVLen], keys[descKeyLen+descIVLen:]
+}
+
+func descriptorLayerMAC(macKey, salt, ciphertext []byte) []byte {
+	h := sha3.New256()
+	binary.Write(h, binary.BigEndian, uint64(len(macKey)))
+	h.Write(macKey)
+	binary.Write(h, binary.BigEndian, uint64(len(salt)))
+	h.Write(salt)
+	h.Write(ciphertext)
+	return h.Sum(nil)
+}
+
+// EncryptDescriptorLayerV3 encrypts plaintext of a descriptor layer.
+// constant is either SuperencryptedConstantV3 or EncryptedConstantV3.
+func EncryptDescriptorLayerV3(rand io.Reader, plaintext, secretData, subcredential []byte, revisionCounter uint64, constant []byte) ([]byte, error) {
+	salt := make([]byte, descSaltLen)
+	if _, err := io.ReadFull(rand, salt); err != nil {
+		return nil, err
+	}
+	key, iv, macKey := descriptorLayerKeys(secretData, subcredential, revisionCounter, salt, constant)
+	defer Zeroize(key)
+	defer Zeroize(macKey)
+	ciphertext, err := aesCTR(key, iv, plaintext)
+	if err != nil {
+		return nil, err
+	}
+	encrypted := append(salt, ciphertext...)
+	return append(encrypted, descriptorLayerMAC(macKey, salt, ciphertext)...), nil
+}
+
+// DecryptDescriptorLayerV3 decrypts descriptor layer encrypted with
+// EncryptDescriptorLayerV3 and checks its MAC.
+func DecryptDescriptorLayerV3(encrypted, secretData, subcredential []byte, revisionCounter uint64, constant []byte) ([]byte, error) {
+	if len(encrypted) < descSaltLen+descMACLen {
+		return nil, errors.New("Encrypted layer is too short")
+	}
+	salt := encrypted[:descSaltLen]
+	ciphertext := encrypted[descSaltLen : len(encrypted)-descMACLen]
+	mac := encrypted[len(encrypted)-descMACLen:]
+	key, iv, macKey := descriptorLayerKeys(secretData, subcredential, revisionCounter, salt, constant)
+	defer Zeroize(key)
+	defer Zeroize(macKey)
+	if !ConstantTimeEqual(mac, descriptorLayerMAC(macKey, salt, ciphertext)) {
+		return nil, errors.New("Wrong MAC of encrypted layer")
+	}
+	return aesCTR(key, iv, ciphertext)
+}
+
+// authClientKeys derives client ID and cookie encryption key from
+// x25519 shared secret of the client and the service.
+func authClientKeys(subcredential, secretSeed []byte) (clientID, cookieKey []byte) {
+	keys := make([]byte, 8+32)
+	kdf := sha3.NewShake256()
+	kdf.Write(subcredential)
+	kdf.Write(secretSeed)
+	kdf.Read(keys)
+	return keys[:8], keys[8:]
+}
+
+func newAuthClientV3(rand io.Reader, subcredential []byte, ephemeral *ClientAuthKeyV3, client Curve25519Pubkey, cookie []byte) (ac AuthClientV3, err error) {
+	var secretSeed [32]byte
+	curve25519.ScalarMult(&secretSeed, &ephemeral.Private, (*[32]byte)(&client))
+	clientID, cookieKey := authClientKeys(subcredential, secretSeed[:])
+	Zeroize(secretSeed[:])
+	defer Zeroize(cookieKey)
+	copy(ac.ClientID[:], clientID)
+	if _, err := io.ReadFull(rand, ac.IV[:]); err != nil {
+		return ac, err
+	}
+	encCookie, err := aesCTR(cookieKey, ac.IV[:], cookie)
+	if err != nil {
+		return ac, err
+	}
+	copy(ac.EncryptedCookie[:], encCookie)
+	return ac, nil
+}
+
+// DescriptorCookie recovers the descriptor cookie of the layer using
+// client authorization key clientKey.
+func (layer *SuperencryptedLayerV3) DescriptorCookie(subcredential []byte, clientKey *ClientAuthKeyV3) ([]byte, error) {
+	var secretSeed [32]byte
+	curve25519.ScalarMult(&secretSeed, &clientKey.Private, (*[32]byte)(&layer.EphemeralKey))
+	clientID, cookieKey := authClientKeys(subcredential, secretSeed[:])
+	Zeroize(secretSeed[:])
+	defer Zeroize(cookieKey)
+	for _, ac := range layer.AuthClients {
+		if !ConstantTimeEqual(ac.ClientID[:], clientID) {
+			continue
+		}
+		return aesCTR(cookieKey, ac.IV[:], ac.EncryptedCookie[:])
+	}
+	return nil, errors.New("Client is not authorized")
+}
+
+// randIntn returns a uniform random number in [0, n) read from rand.
+func randIntn(rand io.Reader, n int) (int, error) {
+	var b [4]byte
+	limit := ^uint32(0) - ^uint32(0)%uint32(n)
+	for {
+		if _, err := io.ReadFull(rand, b[:]); err != nil {
+			return 0, err
+		}
+		if v := binary.BigEndian.Uint32(b[:]); v < limit {
+			return int(v % uint32(n)), nil
+		}
+	}
+}
+
+// shuffleAuthClients shuffles acs so real entries can't be told
+// from fake ones by position.
+func shuffleAuthClients(rand io.Reader, acs []AuthClientV3) error {
+	for i := len(acs) - 1; i > 0; i-- {
+		j, err := randIntn(rand, i+1)
+		if err != nil {
+			return err
+		}
+		acs[i], acs[j] = acs[j], acs[i]
+	}
+	return nil
+}
+
+// EncryptLayers encrypts inner layer for onion service with identity
+// key pk and sets Superencrypted of desc. SigningKeyCert and
+// RevisionCounter of desc must be set. If clients is not empty only
+// clients with these keys are able to decrypt the inner layer.
+// The auth-client list is padded with fake entries to a multiple of
+// FakeAuthClientsV3 and shuffled. It fails if the inner layer or
+// the resulting descriptor exceed limits (see CheckLimits).
+func (desc *OnionDescriptorV3) EncryptLayers(rand io.Reader, pk ed25519.PublicKey, inner *EncryptedLayerV3, clients []Curve25519Pubkey) error {
+	if err := inner.CheckLimits(); err != nil {
+		return err
+	}
+	blindedKey := desc.BlindedKey()
+	if blindedKey == nil {
+		return errors.New("Descriptor has no signing key certificate")
+	}
+	subcredential := SubcredentialV3(pk, blindedKey)
+	ephemeral, err := GenerateClientAuthKeyV3(rand)
+	if err != nil {
+		return err
+	}
+	defer ephemeral.Zeroize()
+	middle := &SuperencryptedLayerV3{
+		AuthType:     AuthTypeX25519,
+		EphemeralKey: ephemeral.Public,
+	}
+	secretData := []byte(blindedKey)
+	if len(clients) > 0 {
+		cookie := make([]byte, DescriptorCookieSizeV3)
+		defer Zeroize(cookie)
+		if _, err := io.ReadFull(rand, cookie); err != nil {
+			return err
+		}
+		for _, client := range clients {
+			ac, err := newAuthClientV3(rand, subcredential, ephemeral, client, cookie)
+			if err != nil {
+				return err
+			}
+			middle.AuthClients = append(middle.AuthClients, ac)
+		}
+		secretData = append(append([]byte{}, blindedKey...), cookie...)
+		defer Zeroize(secretData)
+	}
+	/* Hide the number of clients as Tor does */
+	for len(middle.AuthClients) == 0 || len(middle.AuthClients)%FakeAuthClientsV3 != 0 {
+		var ac AuthClientV3
+		if _, err := io.ReadFull(rand, ac.ClientID[:]); err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(rand, ac.IV[:]); err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(rand, ac.EncryptedCookie[:]); err != nil {
+			return err
+		}
+		middle.AuthClients = append(middle.AuthClients, ac)
+	}
+	if err := shuffleAuthClients(rand, middle.AuthClients); err != nil {
+		return err
+	}
+	middle.Encrypted, err = EncryptDescriptorLayerV3(rand, inner.Bytes(), secretData,
+		subcredential, desc.RevisionCounter, EncryptedConstantV3)
+	if err != nil {
+		return err
+	}
+	plaintext := middle.Bytes()
+	if rem := len(plaintext) % SuperencryptedPadMultipleV3; rem != 0 {
+		plaintext = append(plaintext, make([]byte, SuperencryptedPadMultipleV3-rem)...)
+	}
+	desc.Superencrypted, err = EncryptDescriptorLayerV3(rand, plaintext, blindedKey,
+		subcredential, desc.RevisionCounter, SuperencryptedConstantV3)
+	if err != nil {
+		return err
+	}
+	/* Signature is of fixed size so it doesn't matter if it's set */
+	return desc.CheckLimits()
+}
+
+// DecryptLayers decrypts layers of desc of onion service onionAddress.
+// clientKey is required only if client authorization is enabled.
+func (desc *OnionDescriptorV3) DecryptLayers(onionAddress string, clientKey *ClientAuthKeyV3) (*SuperencryptedLayerV3, *EncryptedLayerV3, error) {
+	pk, err := OnionAddressPublicKeyV3(onionAddress)
+	if err != nil {
+		return nil, nil, err
+	}
+	blindedKey := desc.BlindedKey()
+	if blindedKey == nil {
+		return nil, nil, errors.New("Descriptor has no signing key certificate")
+	}
+	subcredential := SubcredentialV3(pk, blindedKey)
+	plaintext, err := DecryptDescriptorLayerV3(desc.Superencrypted, blindedKey,
+		subcredential, desc.RevisionCounter, SuperencryptedConstantV3)
+	if err != nil {
+		return nil, nil, err
+	}
+	middle, err := ParseSuperencryptedLayerV3(bytes.TrimRight(plaintext, "\x00"))
+	if err != nil {
+		return nil, nil, err
+	}
+	secretData := []byte(blindedKey)
+	plaintext, err = DecryptDescriptorLayerV3(middle.Encrypted, secretData,
+		subcredential, desc.RevisionCounter, EncryptedConstantV3)
+	if err != nil {
+		if clientKey == nil {
+			return middle, nil, err
+		}
+		cookie, err := middle.DescriptorCookie(subcredential, clientKey)
+		if err != nil {
+			return middle, nil, err
+		}
+		secretData = append(append([]byte{}, blindedKey...), cookie...)
+		Zeroize(cookie)
+		defer Zeroize(secretData)
+		plaintext, err = DecryptDescriptorLayerV3(middle.Encrypted, secretData,
+			subcredential, desc.RevisionCounter, EncryptedConstantV3)
+		if err != nil {
+			return middle, nil, err
+		}
+	}
+	inner, err := ParseEncryptedLayerV3(bytes.TrimRight(plaintext, "\x00"))
+	if err != nil {
+		return middle, nil, err
+	}
+	return middle, inner, nil
+}
@@ -0,0 +1,128 @@
+package onionutil
+
+import (
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+func TestDescriptorLayersV3(t *testing.T) {
+	pk, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	onionAddress, err := OnionAddressV3(pk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blindedPk, blindedSk, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var signingKey Ed25519Pubkey
+	cert := NewCertificate(CertTypeHSDescSigning, signingKey,
+		time.Now().Add(time.Hour), blindedPk)
+	cert.Sign(blindedSk)
+	inner := &EncryptedLayerV3{Create2Formats: []int{Create2FormatNTor}}
+
+	desc := &OnionDescriptorV3{SigningKeyCert: cert, RevisionCounter: 7}
+	if err := desc.EncryptLayers(rand.Reader, pk, inner, nil); err != nil {
+		t.Fatal(err)
+	}
+	middle, decrypted, err := desc.DecryptLayers(onionAddress, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(middle.AuthClients) != FakeAuthClientsV3 ||
+		len(decrypted.Create2Formats) != 1 {
+		t.Fatal("wrong decrypted layers")
+	}
+
+	client, err := GenerateClientAuthKeyV3(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := GenerateClientAuthKeyV3(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = desc.EncryptLayers(rand.Reader, pk, inner, []Curve25519Pubkey{client.Public})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := desc.DecryptLayers(onionAddress, nil); err == nil {
+		t.Fatal("decrypted without client authorization")
+	}
+	if _, _, err := desc.DecryptLayers(onionAddress, other); err == nil {
+		t.Fatal("decrypted by unauthorized client")
+	}
+	if _, _, err := desc.DecryptLayers(onionAddress, client); err != nil {
+		t.Fatal(err)
+	}
+
+	desc.Superencrypted[len(desc.Superencrypted)/2] ^= 1
+	if _, _, err := desc.DecryptLayers(onionAddress, client); err == nil {
+		t.Fatal("tampered descriptor is decrypted")
+	}
+}
+
+func TestEncryptLayersAuthClientsPadding(t *testing.T) {
+	pk, identitySk, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	onionAddress, _ := OnionAddressV3(pk)
+	blindedKey := BlindPrivateKey(ExpandEd25519Key(identitySk), 1, 1440)
+	signingPk, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	desc := &OnionDescriptorV3{RevisionCounter: 1}
+	desc.CertifySigningKey(&blindedKey, signingPk, time.Now().Add(time.Hour))
+	inner := &EncryptedLayerV3{Create2Formats: []int{Create2FormatNTor}}
+
+	var keys []*ClientAuthKeyV3
+	var clients []Curve25519Pubkey
+	for _, n := range []struct{ clients, entries int }{{1, 16}, {16, 16}, {17, 32}} {
+		for len(clients) < n.clients {
+			key, err := GenerateClientAuthKeyV3(rand.Reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			keys = append(keys, key)
+			clients = append(clients, key.Public)
+		}
+		if err := desc.EncryptLayers(rand.Reader, pk, inner, clients); err != nil {
+			t.Fatal(err)
+		}
+		middle, _, err := desc.DecryptLayers(onionAddress, keys[len(keys)-1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(middle.AuthClients) != n.entries {
+			t.Fatalf("%d clients give %d auth-client entries, expected %d",
+				n.clients, len(middle.AuthClients), n.entries)
+		}
+	}
+}
+
+func TestShuffleAuthClients(t *testing.T) {
+	acs := make([]AuthClientV3, FakeAuthClientsV3)
+	for i := range acs {
+		acs[i].ClientID[0] = byte(i)
+	}
+	if err := shuffleAuthClients(rand.Reader, acs); err != nil {
+		t.Fatal(err)
+	}
+	seen := make(map[byte]bool)
+	moved := false
+	for i, ac := range acs {
+		seen[ac.ClientID[0]] = true
+		moved = moved || ac.ClientID[0] != byte(i)
+	}
+	if len(seen) != len(acs) || !moved {
+		t.Fatal("auth-client entries are not shuffled")
+	}
+}
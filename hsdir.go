@@ -0,0 +1,123 @@
+// hsdir.go - serve onion service descriptors like an HSDir does
+//
+// To the extent possible under law, Ivan Markin waived all copyright
+// and related or neighboring rights to this module of onionutil, using the creative
+// commons "cc0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package onionutil
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limits which HSDirs enforce on v2 descriptors (rend-spec 1.4).
+const (
+	MaxDescriptorSizeV2 = 20 * 1024
+	DescriptorMaxAgeV2  = 48 * time.Hour
+	DescriptorMaxSkewV2 = 24 * time.Hour
+)
+
+// HSDirHandler is an http.Handler that implements upload and fetch
+// of v2 onion service descriptors (POST /tor/rendezvous2/publish,
+// GET /tor/rendezvous2/<desc-id>) on top of a DescriptorStore.
+// Like DescriptorCache it refuses descriptors which are not
+// published later than the stored ones.
+type HSDirHandler struct {
+	mu    sync.Mutex
+	Store DescriptorStore
+	// MaxSize limits size of uploaded descriptors.
+	MaxSize int64
+	// MaxAge is maximum age of accepted descriptors. Stored
+	// descriptors expire after MaxAge since their publication.
+	MaxAge time.Duration
+	// MaxSkew is how far in the future publication time
+	// of accepted descriptors could be.
+	MaxSkew time.Duration
+}
+
+func NewHSDirHandler(store DescriptorStore) *HSDirHandler {
+	return &HSDirHandler{
+		Store:   store,
+		MaxSize: MaxDescriptorSizeV2,
+		MaxAge:  DescriptorMaxAgeV2,
+		MaxSkew: DescriptorMaxSkewV2,
+	}
+}
+
+func (h *HSDirHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	const prefix = "/tor/rendezvous2/"
+	switch {
+	case r.Method == "POST" && r.URL.Path == RendezvousPublishPath:
+		if err := h.publish(r.Body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	case r.Method == "GET" && strings.HasPrefix(r.URL.Path, prefix):
+		id := strings.ToLower(strings.TrimPrefix(r.URL.Path, prefix))
+		sd, err := h.Store.Get(id)
+		if err == ErrDescriptorNotFound {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Internal error", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write(sd.Raw)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (h *HSDirHandler) publish(body io.Reader) error {
+	raw, err := ioutil.ReadAll(io.LimitReader(body, h.MaxSize+1))
+	if err != nil {
+		return err
+	}
+	if int64(len(raw)) > h.MaxSize {
+		return ErrDescriptorTooLarge
+	}
+	results, _ := ParseOnionDescriptors(raw)
+	if len(results) != 1 {
+		return errors.New("Expected exactly one descriptor")
+	}
+	if results[0].Err != nil {
+		return results[0].Err
+	}
+	desc := results[0].Desc
+	if err := desc.validate(time.Now(), h.MaxAge, h.MaxSkew); err != nil {
+		return err
+	}
+	if err := desc.VerifySignature(); err != nil {
+		return err
+	}
+	sd := &StoredDescriptor{
+		ID:        Base32Encode(desc.DescID),
+		Version:   desc.Version,
+		Published: desc.PublicationTime,
+		Expires:   desc.PublicationTime.Add(h.MaxAge),
+		Raw:       raw,
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	old, err := h.Store.Get(sd.ID)
+	switch err {
+	case nil:
+		if err := checkReplacement(old, sd); err != nil {
+			return err
+		}
+	case ErrDescriptorNotFound:
+	default:
+		return err
+	}
+	return h.Store.Put(sd)
+}
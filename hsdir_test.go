@@ -0,0 +1,108 @@
+package onionutil
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHSDirHandler(t *testing.T) {
+	sk, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var desc OnionDescriptor
+	desc.InitDefaults()
+	desc.IntropointsBlock = []byte("introduction-point\n")
+	if err := desc.FullSign(sk); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(NewHSDirHandler(NewMemoryStore()))
+	defer srv.Close()
+
+	resp, err := http.Post(srv.URL+RendezvousPublishPath, "text/plain",
+		bytes.NewReader(desc.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("upload failed: %v", resp.Status)
+	}
+
+	resp, err = http.Get(srv.URL + RendezvousDescriptorPath(desc.DescID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fetched, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(fetched, desc.Bytes()) {
+		t.Fatal("fetched descriptor differs from the uploaded one")
+	}
+
+	stale := desc
+	stale.PublicationTime = time.Now().Add(-2 * DescriptorMaxAgeV2)
+	if err := stale.Sign(sk); err != nil {
+		t.Fatal(err)
+	}
+	resp, err = http.Post(srv.URL+RendezvousPublishPath, "text/plain",
+		bytes.NewReader(stale.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("stale descriptor is accepted: %v", resp.Status)
+	}
+}
+
+func TestHSDirHandlerReplacement(t *testing.T) {
+	sk, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var desc OnionDescriptor
+	desc.InitDefaults()
+	desc.IntropointsBlock = []byte("introduction-point\n")
+	if err := desc.FullSign(sk); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(NewHSDirHandler(NewMemoryStore()))
+	defer srv.Close()
+	publish := func(d OnionDescriptor, publicationTime time.Time) int {
+		d.PublicationTime = publicationTime
+		if err := d.Sign(sk); err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.Post(srv.URL+RendezvousPublishPath, "text/plain",
+			bytes.NewReader(d.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	published := desc.PublicationTime
+	if status := publish(desc, published); status != http.StatusOK {
+		t.Fatalf("upload failed: %d", status)
+	}
+	if status := publish(desc, published.Add(-time.Hour)); status != http.StatusBadRequest {
+		t.Fatalf("older descriptor is accepted: %d", status)
+	}
+	if status := publish(desc, published); status != http.StatusBadRequest {
+		t.Fatalf("replayed descriptor is accepted: %d", status)
+	}
+	if status := publish(desc, published.Add(time.Hour)); status != http.StatusOK {
+		t.Fatalf("newer descriptor is refused: %d", status)
+	}
+}
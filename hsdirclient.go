@@ -0,0 +1,84 @@
+// hsdirclient.go - upload and download onion service descriptors
+//
+// To the extent possible under law, Ivan Markin waived all copyright
+// and related or neighboring rights to this module of onionutil, using the creative
+// commons "cc0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package onionutil
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// DialContextFunc is a function that dials addr on network
+// like net.Dialer.DialContext does.
+type DialContextFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// NewDirClientDialer returns DirClient which connects to directory
+// server at baseURL via dial (e.g. through a SOCKS proxy).
+func NewDirClientDialer(baseURL string, dial DialContextFunc) *DirClient {
+	return &DirClient{
+		BaseURL: baseURL,
+		HTTPClient: &http.Client{
+			Transport: &http.Transport{DialContext: dial},
+		},
+	}
+}
+
+// NewDirClientConn returns DirClient which makes a single request
+// over already established connection conn.
+func NewDirClientConn(conn net.Conn) *DirClient {
+	var once sync.Once
+	dial := func(ctx context.Context, network, addr string) (c net.Conn, err error) {
+		err = errors.New("Connection is already used")
+		once.Do(func() { c, err = conn, nil })
+		return c, err
+	}
+	dc := NewDirClientDialer("http://"+conn.RemoteAddr().String(), dial)
+	dc.HTTPClient.Transport.(*http.Transport).DisableKeepAlives = true
+	return dc
+}
+
+// Post uploads body to path.
+func (dc *DirClient) Post(ctx context.Context, path string, body []byte) error {
+	req, err := http.NewRequest("POST", strings.TrimRight(dc.BaseURL, "/")+path,
+		bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	resp, err := dc.httpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Unable to upload to %s: %s", path, resp.Status)
+	}
+	return nil
+}
+
+// PublishOnionDescriptor uploads v2 descriptor desc to an HSDir.
+func (dc *DirClient) PublishOnionDescriptor(ctx context.Context, desc *OnionDescriptor) error {
+	body, err := desc.Encode()
+	if err != nil {
+		return err
+	}
+	return dc.Post(ctx, RendezvousPublishPath, body)
+}
+
+// PublishOnionDescriptorV3 uploads v3 descriptor desc to an HSDir.
+func (dc *DirClient) PublishOnionDescriptorV3(ctx context.Context, desc *OnionDescriptorV3) error {
+	return dc.Post(ctx, HSPublishPathV3, desc.Bytes())
+}
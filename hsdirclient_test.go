@@ -0,0 +1,49 @@
+package onionutil
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"net"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHSDirClient(t *testing.T) {
+	sk, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var desc OnionDescriptor
+	desc.InitDefaults()
+	desc.IntropointsBlock = []byte("introduction-point\n")
+	if err := desc.FullSign(sk); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(NewHSDirHandler(NewMemoryStore()))
+	defer srv.Close()
+	ctx := context.Background()
+
+	dc := NewDirClientDialer(srv.URL, new(net.Dialer).DialContext)
+	if err := dc.PublishOnionDescriptor(ctx, &desc); err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	dc = NewDirClientConn(conn)
+	fetched, err := dc.FetchOnionDescriptor(ctx, desc.DescID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(fetched.Bytes(), desc.Bytes()) {
+		t.Fatal("fetched descriptor differs from the uploaded one")
+	}
+	if _, err := dc.FetchOnionDescriptor(ctx, desc.DescID); err == nil {
+		t.Fatal("connection is reused")
+	}
+}
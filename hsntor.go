@@ -0,0 +1,199 @@
+// hsntor.go - hs-ntor handshake of v3 onion services
+//
+// To the extent possible under law, Ivan Markin waived all copyright
+// and related or neighboring rights to this module of onionutil, using the creative
+// commons "cc0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package onionutil
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"golang.org/x/crypto/sha3"
+)
+
+// hs-ntor handshake constants (rend-spec-v3 [NTOR-WITH-EXTRA-DATA]).
+var (
+	HSNTorProtoID = []byte("tor-hs-ntor-curve25519-sha3-256-1")
+	hsntorTEnc    = []byte("tor-hs-ntor-curve25519-sha3-256-1:hs_key_extract")
+	hsntorMExpand = []byte("tor-hs-ntor-curve25519-sha3-256-1:hs_key_expand")
+	hsntorTVerify = []byte("tor-hs-ntor-curve25519-sha3-256-1:hs_verify")
+	hsntorTMac    = []byte("tor-hs-ntor-curve25519-sha3-256-1:hs_mac")
+)
+
+const (
+	hsntorEncKeyLen = 32
+	hsntorMACLen    = 32
+	// HSNTorReplySize is the size of HANDSHAKE_INFO of RENDEZVOUS
+	// cells: SERVER_PK | AUTH.
+	HSNTorReplySize = NTorOnionKeySize + hsntorMACLen
+	// HSNTorKeysSize is the size of key material of rendezvous
+	// circuits: Df | Db | Kf | Kb.
+	HSNTorKeysSize = 2*sha3Size + 2*hsntorEncKeyLen
+	sha3Size       = 32
+)
+
+// hsMAC is MAC of rend-spec-v3: SHA3-256(htonll(len(key)) | key | msg).
+func hsMAC(key, msg []byte) []byte {
+	h := sha3.New256()
+	binary.Write(h, binary.BigEndian, uint64(len(key)))
+	h.Write(key)
+	h.Write(msg)
+	return h.Sum(nil)
+}
+
+// hsntorIntroKeys derives keys which encrypt and authenticate
+// INTRODUCE1 cells from exp, which is EXP(B,x) for clients and
+// EXP(X,b) for services, introduction point authentication key
+// authKey, client key X, service encryption key B and subcredential.
+func hsntorIntroKeys(exp []byte, authKey Ed25519Pubkey, X, B NTorOnionKey, subcredential []byte) (encKey, macKey []byte) {
+	w := new(bytes.Buffer)
+	w.Write(exp)
+	w.Write(authKey[:])
+	w.Write(X[:])
+	w.Write(B[:])
+	w.Write(HSNTorProtoID)
+	w.Write(hsntorTEnc)
+	w.Write(hsntorMExpand)
+	w.Write(subcredential)
+	defer Zeroize(w.Bytes())
+	kdf := sha3.NewShake256()
+	kdf.Write(w.Bytes())
+	keys := make([]byte, hsntorEncKeyLen+hsntorMACLen)
+	kdf.Read(keys)
+	return keys[:hsntorEncKeyLen], keys[hsntorEncKeyLen:]
+}
+
+// hsntorRendKeys derives AUTH_INPUT_MAC and key material of
+// rendezvous circuit from exp1 and exp2 which are EXP(Y,x) and
+// EXP(B,x) for clients and EXP(X,y) and EXP(X,b) for services.
+func hsntorRendKeys(exp1, exp2 []byte, authKey Ed25519Pubkey, B, X, Y NTorOnionKey) (auth, keys []byte) {
+	w := new(bytes.Buffer)
+	w.Write(exp1)
+	w.Write(exp2)
+	w.Write(authKey[:])
+	w.Write(B[:])
+	w.Write(X[:])
+	w.Write(Y[:])
+	w.Write(HSNTorProtoID)
+	secretInput := w.Bytes()
+	defer Zeroize(secretInput)
+
+	keySeed := hsMAC(secretInput, hsntorTEnc)
+	defer Zeroize(keySeed)
+	authInput := new(bytes.Buffer)
+	authInput.Write(hsMAC(secretInput, hsntorTVerify))
+	authInput.Write(authKey[:])
+	authInput.Write(B[:])
+	authInput.Write(Y[:])
+	authInput.Write(X[:])
+	authInput.Write(HSNTorProtoID)
+	authInput.Write(ntorServerStr)
+	auth = hsMAC(authInput.Bytes(), hsntorTMac)
+
+	kdf := sha3.NewShake256()
+	kdf.Write(keySeed)
+	kdf.Write(hsntorMExpand)
+	keys = make([]byte, HSNTorKeysSize)
+	kdf.Read(keys)
+	return auth, keys
+}
+
+// HSNTorClientHandshake is the client side state of hs-ntor handshake
+// with a service through introduction point with authentication key
+// AuthKey and service encryption key B.
+type HSNTorClientHandshake struct {
+	AuthKey       Ed25519Pubkey
+	B             NTorOnionKey
+	Subcredential []byte
+	ephemeral     *NTorKeypair
+}
+
+// NewHSNTorClientHandshake starts handshake with a service with
+// subcredential subcredential through introduction point ip
+// of its descriptor.
+func NewHSNTorClientHandshake(rand io.Reader, ip *IntroductionPointV3, subcredential []byte) (*HSNTorClientHandshake, error) {
+	if ip.AuthKeyCert == nil {
+		return nil, errors.New("No introduction point authentication key")
+	}
+	ephemeral, err := GenerateNTorKeypair(rand)
+	if err != nil {
+		return nil, err
+	}
+	return &HSNTorClientHandshake{
+		AuthKey:       ip.AuthKeyCert.CertifiedKey,
+		B:             ip.EncKey,
+		Subcredential: subcredential,
+		ephemeral:     ephemeral,
+	}, nil
+}
+
+// Introduce returns INTRODUCE1 cell carrying data.
+func (h *HSNTorClientHandshake) Introduce(data *IntroduceDataV3) (*Introduce1V3, error) {
+	ip := &IntroductionPointV3{
+		AuthKeyCert: &Certificate{CertifiedKey: h.AuthKey},
+		EncKey:      h.B,
+	}
+	return EncryptIntroduce1V3(h.ephemeral, ip, h.Subcredential, data)
+}
+
+// Finish processes HANDSHAKE_INFO of RENDEZVOUS2 cell and returns
+// key material of the rendezvous circuit (HSNTorKeysSize bytes).
+// The ephemeral key is wiped afterwards.
+func (h *HSNTorClientHandshake) Finish(reply []byte) ([]byte, error) {
+	defer h.ephemeral.Zeroize()
+	if len(reply) != HSNTorReplySize {
+		return nil, errors.New("Wrong hs-ntor reply length")
+	}
+	var Y NTorOnionKey
+	copy(Y[:], reply)
+	expY, err := ntorExp(&h.ephemeral.Private, Y)
+	if err != nil {
+		return nil, err
+	}
+	defer Zeroize(expY)
+	expB, err := ntorExp(&h.ephemeral.Private, h.B)
+	if err != nil {
+		return nil, err
+	}
+	defer Zeroize(expB)
+	auth, keys := hsntorRendKeys(expY, expB, h.AuthKey, h.B, h.ephemeral.Public, Y)
+	if !ConstantTimeEqual(auth, reply[NTorOnionKeySize:]) {
+		Zeroize(keys)
+		return nil, ErrNTorHandshakeFailed
+	}
+	return keys, nil
+}
+
+// HSNTorServiceHandshake decrypts INTRODUCE2 cell with the service
+// encryption keypair encKey of the introduction point and
+// subcredential. It returns the decrypted data, HANDSHAKE_INFO
+// for RENDEZVOUS1 cell and key material of the rendezvous circuit.
+func HSNTorServiceHandshake(rand io.Reader, encKey *NTorKeypair, subcredential []byte, cell *Introduce1V3) (data *IntroduceDataV3, reply, keys []byte, err error) {
+	data, err = cell.Decrypt(encKey, subcredential)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	ephemeral, err := GenerateNTorKeypair(rand)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer ephemeral.Zeroize()
+	expY, err := ntorExp(&ephemeral.Private, cell.ClientKey)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer Zeroize(expY)
+	expB, err := ntorExp(&encKey.Private, cell.ClientKey)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer Zeroize(expB)
+	auth, keys := hsntorRendKeys(expY, expB, cell.AuthKey, encKey.Public, cell.ClientKey, ephemeral.Public)
+	reply = append(append([]byte{}, ephemeral.Public[:]...), auth...)
+	return data, reply, keys, nil
+}
@@ -0,0 +1,104 @@
+package onionutil
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+func TestHSNTorHandshake(t *testing.T) {
+	authPk, _, _ := ed25519.GenerateKey(rand.Reader)
+	var authKey Ed25519Pubkey
+	copy(authKey[:], authPk)
+	encKey, err := GenerateNTorKeypair(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ip := &IntroductionPointV3{
+		AuthKeyCert: NewCertificate(CertTypeHSIntroAuth, authKey, time.Now().Add(time.Hour), nil),
+		EncKey:      encKey.Public,
+	}
+	subcredential := make([]byte, 32)
+	rand.Read(subcredential)
+
+	client, err := NewHSNTorClientHandshake(rand.Reader, ip, subcredential)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cookie, _ := NewRendCookie(rand.Reader)
+	rp, _ := GenerateNTorKeypair(rand.Reader)
+	cell, err := client.Introduce(&IntroduceDataV3{Cookie: cookie, OnionKey: rp.Public})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, reply, serviceKeys, err := HSNTorServiceHandshake(rand.Reader, encKey, subcredential, cell)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data.Cookie != cookie || len(reply) != HSNTorReplySize {
+		t.Fatal("wrong INTRODUCE2 handling")
+	}
+	broken := append([]byte{}, reply...)
+	broken[len(broken)-1] ^= 1
+	saved := *client.ephemeral
+	if _, err := client.Finish(broken); err != ErrNTorHandshakeFailed {
+		t.Fatalf("broken AUTH: %v", err)
+	}
+	*client.ephemeral = saved
+	clientKeys, err := client.Finish(reply)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(clientKeys) != HSNTorKeysSize || !bytes.Equal(clientKeys, serviceKeys) {
+		t.Fatal("key material differs")
+	}
+}
+
+func TestHSNTorInvalidKeys(t *testing.T) {
+	authPk, _, _ := ed25519.GenerateKey(rand.Reader)
+	var authKey Ed25519Pubkey
+	copy(authKey[:], authPk)
+	encKey, err := GenerateNTorKeypair(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	/* u-coordinate of a point of order 8 */
+	var smallOrder NTorOnionKey
+	copy(smallOrder[:], mustDecodeHex(t, "e0eb7a7c3b41b8ae1656e3faf19fc46ada098deb9c32b1fd866205165f49b800"))
+	subcredential := make([]byte, 32)
+
+	ip := &IntroductionPointV3{
+		AuthKeyCert: NewCertificate(CertTypeHSIntroAuth, authKey, time.Now().Add(time.Hour), nil),
+		EncKey:      smallOrder,
+	}
+	client, err := NewHSNTorClientHandshake(rand.Reader, ip, subcredential)
+	if err == nil {
+		_, err = client.Introduce(&IntroduceDataV3{})
+	}
+	if !errors.Is(err, ErrSmallOrderKey) {
+		t.Fatalf("small-order encryption key of introduction point: %v", err)
+	}
+
+	ip.EncKey = encKey.Public
+	client, err = NewHSNTorClientHandshake(rand.Reader, ip, subcredential)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rp, _ := GenerateNTorKeypair(rand.Reader)
+	cell, err := client.Introduce(&IntroduceDataV3{OnionKey: rp.Public})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cell.ClientKey = smallOrder
+	_, _, _, err = HSNTorServiceHandshake(rand.Reader, encKey, subcredential, cell)
+	if !errors.Is(err, ErrSmallOrderKey) || !errors.Is(err, ErrNTorHandshakeFailed) {
+		t.Fatalf("small-order client key: %v", err)
+	}
+	if _, err := cell.Decrypt(encKey, subcredential); !errors.Is(err, ErrSmallOrderKey) {
+		t.Fatalf("small-order client key in INTRODUCE2: %v", err)
+	}
+}
@@ -0,0 +1,248 @@
+// edwards25519.go - group arithmetic on the edwards25519 curve
+//
+// To the extent possible under law, Ivan Markin waived all copyright
+// and related or neighboring rights to this module of onionutil, using the creative
+// commons "cc0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+// Package edwards25519 implements the group operations on edwards25519
+// that Tor needs beyond plain Ed25519 signatures: point validation,
+// key blinding and conversion to Curve25519. It is built on math/big,
+// is not constant time and must not be used with secret scalars
+// where timing matters.
+package edwards25519
+
+import (
+	"errors"
+	"math/big"
+)
+
+var (
+	// Prime is the field prime 2^255 - 19.
+	Prime, _ = new(big.Int).SetString("57896044618658097711785492504343953926634992332820282019728792003956564819949", 10)
+	// Order is the order of the prime-order subgroup (l).
+	Order, _ = new(big.Int).SetString("7237005577332262213973186563042994240857116359379907606001950938285454250989", 10)
+
+	// d = -121665/121666
+	d = mod(new(big.Int).Mul(big.NewInt(-121665),
+		inv(big.NewInt(121666))))
+	d2 = mod(new(big.Int).Lsh(d, 1))
+	// sqrtM1 = 2^((p-1)/4)
+	sqrtM1 = new(big.Int).Exp(big.NewInt(2),
+		new(big.Int).Rsh(new(big.Int).Sub(Prime, big.NewInt(1)), 2), Prime)
+
+	one  = big.NewInt(1)
+	base = mustDecode([]byte{
+		0x58, 0x66, 0x66, 0x66, 0x66, 0x66, 0x66, 0x66,
+		0x66, 0x66, 0x66, 0x66, 0x66, 0x66, 0x66, 0x66,
+		0x66, 0x66, 0x66, 0x66, 0x66, 0x66, 0x66, 0x66,
+		0x66, 0x66, 0x66, 0x66, 0x66, 0x66, 0x66, 0x66,
+	})
+)
+
+var (
+	ErrNonCanonical = errors.New("non-canonical point encoding")
+	ErrNotOnCurve   = errors.New("point is not on the curve")
+)
+
+func mod(a *big.Int) *big.Int {
+	return a.Mod(a, Prime)
+}
+
+func inv(a *big.Int) *big.Int {
+	return new(big.Int).ModInverse(a, Prime)
+}
+
+func mul(a, b *big.Int) *big.Int {
+	return mod(new(big.Int).Mul(a, b))
+}
+
+// Point is a point on edwards25519 in extended coordinates.
+type Point struct {
+	x, y, z, t *big.Int
+}
+
+// NewIdentityPoint returns the neutral element.
+func NewIdentityPoint() *Point {
+	return &Point{big.NewInt(0), big.NewInt(1), big.NewInt(1), big.NewInt(0)}
+}
+
+// NewGeneratorPoint returns the canonical base point B.
+func NewGeneratorPoint() *Point {
+	return new(Point).Set(base)
+}
+
+func mustDecode(b []byte) *Point {
+	p, err := new(Point).SetBytes(b)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// Set sets p to q and returns p.
+func (p *Point) Set(q *Point) *Point {
+	p.x = new(big.Int).Set(q.x)
+	p.y = new(big.Int).Set(q.y)
+	p.z = new(big.Int).Set(q.z)
+	p.t = new(big.Int).Set(q.t)
+	return p
+}
+
+// SetBytes decodes 32-byte encoding b into p. Non-canonical
+// encodings are rejected.
+func (p *Point) SetBytes(b []byte) (*Point, error) {
+	if len(b) != 32 {
+		return nil, errors.New("invalid point encoding length")
+	}
+	buf := make([]byte, 32)
+	copy(buf, b)
+	sign := buf[31] >> 7
+	buf[31] &= 0x7f
+	y := ScalarFromBytes(buf)
+	if y.Cmp(Prime) >= 0 {
+		return nil, ErrNonCanonical
+	}
+	// x^2 = (y^2 - 1) / (d*y^2 + 1)
+	yy := mul(y, y)
+	u := mod(new(big.Int).Sub(yy, one))
+	v := mod(new(big.Int).Add(mul(d, yy), one))
+	xx := mul(u, inv(v))
+	exp := new(big.Int).Rsh(new(big.Int).Add(Prime, big.NewInt(3)), 3)
+	x := new(big.Int).Exp(xx, exp, Prime)
+	if mul(x, x).Cmp(xx) != 0 {
+		x = mul(x, sqrtM1)
+	}
+	if mul(x, x).Cmp(xx) != 0 {
+		return nil, ErrNotOnCurve
+	}
+	if x.Sign() == 0 && sign == 1 {
+		return nil, ErrNonCanonical
+	}
+	if byte(x.Bit(0)) != sign {
+		x.Sub(Prime, x)
+	}
+	p.x, p.y, p.z, p.t = x, y, big.NewInt(1), mul(x, y)
+	return p, nil
+}
+
+// affine returns affine coordinates of p.
+func (p *Point) affine() (x, y *big.Int) {
+	zinv := inv(p.z)
+	return mul(p.x, zinv), mul(p.y, zinv)
+}
+
+// Bytes returns the canonical 32-byte encoding of p.
+func (p *Point) Bytes() []byte {
+	x, y := p.affine()
+	b := ScalarBytes(y)
+	b[31] |= byte(x.Bit(0)) << 7
+	return b
+}
+
+// Add sets p = a + b and returns p.
+func (p *Point) Add(a, b *Point) *Point {
+	A := mul(new(big.Int).Sub(a.y, a.x), new(big.Int).Sub(b.y, b.x))
+	B := mul(new(big.Int).Add(a.y, a.x), new(big.Int).Add(b.y, b.x))
+	C := mul(mul(a.t, d2), b.t)
+	D := mul(new(big.Int).Lsh(a.z, 1), b.z)
+	E := mod(new(big.Int).Sub(B, A))
+	F := mod(new(big.Int).Sub(D, C))
+	G := mod(new(big.Int).Add(D, C))
+	H := mod(new(big.Int).Add(B, A))
+	p.x, p.y, p.z, p.t = mul(E, F), mul(G, H), mul(F, G), mul(E, H)
+	return p
+}
+
+// ScalarMult sets p = k * q and returns p.
+func (p *Point) ScalarMult(k *big.Int, q *Point) *Point {
+	r := NewIdentityPoint()
+	a := new(Point).Set(q)
+	for i := 0; i < k.BitLen(); i++ {
+		if k.Bit(i) == 1 {
+			r.Add(r, a)
+		}
+		a.Add(a, a)
+	}
+	return p.Set(r)
+}
+
+// ScalarBaseMult sets p = k * B and returns p.
+func (p *Point) ScalarBaseMult(k *big.Int) *Point {
+	return p.ScalarMult(k, base)
+}
+
+// Equal reports whether p and q represent the same point.
+func (p *Point) Equal(q *Point) bool {
+	return mul(p.x, q.z).Cmp(mul(q.x, p.z)) == 0 &&
+		mul(p.y, q.z).Cmp(mul(q.y, p.z)) == 0
+}
+
+// IsIdentity reports whether p is the neutral element.
+func (p *Point) IsIdentity() bool {
+	return p.Equal(NewIdentityPoint())
+}
+
+// IsSmallOrder reports whether p belongs to the torsion subgroup
+// of order 8.
+func (p *Point) IsSmallOrder() bool {
+	return new(Point).ScalarMult(big.NewInt(8), p).IsIdentity()
+}
+
+// IsTorsionFree reports whether p belongs to the prime-order subgroup.
+func (p *Point) IsTorsionFree() bool {
+	return new(Point).ScalarMult(Order, p).IsIdentity()
+}
+
+// ScalarFromBytes interprets b as a little-endian integer.
+func ScalarFromBytes(b []byte) *big.Int {
+	be := make([]byte, len(b))
+	for i := range b {
+		be[len(b)-1-i] = b[i]
+	}
+	return new(big.Int).SetBytes(be)
+}
+
+// ScalarBytes returns 32-byte little-endian encoding of s.
+func ScalarBytes(s *big.Int) []byte {
+	be := s.Bytes()
+	b := make([]byte, 32)
+	for i := 0; i < len(be) && i < 32; i++ {
+		b[i] = be[len(be)-1-i]
+	}
+	return b
+}
+
+// SetMontgomery sets p to the point birationally equivalent to
+// Curve25519 u-coordinate u with the sign of x set to sign.
+// y = (u - 1) / (u + 1)
+func (p *Point) SetMontgomery(u []byte, sign byte) (*Point, error) {
+	if len(u) != 32 {
+		return nil, errors.New("invalid u-coordinate length")
+	}
+	buf := make([]byte, 32)
+	copy(buf, u)
+	buf[31] &= 0x7f
+	uu := mod(ScalarFromBytes(buf))
+	denom := mod(new(big.Int).Add(uu, one))
+	if denom.Sign() == 0 {
+		return nil, ErrNotOnCurve
+	}
+	y := mul(mod(new(big.Int).Sub(uu, one)), inv(denom))
+	enc := ScalarBytes(y)
+	enc[31] |= (sign & 1) << 7
+	return p.SetBytes(enc)
+}
+
+// Montgomery returns the Curve25519 u-coordinate birationally
+// equivalent to p.
+// u = (1 + y) / (1 - y)
+func (p *Point) Montgomery() ([]byte, error) {
+	_, y := p.affine()
+	denom := mod(new(big.Int).Sub(one, y))
+	if denom.Sign() == 0 {
+		return nil, ErrNotOnCurve
+	}
+	u := mul(mod(new(big.Int).Add(one, y)), inv(denom))
+	return ScalarBytes(u), nil
+}
@@ -0,0 +1,107 @@
+package edwards25519
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"math/big"
+	"testing"
+
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/ed25519"
+)
+
+func TestBasePoint(t *testing.T) {
+	B := NewGeneratorPoint()
+	if !B.IsTorsionFree() {
+		t.Fatal("base point is not in the prime-order subgroup")
+	}
+	if B.IsSmallOrder() {
+		t.Fatal("base point is of small order")
+	}
+	enc := B.Bytes()
+	dec, err := new(Point).SetBytes(enc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !dec.Equal(B) || !bytes.Equal(dec.Bytes(), enc) {
+		t.Fatal("base point encoding round-trip failed")
+	}
+}
+
+func TestScalarBaseMultMatchesEd25519(t *testing.T) {
+	seed := bytes.Repeat([]byte{0x42}, ed25519.SeedSize)
+	sk := ed25519.NewKeyFromSeed(seed)
+	h := sha512.Sum512(seed)
+	h[0] &= 248
+	h[31] &= 127
+	h[31] |= 64
+	A := new(Point).ScalarBaseMult(ScalarFromBytes(h[:32]))
+	if !bytes.Equal(A.Bytes(), sk.Public().(ed25519.PublicKey)) {
+		t.Fatal("ScalarBaseMult disagrees with ed25519 key generation")
+	}
+}
+
+func TestSmallOrder(t *testing.T) {
+	/* (0, -1) is the point of order 2 */
+	enc := ScalarBytes(new(big.Int).Sub(Prime, big.NewInt(1)))
+	p, err := new(Point).SetBytes(enc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.IsSmallOrder() || p.IsTorsionFree() {
+		t.Fatal("point of order 2 is not detected")
+	}
+	mixed := new(Point).Add(p, NewGeneratorPoint())
+	if mixed.IsSmallOrder() || mixed.IsTorsionFree() {
+		t.Fatal("point with torsion component is not detected")
+	}
+}
+
+func TestNonCanonical(t *testing.T) {
+	enc := ScalarBytes(new(big.Int).Add(Prime, big.NewInt(1)))
+	if _, err := new(Point).SetBytes(enc); err != ErrNonCanonical {
+		t.Fatalf("expected ErrNonCanonical, got %v", err)
+	}
+}
+
+func TestSetMontgomery(t *testing.T) {
+	var sk, u [32]byte
+	for i := range sk {
+		sk[i] = byte(i)
+	}
+	sk[0] &= 248
+	sk[31] &= 127
+	sk[31] |= 64
+	curve25519.ScalarBaseMult(&u, &sk)
+	A := new(Point).ScalarBaseMult(ScalarFromBytes(sk[:]))
+	enc := A.Bytes()
+	p, err := new(Point).SetMontgomery(u[:], enc[31]>>7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.Equal(A) {
+		t.Fatal("SetMontgomery disagrees with ScalarBaseMult")
+	}
+}
+
+func TestMontgomery(t *testing.T) {
+	var sk, u [32]byte
+	for i := range sk {
+		sk[i] = byte(i)
+	}
+	sk[0] &= 248
+	sk[31] &= 127
+	sk[31] |= 64
+	curve25519.ScalarBaseMult(&u, &sk)
+	A := new(Point).ScalarBaseMult(ScalarFromBytes(sk[:]))
+	mu, err := A.Montgomery()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(mu, u[:]) {
+		t.Fatal("Montgomery disagrees with curve25519.ScalarBaseMult")
+	}
+	if _, err := NewIdentityPoint().Montgomery(); err == nil {
+		t.Fatal("Identity point has been converted")
+	}
+}
@@ -0,0 +1,85 @@
+// encoding.go - base32 and base64 encodings used by Tor
+//
+// To the extent possible under law, Ivan Markin waived all copyright
+// and related or neighboring rights to this module of onionutil, using the creative
+// commons "cc0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+// Package encoding implements the base32 and base64 variants of Tor
+// for onionutil packages. See the exported wrappers in onionutil.
+package encoding
+
+import (
+	"encoding/base32"
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+var unpadded = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// Base32Encode returns lowercase padded base32 encoding of binary.
+func Base32Encode(binary []byte) string {
+	return strings.ToLower(base32.StdEncoding.EncodeToString(binary))
+}
+
+// Base32Decode decodes case-insensitive padded base32 string.
+func Base32Decode(b32 string) ([]byte, error) {
+	return base32.StdEncoding.DecodeString(strings.ToUpper(b32))
+}
+
+// Base32EncodeUnpadded returns lowercase base32 encoding of binary
+// without padding.
+func Base32EncodeUnpadded(binary []byte) string {
+	return strings.ToLower(unpadded.EncodeToString(binary))
+}
+
+// Base32DecodeUnpadded decodes case-insensitive base32 string
+// without padding.
+func Base32DecodeUnpadded(b32 string) ([]byte, error) {
+	return unpadded.DecodeString(strings.ToUpper(b32))
+}
+
+// Base32EncodedLen returns length of base32 encoding (without
+// padding) of n bytes.
+func Base32EncodedLen(n int) int {
+	return (n*8 + 4) / 5
+}
+
+// Base32DecodeStrict decodes case-insensitive base32 string with
+// or without padding which must encode exactly n bytes. Encodings
+// with non-zero trailing bits are rejected.
+func Base32DecodeStrict(b32 string, n int) ([]byte, error) {
+	s := strings.TrimRight(b32, "=")
+	if len(s) != Base32EncodedLen(n) {
+		return nil, fmt.Errorf("Wrong length of base32 value: %d", len(s))
+	}
+	binary, err := Base32DecodeUnpadded(s)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.EqualFold(Base32EncodeUnpadded(binary), s) {
+		return nil, fmt.Errorf("Non-canonical base32 value")
+	}
+	return binary, nil
+}
+
+// DecodeBase64 decodes base64 data with or without padding.
+func DecodeBase64(data []byte) ([]byte, error) {
+	s := strings.TrimRight(string(data), "=")
+	return base64.RawStdEncoding.DecodeString(s)
+}
+
+// DecodeBase64Fixed decodes base64 data with or without padding
+// into dst which must be filled exactly.
+func DecodeBase64Fixed(dst, data []byte) error {
+	b, err := DecodeBase64(data)
+	if err != nil {
+		return err
+	}
+	if len(b) != len(dst) {
+		return fmt.Errorf("Wrong length of base64 value: %d", len(b))
+	}
+	copy(dst, b)
+	return nil
+}
@@ -0,0 +1,33 @@
+// torerr.go - errors shared by onionutil packages
+//
+// To the extent possible under law, Ivan Markin waived all copyright
+// and related or neighboring rights to this module of onionutil, using the creative
+// commons "cc0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+// Package torerr holds errors which are returned by several
+// onionutil packages so callers can check them with errors.Is
+// regardless of the package that returned them.
+package torerr
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrInvalidAddress = errors.New("Invalid onion address")
+	ErrBadSignature   = errors.New("Bad signature")
+	ErrTruncated      = errors.New("Truncated data")
+	ErrTrailingData   = errors.New("Trailing data")
+)
+
+// Address returns ErrInvalidAddress wrapped with msg.
+func Address(msg string) error {
+	return fmt.Errorf("%w: %s", ErrInvalidAddress, msg)
+}
+
+// Signature returns ErrBadSignature wrapped with what.
+func Signature(what string) error {
+	return fmt.Errorf("%w: %s", ErrBadSignature, what)
+}
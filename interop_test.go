@@ -0,0 +1,158 @@
+// interop_test.go - cross-check with artifacts of little-t-tor
+//
+// To the extent possible under law, Ivan Markin waived all copyright
+// and related or neighboring rights to this module of onionutil, using the creative
+// commons "cc0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+//go:build interop
+// +build interop
+
+package onionutil
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+// Interop tests run with "go test -tags interop". torBinary returns
+// tor binary from $TOR or PATH.
+func torBinary(t *testing.T) string {
+	if tor := os.Getenv("TOR"); tor != "" {
+		return tor
+	}
+	tor, err := exec.LookPath("tor")
+	if err != nil {
+		t.Skip("tor is not found")
+	}
+	return tor
+}
+
+// runTor runs tor with torrc options args in DataDirectory dir until
+// file appears or timeout passes.
+func runTor(t *testing.T, dir, file string, args ...string) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	args = append([]string{"-f", os.DevNull, "--DataDirectory", dir,
+		"--DisableNetwork", "1", "--SocksPort", "0", "--Log", "warn stderr"}, args...)
+	cmd := exec.CommandContext(ctx, torBinary(t), args...)
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer cmd.Wait()
+	defer cmd.Process.Kill()
+	for ctx.Err() == nil {
+		if _, err := os.Stat(file); err == nil {
+			/* Let tor finish writing files */
+			time.Sleep(time.Second)
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	t.Fatalf("tor hasn't created %s", file)
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "onionutil-interop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Chmod(dir, 0700)
+	return dir
+}
+
+func TestInteropServiceKeysV3(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	hsDir := filepath.Join(dir, "hs")
+	runTor(t, dir, filepath.Join(hsDir, HostnameFilename),
+		"--HiddenServiceDir", hsDir, "--HiddenServicePort", "80 127.0.0.1:8080",
+		"--HiddenServiceVersion", "3")
+
+	esk, err := LoadSecretKeyFileV3(filepath.Join(hsDir, SecretKeyFilenameV3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pk, err := LoadPublicKeyFileV3(filepath.Join(hsDir, PublicKeyFilenameV3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(esk.Public().(ed25519.PublicKey), pk) {
+		t.Fatal("public key of secret key file differs from public key file")
+	}
+	hostname, err := ioutil.ReadFile(filepath.Join(hsDir, HostnameFilename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	onionAddress, err := OnionAddressV3(pk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(hostname) != onionAddress+".onion\n" {
+		t.Fatalf("onion address %s differs from hostname %q", onionAddress, hostname)
+	}
+	if info := DescribeAddress(string(hostname)); !info.Valid {
+		t.Fatalf("hostname is not valid: %v", info)
+	}
+	data, _ := ioutil.ReadFile(filepath.Join(hsDir, SecretKeyFilenameV3))
+	if !bytes.Equal(EncodeSecretKeyV3(esk), data) {
+		t.Fatal("encoding of secret key file differs")
+	}
+	data, _ = ioutil.ReadFile(filepath.Join(hsDir, PublicKeyFilenameV3))
+	if !bytes.Equal(EncodePublicKeyV3(pk), data) {
+		t.Fatal("encoding of public key file differs")
+	}
+}
+
+func TestInteropRelayKeys(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	out, err := exec.Command(torBinary(t), "-f", os.DevNull, "--list-fingerprint",
+		"--DataDirectory", dir, "--ORPort", "9999", "--Nickname", "onionutil").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	/* The last line is "onionutil XXXX XXXX ..." */
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	fields := strings.SplitN(lines[len(lines)-1], " ", 2)
+	if len(fields) != 2 || fields[0] != "onionutil" {
+		t.Fatalf("unexpected output: %s", out)
+	}
+	expected, err := ParseFingerprint(fields[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	keysDir := filepath.Join(dir, "keys")
+	legacy, err := LoadRelayLegacyKeys(keysDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fp, err := legacy.Fingerprint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !fp.Equal(expected) {
+		t.Fatalf("fingerprint %s differs from %s", fp, expected)
+	}
+	keys, err := LoadRelayKeys(keysDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := keys.Verify(); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadFile(filepath.Join(keysDir, SigningCertFilename))
+	if !bytes.Equal(EncodeSigningCert(keys.SigningCert), data) {
+		t.Fatal("encoding of signing certificate differs")
+	}
+}
@@ -0,0 +1,332 @@
+// introducev2.go - INTRODUCE1 and INTRODUCE2 cells of v2 onion services
+//
+// To the extent possible under law, Ivan Markin waived all copyright
+// and related or neighboring rights to this module of onionutil, using the creative
+// commons "cc0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package onionutil
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/rsa"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"time"
+
+	"github.com/nogoegst/onionutil/pkcs1"
+)
+
+const (
+	RendCookieSize = 20
+	// DHKeySize is the size of public values of Tor's DH (DH_LEN).
+	DHKeySize = 128
+	// dhPrivateKeySize is the size of DH private keys (DH_SEC_LEN).
+	dhPrivateKeySize = 40
+)
+
+/* Hybrid encryption parameters (tor-spec 0.3) */
+const (
+	pkEncLen  = 128
+	pkPadLen  = 42
+	hybridKey = 16
+)
+
+/* 1024-bit MODP group of RFC 2409 (tor-spec 0.3) */
+var (
+	dhPrime, _ = new(big.Int).SetString(
+		"FFFFFFFFFFFFFFFFC90FDAA22168C234C4C6628B80DC1CD1"+
+			"29024E088A67CC74020BBEA63B139B22514A08798E3404DD"+
+			"EF9519B3CD3A431B302B0A6DF25F14374FE1356D6D51C245"+
+			"E485B576625E7EC6F44C42E9A637ED6B0BFF5CB6F406B7ED"+
+			"EE386BFB5A899FA5AE9F24117C4B1FE649286651ECE65381"+
+			"FFFFFFFFFFFFFFFF", 16)
+	dhGenerator = big.NewInt(2)
+)
+
+// RendCookie is a rendezvous cookie chosen by a client
+// to match its circuit with the one of the service.
+type RendCookie [RendCookieSize]byte
+
+func NewRendCookie(rand io.Reader) (cookie RendCookie, err error) {
+	_, err = io.ReadFull(rand, cookie[:])
+	return cookie, err
+}
+
+// DHKeypair is a keypair of Tor's Diffie-Hellman handshake
+// (g^x of INTRODUCE cells and g^y of RENDEZVOUS1 cells).
+// Exponentiation is done with math/big which is not constant
+// time, so the private exponent may leak through timing.
+type DHKeypair struct {
+	Private []byte
+	Public  []byte
+}
+
+func GenerateDHKeypair(rand io.Reader) (*DHKeypair, error) {
+	kp := &DHKeypair{Private: make([]byte, dhPrivateKeySize)}
+	if _, err := io.ReadFull(rand, kp.Private); err != nil {
+		return nil, err
+	}
+	x := new(big.Int).SetBytes(kp.Private)
+	kp.Public = new(big.Int).Exp(dhGenerator, x, dhPrime).FillBytes(make([]byte, DHKeySize))
+	return kp, nil
+}
+
+// checkDHPublic checks that 1 < y < p-1 as Tor does.
+func checkDHPublic(y *big.Int) error {
+	pMinus1 := new(big.Int).Sub(dhPrime, big.NewInt(1))
+	if y.Cmp(big.NewInt(1)) <= 0 || y.Cmp(pMinus1) >= 0 {
+		return errors.New("Invalid DH public value")
+	}
+	return nil
+}
+
+// SharedSecret returns g^xy for public value peer of the other side.
+func (kp *DHKeypair) SharedSecret(peer []byte) ([]byte, error) {
+	if len(peer) != DHKeySize {
+		return nil, errors.New("Wrong length of DH public value")
+	}
+	y := new(big.Int).SetBytes(peer)
+	if err := checkDHPublic(y); err != nil {
+		return nil, err
+	}
+	x := new(big.Int).SetBytes(kp.Private)
+	return new(big.Int).Exp(y, x, dhPrime).FillBytes(make([]byte, DHKeySize)), nil
+}
+
+// Zeroize overwrites the private key with zeros.
+func (kp *DHKeypair) Zeroize() {
+	Zeroize(kp.Private)
+}
+
+// KDFTor expands k0 into n bytes of key material:
+// SHA1(k0 | [00]) | SHA1(k0 | [01]) | ... (tor-spec 5.2.1).
+func KDFTor(k0 []byte, n int) []byte {
+	var keys []byte
+	for i := 0; len(keys) < n; i++ {
+		h := sha1.New()
+		h.Write(k0)
+		h.Write([]byte{byte(i)})
+		keys = h.Sum(keys)
+	}
+	return keys[:n]
+}
+
+// IntroduceV2 is the part of INTRODUCE1 cells of v2 onion services
+// which is encrypted to the service key of an introduction point
+// (rend-spec 1.8). Versions 2 and 3 are supported.
+type IntroduceV2 struct {
+	Version byte
+	// AuthType (ClientAuthBasic or ClientAuthStealth) and AuthData
+	// (descriptor cookie) are present in version 3 only.
+	AuthType byte
+	AuthData []byte
+	// Timestamp is present in version 3 only.
+	Timestamp time.Time
+	// Rendezvous point.
+	RendezvousIP       net.IP
+	RendezvousPort     uint16
+	RendezvousID       Fingerprint
+	RendezvousOnionKey *rsa.PublicKey
+	Cookie             RendCookie
+	// DHPublic is g^x of the client.
+	DHPublic []byte
+}
+
+// Encode returns encoding of intro before encryption.
+func (intro *IntroduceV2) Encode() ([]byte, error) {
+	if intro.Version != 2 && intro.Version != 3 {
+		return nil, fmt.Errorf("Unsupported INTRODUCE version %d", intro.Version)
+	}
+	ip := intro.RendezvousIP.To4()
+	if ip == nil {
+		return nil, errors.New("Rendezvous point address must be IPv4")
+	}
+	if len(intro.DHPublic) != DHKeySize {
+		return nil, errors.New("Wrong length of DH public value")
+	}
+	onionKey, err := pkcs1.EncodePublicKeyDER(intro.RendezvousOnionKey)
+	if err != nil {
+		return nil, err
+	}
+	w := new(bytes.Buffer)
+	w.WriteByte(intro.Version)
+	if intro.Version == 3 {
+		w.WriteByte(intro.AuthType)
+		if intro.AuthType != 0 {
+			binary.Write(w, binary.BigEndian, uint16(len(intro.AuthData)))
+			w.Write(intro.AuthData)
+		}
+		binary.Write(w, binary.BigEndian, uint32(intro.Timestamp.Unix()))
+	}
+	w.Write(ip)
+	binary.Write(w, binary.BigEndian, intro.RendezvousPort)
+	w.Write(intro.RendezvousID[:])
+	binary.Write(w, binary.BigEndian, uint16(len(onionKey)))
+	w.Write(onionKey)
+	w.Write(intro.Cookie[:])
+	w.Write(intro.DHPublic)
+	return w.Bytes(), nil
+}
+
+// ParseIntroduceV2 parses decrypted part of INTRODUCE2 cell.
+func ParseIntroduceV2(data []byte) (*IntroduceV2, error) {
+	r := bytes.NewReader(data)
+	intro := new(IntroduceV2)
+	var err error
+	if intro.Version, err = r.ReadByte(); err != nil {
+		return nil, ErrTruncated
+	}
+	if intro.Version != 2 && intro.Version != 3 {
+		return nil, fmt.Errorf("Unsupported INTRODUCE version %d", intro.Version)
+	}
+	if intro.Version == 3 {
+		if intro.AuthType, err = r.ReadByte(); err != nil {
+			return nil, ErrTruncated
+		}
+		if intro.AuthType != 0 {
+			var authLen uint16
+			if err := binary.Read(r, binary.BigEndian, &authLen); err != nil {
+				return nil, ErrTruncated
+			}
+			intro.AuthData = make([]byte, authLen)
+			if _, err := io.ReadFull(r, intro.AuthData); err != nil {
+				return nil, ErrTruncated
+			}
+		}
+		var ts uint32
+		if err := binary.Read(r, binary.BigEndian, &ts); err != nil {
+			return nil, ErrTruncated
+		}
+		intro.Timestamp = time.Unix(int64(ts), 0)
+	}
+	ip := make([]byte, net.IPv4len)
+	if _, err := io.ReadFull(r, ip); err != nil {
+		return nil, ErrTruncated
+	}
+	intro.RendezvousIP = net.IP(ip)
+	if err := binary.Read(r, binary.BigEndian, &intro.RendezvousPort); err != nil {
+		return nil, ErrTruncated
+	}
+	if _, err := io.ReadFull(r, intro.RendezvousID[:]); err != nil {
+		return nil, ErrTruncated
+	}
+	var keyLen uint16
+	if err := binary.Read(r, binary.BigEndian, &keyLen); err != nil {
+		return nil, ErrTruncated
+	}
+	onionKey := make([]byte, keyLen)
+	if _, err := io.ReadFull(r, onionKey); err != nil {
+		return nil, ErrTruncated
+	}
+	pk, rest, err := pkcs1.DecodePublicKeyDER(onionKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, errors.New("Trailing data after rendezvous point onion key")
+	}
+	intro.RendezvousOnionKey = pk
+	if _, err := io.ReadFull(r, intro.Cookie[:]); err != nil {
+		return nil, ErrTruncated
+	}
+	intro.DHPublic = make([]byte, DHKeySize)
+	if _, err := io.ReadFull(r, intro.DHPublic); err != nil {
+		return nil, ErrTruncated
+	}
+	if r.Len() != 0 {
+		return nil, ErrTrailingData
+	}
+	return intro, nil
+}
+
+// hybridEncrypt encrypts m to pk with hybrid encryption of tor-spec 0.4
+// (RSA-OAEP followed by AES-128-CTR if m doesn't fit).
+func hybridEncrypt(rand io.Reader, pk *rsa.PublicKey, m []byte) ([]byte, error) {
+	if len(m) <= pkEncLen-pkPadLen {
+		return rsa.EncryptOAEP(sha1.New(), rand, pk, m, nil)
+	}
+	key := make([]byte, hybridKey)
+	if _, err := io.ReadFull(rand, key); err != nil {
+		return nil, err
+	}
+	defer Zeroize(key)
+	split := pkEncLen - pkPadLen - hybridKey
+	c1, err := rsa.EncryptOAEP(sha1.New(), rand, pk, append(append([]byte{}, key...), m[:split]...), nil)
+	if err != nil {
+		return nil, err
+	}
+	c2, err := aesCTR(key, make([]byte, aes.BlockSize), m[split:])
+	if err != nil {
+		return nil, err
+	}
+	return append(c1, c2...), nil
+}
+
+func hybridDecrypt(sk *rsa.PrivateKey, c []byte) ([]byte, error) {
+	if len(c) < pkEncLen {
+		return nil, ErrTruncated
+	}
+	m1, err := rsa.DecryptOAEP(sha1.New(), nil, sk, c[:pkEncLen], nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(c) == pkEncLen {
+		return m1, nil
+	}
+	if len(m1) < hybridKey {
+		return nil, errors.New("Malformed hybrid encryption")
+	}
+	key := m1[:hybridKey]
+	defer Zeroize(key)
+	m2, err := aesCTR(key, make([]byte, aes.BlockSize), c[pkEncLen:])
+	if err != nil {
+		return nil, err
+	}
+	return append(append([]byte{}, m1[hybridKey:]...), m2...), nil
+}
+
+// EncryptIntroduce1V2 returns payload of INTRODUCE1 cell carrying
+// intro encrypted to service key serviceKey of an introduction point
+// (see IntroductionPoint.ServiceKey).
+func EncryptIntroduce1V2(rand io.Reader, serviceKey *rsa.PublicKey, intro *IntroduceV2) ([]byte, error) {
+	pkID, err := RSAPubkeyHash(serviceKey)
+	if err != nil {
+		return nil, err
+	}
+	m, err := intro.Encode()
+	if err != nil {
+		return nil, err
+	}
+	enc, err := hybridEncrypt(rand, serviceKey, m)
+	if err != nil {
+		return nil, err
+	}
+	return append(pkID, enc...), nil
+}
+
+// DecryptIntroduce2V2 decrypts payload of INTRODUCE2 cell with
+// service key sk of an introduction point.
+func DecryptIntroduce2V2(sk *rsa.PrivateKey, payload []byte) (*IntroduceV2, error) {
+	if len(payload) < sha1.Size {
+		return nil, ErrTruncated
+	}
+	pkID, err := RSAPubkeyHash(&sk.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(payload[:sha1.Size], pkID) {
+		return nil, errors.New("INTRODUCE2 cell is for another service key")
+	}
+	m, err := hybridDecrypt(sk, payload[sha1.Size:])
+	if err != nil {
+		return nil, err
+	}
+	return ParseIntroduceV2(m)
+}
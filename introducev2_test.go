@@ -0,0 +1,84 @@
+package onionutil
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestIntroduceV2(t *testing.T) {
+	serviceKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rpKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := GenerateDHKeypair(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cookie, err := NewRendCookie(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rpID, _ := NewFingerprint(&rpKey.PublicKey)
+	intro := &IntroduceV2{
+		Version:            3,
+		AuthType:           ClientAuthBasic,
+		AuthData:           make([]byte, DescriptorCookieSize),
+		Timestamp:          time.Unix(time.Now().Unix()/600*600, 0),
+		RendezvousIP:       net.ParseIP("192.0.2.1"),
+		RendezvousPort:     9001,
+		RendezvousID:       rpID,
+		RendezvousOnionKey: &rpKey.PublicKey,
+		Cookie:             cookie,
+		DHPublic:           client.Public,
+	}
+	payload, err := EncryptIntroduce1V2(rand.Reader, &serviceKey.PublicKey, intro)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := DecryptIntroduce2V2(serviceKey, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := intro.Encode()
+	if enc, _ := got.Encode(); !bytes.Equal(enc, want) {
+		t.Fatal("decrypted INTRODUCE differs")
+	}
+	if !got.Timestamp.Equal(intro.Timestamp) || got.Cookie != cookie {
+		t.Fatal("wrong fields after decryption")
+	}
+	if _, err := DecryptIntroduce2V2(rpKey, payload); err == nil {
+		t.Fatal("INTRODUCE2 is decrypted with another key")
+	}
+
+	service, err := GenerateDHKeypair(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s1, err := client.SharedSecret(service.Public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s2, err := service.SharedSecret(got.DHPublic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(s1, s2) {
+		t.Fatal("DH shared secrets differ")
+	}
+	one := make([]byte, DHKeySize)
+	one[DHKeySize-1] = 1
+	if _, err := client.SharedSecret(one); err == nil {
+		t.Fatal("degenerate DH public value is accepted")
+	}
+	if k := KDFTor(s1, 72); len(k) != 72 || !bytes.Equal(k[:20], KDFTor(s1, 20)) {
+		t.Fatal("KDF-TOR output is inconsistent")
+	}
+}
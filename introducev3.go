@@ -0,0 +1,282 @@
+// introducev3.go - INTRODUCE1 and INTRODUCE2 cells of v3 onion services
+//
+// To the extent possible under law, Ivan Markin waived all copyright
+// and related or neighboring rights to this module of onionutil, using the creative
+// commons "cc0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package onionutil
+
+import (
+	"bytes"
+	"crypto/aes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	// IntroAuthKeyTypeEd25519 is the type of Ed25519 introduction
+	// point authentication keys (0x00 and 0x01 are legacy RSA ones).
+	IntroAuthKeyTypeEd25519 = 0x02
+	// IntroOnionKeyTypeNTor is the type of ntor onion keys
+	// of rendezvous points.
+	IntroOnionKeyTypeNTor = 0x01
+	// introduce1MinSize is the size INTRODUCE1 cells are padded to.
+	introduce1MinSize = 246
+)
+
+// CellExtension is an extension of onion service cells
+// (EXT_FIELD_TYPE, EXT_FIELD_LEN and EXT_FIELD).
+type CellExtension struct {
+	Type byte
+	Data []byte
+}
+
+// encodeCellExtensions encodes exts prefixed with their number.
+func encodeCellExtensions(w *bytes.Buffer, exts []CellExtension) error {
+	if len(exts) > 255 {
+		return errors.New("Too many cell extensions")
+	}
+	w.WriteByte(byte(len(exts)))
+	for _, ext := range exts {
+		if len(ext.Data) > 255 {
+			return errors.New("Cell extension is too long")
+		}
+		w.WriteByte(ext.Type)
+		w.WriteByte(byte(len(ext.Data)))
+		w.Write(ext.Data)
+	}
+	return nil
+}
+
+func decodeCellExtensions(r *bytes.Reader) ([]CellExtension, error) {
+	n, err := r.ReadByte()
+	if err != nil {
+		return nil, ErrTruncated
+	}
+	var exts []CellExtension
+	for i := 0; i < int(n); i++ {
+		var hdr [2]byte
+		if _, err := io.ReadFull(r, hdr[:]); err != nil {
+			return nil, ErrTruncated
+		}
+		ext := CellExtension{Type: hdr[0], Data: make([]byte, hdr[1])}
+		if _, err := io.ReadFull(r, ext.Data); err != nil {
+			return nil, ErrTruncated
+		}
+		exts = append(exts, ext)
+	}
+	return exts, nil
+}
+
+// Introduce1V3 is INTRODUCE1 (or INTRODUCE2) cell of v3 onion
+// services (rend-spec-v3 3.2.1).
+type Introduce1V3 struct {
+	// LegacyKeyID is all-zero for Ed25519 authentication keys.
+	LegacyKeyID [FingerprintSize]byte
+	AuthKey     Ed25519Pubkey
+	Extensions  []CellExtension
+	// ClientKey is the ephemeral hs-ntor key X of the client.
+	ClientKey NTorOnionKey
+	Encrypted []byte
+	MAC       [hsntorMACLen]byte
+}
+
+// body returns encoding of the cell without MAC.
+func (cell *Introduce1V3) body() ([]byte, error) {
+	w := new(bytes.Buffer)
+	w.Write(cell.LegacyKeyID[:])
+	w.WriteByte(IntroAuthKeyTypeEd25519)
+	binary.Write(w, binary.BigEndian, uint16(Ed25519PubkeySize))
+	w.Write(cell.AuthKey[:])
+	if err := encodeCellExtensions(w, cell.Extensions); err != nil {
+		return nil, err
+	}
+	w.Write(cell.ClientKey[:])
+	w.Write(cell.Encrypted)
+	return w.Bytes(), nil
+}
+
+// Encode returns the cell payload.
+func (cell *Introduce1V3) Encode() ([]byte, error) {
+	b, err := cell.body()
+	if err != nil {
+		return nil, err
+	}
+	return append(b, cell.MAC[:]...), nil
+}
+
+// ParseIntroduce1V3 parses payload of INTRODUCE1 or INTRODUCE2 cell
+// with Ed25519 authentication key.
+func ParseIntroduce1V3(data []byte) (*Introduce1V3, error) {
+	r := bytes.NewReader(data)
+	cell := new(Introduce1V3)
+	if _, err := io.ReadFull(r, cell.LegacyKeyID[:]); err != nil {
+		return nil, ErrTruncated
+	}
+	keyType, err := r.ReadByte()
+	if err != nil {
+		return nil, ErrTruncated
+	}
+	if keyType != IntroAuthKeyTypeEd25519 {
+		return nil, fmt.Errorf("Unsupported authentication key type %d", keyType)
+	}
+	var keyLen uint16
+	if err := binary.Read(r, binary.BigEndian, &keyLen); err != nil {
+		return nil, ErrTruncated
+	}
+	if keyLen != Ed25519PubkeySize {
+		return nil, fmt.Errorf("Wrong length of authentication key: %d", keyLen)
+	}
+	if _, err := io.ReadFull(r, cell.AuthKey[:]); err != nil {
+		return nil, ErrTruncated
+	}
+	if cell.Extensions, err = decodeCellExtensions(r); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(r, cell.ClientKey[:]); err != nil {
+		return nil, ErrTruncated
+	}
+	if r.Len() < hsntorMACLen {
+		return nil, ErrTruncated
+	}
+	cell.Encrypted = make([]byte, r.Len()-hsntorMACLen)
+	io.ReadFull(r, cell.Encrypted)
+	io.ReadFull(r, cell.MAC[:])
+	return cell, nil
+}
+
+// IntroduceDataV3 is the encrypted part of INTRODUCE1 cell
+// (rend-spec-v3 3.3).
+type IntroduceDataV3 struct {
+	Cookie     RendCookie
+	Extensions []CellExtension
+	// OnionKey is the ntor onion key of the rendezvous point.
+	OnionKey       NTorOnionKey
+	LinkSpecifiers []LinkSpecifier
+}
+
+// Encode returns encoding of data without padding.
+func (data *IntroduceDataV3) Encode() ([]byte, error) {
+	w := new(bytes.Buffer)
+	w.Write(data.Cookie[:])
+	if err := encodeCellExtensions(w, data.Extensions); err != nil {
+		return nil, err
+	}
+	w.WriteByte(IntroOnionKeyTypeNTor)
+	binary.Write(w, binary.BigEndian, uint16(NTorOnionKeySize))
+	w.Write(data.OnionKey[:])
+	lss, err := EncodeLinkSpecifiers(data.LinkSpecifiers)
+	if err != nil {
+		return nil, err
+	}
+	w.Write(lss)
+	return w.Bytes(), nil
+}
+
+// ParseIntroduceDataV3 parses decrypted part of INTRODUCE2 cell.
+// Padding is ignored.
+func ParseIntroduceDataV3(b []byte) (*IntroduceDataV3, error) {
+	r := bytes.NewReader(b)
+	data := new(IntroduceDataV3)
+	if _, err := io.ReadFull(r, data.Cookie[:]); err != nil {
+		return nil, ErrTruncated
+	}
+	var err error
+	if data.Extensions, err = decodeCellExtensions(r); err != nil {
+		return nil, err
+	}
+	keyType, err := r.ReadByte()
+	if err != nil {
+		return nil, ErrTruncated
+	}
+	if keyType != IntroOnionKeyTypeNTor {
+		return nil, fmt.Errorf("Unsupported onion key type %d", keyType)
+	}
+	var keyLen uint16
+	if err := binary.Read(r, binary.BigEndian, &keyLen); err != nil {
+		return nil, ErrTruncated
+	}
+	if keyLen != NTorOnionKeySize {
+		return nil, fmt.Errorf("Wrong length of onion key: %d", keyLen)
+	}
+	if _, err := io.ReadFull(r, data.OnionKey[:]); err != nil {
+		return nil, ErrTruncated
+	}
+	rest := b[len(b)-r.Len():]
+	if data.LinkSpecifiers, _, err = DecodeLinkSpecifiers(rest); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// EncryptIntroduce1V3 returns INTRODUCE1 cell carrying data for
+// introduction point ip of a service with subcredential subcredential.
+// client is the ephemeral hs-ntor keypair of the client which is
+// needed later to finish the handshake.
+func EncryptIntroduce1V3(client *NTorKeypair, ip *IntroductionPointV3, subcredential []byte, data *IntroduceDataV3) (*Introduce1V3, error) {
+	if ip.AuthKeyCert == nil {
+		return nil, errors.New("No introduction point authentication key")
+	}
+	plaintext, err := data.Encode()
+	if err != nil {
+		return nil, err
+	}
+	cell := &Introduce1V3{
+		AuthKey:   ip.AuthKeyCert.CertifiedKey,
+		ClientKey: client.Public,
+	}
+	cell.Encrypted = plaintext
+	body, err := cell.body()
+	if err != nil {
+		return nil, err
+	}
+	/* Pad so INTRODUCE1 cells don't reveal length of the contents */
+	if n := len(body) + hsntorMACLen; n < introduce1MinSize {
+		plaintext = append(plaintext, make([]byte, introduce1MinSize-n)...)
+	}
+	exp, err := ntorExp(&client.Private, ip.EncKey)
+	if err != nil {
+		return nil, err
+	}
+	defer Zeroize(exp)
+	encKey, macKey := hsntorIntroKeys(exp, cell.AuthKey, client.Public, ip.EncKey, subcredential)
+	defer Zeroize(encKey)
+	defer Zeroize(macKey)
+	if cell.Encrypted, err = aesCTR(encKey, make([]byte, aes.BlockSize), plaintext); err != nil {
+		return nil, err
+	}
+	if body, err = cell.body(); err != nil {
+		return nil, err
+	}
+	copy(cell.MAC[:], hsMAC(macKey, body))
+	return cell, nil
+}
+
+// Decrypt checks MAC of INTRODUCE2 cell and decrypts it with
+// the service encryption keypair encKey of the introduction point
+// (see IntroductionPointV3.EncKey) and subcredential.
+func (cell *Introduce1V3) Decrypt(encKey *NTorKeypair, subcredential []byte) (*IntroduceDataV3, error) {
+	exp, err := ntorExp(&encKey.Private, cell.ClientKey)
+	if err != nil {
+		return nil, err
+	}
+	defer Zeroize(exp)
+	key, macKey := hsntorIntroKeys(exp, cell.AuthKey, cell.ClientKey, encKey.Public, subcredential)
+	defer Zeroize(key)
+	defer Zeroize(macKey)
+	body, err := cell.body()
+	if err != nil {
+		return nil, err
+	}
+	if !ConstantTimeEqual(cell.MAC[:], hsMAC(macKey, body)) {
+		return nil, errors.New("Wrong MAC of INTRODUCE2 cell")
+	}
+	plaintext, err := aesCTR(key, make([]byte, aes.BlockSize), cell.Encrypted)
+	if err != nil {
+		return nil, err
+	}
+	return ParseIntroduceDataV3(plaintext)
+}
@@ -0,0 +1,71 @@
+package onionutil
+
+import (
+	"bytes"
+	"crypto/rand"
+	"net"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+func TestIntroduce1V3(t *testing.T) {
+	authPk, _, _ := ed25519.GenerateKey(rand.Reader)
+	var authKey Ed25519Pubkey
+	copy(authKey[:], authPk)
+	service, err := GenerateNTorKeypair(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ip := &IntroductionPointV3{
+		AuthKeyCert: NewCertificate(CertTypeHSIntroAuth, authKey, time.Now().Add(time.Hour), nil),
+		EncKey:      service.Public,
+	}
+	client, err := GenerateNTorKeypair(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rp, _ := GenerateNTorKeypair(rand.Reader)
+	cookie, _ := NewRendCookie(rand.Reader)
+	subcredential := make([]byte, 32)
+	rand.Read(subcredential)
+	data := &IntroduceDataV3{
+		Cookie:   cookie,
+		OnionKey: rp.Public,
+		LinkSpecifiers: []LinkSpecifier{
+			NewLinkSpecifierTCP(&net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 9001}),
+			NewLinkSpecifierLegacyID(make([]byte, FingerprintSize)),
+		},
+	}
+	cell, err := EncryptIntroduce1V3(client, ip, subcredential, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := cell.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(payload) != introduce1MinSize {
+		t.Fatalf("INTRODUCE1 is %d bytes long", len(payload))
+	}
+	parsed, err := ParseIntroduce1V3(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.AuthKey != authKey || parsed.ClientKey != client.Public {
+		t.Fatal("wrong keys in parsed cell")
+	}
+	got, err := parsed.Decrypt(service, subcredential)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := data.Encode()
+	if enc, _ := got.Encode(); !bytes.Equal(enc, want) {
+		t.Fatal("decrypted data differs")
+	}
+	subcredential[0] ^= 1
+	if _, err := parsed.Decrypt(service, subcredential); err == nil {
+		t.Fatal("cell is decrypted with wrong subcredential")
+	}
+}
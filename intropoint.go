@@ -10,10 +10,10 @@ package onionutil
 import (
 	"bytes"
 	"crypto/rsa"
-	"encoding/pem"
+	"errors"
 	"fmt"
-	"log"
 	"net"
+	"strconv"
 
 	"github.com/nogoegst/onionutil/pkcs1"
 	"github.com/nogoegst/onionutil/torparse"
@@ -27,74 +27,108 @@ type IntroductionPoint struct {
 	ServiceKey      *rsa.PublicKey
 }
 
-func ParseIntroPoints(ips_str []byte) (ips []IntroductionPoint, rest string) {
+func ParseIntroPoints(ips_str []byte) (ips []IntroductionPoint, rest string, err error) {
 	docs, _rest := torparse.ParseTorDocument(ips_str)
 	for _, doc := range docs {
-		if _, ok := doc["introduction-point"]; !ok {
-			log.Printf("Got a document that is not an introduction point")
-			continue
+		if _, ok := doc.Entries["introduction-point"]; !ok {
+			return nil, "", errors.New("Got a document that is not an introduction point")
 		}
 		var ip IntroductionPoint
 
-		identity, err := Base32Decode(string(doc["introduction-point"].FJoined()))
+		identity, err := Base32Decode(string(doc.Entries["introduction-point"].FJoined()))
 		if err != nil {
-			log.Printf("The IP has invalid idenity. Skipping")
-			continue
+			return nil, "", errors.New("The IP has invalid idenity")
 		}
 		ip.Identity = identity
 
-		ip.InternetAddress = net.ParseIP(string(doc["ip-address"].FJoined()))
+		ip.InternetAddress = net.ParseIP(string(doc.Entries["ip-address"].FJoined()))
 		if ip.InternetAddress == nil {
-			log.Printf("Not a valid Internet address for an IntroPoint")
-			continue
+			return nil, "", errors.New("Not a valid Internet address for an IntroPoint")
 		}
-		onion_port, err := InetPortFromByteString(doc["onion-port"].FJoined())
+		onion_port, err := InetPortFromByteString(doc.Entries["onion-port"].FJoined())
 		if err != nil {
-			log.Printf("Error parsing IP port: %v", err)
-			continue
+			return nil, "", fmt.Errorf("Error parsing IP port: %w", err)
 		}
 		ip.OnionPort = onion_port
-		onion_key, _, err := pkcs1.DecodePublicKeyDER(doc["onion-key"].FJoined())
+		onion_key, _, err := pkcs1.DecodePublicKeyDER(doc.Entries["onion-key"].FJoined())
 		if err != nil {
-			log.Printf("Decoding DER sequence of PulicKey has failed: %v.", err)
-			continue
+			return nil, "", fmt.Errorf("Decoding DER sequence of PulicKey has failed: %w", err)
 		}
 		ip.OnionKey = onion_key
-		service_key, _, err := pkcs1.DecodePublicKeyDER(doc["service-key"].FJoined())
+		service_key, _, err := pkcs1.DecodePublicKeyDER(doc.Entries["service-key"].FJoined())
 		if err != nil {
-			log.Printf("Decoding DER sequence of PulicKey has failed: %v.", err)
-			continue
+			return nil, "", fmt.Errorf("Decoding DER sequence of PulicKey has failed: %w", err)
 		}
 		ip.ServiceKey = service_key
 
 		ips = append(ips, ip)
 	}
 	rest = string(_rest)
-	return ips, rest
+	return ips, rest, nil
 }
 
-// XXX: replace Falalf's with graceful errors
+// Bytes returns encoding of the introduction point. It returns nil
+// if the keys cannot be encoded.
 func (ip IntroductionPoint) Bytes() (encodedIP []byte) {
-	w := new(bytes.Buffer)
-	fmt.Fprintf(w, "introduction-point %v\n", Base32Encode(ip.Identity))
-	fmt.Fprintf(w, "ip-address %v\n", ip.InternetAddress)
-	fmt.Fprintf(w, "onion-port %v\n", ip.OnionPort)
+	encodedIP, _ = ip.Encode()
+	return encodedIP
+}
+
+func (ip IntroductionPoint) Encode() ([]byte, error) {
 	onionKeyDER, err := pkcs1.EncodePublicKeyDER(ip.OnionKey)
 	if err != nil {
-		log.Fatalf("Cannot encode public key into DER sequence.")
+		return nil, err
 	}
-	onionKeyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PUBLIC KEY",
-		Bytes: onionKeyDER})
-	fmt.Fprintf(w, "onion-key\n%s", onionKeyPEM)
 	serviceKeyDER, err := pkcs1.EncodePublicKeyDER(ip.ServiceKey)
 	if err != nil {
-		log.Fatalf("Cannot encode public key into DER sequence.")
+		return nil, err
+	}
+	d := torparse.NewDocument()
+	d.Item("introduction-point", Base32Encode(ip.Identity))
+	d.Item("ip-address", ip.InternetAddress.String())
+	d.Item("onion-port", strconv.Itoa(int(ip.OnionPort)))
+	d.ItemObject("onion-key", "RSA PUBLIC KEY", onionKeyDER)
+	d.ItemObject("service-key", "RSA PUBLIC KEY", serviceKeyDER)
+	return d.Bytes()
+}
+
+// EncodeIntroPoints encodes ips into introduction-points block
+// of v2 descriptor. There must be at most MaxIntroPointsV2 of them.
+func EncodeIntroPoints(ips []IntroductionPoint) ([]byte, error) {
+	if err := checkIntroPointsCount(len(ips), MaxIntroPointsV2); err != nil {
+		return nil, err
+	}
+	w := new(bytes.Buffer)
+	for _, ip := range ips {
+		encodedIP, err := ip.Encode()
+		if err != nil {
+			return nil, err
+		}
+		w.Write(encodedIP)
+	}
+	return w.Bytes(), nil
+}
+
+// IntroPoints parses unencrypted introduction points of desc.
+func (desc *OnionDescriptor) IntroPoints() ([]IntroductionPoint, error) {
+	ips, rest, err := ParseIntroPoints(desc.IntropointsBlock)
+	if err != nil {
+		return nil, err
 	}
-	serviceKeyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PUBLIC KEY",
-		Bytes: serviceKeyDER})
-	fmt.Fprintf(w, "service-key\n%s", serviceKeyPEM)
+	if len(rest) != 0 {
+		return nil, fmt.Errorf("Trailing data in introduction points")
+	}
+	return ips, nil
+}
 
-	return w.Bytes()
+// SetIntroPoints sets unencrypted introduction points of desc to ips.
+func (desc *OnionDescriptor) SetIntroPoints(ips []IntroductionPoint) error {
+	block, err := EncodeIntroPoints(ips)
+	if err != nil {
+		return err
+	}
+	desc.IntropointsBlock = block
+	return nil
 }
 
 func (ip *IntroductionPoint) String() string {
@@ -0,0 +1,165 @@
+// intropointv3.go - deal with v3 introduction points
+//
+// To the extent possible under law, Ivan Markin waived all copyright
+// and related or neighboring rights to this module of onionutil, using the creative
+// commons "cc0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package onionutil
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"github.com/nogoegst/onionutil/pkcs1"
+	"github.com/nogoegst/onionutil/torparse"
+)
+
+// IntroductionPointV3 is an "introduction-point" section of the
+// inner layer of v3 descriptor (rend-spec-v3 2.5.2.2).
+type IntroductionPointV3 struct {
+	LinkSpecifiers []LinkSpecifier
+	// OnionKey is the ntor key of the introduction point relay.
+	OnionKey NTorOnionKey
+	// AuthKeyCert certifies introduction point authentication key
+	// with the descriptor signing key.
+	AuthKeyCert *Certificate
+	// EncKey is the service ntor key used for INTRODUCE2 cells.
+	EncKey NTorOnionKey
+	// EncKeyCert certifies ed25519 equivalent of EncKey with the
+	// descriptor signing key.
+	EncKeyCert *Certificate
+	// LegacyKey and LegacyKeyCert are used by introduction points
+	// that do not support ed25519 authentication keys.
+	LegacyKey     *rsa.PublicKey
+	LegacyKeyCert []byte
+}
+
+// parseNTorKeyEntry parses "<keyword> ntor <key>" entry.
+func parseNTorKeyEntry(entries torparse.TorEntries) (key NTorOnionKey, err error) {
+	if len(entries) != 1 || len(entries[0]) != 2 || string(entries[0][0]) != "ntor" {
+		return key, errors.New("Malformed ntor key entry")
+	}
+	return ParseNTorOnionKey(entries[0][1])
+}
+
+func ParseIntroductionPointV3(data []byte) (*IntroductionPointV3, error) {
+	doc, err := singleTorDocument(data)
+	if err != nil {
+		return nil, err
+	}
+	for _, kw := range []string{"introduction-point", "onion-key",
+		"auth-key", "enc-key", "enc-key-cert"} {
+		if !torparse.ExactlyOnce(doc.Entries[kw]) {
+			return nil, fmt.Errorf("%s must appear exactly once", kw)
+		}
+	}
+	ip := new(IntroductionPointV3)
+	lsData, err := decodeBase64(doc.Entries["introduction-point"].FJoined())
+	if err != nil {
+		return nil, err
+	}
+	lss, rest, err := DecodeLinkSpecifiers(lsData)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, errors.New("Trailing data in link specifiers")
+	}
+	ip.LinkSpecifiers = lss
+	if ip.OnionKey, err = parseNTorKeyEntry(doc.Entries["onion-key"]); err != nil {
+		return nil, err
+	}
+	if ip.EncKey, err = parseNTorKeyEntry(doc.Entries["enc-key"]); err != nil {
+		return nil, err
+	}
+	authKeyCert, err := ParseCertFromBytes(doc.Entries["auth-key"].FJoined())
+	if err != nil {
+		return nil, err
+	}
+	ip.AuthKeyCert = &authKeyCert
+	encKeyCert, err := ParseCertFromBytes(doc.Entries["enc-key-cert"].FJoined())
+	if err != nil {
+		return nil, err
+	}
+	ip.EncKeyCert = &encKeyCert
+	if value, ok := doc.Entries["legacy-key"]; ok {
+		if !torparse.AtMostOnce(value) {
+			return nil, errors.New("legacy-key must appear at most once")
+		}
+		if !torparse.ExactlyOnce(doc.Entries["legacy-key-cert"]) {
+			return nil, errors.New("legacy-key-cert must appear exactly once")
+		}
+		ip.LegacyKey, _, err = pkcs1.DecodePublicKeyDER(value.FJoined())
+		if err != nil {
+			return nil, err
+		}
+		ip.LegacyKeyCert = doc.Entries["legacy-key-cert"].FJoined()
+	}
+	return ip, nil
+}
+
+func (ip *IntroductionPointV3) Encode() ([]byte, error) {
+	if ip.AuthKeyCert == nil || ip.EncKeyCert == nil {
+		return nil, errors.New("Missing introduction point certificates")
+	}
+	lsData, err := EncodeLinkSpecifiers(ip.LinkSpecifiers)
+	if err != nil {
+		return nil, err
+	}
+	d := torparse.NewDocument()
+	d.Item("introduction-point", base64.StdEncoding.EncodeToString(lsData))
+	d.Item("onion-key", "ntor", ip.OnionKey.String())
+	d.ItemObject("auth-key", "ED25519 CERT", ip.AuthKeyCert.Bytes())
+	d.Item("enc-key", "ntor", ip.EncKey.String())
+	d.ItemObject("enc-key-cert", "ED25519 CERT", ip.EncKeyCert.Bytes())
+	if ip.LegacyKey != nil {
+		legacyKeyDER, err := pkcs1.EncodePublicKeyDER(ip.LegacyKey)
+		if err != nil {
+			return nil, err
+		}
+		d.ItemObject("legacy-key", "RSA PUBLIC KEY", legacyKeyDER)
+		d.ItemObject("legacy-key-cert", "CROSSCERT", ip.LegacyKeyCert)
+	}
+	return d.Bytes()
+}
+
+// Bytes returns encoding of the introduction point. It returns nil
+// if the introduction point cannot be encoded.
+func (ip *IntroductionPointV3) Bytes() []byte {
+	b, _ := ip.Encode()
+	return b
+}
+
+// IntroductionPoints parses introduction points of the layer.
+func (layer *EncryptedLayerV3) IntroductionPoints() ([]*IntroductionPointV3, error) {
+	var ips []*IntroductionPointV3
+	for i, section := range layer.IntroPoints {
+		ip, err := ParseIntroductionPointV3(section)
+		if err != nil {
+			return nil, fmt.Errorf("Introduction point %d: %w", i, err)
+		}
+		ips = append(ips, ip)
+	}
+	return ips, nil
+}
+
+// SetIntroductionPoints sets introduction points of the layer to ips.
+// There must be at most MaxIntroPointsV3 of them.
+func (layer *EncryptedLayerV3) SetIntroductionPoints(ips []*IntroductionPointV3) error {
+	if err := checkIntroPointsCount(len(ips), MaxIntroPointsV3); err != nil {
+		return err
+	}
+	var sections [][]byte
+	for _, ip := range ips {
+		section, err := ip.Encode()
+		if err != nil {
+			return err
+		}
+		sections = append(sections, section)
+	}
+	layer.IntroPoints = sections
+	return nil
+}
@@ -0,0 +1,80 @@
+package onionutil
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"net"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+func TestIntroductionPointV3(t *testing.T) {
+	descPk, descSk, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	relayKey, err := GenerateNTorKeypair(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encKey, err := GenerateNTorKeypair(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacyKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var authKey Ed25519Pubkey
+	rand.Read(authKey[:])
+	authKeyCert := NewCertificate(CertTypeHSIntroAuth, authKey, time.Now().Add(time.Hour), descPk)
+	authKeyCert.Sign(descSk)
+	encKeyCert := NewCertificate(CertTypeHSNTorEncCrosscert, authKey, time.Now().Add(time.Hour), descPk)
+	encKeyCert.Sign(descSk)
+
+	ip := &IntroductionPointV3{
+		LinkSpecifiers: []LinkSpecifier{
+			NewLinkSpecifierTCP(&net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 9001}),
+			NewLinkSpecifierLegacyID(make([]byte, NTorIdentitySize)),
+		},
+		OnionKey:      relayKey.Public,
+		AuthKeyCert:   authKeyCert,
+		EncKey:        encKey.Public,
+		EncKeyCert:    encKeyCert,
+		LegacyKey:     &legacyKey.PublicKey,
+		LegacyKeyCert: []byte("crosscert"),
+	}
+	layer := &EncryptedLayerV3{Create2Formats: []int{Create2FormatNTor}}
+	if err := layer.SetIntroductionPoints([]*IntroductionPointV3{ip, ip}); err != nil {
+		t.Fatal(err)
+	}
+	parsedLayer, err := ParseEncryptedLayerV3(layer.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ips, err := parsedLayer.IntroductionPoints()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ips) != 2 {
+		t.Fatalf("got %d introduction points", len(ips))
+	}
+	parsed := ips[1]
+	if !bytes.Equal(parsed.Bytes(), ip.Bytes()) {
+		t.Fatal("introduction point round-trip failed")
+	}
+	if parsed.OnionKey != ip.OnionKey || parsed.EncKey != ip.EncKey ||
+		parsed.LegacyKey.N.Cmp(legacyKey.N) != 0 {
+		t.Fatal("wrong keys")
+	}
+	if err := parsed.AuthKeyCert.Verify(descPk); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ParseIntroductionPointV3([]byte("introduction-point AA==\n")); err == nil {
+		t.Fatal("incomplete introduction point accepted")
+	}
+}
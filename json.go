@@ -0,0 +1,191 @@
+// json.go - JSON encoding of parsed Tor data
+//
+// To the extent possible under law, Ivan Markin waived all copyright
+// and related or neighboring rights to this module of onionutil, using the creative
+// commons "cc0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package onionutil
+
+import (
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nogoegst/onionutil/pkcs1"
+	"github.com/nogoegst/onionutil/torparse"
+)
+
+type onionDescriptorJSON struct {
+	DescID             string    `json:"descriptor_id"`
+	OnionAddress       string    `json:"onion_address,omitempty"`
+	Version            int       `json:"version"`
+	PermanentKey       string    `json:"permanent_key,omitempty"`
+	SecretIDPart       string    `json:"secret_id_part"`
+	PublicationTime    time.Time `json:"publication_time"`
+	ProtocolVersions   []int     `json:"protocol_versions"`
+	IntroductionPoints []byte    `json:"introduction_points,omitempty"`
+	Signature          []byte    `json:"signature,omitempty"`
+	Replica            int       `json:"replica"`
+}
+
+// MarshalJSON encodes IDs in base32, the permanent key in PEM
+// and the publication time in RFC 3339. Onion address is
+// informational and is ignored by UnmarshalJSON.
+func (desc *OnionDescriptor) MarshalJSON() ([]byte, error) {
+	j := onionDescriptorJSON{
+		DescID:             Base32Encode(desc.DescID),
+		Version:            desc.Version,
+		SecretIDPart:       Base32Encode(desc.SecretIDPart),
+		PublicationTime:    desc.PublicationTime.UTC(),
+		ProtocolVersions:   desc.ProtocolVersions,
+		IntroductionPoints: desc.IntropointsBlock,
+		Signature:          desc.Signature,
+		Replica:            desc.Replica,
+	}
+	if desc.PermanentKey != nil {
+		/* Keys of existing services may not satisfy CheckTorKey */
+		der, err := pkcs1.EncodePublicKeyDER(desc.PermanentKey)
+		if err != nil {
+			return nil, err
+		}
+		j.PermanentKey = string(pem.EncodeToMemory(&pem.Block{
+			Type:  pkcs1.PublicKeyPEMType,
+			Bytes: der,
+		}))
+		j.OnionAddress, err = OnionAddressV2(desc.PermanentKey)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(j)
+}
+
+func (desc *OnionDescriptor) UnmarshalJSON(data []byte) (err error) {
+	var j onionDescriptorJSON
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+	d := OnionDescriptor{
+		Version:          j.Version,
+		PublicationTime:  j.PublicationTime,
+		ProtocolVersions: j.ProtocolVersions,
+		IntropointsBlock: j.IntroductionPoints,
+		Signature:        j.Signature,
+		Replica:          j.Replica,
+	}
+	if d.DescID, err = Base32Decode(j.DescID); err != nil {
+		return err
+	}
+	if d.SecretIDPart, err = Base32Decode(j.SecretIDPart); err != nil {
+		return err
+	}
+	if j.PermanentKey != "" {
+		der, err := torparse.DecodePEMBlock([]byte(j.PermanentKey), torparse.ObjectRSAPublicKey)
+		if err != nil {
+			return fmt.Errorf("Malformed permanent key: %w", err)
+		}
+		if d.PermanentKey, _, err = pkcs1.DecodePublicKeyDER(der); err != nil {
+			return err
+		}
+	}
+	*desc = d
+	return nil
+}
+
+// MarshalJSON encodes the platform as its line.
+func (platform Platform) MarshalJSON() ([]byte, error) {
+	return json.Marshal(platform.String())
+}
+
+func (platform *Platform) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	var entry torparse.TorEntry
+	for _, word := range strings.Fields(s) {
+		entry = append(entry, []byte(word))
+	}
+	p, err := ParsePlatformEntry(entry)
+	if err != nil {
+		return err
+	}
+	*platform = p
+	return nil
+}
+
+type bandwidthJSON struct {
+	Average  uint64 `json:"average"`
+	Burst    uint64 `json:"burst"`
+	Observed uint64 `json:"observed"`
+}
+
+func (bw Bandwidth) MarshalJSON() ([]byte, error) {
+	return json.Marshal(bandwidthJSON(bw))
+}
+
+func (bw *Bandwidth) UnmarshalJSON(data []byte) error {
+	var j bandwidthJSON
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+	*bw = Bandwidth(j)
+	return nil
+}
+
+// MarshalJSON encodes the rule as a string like "accept *:80".
+func (rule PolicyRule) MarshalJSON() ([]byte, error) {
+	return json.Marshal(rule.String())
+}
+
+func (rule *PolicyRule) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	r, err := ParsePolicyRule(s)
+	if err != nil {
+		return err
+	}
+	*rule = r
+	return nil
+}
+
+// MarshalJSON encodes the summary as a string like "accept 80,443".
+func (ps *PolicySummary) MarshalJSON() ([]byte, error) {
+	return json.Marshal(ps.String())
+}
+
+func (ps *PolicySummary) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	summary, err := ParsePolicySummary(s)
+	if err != nil {
+		return err
+	}
+	*ps = *summary
+	return nil
+}
+
+// MarshalJSON encodes the policy as a string like "accept 80,443".
+func (p *Exit6Policy) MarshalJSON() ([]byte, error) {
+	return json.Marshal(p.String())
+}
+
+func (p *Exit6Policy) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	policy, err := ParseExit6Policy(s)
+	if err != nil {
+		return err
+	}
+	*p = *policy
+	return nil
+}
@@ -0,0 +1,87 @@
+// json_test.go - tests for JSON encoding
+//
+// To the extent possible under law, Ivan Markin waived all copyright
+// and related or neighboring rights to this module of onionutil, using the creative
+// commons "cc0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package onionutil
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nogoegst/onionutil/testvectors"
+	"golang.org/x/crypto/ed25519"
+)
+
+func TestOnionDescriptorJSON(t *testing.T) {
+	results, _ := ParseOnionDescriptors([]byte(testvectors.ServiceDescriptorV2.Data))
+	desc := results[0].Desc
+	data, err := json.Marshal(desc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{
+		`"descriptor_id":"` + testvectors.ServiceDescriptorV2.DescID + `"`,
+		`"onion_address":"` + testvectors.ServiceDescriptorV2.OnionAddress + `"`,
+		`"publication_time":"2016-06-21T20:00:00Z"`,
+	} {
+		if !strings.Contains(string(data), s) {
+			t.Fatalf("%s is missing in %s", s, data)
+		}
+	}
+	var decoded OnionDescriptor
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decoded.Bytes(), desc.Bytes()) {
+		t.Fatal("descriptor is changed by JSON round trip")
+	}
+	if err := decoded.VerifySignature(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCertificateJSON(t *testing.T) {
+	pk, sk, _ := ed25519.GenerateKey(rand.Reader)
+	var certified Ed25519Pubkey
+	cert := NewCertificate(CertTypeIdentitySigning, certified, time.Now().Add(time.Hour), pk)
+	cert.Sign(sk)
+	data, err := json.Marshal(cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Certificate
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decoded.Bytes(), cert.Bytes()) {
+		t.Fatal("certificate is changed by JSON round trip")
+	}
+}
+
+func TestPolicyJSON(t *testing.T) {
+	policy := Policy{}
+	if err := json.Unmarshal([]byte(`["accept *:80","reject *:*"]`), &policy); err != nil {
+		t.Fatal(err)
+	}
+	if policy.String() != "accept *:80\nreject *:*\n" {
+		t.Fatalf("wrong policy: %q", policy)
+	}
+	data, err := json.Marshal(struct {
+		Bandwidth Bandwidth
+		Platform  Platform
+	}{Bandwidth{1, 2, 3}, Platform{SoftwareName: "Tor", SoftwareVersion: "0.3.5.7", Name: "Linux"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"Bandwidth":{"average":1,"burst":2,"observed":3},"Platform":"Tor 0.3.5.7 on Linux"}`
+	if string(data) != expected {
+		t.Fatalf("wrong encoding: %s", data)
+	}
+}
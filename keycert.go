@@ -0,0 +1,168 @@
+// keycert.go - directory authority key certificates
+//
+// To the extent possible under law, Ivan Markin waived all copyright
+// and related or neighboring rights to this module of onionutil, using the creative
+// commons "cc0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package onionutil
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/nogoegst/onionutil/pkcs1"
+	"github.com/nogoegst/onionutil/torparse"
+)
+
+// KeyCertificate is a key certificate of a directory authority
+// which certifies its medium-term signing key with the long-term
+// identity key (dir-spec 3.1).
+type KeyCertificate struct {
+	Version     int
+	Address     string
+	Fingerprint Fingerprint
+	Published   time.Time
+	Expires     time.Time
+	IdentityKey *rsa.PublicKey
+	SigningKey  *rsa.PublicKey
+	// Crosscert is the signature of identity key digest
+	// with the signing key.
+	Crosscert []byte
+	// Certification is the signature of the certificate
+	// with the identity key.
+	Certification []byte
+
+	// Raw is the encoded certificate.
+	Raw []byte
+}
+
+func ParseKeyCertificate(data []byte) (*KeyCertificate, error) {
+	doc, err := singleTorDocument(data)
+	if err != nil {
+		return nil, err
+	}
+	for _, kw := range []string{"dir-key-certificate-version", "fingerprint",
+		"dir-key-published", "dir-key-expires", "dir-identity-key",
+		"dir-signing-key", "dir-key-crosscert", "dir-key-certification"} {
+		if !torparse.ExactlyOnce(doc.Entries[kw]) {
+			return nil, fmt.Errorf("%s must appear exactly once", kw)
+		}
+	}
+	kc := &KeyCertificate{Raw: data}
+	kc.Version, err = strconv.Atoi(string(doc.Entries["dir-key-certificate-version"].FJoined()))
+	if err != nil {
+		return nil, err
+	}
+	if kc.Version != 3 {
+		return nil, fmt.Errorf("Unsupported key certificate version %d", kc.Version)
+	}
+	if value, ok := doc.Entries["dir-address"]; ok {
+		if !torparse.AtMostOnce(value) {
+			return nil, errors.New("dir-address must appear at most once")
+		}
+		kc.Address = string(value.FJoined())
+	}
+	kc.Fingerprint, err = ParseFingerprint(string(doc.Entries["fingerprint"].FJoined()))
+	if err != nil {
+		return nil, err
+	}
+	if kc.Published, err = parseDocumentTime(doc.Entries["dir-key-published"][0]); err != nil {
+		return nil, err
+	}
+	if kc.Expires, err = parseDocumentTime(doc.Entries["dir-key-expires"][0]); err != nil {
+		return nil, err
+	}
+	kc.IdentityKey, _, err = pkcs1.DecodePublicKeyDER(doc.Entries["dir-identity-key"].FJoined())
+	if err != nil {
+		return nil, err
+	}
+	kc.SigningKey, _, err = pkcs1.DecodePublicKeyDER(doc.Entries["dir-signing-key"].FJoined())
+	if err != nil {
+		return nil, err
+	}
+	kc.Crosscert = doc.Entries["dir-key-crosscert"].FJoined()
+	kc.Certification = doc.Entries["dir-key-certification"].FJoined()
+	return kc, nil
+}
+
+// ParseKeyCertificates parses concatenated key certificates
+// as served by directories (/tor/keys/...).
+func ParseKeyCertificates(data []byte) (kcs []*KeyCertificate, err error) {
+	_, sections := splitSections(data, "dir-key-certificate-version")
+	for i, section := range sections {
+		kc, err := ParseKeyCertificate(section)
+		if err != nil {
+			return nil, fmt.Errorf("Key certificate %d: %w", i, err)
+		}
+		kcs = append(kcs, kc)
+	}
+	return kcs, nil
+}
+
+// SigningKeyDigest returns SHA1 digest of DER-encoded signing key
+// which is used to refer to it in directory signatures.
+func (kc *KeyCertificate) SigningKeyDigest() ([]byte, error) {
+	return RSAPubkeyHash(kc.SigningKey)
+}
+
+// VerifyCrosscert checks that the signing key has signed
+// the identity key digest.
+func (kc *KeyCertificate) VerifyCrosscert() error {
+	fp, err := NewFingerprint(kc.IdentityKey)
+	if err != nil {
+		return err
+	}
+	if !fp.Equal(kc.Fingerprint) {
+		return errors.New("Fingerprint doesn't match identity key")
+	}
+	return verifyPKCS1v15(kc.SigningKey, crypto.Hash(0), fp[:], kc.Crosscert)
+}
+
+// VerifyCertification checks that the identity key has signed
+// the certificate.
+func (kc *KeyCertificate) VerifyCertification() error {
+	doc, err := singleTorDocument(kc.Raw)
+	if err != nil {
+		return err
+	}
+	signed := doc.SignedPart("dir-key-certification")
+	if signed == nil {
+		return errors.New("No dir-key-certification")
+	}
+	digest := sha1.Sum(signed)
+	return verifyPKCS1v15(kc.IdentityKey, crypto.Hash(0), digest[:], kc.Certification)
+}
+
+// Verify checks both the cross-certificate and the certification.
+func (kc *KeyCertificate) Verify() error {
+	if err := kc.VerifyCrosscert(); err != nil {
+		return fmt.Errorf("Invalid dir-key-crosscert: %w", err)
+	}
+	if err := kc.VerifyCertification(); err != nil {
+		return fmt.Errorf("Invalid dir-key-certification: %w", err)
+	}
+	return nil
+}
+
+// Expired reports whether the certificate is expired at time now.
+func (kc *KeyCertificate) Expired(now time.Time) bool {
+	return !now.Before(kc.Expires)
+}
+
+// Validate checks signatures of the certificate and that it's
+// valid at time now.
+func (kc *KeyCertificate) Validate(now time.Time) error {
+	if now.Before(kc.Published) {
+		return errors.New("Key certificate is published in the future")
+	}
+	if kc.Expired(now) {
+		return errors.New("Key certificate is expired")
+	}
+	return kc.Verify()
+}
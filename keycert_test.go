@@ -0,0 +1,109 @@
+package onionutil
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nogoegst/onionutil/pkcs1"
+	"github.com/nogoegst/onionutil/torparse"
+)
+
+// testKeyCertificate returns key certificate of signing key
+// made with identity key.
+func testKeyCertificate(t *testing.T, identity, signing *rsa.PrivateKey, published time.Time) []byte {
+	fp, err := NewFingerprint(&identity.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := torparse.NewDocument()
+	d.Item("dir-key-certificate-version", "3")
+	d.Item("fingerprint", fp.String())
+	d.Item("dir-key-published", strings.Fields(published.UTC().Format(PublicationTimeFormat))...)
+	d.Item("dir-key-expires", strings.Fields(published.AddDate(0, 6, 0).UTC().Format(PublicationTimeFormat))...)
+	identityDER, _ := pkcs1.EncodePublicKeyDER(&identity.PublicKey)
+	d.ItemObject("dir-identity-key", "RSA PUBLIC KEY", identityDER)
+	signingDER, _ := pkcs1.EncodePublicKeyDER(&signing.PublicKey)
+	d.ItemObject("dir-signing-key", "RSA PUBLIC KEY", signingDER)
+	crosscert, err := rsa.SignPKCS1v15(nil, signing, crypto.Hash(0), fp[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.ItemObject("dir-key-crosscert", "ID SIGNATURE", crosscert)
+	signed, err := d.Item("dir-key-certification").Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha1.Sum(signed)
+	certification, err := rsa.SignPKCS1v15(nil, identity, crypto.Hash(0), digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := d.Object("SIGNATURE", certification).Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestParseKeyCertificates(t *testing.T) {
+	identity, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signing, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	published := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	cert := testKeyCertificate(t, identity, signing, published)
+	kcs, err := ParseKeyCertificates(append(append([]byte{}, cert...), cert...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(kcs) != 2 {
+		t.Fatalf("parsed %d certificates", len(kcs))
+	}
+	kc := kcs[1]
+	fp, _ := NewFingerprint(&identity.PublicKey)
+	if kc.Fingerprint != fp || !kc.Published.Equal(published) ||
+		kc.SigningKey.N.Cmp(signing.N) != 0 || !bytes.Equal(kc.Raw, cert) {
+		t.Fatal("wrong key certificate")
+	}
+}
+
+func TestKeyCertificateValidate(t *testing.T) {
+	identity, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signing, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	published := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	kc, err := ParseKeyCertificate(testKeyCertificate(t, identity, signing, published))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := kc.Validate(published.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if kc.Validate(published.AddDate(1, 0, 0)) == nil {
+		t.Fatal("expired certificate is valid")
+	}
+	kc.Raw = bytes.Replace(kc.Raw, []byte("dir-key-published 2018"), []byte("dir-key-published 2019"), 1)
+	if kc.VerifyCertification() == nil {
+		t.Fatal("tampered certificate verified")
+	}
+	other, _ := NewFingerprint(&signing.PublicKey)
+	kc.Fingerprint = other
+	if kc.VerifyCrosscert() == nil {
+		t.Fatal("crosscert verified with wrong identity")
+	}
+}
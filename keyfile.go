@@ -8,11 +8,36 @@
 package onionutil
 
 import (
+	"bytes"
 	"crypto"
+	"crypto/rsa"
 	"crypto/x509"
 	"encoding/pem"
 	"fmt"
 	"io/ioutil"
+	"path/filepath"
+
+	"github.com/nogoegst/onionutil/pkcs1"
+	"golang.org/x/crypto/ed25519"
+)
+
+// Names of files in HiddenServiceDir.
+const (
+	HostnameFilename     = "hostname"
+	PrivateKeyFilenameV2 = "private_key"
+	SecretKeyFilenameV3  = "hs_ed25519_secret_key"
+	PublicKeyFilenameV3  = "hs_ed25519_public_key"
+	ClientKeysFilenameV2 = "client_keys"
+	AuthorizedClientsDir = "authorized_clients"
+)
+
+// Tags of Tor's ed25519 key files. Tags are padded
+// with zeros to keyFileTagSize bytes.
+const (
+	SecretKeyFileTagV3 = "== ed25519v1-secret: type0 =="
+	PublicKeyFileTagV3 = "== ed25519v1-public: type0 =="
+
+	keyFileTagSize = 32
 )
 
 func LoadPrivateKeyFile(filename string) (crypto.PrivateKey, crypto.PublicKey, error) {
@@ -20,6 +45,13 @@ func LoadPrivateKeyFile(filename string) (crypto.PrivateKey, crypto.PublicKey, e
 	if err != nil {
 		return nil, nil, err
 	}
+	if bytes.HasPrefix(fileContent, []byte(SecretKeyFileTagV3)) {
+		esk, err := DecodeSecretKeyV3(fileContent)
+		if err != nil {
+			return nil, nil, err
+		}
+		return esk, esk.Public(), nil
+	}
 	block, rest := pem.Decode(fileContent)
 	if len(rest) == len(fileContent) {
 		return nil, nil, fmt.Errorf("No vailid PEM blocks found")
@@ -36,3 +68,130 @@ func LoadPrivateKeyFile(filename string) (crypto.PrivateKey, crypto.PublicKey, e
 		return nil, nil, fmt.Errorf("Unrecognized type of PEM block")
 	}
 }
+
+// LoadPrivateKeyFileV2 loads v2 onion service key from Tor's
+// private_key file.
+func LoadPrivateKeyFileV2(filename string) (*rsa.PrivateKey, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return pkcs1.DecodePrivateKeyPEM(data)
+}
+
+// SavePrivateKeyFileV2 saves v2 onion service key sk in the format
+// of Tor's private_key file.
+func SavePrivateKeyFileV2(filename string, sk *rsa.PrivateKey) error {
+	data, err := pkcs1.EncodePrivateKeyPEM(sk)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, data, 0600)
+}
+
+// SaveHostnameFile writes onion address of public key pk
+// into hostname file.
+func SaveHostnameFile(filename string, pk crypto.PublicKey) error {
+	onionAddress, err := OnionAddress(pk)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, []byte(onionAddress+".onion\n"), 0600)
+}
+
+// SaveServiceDirV2 writes private_key and hostname files of v2 onion
+// service with key sk into HiddenServiceDir dir which must exist.
+func SaveServiceDirV2(dir string, sk *rsa.PrivateKey) error {
+	err := SavePrivateKeyFileV2(filepath.Join(dir, PrivateKeyFilenameV2), sk)
+	if err != nil {
+		return err
+	}
+	return SaveHostnameFile(filepath.Join(dir, HostnameFilename), sk.Public())
+}
+
+func keyFileTag(tag string) []byte {
+	b := make([]byte, keyFileTagSize)
+	copy(b, tag)
+	return b
+}
+
+func decodeTaggedKey(data []byte, tag string, size int) ([]byte, error) {
+	if len(data) != keyFileTagSize+size {
+		return nil, fmt.Errorf("Wrong key file size")
+	}
+	if !bytes.Equal(data[:keyFileTagSize], keyFileTag(tag)) {
+		return nil, fmt.Errorf("Wrong key file tag")
+	}
+	return data[keyFileTagSize:], nil
+}
+
+// EncodeSecretKeyV3 encodes expanded key esk in the format
+// of Tor's hs_ed25519_secret_key file.
+func EncodeSecretKeyV3(esk *Ed25519ExpandedKey) []byte {
+	return append(keyFileTag(SecretKeyFileTagV3), esk[:]...)
+}
+
+func DecodeSecretKeyV3(data []byte) (*Ed25519ExpandedKey, error) {
+	key, err := decodeTaggedKey(data, SecretKeyFileTagV3, Ed25519ExpandedKeySize)
+	if err != nil {
+		return nil, err
+	}
+	esk := new(Ed25519ExpandedKey)
+	copy(esk[:], key)
+	return esk, nil
+}
+
+// EncodePublicKeyV3 encodes pk in the format of Tor's
+// hs_ed25519_public_key file.
+func EncodePublicKeyV3(pk ed25519.PublicKey) []byte {
+	return append(keyFileTag(PublicKeyFileTagV3), pk...)
+}
+
+func DecodePublicKeyV3(data []byte) (ed25519.PublicKey, error) {
+	key, err := decodeTaggedKey(data, PublicKeyFileTagV3, ed25519.PublicKeySize)
+	if err != nil {
+		return nil, err
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+func LoadSecretKeyFileV3(filename string) (*Ed25519ExpandedKey, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return DecodeSecretKeyV3(data)
+}
+
+func SaveSecretKeyFileV3(filename string, esk *Ed25519ExpandedKey) error {
+	return ioutil.WriteFile(filename, EncodeSecretKeyV3(esk), 0600)
+}
+
+func LoadPublicKeyFileV3(filename string) (ed25519.PublicKey, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return DecodePublicKeyV3(data)
+}
+
+func SavePublicKeyFileV3(filename string, pk ed25519.PublicKey) error {
+	return ioutil.WriteFile(filename, EncodePublicKeyV3(pk), 0600)
+}
+
+// SaveServiceDirV3 writes hs_ed25519_secret_key, hs_ed25519_public_key
+// and hostname files of v3 onion service with key sk into
+// HiddenServiceDir dir which must exist.
+func SaveServiceDirV3(dir string, sk ed25519.PrivateKey) error {
+	esk := ExpandEd25519Key(sk)
+	pk := sk.Public().(ed25519.PublicKey)
+	err := SaveSecretKeyFileV3(filepath.Join(dir, SecretKeyFilenameV3), &esk)
+	if err != nil {
+		return err
+	}
+	err = SavePublicKeyFileV3(filepath.Join(dir, PublicKeyFilenameV3), pk)
+	if err != nil {
+		return err
+	}
+	return SaveHostnameFile(filepath.Join(dir, HostnameFilename), pk)
+}
@@ -0,0 +1,81 @@
+package onionutil
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+func TestServiceDirV2(t *testing.T) {
+	dir, err := ioutil.TempDir("", "onionutil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	sk, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveServiceDirV2(dir, sk); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadPrivateKeyFileV2(filepath.Join(dir, PrivateKeyFilenameV2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.D.Cmp(sk.D) != 0 {
+		t.Fatal("loaded key differs from the saved one")
+	}
+	hostname, err := ioutil.ReadFile(filepath.Join(dir, HostnameFilename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	onionAddress, _ := OnionAddressV2(&sk.PublicKey)
+	if string(hostname) != onionAddress+".onion\n" {
+		t.Fatalf("wrong hostname file: %q", hostname)
+	}
+}
+
+func TestServiceDirV3(t *testing.T) {
+	dir, err := ioutil.TempDir("", "onionutil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	pk, sk, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveServiceDirV3(dir, sk); err != nil {
+		t.Fatal(err)
+	}
+	loadedSk, loadedPk, err := LoadPrivateKeyFile(filepath.Join(dir, SecretKeyFilenameV3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(loadedPk.(ed25519.PublicKey), pk) {
+		t.Fatal("public key of loaded secret key differs")
+	}
+	esk := loadedSk.(*Ed25519ExpandedKey)
+	sig, err := esk.Sign(rand.Reader, []byte("message"), crypto.Hash(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ed25519.Verify(pk, []byte("message"), sig) {
+		t.Fatal("loaded key produced an invalid signature")
+	}
+	filePk, err := LoadPublicKeyFileV3(filepath.Join(dir, PublicKeyFilenameV3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(filePk, pk) {
+		t.Fatal("loaded public key differs")
+	}
+}
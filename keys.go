@@ -0,0 +1,71 @@
+// keys.go - operations with fixed-size public keys
+//
+// To the extent possible under law, Ivan Markin waived all copyright
+// and related or neighboring rights to this module of onionutil, using the creative
+// commons "cc0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package onionutil
+
+import (
+	"github.com/nogoegst/onionutil/torkeys"
+)
+
+/* Key types live in torkeys, these are kept for compatibility */
+
+const (
+	Ed25519PubkeySize    = torkeys.Ed25519PubkeySize
+	Ed25519SignatureSize = torkeys.Ed25519SignatureSize
+	Curve25519PubkeySize = torkeys.Curve25519PubkeySize
+	RSAPubkeySize        = torkeys.RSAPubkeySize
+	RSASignatureSize     = torkeys.RSASignatureSize
+)
+
+type (
+	Ed25519Pubkey    = torkeys.Ed25519Pubkey
+	Ed25519Signature = torkeys.Ed25519Signature
+	Curve25519Pubkey = torkeys.Curve25519Pubkey
+	RSASignature     = torkeys.RSASignature
+)
+
+var (
+	ErrZeroKey         = torkeys.ErrZeroKey
+	ErrNonCanonicalKey = torkeys.ErrNonCanonicalKey
+	ErrInvalidKey      = torkeys.ErrInvalidKey
+	ErrSmallOrderKey   = torkeys.ErrSmallOrderKey
+	ErrTorsionKey      = torkeys.ErrTorsionKey
+)
+
+// Ed25519PubkeyFromBytes returns Ed25519 public key stored in b.
+func Ed25519PubkeyFromBytes(b []byte) (Ed25519Pubkey, error) {
+	return torkeys.Ed25519PubkeyFromBytes(b)
+}
+
+// ParseEd25519Pubkey parses Ed25519 public key encoded in base64
+// with or without padding.
+func ParseEd25519Pubkey(s string) (Ed25519Pubkey, error) {
+	return torkeys.ParseEd25519Pubkey(s)
+}
+
+// ParseEd25519PubkeyBase32 parses Ed25519 public key encoded
+// in base32.
+func ParseEd25519PubkeyBase32(s string) (Ed25519Pubkey, error) {
+	return torkeys.ParseEd25519PubkeyBase32(s)
+}
+
+// Curve25519PubkeyFromBytes returns Curve25519 public key stored in b.
+func Curve25519PubkeyFromBytes(b []byte) (Curve25519Pubkey, error) {
+	return torkeys.Curve25519PubkeyFromBytes(b)
+}
+
+// ParseCurve25519Pubkey parses Curve25519 public key encoded
+// in base64 with or without padding.
+func ParseCurve25519Pubkey(s string) (Curve25519Pubkey, error) {
+	return torkeys.ParseCurve25519Pubkey(s)
+}
+
+// ParseCurve25519PubkeyBase32 parses Curve25519 public key encoded
+// in base32.
+func ParseCurve25519PubkeyBase32(s string) (Curve25519Pubkey, error) {
+	return torkeys.ParseCurve25519PubkeyBase32(s)
+}
@@ -0,0 +1,64 @@
+package onionutil
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/ed25519"
+)
+
+func TestEd25519PubkeyEncodings(t *testing.T) {
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pk, err := Ed25519PubkeyFromBytes(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(pk.PublicKey(), pub) {
+		t.Fatal("PublicKey differs from the original key")
+	}
+	if pk2, err := ParseEd25519Pubkey(pk.String()); err != nil || pk2 != pk {
+		t.Fatalf("base64 round trip failed: %v", err)
+	}
+	if pk2, err := ParseEd25519PubkeyBase32(pk.Base32()); err != nil || pk2 != pk {
+		t.Fatalf("base32 round trip failed: %v", err)
+	}
+	if _, err := Ed25519PubkeyFromBytes(pub[:31]); err == nil {
+		t.Fatal("Short key has been accepted")
+	}
+}
+
+func TestEd25519PubkeyCurve25519(t *testing.T) {
+	kp, err := GenerateNTorKeypair(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	esk, signBit := kp.Ed25519Key()
+	epk, err := Ed25519PubkeyFromBytes(esk.Public().(ed25519.PublicKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cpk, err := epk.Curve25519()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want [32]byte
+	curve25519.ScalarBaseMult(&want, &kp.Private)
+	if cpk != Curve25519Pubkey(want) {
+		t.Fatal("Curve25519 key differs from the ntor key")
+	}
+	epk2, err := cpk.Ed25519(signBit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if epk2 != epk {
+		t.Fatal("Round trip to Ed25519 failed")
+	}
+	if cpk2, err := ParseCurve25519PubkeyBase32(cpk.Base32()); err != nil || cpk2 != cpk {
+		t.Fatalf("base32 round trip failed: %v", err)
+	}
+}
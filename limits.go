@@ -0,0 +1,70 @@
+// limits.go - limits of onion service descriptors
+//
+// To the extent possible under law, Ivan Markin waived all copyright
+// and related or neighboring rights to this module of onionutil, using the creative
+// commons "cc0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package onionutil
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Maximum numbers of introduction points in a descriptor.
+const (
+	MaxIntroPointsV2 = 10
+	MaxIntroPointsV3 = 20
+)
+
+// MaxDescriptorSizeV3 is the default maximum size of v3 descriptors
+// which HSDirs accept (HSV3MaxDescriptorSize consensus parameter).
+const MaxDescriptorSizeV3 = 50000
+
+// Errors of descriptors which exceed limits. Check them with errors.Is.
+var (
+	ErrTooManyIntroPoints = errors.New("Too many introduction points")
+	ErrDescriptorTooLarge = errors.New("Descriptor is too large")
+)
+
+func checkIntroPointsCount(n, max int) error {
+	if n > max {
+		return fmt.Errorf("%w: %d (at most %d)", ErrTooManyIntroPoints, n, max)
+	}
+	return nil
+}
+
+func checkDescriptorSize(size, max int) error {
+	if size > max {
+		return fmt.Errorf("%w: %d bytes (at most %d)", ErrDescriptorTooLarge, size, max)
+	}
+	return nil
+}
+
+// CheckLimits checks that desc fits into MaxDescriptorSizeV2 and has
+// at most MaxIntroPointsV2 introduction points. Encrypted introduction
+// points are not counted.
+func (desc *OnionDescriptor) CheckLimits() error {
+	if ips, err := desc.IntroPoints(); err == nil {
+		if err := checkIntroPointsCount(len(ips), MaxIntroPointsV2); err != nil {
+			return err
+		}
+	}
+	body, err := desc.Encode()
+	if err != nil {
+		return err
+	}
+	return checkDescriptorSize(len(body), MaxDescriptorSizeV2)
+}
+
+// CheckLimits checks that the layer has at most MaxIntroPointsV3
+// introduction points.
+func (layer *EncryptedLayerV3) CheckLimits() error {
+	return checkIntroPointsCount(len(layer.IntroPoints), MaxIntroPointsV3)
+}
+
+// CheckLimits checks that desc fits into MaxDescriptorSizeV3.
+func (desc *OnionDescriptorV3) CheckLimits() error {
+	return checkDescriptorSize(len(desc.Bytes()), MaxDescriptorSizeV3)
+}
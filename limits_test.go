@@ -0,0 +1,53 @@
+package onionutil
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestIntroPointsLimit(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ips := make([]IntroductionPoint, MaxIntroPointsV2+1)
+	for i := range ips {
+		ips[i] = IntroductionPoint{
+			Identity:        make([]byte, 10),
+			InternetAddress: net.IPv4(192, 0, 2, byte(i)),
+			OnionPort:       9001,
+			OnionKey:        &key.PublicKey,
+			ServiceKey:      &key.PublicKey,
+		}
+	}
+	if _, err := GenerateDescriptorSet(key, ips, time.Now()); !errors.Is(err, ErrTooManyIntroPoints) {
+		t.Fatalf("wrong error: %v", err)
+	}
+	descs, err := GenerateDescriptorSet(key, ips[:MaxIntroPointsV2], time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := descs[0].CheckLimits(); err != nil {
+		t.Fatal(err)
+	}
+
+	layer := &EncryptedLayerV3{IntroPoints: make([][]byte, MaxIntroPointsV3+1)}
+	if err := layer.CheckLimits(); !errors.Is(err, ErrTooManyIntroPoints) {
+		t.Fatalf("wrong error: %v", err)
+	}
+}
+
+func TestDescriptorSizeLimit(t *testing.T) {
+	desc := &OnionDescriptorV3{Superencrypted: make([]byte, MaxDescriptorSizeV3)}
+	if err := desc.CheckLimits(); !errors.Is(err, ErrDescriptorTooLarge) {
+		t.Fatalf("wrong error: %v", err)
+	}
+	desc.Superencrypted = make([]byte, 1000)
+	if err := desc.CheckLimits(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,118 @@
+// linkspec.go - link specifiers
+//
+// To the extent possible under law, Ivan Markin waived all copyright
+// and related or neighboring rights to this module of onionutil, using the creative
+// commons "cc0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package onionutil
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+)
+
+// Link specifier types (tor-spec 5.1.2).
+const (
+	LinkSpecIPv4      = 0x00
+	LinkSpecIPv6      = 0x01
+	LinkSpecLegacyID  = 0x02
+	LinkSpecEd25519ID = 0x03
+)
+
+var linkSpecLengths = map[byte]int{
+	LinkSpecIPv4:      net.IPv4len + 2,
+	LinkSpecIPv6:      net.IPv6len + 2,
+	LinkSpecLegacyID:  NTorIdentitySize,
+	LinkSpecEd25519ID: Ed25519PubkeySize,
+}
+
+// LinkSpecifier describes how to connect to a relay or
+// how to identify it. Unknown types are kept as is.
+type LinkSpecifier struct {
+	Type byte
+	Data []byte
+}
+
+// NewLinkSpecifierTCP returns TLS-over-TCP link specifier of addr.
+func NewLinkSpecifierTCP(addr *net.TCPAddr) LinkSpecifier {
+	ls := LinkSpecifier{Type: LinkSpecIPv6, Data: addr.IP.To16()}
+	if ip4 := addr.IP.To4(); ip4 != nil {
+		ls = LinkSpecifier{Type: LinkSpecIPv4, Data: ip4}
+	}
+	port := make([]byte, 2)
+	binary.BigEndian.PutUint16(port, uint16(addr.Port))
+	ls.Data = append(append([]byte{}, ls.Data...), port...)
+	return ls
+}
+
+// NewLinkSpecifierLegacyID returns link specifier of RSA identity
+// digest fingerprint.
+func NewLinkSpecifierLegacyID(fingerprint []byte) LinkSpecifier {
+	return LinkSpecifier{Type: LinkSpecLegacyID, Data: append([]byte{}, fingerprint...)}
+}
+
+// NewLinkSpecifierEd25519ID returns link specifier of Ed25519 identity id.
+func NewLinkSpecifierEd25519ID(id Ed25519Pubkey) LinkSpecifier {
+	return LinkSpecifier{Type: LinkSpecEd25519ID, Data: append([]byte{}, id[:]...)}
+}
+
+// TCPAddr returns address of TLS-over-TCP link specifier.
+func (ls LinkSpecifier) TCPAddr() (*net.TCPAddr, error) {
+	if (ls.Type != LinkSpecIPv4 && ls.Type != LinkSpecIPv6) ||
+		len(ls.Data) != linkSpecLengths[ls.Type] {
+		return nil, errors.New("Not a TLS-over-TCP link specifier")
+	}
+	n := len(ls.Data) - 2
+	return &net.TCPAddr{
+		IP:   net.IP(append([]byte{}, ls.Data[:n]...)),
+		Port: int(binary.BigEndian.Uint16(ls.Data[n:])),
+	}, nil
+}
+
+// Bytes returns LSTYPE | LSLEN | LSPEC.
+func (ls LinkSpecifier) Bytes() []byte {
+	return append([]byte{ls.Type, byte(len(ls.Data))}, ls.Data...)
+}
+
+// EncodeLinkSpecifiers encodes lss prefixed with their number.
+func EncodeLinkSpecifiers(lss []LinkSpecifier) ([]byte, error) {
+	if len(lss) > 255 {
+		return nil, errors.New("Too many link specifiers")
+	}
+	b := []byte{byte(len(lss))}
+	for _, ls := range lss {
+		if len(ls.Data) > 255 {
+			return nil, errors.New("Link specifier is too long")
+		}
+		b = append(b, ls.Bytes()...)
+	}
+	return b, nil
+}
+
+// DecodeLinkSpecifiers decodes link specifiers prefixed with
+// their number and returns the rest of data.
+func DecodeLinkSpecifiers(data []byte) (lss []LinkSpecifier, rest []byte, err error) {
+	if len(data) < 1 {
+		return nil, nil, errors.New("Truncated link specifiers")
+	}
+	n := int(data[0])
+	data = data[1:]
+	for i := 0; i < n; i++ {
+		if len(data) < 2 || len(data) < 2+int(data[1]) {
+			return nil, nil, errors.New("Truncated link specifier")
+		}
+		ls := LinkSpecifier{
+			Type: data[0],
+			Data: append([]byte{}, data[2:2+int(data[1])]...),
+		}
+		if length, ok := linkSpecLengths[ls.Type]; ok && len(ls.Data) != length {
+			return nil, nil, fmt.Errorf("Wrong length of link specifier of type %d", ls.Type)
+		}
+		lss = append(lss, ls)
+		data = data[2+len(ls.Data):]
+	}
+	return lss, data, nil
+}
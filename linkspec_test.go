@@ -0,0 +1,52 @@
+package onionutil
+
+import (
+	"bytes"
+	"net"
+	"testing"
+)
+
+func TestLinkSpecifiers(t *testing.T) {
+	var edID Ed25519Pubkey
+	edID[0] = 0xed
+	lss := []LinkSpecifier{
+		NewLinkSpecifierTCP(&net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 9001}),
+		NewLinkSpecifierTCP(&net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 443}),
+		NewLinkSpecifierLegacyID(bytes.Repeat([]byte{0xaa}, NTorIdentitySize)),
+		NewLinkSpecifierEd25519ID(edID),
+		{Type: 0x7f, Data: []byte("unknown")},
+	}
+	b, err := EncodeLinkSpecifiers(lss)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(b, []byte{5, LinkSpecIPv4, 6, 192, 0, 2, 1, 0x23, 0x29}) {
+		t.Fatalf("unexpected encoding: %x", b)
+	}
+	decoded, rest, err := DecodeLinkSpecifiers(append(b, 0xff))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded) != len(lss) || !bytes.Equal(rest, []byte{0xff}) {
+		t.Fatalf("decoded %d specifiers, rest %x", len(decoded), rest)
+	}
+	for i := range lss {
+		if decoded[i].Type != lss[i].Type || !bytes.Equal(decoded[i].Data, lss[i].Data) {
+			t.Fatalf("specifier %d mismatch", i)
+		}
+	}
+	addr, err := decoded[1].TCPAddr()
+	if err != nil || addr.String() != "[2001:db8::1]:443" {
+		t.Fatalf("wrong address %v: %v", addr, err)
+	}
+	if _, err := decoded[2].TCPAddr(); err == nil {
+		t.Fatal("legacy ID treated as address")
+	}
+
+	if _, _, err := DecodeLinkSpecifiers([]byte{1, LinkSpecIPv4, 4, 1, 2, 3, 4}); err == nil {
+		t.Fatal("wrong length accepted")
+	}
+	if _, _, err := DecodeLinkSpecifiers(b[:len(b)-1]); err == nil {
+		t.Fatal("truncated specifiers accepted")
+	}
+}
@@ -0,0 +1,50 @@
+// lint.go - check documents strictly before publication
+//
+// To the extent possible under law, Ivan Markin waived all copyright
+// and related or neighboring rights to this module of onionutil, using the creative
+// commons "cc0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package onionutil
+
+import (
+	"github.com/nogoegst/onionutil/torparse"
+)
+
+// OnionDescriptorGrammar is the grammar of v2 onion service
+// descriptors (rend-spec 1.3).
+var OnionDescriptorGrammar = torparse.Grammar{
+	"rendezvous-service-descriptor": {MinArgs: 1, MaxArgs: 1, Occurrence: torparse.OccurOnce, AtStart: true},
+	"version":                       {MinArgs: 1, MaxArgs: 1, Occurrence: torparse.OccurOnce},
+	"permanent-key":                 {MaxArgs: 0, Occurrence: torparse.OccurOnce, Object: torparse.ObjectRequired, ObjectType: torparse.ObjectRSAPublicKey},
+	"secret-id-part":                {MinArgs: 1, MaxArgs: 1, Occurrence: torparse.OccurOnce},
+	"publication-time":              {MinArgs: 2, MaxArgs: 2, Occurrence: torparse.OccurOnce},
+	"protocol-versions":             {MinArgs: 1, MaxArgs: 1, Occurrence: torparse.OccurOnce},
+	"introduction-points":           {MaxArgs: 0, Occurrence: torparse.OccurAtMostOnce, Object: torparse.ObjectRequired, ObjectType: torparse.ObjectMessage},
+	"signature":                     {MaxArgs: 0, Occurrence: torparse.OccurOnce, Object: torparse.ObjectRequired, ObjectType: torparse.ObjectSignature, AtEnd: true},
+}
+
+// OnionDescriptorV3Grammar is the grammar of the plaintext part of
+// v3 onion service descriptors (rend-spec-v3 2.4).
+var OnionDescriptorV3Grammar = torparse.Grammar{
+	"hs-descriptor":               {MinArgs: 1, MaxArgs: 1, Occurrence: torparse.OccurOnce, AtStart: true},
+	"descriptor-lifetime":         {MinArgs: 1, MaxArgs: 1, Occurrence: torparse.OccurOnce},
+	"descriptor-signing-key-cert": {MaxArgs: 0, Occurrence: torparse.OccurOnce, Object: torparse.ObjectRequired, ObjectType: torparse.ObjectEd25519Cert},
+	"revision-counter":            {MinArgs: 1, MaxArgs: 1, Occurrence: torparse.OccurOnce},
+	"superencrypted":              {MaxArgs: 0, Occurrence: torparse.OccurOnce, Object: torparse.ObjectRequired, ObjectType: torparse.ObjectMessage},
+	"signature":                   {MinArgs: 1, MaxArgs: 1, Occurrence: torparse.OccurOnce, AtEnd: true},
+}
+
+// LintOnionDescriptor checks that data is a well-formed v2 onion
+// service descriptor. Returned error is torparse.SyntaxErrors.
+func LintOnionDescriptor(data []byte) error {
+	_, err := torparse.ParseTorDocumentStrict(data, OnionDescriptorGrammar)
+	return err
+}
+
+// LintOnionDescriptorV3 checks that data is a well-formed v3 onion
+// service descriptor. Returned error is torparse.SyntaxErrors.
+func LintOnionDescriptorV3(data []byte) error {
+	_, err := torparse.ParseTorDocumentStrict(data, OnionDescriptorV3Grammar)
+	return err
+}
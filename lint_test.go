@@ -0,0 +1,31 @@
+package onionutil
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/nogoegst/onionutil/testvectors"
+	"github.com/nogoegst/onionutil/torparse"
+)
+
+func TestLintOnionDescriptor(t *testing.T) {
+	data := []byte(testvectors.ServiceDescriptorV2.Data)
+	/* The file has an extra empty line at the end */
+	data = append(bytes.TrimRight(data, "\n"), '\n')
+	if err := LintOnionDescriptor(data); err != nil {
+		t.Fatal(err)
+	}
+	bad := bytes.Replace(data, []byte("version 2\n"), []byte("version  2\nversion 2\n"), 1)
+	errs, ok := LintOnionDescriptor(bad).(torparse.SyntaxErrors)
+	if !ok || len(errs) == 0 {
+		t.Fatal("malformed descriptor passed")
+	}
+	if errs[0].Line != 2 || errs[0].Keyword != "version" {
+		t.Fatalf("wrong error: %v", errs[0])
+	}
+	bad = bytes.Replace(data, []byte("-----END SIGNATURE-----"), []byte("-----END MESSAGE-----"), 1)
+	errs, ok = LintOnionDescriptor(bad).(torparse.SyntaxErrors)
+	if !ok || len(errs) == 0 || errs[0].Line != 99 {
+		t.Fatalf("wrong errors: %v", errs)
+	}
+}
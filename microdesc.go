@@ -0,0 +1,150 @@
+// microdesc.go - deal with microdescriptors
+//
+// To the extent possible under law, Ivan Markin waived all copyright
+// and related or neighboring rights to this module of onionutil, using the creative
+// commons "cc0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package onionutil
+
+import (
+	"bytes"
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"github.com/nogoegst/onionutil/pkcs1"
+	"github.com/nogoegst/onionutil/torparse"
+)
+
+// Microdescriptor is a relay microdescriptor (dir-spec 3.3).
+type Microdescriptor struct {
+	OnionKey     *rsa.PublicKey
+	NTorOnionKey NTorOnionKey
+	Family       []string
+	// PolicySummary and Policy6Summary are summaries of exit
+	// policies from "p" and "p6" lines.
+	PolicySummary  *PolicySummary
+	Policy6Summary *PolicySummary
+	Ed25519ID      Ed25519Pubkey
+
+	// Raw is the encoded microdescriptor.
+	Raw []byte
+}
+
+// Digest returns base64-encoded SHA-256 digest of md which is used
+// to refer to it from microdescriptor consensuses.
+func (md *Microdescriptor) Digest() string {
+	return base64.RawStdEncoding.EncodeToString(DigestSHA256.Sum(md.Raw))
+}
+
+// splitMicrodescriptors splits data into microdescriptors each
+// starting with "onion-key" line.
+func splitMicrodescriptors(data []byte) (mds [][]byte) {
+	sep := []byte("\nonion-key\n")
+	start := 0
+	if !bytes.HasPrefix(data, sep[1:]) {
+		start = bytes.Index(data, sep)
+		if start < 0 {
+			return nil
+		}
+		start++
+	}
+	data = data[start:]
+	for len(data) > 0 {
+		next := bytes.Index(data, sep)
+		if next < 0 {
+			mds = append(mds, data)
+			break
+		}
+		mds = append(mds, data[:next+1])
+		data = data[next+1:]
+	}
+	return mds
+}
+
+func parseMicrodescriptor(raw []byte) (*Microdescriptor, error) {
+	doc, err := singleTorDocument(raw)
+	if err != nil {
+		return nil, err
+	}
+	md := &Microdescriptor{Raw: raw}
+	if !torparse.ExactlyOnce(doc.Entries["onion-key"]) {
+		return nil, errors.New("onion-key must appear exactly once")
+	}
+	/* onion-key is optional since tor 0.4.8 and may be empty */
+	if onionKey := doc.Entries["onion-key"][0]; len(onionKey) > 0 {
+		md.OnionKey, _, err = pkcs1.DecodePublicKeyDER(onionKey[len(onionKey)-1])
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !torparse.ExactlyOnce(doc.Entries["ntor-onion-key"]) {
+		return nil, errors.New("ntor-onion-key must appear exactly once")
+	}
+	if md.NTorOnionKey, err = ParseNTorOnionKey(doc.Entries["ntor-onion-key"].FJoined()); err != nil {
+		return nil, err
+	}
+	if value, ok := doc.Entries["family"]; ok {
+		if !torparse.AtMostOnce(value) {
+			return nil, errors.New("family must appear at most once")
+		}
+		for _, member := range value[0] {
+			md.Family = append(md.Family, string(member))
+		}
+	}
+	if value, ok := doc.Entries["p"]; ok {
+		if !torparse.AtMostOnce(value) {
+			return nil, errors.New("p must appear at most once")
+		}
+		if md.PolicySummary, err = ParsePolicySummary(string(value.FJoined())); err != nil {
+			return nil, err
+		}
+	}
+	if value, ok := doc.Entries["p6"]; ok {
+		if !torparse.AtMostOnce(value) {
+			return nil, errors.New("p6 must appear at most once")
+		}
+		if md.Policy6Summary, err = ParsePolicySummary(string(value.FJoined())); err != nil {
+			return nil, err
+		}
+	}
+	for _, id := range doc.Entries["id"] {
+		if len(id) != 2 || string(id[0]) != "ed25519" {
+			continue
+		}
+		if err := decodeBase64Fixed(md.Ed25519ID[:], id[1]); err != nil {
+			return nil, err
+		}
+	}
+	return md, nil
+}
+
+// ParseMicrodescriptors parses microdescriptors from data as
+// served by directories or stored in cached-microdescs.
+// Annotations are ignored.
+func ParseMicrodescriptors(data []byte) (mds []*Microdescriptor, err error) {
+	return ParseMicrodescriptorsContext(context.Background(), data)
+}
+
+// ParseMicrodescriptorsContext is like ParseMicrodescriptors but
+// stops parsing once ctx is done and returns ctx.Err().
+func ParseMicrodescriptorsContext(ctx context.Context, data []byte) (mds []*Microdescriptor, err error) {
+	for i, raw := range splitMicrodescriptors(data) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		/* Skip annotations of the next microdescriptor */
+		if end := bytes.Index(raw, []byte("\n@")); end >= 0 {
+			raw = raw[:end+1]
+		}
+		md, err := parseMicrodescriptor(raw)
+		if err != nil {
+			return nil, fmt.Errorf("Microdescriptor %d: %w", i, err)
+		}
+		mds = append(mds, md)
+	}
+	return mds, nil
+}
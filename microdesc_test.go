@@ -0,0 +1,57 @@
+package onionutil
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"testing"
+)
+
+func TestParseMicrodescriptors(t *testing.T) {
+	sk, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	md1 := "onion-key\n" + string(pemRSAPublicKey(t, &sk.PublicKey)) +
+		"ntor-onion-key 4pvbFChEqTnMZbRIAvWlnZtZmyLK+ozQ37Xxvn0bFEQ=\n" +
+		"family $0011BD2485AD45D984EC4159C88FC066E5E3300E\n" +
+		"p accept 80,443\n" +
+		"id ed25519 pBo7jbSgSWVCY9nGDYxNvAcvQHEqDLOpH7JI4jtmCiQ\n"
+	md2 := "onion-key\n" +
+		"ntor-onion-key 4pvbFChEqTnMZbRIAvWlnZtZmyLK+ozQ37Xxvn0bFEQ\n" +
+		"p6 reject 1-65535\n"
+	data := "@last-listed 2019-01-02 03:00:00\n" + md1 +
+		"@last-listed 2019-01-02 03:00:00\n" + md2
+
+	mds, err := ParseMicrodescriptors([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mds) != 2 {
+		t.Fatalf("wrong number of microdescriptors: %d", len(mds))
+	}
+	if mds[0].OnionKey == nil || mds[0].OnionKey.N.Cmp(sk.N) != 0 {
+		t.Fatal("onion-key is not parsed")
+	}
+	if len(mds[0].Family) != 1 || !mds[0].PolicySummary.Accept ||
+		mds[0].Ed25519ID[0] != 0xa4 {
+		t.Fatalf("wrong microdescriptor: %+v", mds[0])
+	}
+	if mds[1].OnionKey != nil || mds[1].Policy6Summary == nil || mds[1].Policy6Summary.Accept {
+		t.Fatalf("wrong microdescriptor: %+v", mds[1])
+	}
+	h := sha256.Sum256([]byte(md1))
+	if mds[0].Digest() != base64.RawStdEncoding.EncodeToString(h[:]) {
+		t.Fatal("wrong digest")
+	}
+}
+
+func TestParseMicrodescriptorsContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := ParseMicrodescriptorsContext(ctx, []byte("onion-key\n")); err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
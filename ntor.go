@@ -0,0 +1,228 @@
+// ntor.go - ntor onion keys and handshake
+//
+// To the extent possible under law, Ivan Markin waived all copyright
+// and related or neighboring rights to this module of onionutil, using the creative
+// commons "cc0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package onionutil
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/curve25519"
+)
+
+// ntor handshake constants (tor-spec 5.1.4).
+var (
+	NTorProtoID   = []byte("ntor-curve25519-sha256-1")
+	ntorTMac      = []byte("ntor-curve25519-sha256-1:mac")
+	ntorTKey      = []byte("ntor-curve25519-sha256-1:key_extract")
+	ntorTVerify   = []byte("ntor-curve25519-sha256-1:verify")
+	ntorMExpand   = []byte("ntor-curve25519-sha256-1:key_expand")
+	ntorServerStr = []byte("Server")
+)
+
+const (
+	NTorIdentitySize  = 20
+	NTorOnionskinSize = NTorIdentitySize + 2*NTorOnionKeySize
+	NTorReplySize     = NTorOnionKeySize + sha256.Size
+)
+
+var ErrNTorHandshakeFailed = errors.New("ntor handshake failed")
+
+// NTorOnionKey is a curve25519 onion key of a relay used in ntor
+// handshake ("ntor-onion-key" line of router descriptors).
+type NTorOnionKey Curve25519Pubkey
+
+// ParseNTorOnionKey parses base64-encoded ntor onion key
+// with or without padding.
+func ParseNTorOnionKey(data []byte) (key NTorOnionKey, err error) {
+	err = decodeBase64Fixed(key[:], data)
+	return key, err
+}
+
+// Validate checks that key is a valid curve25519 public key.
+func (key NTorOnionKey) Validate() error {
+	return Curve25519Pubkey(key).Validate()
+}
+
+func (key NTorOnionKey) String() string {
+	return base64.StdEncoding.EncodeToString(key[:])
+}
+
+// NTorKeypair is a curve25519 keypair used in ntor handshake.
+type NTorKeypair struct {
+	Private [32]byte
+	Public  NTorOnionKey
+}
+
+func GenerateNTorKeypair(rand io.Reader) (*NTorKeypair, error) {
+	kp := new(NTorKeypair)
+	if _, err := io.ReadFull(rand, kp.Private[:]); err != nil {
+		return nil, err
+	}
+	kp.Private[0] &= 248
+	kp.Private[31] &= 127
+	kp.Private[31] |= 64
+	curve25519.ScalarBaseMult((*[32]byte)(&kp.Public), &kp.Private)
+	return kp, nil
+}
+
+// Zeroize overwrites the private key with zeros.
+func (kp *NTorKeypair) Zeroize() {
+	Zeroize(kp.Private[:])
+}
+
+func ntorHMAC(key, msg []byte) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write(msg)
+	return h.Sum(nil)
+}
+
+// ntorExp computes x25519(sk, pk). Invalid peer keys and all-zero
+// results are rejected.
+func ntorExp(sk *[32]byte, pk NTorOnionKey) ([]byte, error) {
+	if err := pk.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrNTorHandshakeFailed, err)
+	}
+	var shared [32]byte
+	curve25519.ScalarMult(&shared, sk, (*[32]byte)(&pk))
+	if shared == ([32]byte{}) {
+		return nil, ErrNTorHandshakeFailed
+	}
+	return shared[:], nil
+}
+
+// ntorKeys derives AUTH and keyLen bytes of key material
+// from secret_input.
+func ntorKeys(secretInput, id []byte, B, X, Y NTorOnionKey, keyLen int) (auth, keys []byte) {
+	verify := ntorHMAC(ntorTVerify, secretInput)
+	authInput := new(bytes.Buffer)
+	authInput.Write(verify)
+	authInput.Write(id)
+	authInput.Write(B[:])
+	authInput.Write(Y[:])
+	authInput.Write(X[:])
+	authInput.Write(NTorProtoID)
+	authInput.Write(ntorServerStr)
+	auth = ntorHMAC(ntorTMac, authInput.Bytes())
+
+	/* HKDF-SHA256 with salt t_key and info m_expand (tor-spec 5.2.2) */
+	keySeed := ntorHMAC(ntorTKey, secretInput)
+	var prev []byte
+	for i := byte(1); len(keys) < keyLen; i++ {
+		h := hmac.New(sha256.New, keySeed)
+		h.Write(prev)
+		h.Write(ntorMExpand)
+		h.Write([]byte{i})
+		prev = h.Sum(nil)
+		keys = append(keys, prev...)
+	}
+	Zeroize(keySeed)
+	return auth, keys[:keyLen]
+}
+
+func ntorSecretInput(exp1, exp2, id []byte, B, X, Y NTorOnionKey) []byte {
+	w := new(bytes.Buffer)
+	w.Write(exp1)
+	w.Write(exp2)
+	w.Write(id)
+	w.Write(B[:])
+	w.Write(X[:])
+	w.Write(Y[:])
+	w.Write(NTorProtoID)
+	return w.Bytes()
+}
+
+// NTorClientHandshake is the client side state of ntor handshake
+// with a relay with identity digest ID and ntor onion key B.
+type NTorClientHandshake struct {
+	ID        []byte
+	B         NTorOnionKey
+	ephemeral *NTorKeypair
+}
+
+func NewNTorClientHandshake(rand io.Reader, id []byte, B NTorOnionKey) (*NTorClientHandshake, error) {
+	if len(id) != NTorIdentitySize {
+		return nil, errors.New("Wrong relay identity length")
+	}
+	ephemeral, err := GenerateNTorKeypair(rand)
+	if err != nil {
+		return nil, err
+	}
+	return &NTorClientHandshake{ID: id, B: B, ephemeral: ephemeral}, nil
+}
+
+// Onionskin returns the client handshake message ID | B | X.
+func (h *NTorClientHandshake) Onionskin() []byte {
+	onionskin := append([]byte{}, h.ID...)
+	onionskin = append(onionskin, h.B[:]...)
+	return append(onionskin, h.ephemeral.Public[:]...)
+}
+
+// Finish processes server reply Y | AUTH and returns keyLen bytes
+// of key material. The ephemeral key is wiped afterwards.
+func (h *NTorClientHandshake) Finish(reply []byte, keyLen int) ([]byte, error) {
+	defer h.ephemeral.Zeroize()
+	if len(reply) != NTorReplySize {
+		return nil, errors.New("Wrong ntor reply length")
+	}
+	var Y NTorOnionKey
+	copy(Y[:], reply)
+	expY, err := ntorExp(&h.ephemeral.Private, Y)
+	if err != nil {
+		return nil, err
+	}
+	expB, err := ntorExp(&h.ephemeral.Private, h.B)
+	if err != nil {
+		return nil, err
+	}
+	secretInput := ntorSecretInput(expY, expB, h.ID, h.B, h.ephemeral.Public, Y)
+	defer Zeroize(secretInput)
+	auth, keys := ntorKeys(secretInput, h.ID, h.B, h.ephemeral.Public, Y, keyLen)
+	if !hmac.Equal(auth, reply[NTorOnionKeySize:]) {
+		Zeroize(keys)
+		return nil, ErrNTorHandshakeFailed
+	}
+	return keys, nil
+}
+
+// NTorServerHandshake processes onionskin of a client with relay
+// identity digest id and ntor keypair b. It returns reply to the
+// client and keyLen bytes of key material.
+func NTorServerHandshake(rand io.Reader, id []byte, b *NTorKeypair, onionskin []byte, keyLen int) (reply, keys []byte, err error) {
+	if len(onionskin) != NTorOnionskinSize {
+		return nil, nil, errors.New("Wrong ntor onionskin length")
+	}
+	if !bytes.Equal(onionskin[:NTorIdentitySize], id) ||
+		!bytes.Equal(onionskin[NTorIdentitySize:NTorIdentitySize+NTorOnionKeySize], b.Public[:]) {
+		return nil, nil, errors.New("Onionskin is not for this relay")
+	}
+	var X NTorOnionKey
+	copy(X[:], onionskin[NTorIdentitySize+NTorOnionKeySize:])
+	ephemeral, err := GenerateNTorKeypair(rand)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer ephemeral.Zeroize()
+	expY, err := ntorExp(&ephemeral.Private, X)
+	if err != nil {
+		return nil, nil, err
+	}
+	expB, err := ntorExp(&b.Private, X)
+	if err != nil {
+		return nil, nil, err
+	}
+	secretInput := ntorSecretInput(expY, expB, id, b.Public, X, ephemeral.Public)
+	defer Zeroize(secretInput)
+	auth, keys := ntorKeys(secretInput, id, b.Public, X, ephemeral.Public, keyLen)
+	reply = append(append([]byte{}, ephemeral.Public[:]...), auth...)
+	return reply, keys, nil
+}
@@ -0,0 +1,53 @@
+package onionutil
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+)
+
+func TestNTorHandshake(t *testing.T) {
+	relay, err := GenerateNTorKeypair(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := make([]byte, NTorIdentitySize)
+	rand.Read(id)
+
+	parsed, err := ParseNTorOnionKey([]byte(relay.Public.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed != relay.Public || parsed.Validate() != nil {
+		t.Fatal("ntor onion key round-trip failed")
+	}
+
+	client, err := NewNTorClientHandshake(rand.Reader, id, relay.Public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reply, serverKeys, err := NTorServerHandshake(rand.Reader, id, relay, client.Onionskin(), 72)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientKeys, err := client.Finish(reply, 72)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(clientKeys) != 72 || !bytes.Equal(clientKeys, serverKeys) {
+		t.Fatal("keys differ")
+	}
+
+	client, err = NewNTorClientHandshake(rand.Reader, id, relay.Public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reply, _, err = NTorServerHandshake(rand.Reader, id, relay, client.Onionskin(), 72)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reply[len(reply)-1] ^= 1
+	if _, err := client.Finish(reply, 72); err != ErrNTorHandshakeFailed {
+		t.Fatal("forged reply is accepted")
+	}
+}
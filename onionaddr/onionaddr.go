@@ -0,0 +1,190 @@
+// onionaddr.go - encoding and decoding of onion addresses
+//
+// To the extent possible under law, Ivan Markin waived all copyright
+// and related or neighboring rights to this module of onionutil, using the creative
+// commons "cc0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+// Package onionaddr encodes, decodes and validates v2 and v3
+// onion addresses. Addresses are handled without ".onion" suffix
+// unless noted otherwise.
+package onionaddr
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/nogoegst/onionutil/internal/encoding"
+	"github.com/nogoegst/onionutil/internal/torerr"
+	"github.com/nogoegst/onionutil/pkcs1"
+	"golang.org/x/crypto/ed25519"
+	"golang.org/x/crypto/sha3"
+)
+
+// ErrInvalidAddress is wrapped by errors about malformed addresses.
+var ErrInvalidAddress = torerr.ErrInvalidAddress
+
+// v2 onion addresses
+const (
+	// LengthV2 is the length of decoded v2 addresses (permanent IDs).
+	LengthV2 = 10
+)
+
+// v3 onion addresses (rend-spec-v3 6)
+const (
+	ChecksumLengthV3 = 2
+	VersionV3        = 0x03
+	// LengthV3 is the length of decoded v3 addresses:
+	// pubkey | checksum | version.
+	LengthV3 = ed25519.PublicKeySize + ChecksumLengthV3 + 1
+	// ChecksumPrefix is prepended to key material of checksums.
+	ChecksumPrefix = ".onion checksum"
+)
+
+// PermanentID calculates permanent ID of v2 onion service
+// from its RSA public key pk.
+func PermanentID(pk *rsa.PublicKey) ([]byte, error) {
+	der, err := pkcs1.EncodePublicKeyDER(pk)
+	if err != nil {
+		return nil, err
+	}
+	h := sha1.Sum(der)
+	return h[:LengthV2], nil
+}
+
+// FromPermanentID returns v2 onion address corresponding
+// to permanent ID permID.
+func FromPermanentID(permID []byte) (string, error) {
+	if len(permID) != LengthV2 {
+		return "", fmt.Errorf("%w: permanent ID must be %d bytes long", ErrInvalidAddress, LengthV2)
+	}
+	return encoding.Base32Encode(permID), nil
+}
+
+// V2 returns v2 onion address of service with RSA public key pk.
+func V2(pk *rsa.PublicKey) (string, error) {
+	permID, err := PermanentID(pk)
+	if err != nil {
+		return "", err
+	}
+	return FromPermanentID(permID)
+}
+
+// IsValidV2 reports whether addr is a valid v2 onion address.
+func IsValidV2(addr string) bool {
+	oa, err := encoding.Base32Decode(addr)
+	return err == nil && len(oa) == LengthV2
+}
+
+// Checksum returns checksum of onion address with key material
+// pk and version byte version:
+// SHA3-256(".onion checksum" | pk | version)[:2].
+func Checksum(pk []byte, version byte) []byte {
+	h := sha3.New256()
+	h.Write([]byte(ChecksumPrefix))
+	h.Write(pk)
+	h.Write([]byte{version})
+	return h.Sum(nil)[:ChecksumLengthV3]
+}
+
+// VerifyChecksum checks that checksum is the checksum
+// of onion address with key material pk and version byte version.
+func VerifyChecksum(pk []byte, version byte, checksum []byte) bool {
+	return bytes.Equal(checksum, Checksum(pk, version))
+}
+
+// V3 returns v3 onion address of service with identity key pk.
+func V3(pk ed25519.PublicKey) (string, error) {
+	if len(pk) != ed25519.PublicKeySize {
+		return "", errors.New("Wrong public key length")
+	}
+	oa := make([]byte, 0, LengthV3)
+	oa = append(oa, pk...)
+	oa = append(oa, Checksum(pk, VersionV3)...)
+	oa = append(oa, VersionV3)
+	return encoding.Base32Encode(oa), nil
+}
+
+// PublicKeyV3 extracts identity key from v3 onion address addr.
+func PublicKeyV3(addr string) (ed25519.PublicKey, error) {
+	oa, err := encoding.Base32Decode(addr)
+	if err != nil {
+		return nil, torerr.Address("malformed base32")
+	}
+	if len(oa) != LengthV3 {
+		return nil, torerr.Address("wrong length")
+	}
+	pk := oa[:ed25519.PublicKeySize]
+	checksum := oa[ed25519.PublicKeySize : ed25519.PublicKeySize+ChecksumLengthV3]
+	version := oa[LengthV3-1]
+	if version != VersionV3 {
+		return nil, torerr.Address("wrong version")
+	}
+	if !VerifyChecksum(pk, version, checksum) {
+		return nil, torerr.Address("wrong checksum")
+	}
+	return ed25519.PublicKey(pk), nil
+}
+
+// IsValidV3 reports whether addr is a valid v3 onion address.
+func IsValidV3(addr string) bool {
+	_, err := PublicKeyV3(addr)
+	return err == nil
+}
+
+// IsValid reports whether addr is a valid v2 or v3 onion address.
+func IsValid(addr string) bool {
+	return IsValidV2(addr) || IsValidV3(addr)
+}
+
+// Addr is a parsed onion address.
+type Addr struct {
+	Version int
+	// PermID is the permanent ID of v2 onion service.
+	PermID []byte
+	// Pubkey is the identity key of v3 onion service.
+	Pubkey ed25519.PublicKey
+}
+
+// Parse parses and validates v2 or v3 onion address addr.
+// ".onion" suffix and subdomains are optional.
+func Parse(addr string) (*Addr, error) {
+	addr = strings.ToLower(addr)
+	addr = strings.TrimSuffix(addr, ".onion")
+	if i := strings.LastIndex(addr, "."); i >= 0 {
+		addr = addr[i+1:]
+	}
+	switch len(addr) {
+	case encoding.Base32EncodedLen(LengthV2):
+		permID, err := encoding.Base32Decode(addr)
+		if err != nil {
+			return nil, torerr.Address("malformed base32")
+		}
+		return &Addr{Version: 2, PermID: permID}, nil
+	case encoding.Base32EncodedLen(LengthV3):
+		pk, err := PublicKeyV3(addr)
+		if err != nil {
+			return nil, err
+		}
+		return &Addr{Version: 3, Pubkey: pk}, nil
+	default:
+		return nil, torerr.Address("wrong length")
+	}
+}
+
+// String returns onion address without ".onion" suffix.
+func (a *Addr) String() string {
+	switch a.Version {
+	case 2:
+		return encoding.Base32Encode(a.PermID)
+	case 3:
+		addr, _ := V3(a.Pubkey)
+		return addr
+	default:
+		return ""
+	}
+}
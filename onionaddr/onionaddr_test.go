@@ -0,0 +1,35 @@
+package onionaddr
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	pk, _ := hex.DecodeString("d75a980182b10ab7d54bfed3c964073a0ee172f3daa62325af021a68f707511a")
+	const addr = "25njqamcweflpvkl73j4szahhihoc4xt3ktcgjnpaingr5yhkenl5sid"
+	a, err := Parse("www." + addr + ".onion")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Version != 3 || !bytes.Equal(a.Pubkey, pk) || a.String() != addr {
+		t.Fatalf("wrong address: %+v", a)
+	}
+	a, err = Parse("EXPYUZZ4WQQYQHJN.onion")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Version != 2 || a.String() != "expyuzz4wqqyqhjn" {
+		t.Fatalf("wrong address: %+v", a)
+	}
+	broken := []byte(addr)
+	broken[0] = 'a'
+	if _, err := Parse(string(broken)); !errors.Is(err, ErrInvalidAddress) {
+		t.Fatalf("address with wrong checksum: %v", err)
+	}
+	if IsValid("expyuzz4wqqyqhj") {
+		t.Fatal("short address is valid")
+	}
+}
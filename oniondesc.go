@@ -9,15 +9,14 @@ package onionutil
 
 import (
 	"bytes"
+	"context"
 	"crypto"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha1"
 	"encoding/binary"
-	"encoding/pem"
 	"errors"
 	"fmt"
-	"log"
 	"strconv"
 	"strings"
 	"time"
@@ -27,6 +26,8 @@ import (
 )
 
 type OnionDescriptor struct {
+	// DescID and SecretIDPart are raw bytes as computed by
+	// CalcDescriptorID and CalcSecretID, not their base32 encoding.
 	DescID           []byte
 	Version          int
 	PermanentKey     *rsa.PublicKey
@@ -36,6 +37,9 @@ type OnionDescriptor struct {
 	IntropointsBlock []byte
 	Signature        []byte
 	Replica          int
+	// DescriptorCookie is used to calculate descriptor ID
+	// with stealth client authorization.
+	DescriptorCookie *DescriptorCookie
 }
 
 var (
@@ -55,98 +59,176 @@ func (desc *OnionDescriptor) InitDefaults() {
 func (desc *OnionDescriptor) Finalize(now time.Time) error {
 	nowunix := now.Unix()
 	desc.PublicationTime = time.Unix(nowunix-nowunix%(60*60), 0)
-	permID, err := CalcPermanentID(desc.PermanentKey)
+	permID, err := PermanentID(desc.PermanentKey)
 	if err != nil {
 		return err
 	}
-	desc.SecretIDPart = CalcSecretID(permID, now, byte(desc.Replica))
+	var cookie []byte
+	if desc.DescriptorCookie != nil {
+		cookie = desc.DescriptorCookie[:]
+	}
+	desc.SecretIDPart = CalcSecretIDWithCookie(permID, now, cookie, byte(desc.Replica))
 	desc.DescID = CalcDescriptorID(permID, desc.SecretIDPart)
 	return nil
 }
 
-// TODO return a pointer to descs not descs themselves?
-func ParseOnionDescriptors(descsData []byte) (descs []OnionDescriptor, rest []byte) {
+// DescriptorResult is a result of parsing a single descriptor:
+// either Desc or Err is set.
+type DescriptorResult struct {
+	Desc *OnionDescriptor
+	Err  error
+}
+
+// ParseOnionDescriptors parses v2 descriptors from descsData. Malformed
+// descriptors are reported with an error in the corresponding result.
+func ParseOnionDescriptors(descsData []byte) (results []DescriptorResult, rest []byte) {
+	results, rest, _ = ParseOnionDescriptorsContext(context.Background(), descsData)
+	return results, rest
+}
+
+// ParseOnionDescriptorsContext is like ParseOnionDescriptors but
+// stops parsing once ctx is done and returns ctx.Err().
+func ParseOnionDescriptorsContext(ctx context.Context, descsData []byte) (results []DescriptorResult, rest []byte, err error) {
 	docs, rest := torparse.ParseTorDocument(descsData)
 	for _, doc := range docs {
-		var desc OnionDescriptor
-		if _, ok := doc["rendezvous-service-descriptor"]; !ok {
-			log.Printf("Got a document that is not an onion service")
-			continue
-		} else {
-			desc.DescID = doc["rendezvous-service-descriptor"].FJoined()
+		if err := ctx.Err(); err != nil {
+			return nil, nil, err
 		}
+		desc, err := parseOnionDescriptor(doc)
+		results = append(results, DescriptorResult{Desc: desc, Err: err})
+	}
 
-		version, err := strconv.ParseInt(string(doc["version"].FJoined()), 10, 0)
-		if err != nil {
-			log.Printf("Error parsing descriptor version: %v", err)
-			continue
-		}
-		desc.Version = int(version)
+	return results, rest, nil
+}
 
-		permanentKey, _, err := pkcs1.DecodePublicKeyDER(doc["permanent-key"].FJoined())
-		if err != nil {
-			log.Printf("Decoding DER sequence of PulicKey has failed: %v.", err)
-			continue
+func parseOnionDescriptor(doc torparse.TorDocument) (*OnionDescriptor, error) {
+	var desc OnionDescriptor
+	if _, ok := doc.Entries["rendezvous-service-descriptor"]; !ok {
+		return nil, errors.New("Got a document that is not an onion service")
+	}
+	for _, kw := range []string{"rendezvous-service-descriptor", "version",
+		"permanent-key", "secret-id-part", "publication-time",
+		"protocol-versions", "signature"} {
+		if !torparse.ExactlyOnce(doc.Entries[kw]) {
+			return nil, fmt.Errorf("%s must appear exactly once", kw)
 		}
-		desc.PermanentKey = permanentKey
-		desc.IntropointsBlock = doc["introduction-points"].FJoined()
+	}
+	if !torparse.AtMostOnce(doc.Entries["introduction-points"]) {
+		return nil, errors.New("introduction-points must appear at most once")
+	}
+	descID, err := Base32Decode(string(doc.Entries["rendezvous-service-descriptor"].FJoined()))
+	if err != nil {
+		return nil, parseError(doc, "rendezvous-service-descriptor", err)
+	}
+	desc.DescID = descID
 
-		if len(doc["signature"][0]) < 1 {
-			log.Printf("Empty signature")
-			continue
-		}
-		desc.Signature = doc["signature"].FJoined()
+	version, err := strconv.ParseInt(string(doc.Entries["version"].FJoined()), 10, 0)
+	if err != nil {
+		return nil, parseError(doc, "version", err)
+	}
+	desc.Version = int(version)
 
-		descs = append(descs, desc)
+	permanentKey, _, err := pkcs1.DecodePublicKeyDER(doc.Entries["permanent-key"].FJoined())
+	if err != nil {
+		return nil, parseError(doc, "permanent-key", err)
+	}
+	desc.PermanentKey = permanentKey
+
+	secretIDPart, err := Base32Decode(string(doc.Entries["secret-id-part"].FJoined()))
+	if err != nil {
+		return nil, parseError(doc, "secret-id-part", err)
+	}
+	desc.SecretIDPart = secretIDPart
+
+	publicationTime, err := time.Parse(PublicationTimeFormat,
+		string(doc.Entries["publication-time"].FJoined()))
+	if err != nil {
+		return nil, parseError(doc, "publication-time", err)
 	}
+	desc.PublicationTime = publicationTime
 
-	return descs, rest
+	protocolVersions, err := parseProtocolVersions(doc.Entries["protocol-versions"].FJoined())
+	if err != nil {
+		return nil, parseError(doc, "protocol-versions", err)
+	}
+	desc.ProtocolVersions = protocolVersions
+
+	if _, ok := doc.Entries["introduction-points"]; ok {
+		desc.IntropointsBlock = doc.Entries["introduction-points"].FJoined()
+	}
+
+	if len(doc.Entries["signature"][0]) < 1 {
+		return nil, errors.New("Empty signature")
+	}
+	desc.Signature = doc.Entries["signature"].FJoined()
+
+	return &desc, nil
 }
 
-func (desc *OnionDescriptor) Bytes() []byte {
-	w := new(bytes.Buffer)
+func parseProtocolVersions(data []byte) (versions []int, err error) {
+	for _, v := range strings.Split(string(data), ",") {
+		version, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, version)
+	}
+	return versions, nil
+}
+
+// Encode returns encoding of the descriptor.
+func (desc *OnionDescriptor) Encode() ([]byte, error) {
+	if desc.PermanentKey == nil {
+		return nil, errors.New("Descriptor has no permanent key")
+	}
 	permPubKeyDER, err := pkcs1.EncodePublicKeyDER(desc.PermanentKey)
 	if err != nil {
-		log.Fatalf("Cannot encode public key into DER sequence.")
-	}
-	fmt.Fprintf(w, "rendezvous-service-descriptor %s\n", Base32Encode(desc.DescID))
-	fmt.Fprintf(w, "version %d\n", desc.Version)
-	fmt.Fprintf(w, "permanent-key\n%s",
-		pem.EncodeToMemory(&pem.Block{Type: "RSA PUBLIC KEY",
-			Bytes: permPubKeyDER}))
-	fmt.Fprintf(w, "secret-id-part %s\n",
-		Base32Encode(desc.SecretIDPart))
-	fmt.Fprintf(w, "publication-time %v\n",
-		desc.PublicationTime.Format("2006-01-02 15:04:05"))
+		return nil, fmt.Errorf("Cannot encode permanent key: %w", err)
+	}
 	var protoversions []string
 	for _, v := range desc.ProtocolVersions {
-		protoversions = append(protoversions, fmt.Sprintf("%d", v))
+		protoversions = append(protoversions, strconv.Itoa(v))
 	}
-	fmt.Fprintf(w, "protocol-versions %v\n",
-		strings.Join(protoversions, ","))
+	d := torparse.NewDocument()
+	d.Item("rendezvous-service-descriptor", Base32Encode(desc.DescID))
+	d.Item("version", strconv.Itoa(desc.Version))
+	d.ItemObject("permanent-key", "RSA PUBLIC KEY", permPubKeyDER)
+	d.Item("secret-id-part", Base32Encode(desc.SecretIDPart))
+	d.Item("publication-time", strings.Fields(desc.PublicationTime.Format("2006-01-02 15:04:05"))...)
+	d.Item("protocol-versions", strings.Join(protoversions, ","))
 	if len(desc.IntropointsBlock) > 0 {
-		pemIntroBlock := &pem.Block{Type: "MESSAGE", Bytes: []byte(desc.IntropointsBlock)}
-		fmt.Fprintf(w, "introduction-points\n%s", pem.EncodeToMemory(pemIntroBlock))
+		d.ItemObject("introduction-points", "MESSAGE", desc.IntropointsBlock)
 	}
-	fmt.Fprintf(w, "signature\n")
+	d.Item("signature")
 	if len(desc.Signature) > 0 {
-		pemSignature := pem.EncodeToMemory(&pem.Block{Type: "SIGNATURE", Bytes: desc.Signature})
-		fmt.Fprintf(w, "%s", pemSignature)
+		d.Object("SIGNATURE", desc.Signature)
 	}
-	return w.Bytes()
+	return d.Bytes()
+}
+
+// Bytes returns encoding of the descriptor or nil if it
+// cannot be encoded (see Encode).
+func (desc *OnionDescriptor) Bytes() []byte {
+	b, _ := desc.Encode()
+	return b
 }
 
 func (desc *OnionDescriptor) OnionID() (string, error) {
-	permID, err := CalcPermanentID(desc.PermanentKey)
+	permID, err := PermanentID(desc.PermanentKey)
 	if err != nil {
-		return "", fmt.Errorf("Error in calculating permanent id: %v", err)
+		return "", fmt.Errorf("Error in calculating permanent id: %w", err)
 	}
 	onionID := Base32Encode(permID)
 	return onionID, nil
 }
 
 func (desc *OnionDescriptor) Sign(signer crypto.Signer) error {
-	descDigest := Hash(desc.Bytes())
+	desc.Signature = nil
+	body, err := desc.Encode()
+	if err != nil {
+		return err
+	}
+	descDigest := Hash(body)
 	signature, err := signer.Sign(rand.Reader, descDigest, crypto.Hash(0))
 	if err != nil {
 		return err
@@ -155,24 +237,118 @@ func (desc *OnionDescriptor) Sign(signer crypto.Signer) error {
 	return nil
 }
 
+// SignWithKey signs the descriptor with permanent key sk like Tor
+// does: PKCS #1 v1.5 signature of SHA-1 digest of the descriptor
+// without DigestInfo prefix. If the descriptor has no permanent key
+// the public part of sk is set.
+func (desc *OnionDescriptor) SignWithKey(sk *rsa.PrivateKey) error {
+	if err := pkcs1.CheckTorKey(&sk.PublicKey); err != nil {
+		return err
+	}
+	if desc.PermanentKey == nil {
+		desc.PermanentKey = &sk.PublicKey
+	} else if desc.PermanentKey.N.Cmp(sk.N) != 0 || desc.PermanentKey.E != sk.E {
+		return errors.New("Descriptor has another permanent key")
+	}
+	desc.Signature = nil
+	body, err := desc.Encode()
+	if err != nil {
+		return err
+	}
+	signature, err := rsa.SignPKCS1v15(nil, sk, crypto.Hash(0), Hash(body))
+	if err != nil {
+		return err
+	}
+	desc.Signature = signature
+	return nil
+}
+
 func (desc *OnionDescriptor) VerifySignature() error {
 	signature := desc.Signature
 	desc.Signature = []byte{}
-	descDigest := Hash(desc.Bytes())
+	body, err := desc.Encode()
 	desc.Signature = signature
-	return rsa.VerifyPKCS1v15(desc.PermanentKey, 0, descDigest, signature)
+	if err != nil {
+		return err
+	}
+	descDigest := Hash(body)
+	return verifyPKCS1v15(desc.PermanentKey, 0, descDigest, signature)
+}
+
+func (desc *OnionDescriptor) checkDescID() error {
+	permID, err := PermanentID(desc.PermanentKey)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(desc.DescID, CalcDescriptorID(permID, desc.SecretIDPart)) {
+		return errors.New("descriptor ID doesn't match permanent key")
+	}
+	return nil
+}
+
+// VerifyDescID recomputes descriptor ID from the permanent key and
+// the publication time for every replica and returns the replica
+// whose ID matches the advertised one.
+func (desc *OnionDescriptor) VerifyDescID() (replica int, err error) {
+	permID, err := PermanentID(desc.PermanentKey)
+	if err != nil {
+		return 0, err
+	}
+	var cookie []byte
+	if desc.DescriptorCookie != nil {
+		cookie = desc.DescriptorCookie[:]
+	}
+	for replica := MinReplica; replica <= MaxReplica; replica++ {
+		secretID := CalcSecretIDWithCookie(permID, desc.PublicationTime, cookie, byte(replica))
+		if bytes.Equal(desc.DescID, CalcDescriptorID(permID, secretID)) {
+			return replica, nil
+		}
+	}
+	return 0, errors.New("descriptor ID doesn't match any replica")
+}
+
+// Verify checks signature of the descriptor and that its descriptor ID
+// is derived from the permanent key and the secret-id-part.
+func (desc *OnionDescriptor) Verify() error {
+	if err := desc.checkDescID(); err != nil {
+		return err
+	}
+	return desc.VerifySignature()
+}
+
+// Validate checks version of the descriptor, its publication time
+// against now and that its descriptor ID is derived from the permanent
+// key. Unlike Verify it doesn't check the signature.
+func (desc *OnionDescriptor) Validate(now time.Time) error {
+	return desc.validate(now, DescriptorMaxAgeV2, DescriptorMaxSkewV2)
+}
+
+func (desc *OnionDescriptor) validate(now time.Time, maxAge, maxSkew time.Duration) error {
+	if desc.Version != DescVersion {
+		return fmt.Errorf("Unsupported descriptor version %d", desc.Version)
+	}
+	if desc.PublicationTime.Before(now.Add(-maxAge)) {
+		return errors.New("Descriptor is too old")
+	}
+	if desc.PublicationTime.After(now.Add(maxSkew)) {
+		return errors.New("Descriptor is too far in the future")
+	}
+	return desc.checkDescID()
 }
 
-/* TODO: there is no `descriptor-cookie` now (because we need IP list encryption etc) */
 func CalcSecretID(permID []byte, now time.Time, replica byte) (secretID []byte) {
-	permIDByte := uint32(permID[0])
+	return CalcSecretIDWithCookie(permID, now, nil, replica)
+}
 
-	timePeriodInt := (uint32(now.Unix()) + permIDByte*86400/256) / 86400
-	var timePeriod = new(bytes.Buffer)
-	binary.Write(timePeriod, binary.BigEndian, timePeriodInt)
+// CalcSecretIDWithCookie calculates secret-id-part using descriptor
+// cookie (if any) as stealth client authorization requires.
+func CalcSecretIDWithCookie(permID []byte, now time.Time, cookie []byte, replica byte) (secretID []byte) {
+	var timePeriod [4]byte
+	binary.BigEndian.PutUint32(timePeriod[:], TimePeriodV2(permID, now))
 
 	h := sha1.New()
-	h.Write(timePeriod.Bytes())
+	h.Write(timePeriod[:])
+	h.Write(cookie)
 	h.Write([]byte{replica})
 	secretID = h.Sum(nil)
 	return secretID
@@ -204,11 +380,48 @@ func (desc *OnionDescriptor) FullSign(signer crypto.Signer) error {
 	}
 	err := desc.Finalize(time.Now())
 	if err != nil {
-		return fmt.Errorf("unable to update descriptor: %v", err)
+		return fmt.Errorf("unable to update descriptor: %w", err)
 	}
 	err = desc.Sign(signer)
 	if err != nil {
-		return fmt.Errorf("unable to sign descriptor: %v", err)
+		return fmt.Errorf("unable to sign descriptor: %w", err)
 	}
-	return nil
+	return desc.CheckLimits()
+}
+
+// GenerateDescriptorSet returns descriptors of all replicas of
+// the service with key sk and introduction points ips signed
+// at time now. Descriptor IDs are derived from the publication time
+// shared by all the replicas so HSDirs accept them within
+// the same time period.
+func GenerateDescriptorSet(sk crypto.Signer, ips []IntroductionPoint, now time.Time) ([]*OnionDescriptor, error) {
+	pk, ok := sk.Public().(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("Signer is not RSA")
+	}
+	introBlock, err := EncodeIntroPoints(ips)
+	if err != nil {
+		return nil, err
+	}
+	nowunix := now.Unix()
+	published := time.Unix(nowunix-nowunix%(60*60), 0)
+	var descs []*OnionDescriptor
+	for replica := MinReplica; replica <= MaxReplica; replica++ {
+		desc := new(OnionDescriptor)
+		desc.InitDefaults()
+		desc.PermanentKey = pk
+		desc.IntropointsBlock = introBlock
+		desc.Replica = replica
+		if err := desc.Finalize(published); err != nil {
+			return nil, err
+		}
+		if err := desc.Sign(sk); err != nil {
+			return nil, err
+		}
+		if err := desc.CheckLimits(); err != nil {
+			return nil, err
+		}
+		descs = append(descs, desc)
+	}
+	return descs, nil
 }
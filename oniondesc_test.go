@@ -0,0 +1,161 @@
+package onionutil
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+	"time"
+
+	"github.com/nogoegst/onionutil/testvectors"
+)
+
+func TestParseOnionDescriptors(t *testing.T) {
+	data := []byte(testvectors.ServiceDescriptorV2.Data)
+	results, _ := ParseOnionDescriptors(data)
+	if len(results) != 1 || results[0].Err != nil {
+		t.Fatalf("wrong results: %+v", results)
+	}
+	desc := results[0].Desc
+	published := time.Date(2016, 6, 21, 20, 0, 0, 0, time.UTC)
+	if !desc.PublicationTime.Equal(published) {
+		t.Fatalf("wrong publication-time: %v", desc.PublicationTime)
+	}
+	if len(desc.ProtocolVersions) != 2 || len(desc.SecretIDPart) != 20 {
+		t.Fatalf("wrong descriptor: %+v", desc)
+	}
+	if err := desc.Validate(published.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := desc.Validate(published.Add(72 * time.Hour)); err == nil {
+		t.Fatal("stale descriptor is valid")
+	}
+	desc.SecretIDPart[0] ^= 1
+	if err := desc.Validate(published); err == nil {
+		t.Fatal("descriptor with wrong secret-id-part is valid")
+	}
+}
+
+func TestVerifyDescID(t *testing.T) {
+	sk, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var desc OnionDescriptor
+	desc.InitDefaults()
+	desc.PermanentKey = &sk.PublicKey
+	desc.Replica = 1
+	if err := desc.Finalize(time.Date(2017, 1, 2, 3, 0, 0, 0, time.UTC)); err != nil {
+		t.Fatal(err)
+	}
+	replica, err := desc.VerifyDescID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replica != 1 {
+		t.Fatalf("wrong replica: %d", replica)
+	}
+	desc.PublicationTime = desc.PublicationTime.Add(48 * time.Hour)
+	if _, err := desc.VerifyDescID(); err == nil {
+		t.Fatal("descriptor ID of another time period is accepted")
+	}
+}
+
+func TestOnionDescriptorBytes(t *testing.T) {
+	data := []byte(testvectors.ServiceDescriptorV2.Data)
+	results, _ := ParseOnionDescriptors(data)
+	if len(results) != 1 || results[0].Err != nil {
+		t.Fatalf("wrong results: %+v", results)
+	}
+	/* Unknown fields are dropped on encoding */
+	data = bytes.Replace(data, []byte("new-shiny-field 6h35ln3ntklmbiawjhgd\n"), nil, 1)
+	data = append(bytes.TrimRight(data, "\n"), '\n')
+	if !bytes.Equal(results[0].Desc.Bytes(), data) {
+		t.Fatal("encoding differs from the original")
+	}
+}
+
+func TestGenerateDescriptorSet(t *testing.T) {
+	sk, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2017, 1, 2, 23, 59, 59, 0, time.UTC)
+	descs, err := GenerateDescriptorSet(sk, nil, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(descs) != MaxReplica-MinReplica+1 {
+		t.Fatalf("wrong number of descriptors: %d", len(descs))
+	}
+	for i, desc := range descs {
+		replica, err := desc.VerifyDescID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if replica != MinReplica+i {
+			t.Fatalf("wrong replica: %d", replica)
+		}
+		if err := desc.Verify(); err != nil {
+			t.Fatal(err)
+		}
+		if !desc.PublicationTime.Equal(descs[0].PublicationTime) {
+			t.Fatal("publication times differ")
+		}
+	}
+	if bytes.Equal(descs[0].DescID, descs[1].DescID) {
+		t.Fatal("replicas have the same descriptor ID")
+	}
+}
+
+func TestSignWithKey(t *testing.T) {
+	/* Signature made by tor is a raw PKCS #1 v1.5 signature of the digest */
+	results, _ := ParseOnionDescriptors([]byte(testvectors.ServiceDescriptorV2.Data))
+	if len(results) != 1 || results[0].Err != nil {
+		t.Fatalf("wrong results: %+v", results)
+	}
+	torDesc := results[0].Desc
+	torSig := torDesc.Signature
+	torDesc.Signature = nil
+	if err := rsa.VerifyPKCS1v15(torDesc.PermanentKey, crypto.Hash(0), Hash(torDesc.Bytes()), torSig); err != nil {
+		t.Fatalf("signature made by tor doesn't verify: %v", err)
+	}
+
+	sk, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	desc := *torDesc
+	desc.PermanentKey = nil
+	if err := desc.SignWithKey(sk); err != nil {
+		t.Fatal(err)
+	}
+	sig := desc.Signature
+	desc.Signature = nil
+	expected, err := rsa.SignPKCS1v15(nil, sk, crypto.Hash(0), Hash(desc.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(sig, expected) {
+		t.Fatal("signature differs from tor-style one")
+	}
+	desc.Signature = sig
+	if err := desc.VerifySignature(); err != nil {
+		t.Fatal(err)
+	}
+	if err := torDesc.SignWithKey(sk); err == nil {
+		t.Fatal("key other than the permanent one is accepted")
+	}
+}
+
+func TestOnionDescriptorEncodeError(t *testing.T) {
+	desc := new(OnionDescriptor)
+	desc.InitDefaults()
+	if _, err := desc.Encode(); err == nil {
+		t.Fatal("descriptor without permanent key is encoded")
+	}
+	if err := desc.VerifySignature(); err == nil {
+		t.Fatal("descriptor without permanent key is verified")
+	}
+}
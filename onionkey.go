@@ -0,0 +1,145 @@
+// onionkey.go - identity keys of v2 and v3 onion services
+//
+// To the extent possible under law, Ivan Markin waived all copyright
+// and related or neighboring rights to this module of onionutil, using the creative
+// commons "cc0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package onionutil
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/nogoegst/onionutil/pkcs1"
+	"golang.org/x/crypto/ed25519"
+)
+
+// OnionKey is an identity key of an onion service. It allows to deal
+// with v2 and v3 services alike.
+type OnionKey interface {
+	// Version returns version of the onion service (2 or 3).
+	Version() int
+	// OnionAddress returns onion address of the service
+	// without ".onion" suffix.
+	OnionAddress() (string, error)
+	// PublicBytes returns the public key as embedded in descriptors:
+	// DER-encoded RSA key for v2 and Ed25519 key for v3.
+	PublicBytes() []byte
+	// SignDescriptor signs desc which is *OnionDescriptor for v2
+	// and *OnionDescriptorV3 for v3.
+	SignDescriptor(desc interface{}) error
+	// Zeroize wipes the private key.
+	Zeroize()
+}
+
+// NewOnionKey returns OnionKey of private key sk which is
+// *rsa.PrivateKey, ed25519.PrivateKey or *Ed25519ExpandedKey (like
+// ones returned by GenerateOnionKey and LoadPrivateKeyFile). v3 keys
+// get a descriptor signing key generated using rand.
+func NewOnionKey(rand io.Reader, sk crypto.PrivateKey) (OnionKey, error) {
+	switch sk := sk.(type) {
+	case *rsa.PrivateKey:
+		return &OnionKeyV2{PrivateKey: sk}, nil
+	case ed25519.PrivateKey:
+		esk := ExpandEd25519Key(sk)
+		return NewOnionKeyV3(rand, &esk)
+	case *Ed25519ExpandedKey:
+		return NewOnionKeyV3(rand, sk)
+	default:
+		return nil, fmt.Errorf("Unrecognized type of private key %T", sk)
+	}
+}
+
+// OnionKeyV2 is an identity key of v2 onion service.
+type OnionKeyV2 struct {
+	*rsa.PrivateKey
+}
+
+func (k *OnionKeyV2) Version() int {
+	return 2
+}
+
+func (k *OnionKeyV2) OnionAddress() (string, error) {
+	return OnionAddressV2(&k.PublicKey)
+}
+
+func (k *OnionKeyV2) PublicBytes() []byte {
+	der, _ := pkcs1.EncodePublicKeyDER(&k.PublicKey)
+	return der
+}
+
+// SignDescriptor signs *OnionDescriptor desc (see SignWithKey).
+func (k *OnionKeyV2) SignDescriptor(desc interface{}) error {
+	d, ok := desc.(*OnionDescriptor)
+	if !ok {
+		return fmt.Errorf("Wrong type of v2 descriptor %T", desc)
+	}
+	return d.SignWithKey(k.PrivateKey)
+}
+
+func (k *OnionKeyV2) Zeroize() {
+	ZeroizeRSAPrivateKey(k.PrivateKey)
+}
+
+// OnionKeyV3 is an identity key of v3 onion service along with
+// a descriptor signing key.
+type OnionKeyV3 struct {
+	Identity   *Ed25519ExpandedKey
+	SigningKey ed25519.PrivateKey
+}
+
+// NewOnionKeyV3 returns OnionKeyV3 of identity key esk with
+// a fresh descriptor signing key generated using rand.
+func NewOnionKeyV3(rand io.Reader, esk *Ed25519ExpandedKey) (*OnionKeyV3, error) {
+	_, signingKey, err := ed25519.GenerateKey(rand)
+	if err != nil {
+		return nil, err
+	}
+	return &OnionKeyV3{Identity: esk, SigningKey: signingKey}, nil
+}
+
+func (k *OnionKeyV3) Version() int {
+	return 3
+}
+
+func (k *OnionKeyV3) OnionAddress() (string, error) {
+	return OnionAddressV3(k.Identity.Public().(ed25519.PublicKey))
+}
+
+func (k *OnionKeyV3) PublicBytes() []byte {
+	return []byte(k.Identity.Public().(ed25519.PublicKey))
+}
+
+// CertifyDescriptor embeds certificate of the descriptor signing key
+// signed with the identity key blinded for the default length time
+// period periodNum into desc. The certificate expires a time period
+// after the end of periodNum. It must be done before encryption
+// of descriptor layers.
+func (k *OnionKeyV3) CertifyDescriptor(desc *OnionDescriptorV3, periodNum uint64) {
+	blindedKey := BlindPrivateKey(*k.Identity, periodNum, DefaultTimePeriodsV3.LengthMinutes())
+	defer blindedKey.Zeroize()
+	pk := k.SigningKey.Public().(ed25519.PublicKey)
+	desc.CertifySigningKey(&blindedKey, pk, TimePeriodStart(periodNum+2))
+}
+
+// SignDescriptor signs *OnionDescriptorV3 desc with the descriptor
+// signing key. It must be certified with CertifyDescriptor.
+func (k *OnionKeyV3) SignDescriptor(desc interface{}) error {
+	d, ok := desc.(*OnionDescriptorV3)
+	if !ok {
+		return fmt.Errorf("Wrong type of v3 descriptor %T", desc)
+	}
+	if d.SigningKeyCert == nil {
+		return errors.New("Descriptor has no signing key certificate")
+	}
+	return d.Sign(k.SigningKey)
+}
+
+func (k *OnionKeyV3) Zeroize() {
+	k.Identity.Zeroize()
+	Zeroize(k.SigningKey)
+}
@@ -0,0 +1,80 @@
+package onionutil
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+func TestOnionKeyV2(t *testing.T) {
+	sk, err := GenerateOnionKeyV2(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := NewOnionKey(rand.Reader, sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.Version() != 2 {
+		t.Fatalf("wrong version: %d", key.Version())
+	}
+	desc := new(OnionDescriptor)
+	desc.InitDefaults()
+	desc.PermanentKey = &sk.(*rsa.PrivateKey).PublicKey
+	if err := desc.Finalize(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if err := key.SignDescriptor(desc); err != nil {
+		t.Fatal(err)
+	}
+	if err := desc.VerifySignature(); err != nil {
+		t.Fatal(err)
+	}
+	if key.SignDescriptor(new(OnionDescriptorV3)) == nil {
+		t.Fatal("v3 descriptor is signed with v2 key")
+	}
+}
+
+func TestOnionKeyV3(t *testing.T) {
+	pk, sk, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := NewOnionKey(rand.Reader, sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	onionAddress, err := OnionAddress(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, _ := OnionAddressV3(pk)
+	if onionAddress != expected || string(key.PublicBytes()) != string(pk) {
+		t.Fatalf("wrong onion address: %s", onionAddress)
+	}
+	desc := &OnionDescriptorV3{Version: DescVersionV3, Lifetime: DescLifetimeV3}
+	if key.SignDescriptor(desc) == nil {
+		t.Fatal("descriptor without certificate is signed")
+	}
+	key.(*OnionKeyV3).CertifyDescriptor(desc, TimePeriodNumV3(time.Now()))
+	inner := &EncryptedLayerV3{Create2Formats: []int{Create2FormatNTor}}
+	if err := desc.EncryptLayers(rand.Reader, pk, inner, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := key.SignDescriptor(desc); err != nil {
+		t.Fatal(err)
+	}
+	blindedPk, err := BlindPublicKeyAt(pk, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := desc.VerifySignature(blindedPk, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := desc.DecryptLayers(onionAddress, nil); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,232 @@
+// parseall.go - parse streams of documents concurrently
+//
+// To the extent possible under law, Ivan Markin waived all copyright
+// and related or neighboring rights to this module of onionutil, using the creative
+// commons "cc0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package onionutil
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"runtime"
+
+	"github.com/nogoegst/onionutil/torparse"
+)
+
+type docKind int
+
+const (
+	docUnknown docKind = iota
+	docOnionDescriptor
+	docOnionDescriptorV3
+	docRouterDescriptor
+	docMicrodescriptor
+)
+
+// startKind returns kind of document which starts with line or
+// docUnknown if line doesn't start a document inside document
+// of kind cur.
+func startKind(line []byte, cur docKind) docKind {
+	switch {
+	case bytes.HasPrefix(line, descriptorStart):
+		return docOnionDescriptor
+	case bytes.HasPrefix(line, []byte("hs-descriptor ")):
+		return docOnionDescriptorV3
+	case bytes.HasPrefix(line, []byte("router ")):
+		return docRouterDescriptor
+	case cur != docRouterDescriptor && string(bytes.TrimRight(line, "\r\n")) == "onion-key":
+		/* Server descriptors have onion-key lines too */
+		return docMicrodescriptor
+	}
+	return docUnknown
+}
+
+// splitDocuments reads documents from r and calls emit for each of
+// them with preceding annotations included until emit returns false.
+// Data before the first document or annotation is skipped.
+func splitDocuments(r io.Reader, emit func(raw []byte, kind docKind) bool) error {
+	br := bufio.NewReader(r)
+	var raw []byte
+	kind := docUnknown
+	for {
+		line, err := br.ReadBytes('\n')
+		if len(line) > 0 {
+			next := startKind(line, kind)
+			if (next != docUnknown || line[0] == '@') && kind != docUnknown {
+				if !emit(raw, kind) {
+					return nil
+				}
+				raw, kind = nil, docUnknown
+			}
+			if next != docUnknown {
+				kind = next
+			}
+			if raw != nil || kind != docUnknown || line[0] == '@' {
+				raw = append(raw, line...)
+			}
+		}
+		if err != nil {
+			if kind != docUnknown && !emit(raw, kind) {
+				return nil
+			}
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// stripAnnotations returns raw without leading annotation lines.
+func stripAnnotations(raw []byte) []byte {
+	for len(raw) > 0 && raw[0] == '@' {
+		i := bytes.IndexByte(raw, '\n')
+		if i < 0 {
+			return nil
+		}
+		raw = raw[i+1:]
+	}
+	return raw
+}
+
+func parseDocument(raw []byte, kind docKind) (interface{}, error) {
+	body := stripAnnotations(raw)
+	switch kind {
+	case docOnionDescriptor:
+		docs, _ := torparse.ParseTorDocument(body)
+		if len(docs) != 1 {
+			return nil, errors.New("Malformed descriptor")
+		}
+		desc, err := parseOnionDescriptor(docs[0])
+		if err != nil {
+			return nil, err
+		}
+		return desc, nil
+	case docOnionDescriptorV3:
+		desc, err := ParseOnionDescriptorV3(body)
+		if err != nil {
+			return nil, err
+		}
+		return desc, nil
+	case docRouterDescriptor:
+		desc, err := parseRouterDescriptorSection(body)
+		if err != nil {
+			return nil, err
+		}
+		return &desc, nil
+	case docMicrodescriptor:
+		md, err := parseMicrodescriptor(body)
+		if err != nil {
+			return nil, err
+		}
+		return md, nil
+	}
+	return nil, errors.New("Unknown document type")
+}
+
+// ParseResult is a result of parsing a single document by ParseAll.
+type ParseResult struct {
+	// Index is the number of the document in the input.
+	Index int
+	// Raw is the document along with its annotations.
+	Raw []byte
+	// Desc is *OnionDescriptor, *OnionDescriptorV3, *RouterDescriptor
+	// or *Microdescriptor. It's nil if Err is set.
+	Desc interface{}
+	Err  error
+}
+
+type parseJob struct {
+	index  int
+	raw    []byte
+	kind   docKind
+	result chan ParseResult
+}
+
+// ParseAll splits a stream of v2 and v3 onion service descriptors,
+// server descriptors and microdescriptors (like CollecTor archives)
+// into documents and parses them using workers goroutines (the number
+// of CPUs if workers is not positive). Results are sent in order of
+// documents. Server descriptors are verified. r may be compressed
+// (see Decompress). An error of reading r is sent as the last result.
+// The channel is closed after all the results are sent, so it must
+// be drained.
+func ParseAll(r io.Reader, workers int) <-chan ParseResult {
+	return ParseAllContext(context.Background(), r, workers)
+}
+
+// ParseAllContext is like ParseAll but stops parsing and closes
+// the channel once ctx is done.
+func ParseAllContext(ctx context.Context, r io.Reader, workers int) <-chan ParseResult {
+	if workers < 1 {
+		workers = runtime.NumCPU()
+	}
+	jobs := make(chan parseJob)
+	/* Pending results in order of documents */
+	pending := make(chan chan ParseResult, 2*workers)
+	results := make(chan ParseResult, workers)
+
+	for i := 0; i < workers; i++ {
+		go func() {
+			for job := range jobs {
+				desc, err := parseDocument(job.raw, job.kind)
+				job.result <- ParseResult{Index: job.index, Raw: job.raw, Desc: desc, Err: err}
+			}
+		}()
+	}
+
+	go func() {
+		defer close(pending)
+		defer close(jobs)
+		index := 0
+		dr, err := Decompress(r)
+		if err == nil {
+			err = splitDocuments(dr, func(raw []byte, kind docKind) bool {
+				job := parseJob{index: index, raw: raw, kind: kind, result: make(chan ParseResult, 1)}
+				select {
+				case pending <- job.result:
+				case <-ctx.Done():
+					return false
+				}
+				select {
+				case jobs <- job:
+				case <-ctx.Done():
+					return false
+				}
+				index++
+				return true
+			})
+		}
+		if err != nil {
+			result := make(chan ParseResult, 1)
+			result <- ParseResult{Index: index, Err: err}
+			select {
+			case pending <- result:
+			case <-ctx.Done():
+			}
+		}
+	}()
+
+	go func() {
+		defer close(results)
+		for result := range pending {
+			var res ParseResult
+			select {
+			case res = <-result:
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case results <- res:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return results
+}
@@ -0,0 +1,74 @@
+package onionutil
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"testing"
+
+	"github.com/nogoegst/onionutil/testvectors"
+)
+
+type failingReader struct {
+	r   *bytes.Reader
+	err error
+}
+
+func (fr *failingReader) Read(p []byte) (int, error) {
+	n, err := fr.r.Read(p)
+	if err != nil {
+		return n, fr.err
+	}
+	return n, nil
+}
+
+func TestParseAll(t *testing.T) {
+	router, _ := makeRouterDescriptor(t, "router", "")
+	sk, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	md := "onion-key\n" + string(pemRSAPublicKey(t, &sk.PublicKey)) +
+		"ntor-onion-key 4pvbFChEqTnMZbRIAvWlnZtZmyLK+ozQ37Xxvn0bFEQ=\n"
+	var data []byte
+	data = append(data, "@type hidden-service-descriptor 1.0\n"+testvectors.ServiceDescriptorV2.Data...)
+	data = append(data, "@type server-descriptor 1.0\n"+string(router)...)
+	data = append(data, "rendezvous-service-descriptor garbage\n"...)
+	data = append(data, "@last-listed 2019-01-02 03:00:00\n"+md...)
+	data = append(data, md...)
+
+	readErr := errors.New("read error")
+	var results []ParseResult
+	for res := range ParseAll(&failingReader{bytes.NewReader(data), readErr}, 3) {
+		results = append(results, res)
+	}
+	if len(results) != 6 {
+		t.Fatalf("Wrong number of results: %d", len(results))
+	}
+	for i, res := range results {
+		if res.Index != i {
+			t.Fatalf("Result %d has index %d", i, res.Index)
+		}
+	}
+	if _, ok := results[0].Desc.(*OnionDescriptor); !ok || results[0].Err != nil {
+		t.Fatalf("Wrong onion descriptor result: %v", results[0].Err)
+	}
+	if desc, ok := results[1].Desc.(*RouterDescriptor); !ok || desc.Nickname != "router" {
+		t.Fatalf("Wrong router descriptor result: %v", results[1].Err)
+	}
+	if results[2].Err == nil || results[2].Desc != nil {
+		t.Fatal("Malformed descriptor has been parsed")
+	}
+	for _, res := range results[3:5] {
+		if _, ok := res.Desc.(*Microdescriptor); !ok {
+			t.Fatalf("Wrong microdescriptor result: %v", res.Err)
+		}
+	}
+	if !bytes.HasPrefix(results[3].Raw, []byte("@last-listed")) {
+		t.Fatal("Annotations are not included")
+	}
+	if results[5].Err != readErr {
+		t.Fatalf("Expected read error, got %v", results[5].Err)
+	}
+}
@@ -0,0 +1,53 @@
+package onionutil
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nogoegst/onionutil/testvectors"
+	"github.com/nogoegst/onionutil/torparse"
+)
+
+func TestFindPEMBlocks(t *testing.T) {
+	data := []byte(testvectors.ServiceDescriptorV2.Data)
+	blocks := torparse.FindPEMBlocks(data, "")
+	if len(blocks) != 3 {
+		t.Fatalf("found %d blocks, expected 3", len(blocks))
+	}
+	for i, typ := range []string{torparse.ObjectRSAPublicKey, torparse.ObjectMessage, torparse.ObjectSignature} {
+		b := blocks[i]
+		if b.Type != typ {
+			t.Fatalf("block %d is %s, expected %s", i, b.Type, typ)
+		}
+		if !strings.HasPrefix(string(data[b.Offset:b.End]), "-----BEGIN "+typ+"-----\n") ||
+			!strings.HasSuffix(string(data[b.Offset:b.End]), "-----END "+typ+"-----\n") {
+			t.Fatalf("wrong position of block %d", i)
+		}
+		if err := torparse.CheckObjectType(b.Type); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if blocks[0].Line != 4 || blocks[2].Line != 95 {
+		t.Fatalf("wrong lines: %d, %d", blocks[0].Line, blocks[2].Line)
+	}
+	sigs := torparse.FindPEMBlocks(data, torparse.ObjectSignature)
+	if len(sigs) != 1 || sigs[0].Offset != blocks[2].Offset {
+		t.Fatal("signature block is not found")
+	}
+	der, err := torparse.DecodePEMBlock(data[blocks[0].Offset:blocks[0].End], torparse.ObjectRSAPublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(der) != string(blocks[0].Bytes) {
+		t.Fatal("decoded block differs")
+	}
+	if err := torparse.CheckObjectType("CROSSCERT", torparse.ObjectEd25519Cert); err == nil {
+		t.Fatal("unexpected object type is accepted")
+	}
+	/* Malformed block must not hide the following one */
+	broken := "-----BEGIN MESSAGE-----\n!!!\n-----END MESSAGE-----\n" +
+		string(data[blocks[2].Offset:blocks[2].End])
+	if found := torparse.FindPEMBlocks([]byte(broken), ""); len(found) != 1 || found[0].Line != 4 {
+		t.Fatalf("found %+v", found)
+	}
+}
@@ -0,0 +1,133 @@
+// pem.go - PEM encoding of RSA keys as used by Tor.
+//
+// To the extent possible under law, Ivan Markin waived all copyright
+// and related or neighboring rights to this module of onionutil, using the creative
+// commons "cc0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package pkcs1
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"encoding/pem"
+	"errors"
+	"fmt"
+)
+
+// Constraints Tor imposes on its RSA keys.
+const (
+	TorModulusBits    = 1024
+	TorPublicExponent = 65537
+)
+
+// PEM block types of OpenSSL "traditional" key encoding
+// which Tor uses (e.g. in private_key file).
+const (
+	PrivateKeyPEMType = "RSA PRIVATE KEY"
+	PublicKeyPEMType  = "RSA PUBLIC KEY"
+)
+
+// CheckTorKey checks that pk has 1024-bit modulus
+// and public exponent 65537.
+func CheckTorKey(pk *rsa.PublicKey) error {
+	if pk == nil || pk.N == nil {
+		return errors.New("Empty RSA key")
+	}
+	if pk.N.BitLen() != TorModulusBits {
+		return fmt.Errorf("RSA modulus must be %d bits long, not %d",
+			TorModulusBits, pk.N.BitLen())
+	}
+	if pk.E != TorPublicExponent {
+		return fmt.Errorf("RSA public exponent must be %d, not %d",
+			TorPublicExponent, pk.E)
+	}
+	return nil
+}
+
+// decodePEM decodes the only PEM block of type blockType in data.
+func decodePEM(data []byte, blockType string) ([]byte, error) {
+	block, rest := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("No valid PEM block found")
+	}
+	if block.Type != blockType {
+		return nil, fmt.Errorf("Unexpected PEM block type %s", block.Type)
+	}
+	if len(block.Headers) != 0 {
+		return nil, errors.New("Encrypted keys are not supported")
+	}
+	if len(bytes.TrimSpace(rest)) != 0 {
+		return nil, errors.New("Trailing data after PEM block")
+	}
+	return block.Bytes, nil
+}
+
+// EncodePrivateKeyPEM returns PEM encoding of sk compatible with
+// Tor's private_key file. sk must satisfy Tor's constraints.
+func EncodePrivateKeyPEM(sk *rsa.PrivateKey) ([]byte, error) {
+	if err := CheckTorKey(&sk.PublicKey); err != nil {
+		return nil, err
+	}
+	der, err := EncodePrivateKeyDER(sk)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: PrivateKeyPEMType, Bytes: der}), nil
+}
+
+// DecodePrivateKeyPEM decodes private key in the format of Tor's
+// private_key file and checks that it satisfies Tor's constraints.
+func DecodePrivateKeyPEM(data []byte) (*rsa.PrivateKey, error) {
+	der, err := decodePEM(data, PrivateKeyPEMType)
+	if err != nil {
+		return nil, err
+	}
+	sk, rest, err := DecodePrivateKeyDER(der)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, errors.New("Trailing data after private key")
+	}
+	if err := sk.Validate(); err != nil {
+		return nil, err
+	}
+	if err := CheckTorKey(&sk.PublicKey); err != nil {
+		return nil, err
+	}
+	return sk, nil
+}
+
+// EncodePublicKeyPEM returns PEM encoding of pk as used
+// in Tor documents.
+func EncodePublicKeyPEM(pk *rsa.PublicKey) ([]byte, error) {
+	if err := CheckTorKey(pk); err != nil {
+		return nil, err
+	}
+	der, err := EncodePublicKeyDER(pk)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: PublicKeyPEMType, Bytes: der}), nil
+}
+
+// DecodePublicKeyPEM decodes PEM encoded public key and checks
+// that it satisfies Tor's constraints.
+func DecodePublicKeyPEM(data []byte) (*rsa.PublicKey, error) {
+	der, err := decodePEM(data, PublicKeyPEMType)
+	if err != nil {
+		return nil, err
+	}
+	pk, rest, err := DecodePublicKeyDER(der)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, errors.New("Trailing data after public key")
+	}
+	if err := CheckTorKey(pk); err != nil {
+		return nil, err
+	}
+	return pk, nil
+}
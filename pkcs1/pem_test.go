@@ -0,0 +1,54 @@
+package pkcs1
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+)
+
+func TestPrivateKeyPEM(t *testing.T) {
+	sk, err := rsa.GenerateKey(rand.Reader, TorModulusBits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := EncodePrivateKeyPEM(sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := DecodePrivateKeyPEM(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.N.Cmp(sk.N) != 0 || decoded.D.Cmp(sk.D) != 0 {
+		t.Fatal("decoded key differs")
+	}
+	if _, err := DecodePublicKeyPEM(data); err == nil {
+		t.Fatal("private key is decoded as public")
+	}
+	pkData, err := EncodePublicKeyPEM(&sk.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pk, err := DecodePublicKeyPEM(pkData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pk.N.Cmp(sk.N) != 0 {
+		t.Fatal("decoded public key differs")
+	}
+	if _, err := DecodePrivateKeyPEM(append(data, "garbage"...)); err == nil {
+		t.Fatal("trailing data is accepted")
+	}
+
+	bigSk, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := EncodePrivateKeyPEM(bigSk); err == nil {
+		t.Fatal("2048-bit key is accepted")
+	}
+	pk.E = 3
+	if err := CheckTorKey(pk); err == nil {
+		t.Fatal("wrong public exponent is accepted")
+	}
+}
@@ -0,0 +1,142 @@
+// platform.go - deal with platform lines of relays
+//
+// To the extent possible under law, Ivan Markin waived all copyright
+// and related or neighboring rights to this module of onionutil, using the creative
+// commons "cc0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package onionutil
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/nogoegst/onionutil/torparse"
+)
+
+// Platform is a "platform" line of a router descriptor like
+// "Tor 0.3.2.10 (git-31cc63deb8db1852) on Linux".
+type Platform struct {
+	SoftwareName    string
+	SoftwareVersion string
+	// Extra is anything between the version and " on ".
+	Extra string
+	// Name is the operating system name.
+	Name string
+}
+
+func ParsePlatformEntry(platformE torparse.TorEntry) (platform Platform, err error) {
+	if len(platformE) == 0 {
+		return platform, errors.New("Empty platform")
+	}
+	words := make([]string, len(platformE))
+	for i, word := range platformE {
+		words[i] = string(word)
+	}
+	software := words
+	for i, word := range words {
+		if word == "on" {
+			software = words[:i]
+			platform.Name = strings.Join(words[i+1:], " ")
+			break
+		}
+	}
+	if len(software) == 0 {
+		return platform, errors.New("No software name in platform")
+	}
+	platform.SoftwareName = software[0]
+	if len(software) > 1 {
+		platform.SoftwareVersion = software[1]
+	}
+	if len(software) > 2 {
+		platform.Extra = strings.Join(software[2:], " ")
+	}
+	return platform, nil
+}
+
+func (platform Platform) String() string {
+	words := []string{platform.SoftwareName}
+	for _, word := range []string{platform.SoftwareVersion, platform.Extra} {
+		if word != "" {
+			words = append(words, word)
+		}
+	}
+	if platform.Name != "" {
+		words = append(words, "on", platform.Name)
+	}
+	return strings.Join(words, " ")
+}
+
+// AtLeast reports whether platform runs Tor of version at least
+// version. It returns false if the version can't be determined.
+func (platform Platform) AtLeast(version string) bool {
+	if platform.SoftwareName != "Tor" {
+		return false
+	}
+	v, err := ParseTorVersion(platform.SoftwareVersion)
+	if err != nil {
+		return false
+	}
+	min, err := ParseTorVersion(version)
+	if err != nil {
+		return false
+	}
+	return v.Compare(min) >= 0
+}
+
+// TorVersion is a version of Tor (version-spec).
+type TorVersion struct {
+	Major      int
+	Minor      int
+	Micro      int
+	Patchlevel int
+	StatusTag  string
+}
+
+// ParseTorVersion parses version string "MAJOR.MINOR.MICRO[.PATCHLEVEL][-STATUS_TAG]".
+// Missing MICRO is allowed and treated as zero.
+func ParseTorVersion(s string) (v TorVersion, err error) {
+	if i := strings.IndexByte(s, '-'); i >= 0 {
+		v.StatusTag = s[i+1:]
+		s = s[:i]
+	}
+	parts := strings.Split(s, ".")
+	if len(parts) < 2 || len(parts) > 4 {
+		return v, fmt.Errorf("Malformed Tor version: %s", s)
+	}
+	nums := make([]int, 4)
+	for i, part := range parts {
+		nums[i], err = strconv.Atoi(part)
+		if err != nil || nums[i] < 0 {
+			return v, fmt.Errorf("Malformed Tor version: %s", s)
+		}
+	}
+	v.Major, v.Minor, v.Micro, v.Patchlevel = nums[0], nums[1], nums[2], nums[3]
+	return v, nil
+}
+
+// Compare returns -1, 0 or 1 if v is less, equal or greater than
+// other. Status tags are compared lexically as Tor does.
+func (v TorVersion) Compare(other TorVersion) int {
+	a := []int{v.Major, v.Minor, v.Micro, v.Patchlevel}
+	b := []int{other.Major, other.Minor, other.Micro, other.Patchlevel}
+	for i := range a {
+		if a[i] < b[i] {
+			return -1
+		}
+		if a[i] > b[i] {
+			return 1
+		}
+	}
+	return strings.Compare(v.StatusTag, other.StatusTag)
+}
+
+func (v TorVersion) String() string {
+	s := fmt.Sprintf("%d.%d.%d.%d", v.Major, v.Minor, v.Micro, v.Patchlevel)
+	if v.StatusTag != "" {
+		s += "-" + v.StatusTag
+	}
+	return s
+}
@@ -0,0 +1,39 @@
+package onionutil
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestParsePlatformEntry(t *testing.T) {
+	for _, test := range []struct {
+		line     string
+		platform Platform
+	}{
+		{"Tor 0.4.8.10 on Linux", Platform{"Tor", "0.4.8.10", "", "Linux"}},
+		{"Tor 0.3.2.10 (git-31cc63deb8db1852) on Windows 8",
+			Platform{"Tor", "0.3.2.10", "(git-31cc63deb8db1852)", "Windows 8"}},
+		{"Arti 1.1.0", Platform{"Arti", "1.1.0", "", ""}},
+	} {
+		platform, err := ParsePlatformEntry(bytes.Split([]byte(test.line), []byte(" ")))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if platform != test.platform {
+			t.Fatalf("%q parsed into %+v", test.line, platform)
+		}
+		if platform.String() != test.line {
+			t.Fatalf("%q encoded into %q", test.line, platform.String())
+		}
+	}
+}
+
+func TestPlatformAtLeast(t *testing.T) {
+	platform := Platform{SoftwareName: "Tor", SoftwareVersion: "0.4.8.10"}
+	if !platform.AtLeast("0.4.7") || !platform.AtLeast("0.4.8.10") {
+		t.Fatal("newer version is considered older")
+	}
+	if platform.AtLeast("0.4.8.11") || platform.AtLeast("0.5.0.1-alpha") {
+		t.Fatal("older version is considered newer")
+	}
+}
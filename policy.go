@@ -0,0 +1,345 @@
+// policy.go - exit policies and their summaries
+//
+// To the extent possible under law, Ivan Markin waived all copyright
+// and related or neighboring rights to this module of onionutil, using the creative
+// commons "cc0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package onionutil
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net"
+	"net/netip"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PolicyRule is a single rule of an exit policy like
+// "accept 1.2.0.0/16:80-443" (dir-spec 2.1.3).
+type PolicyRule struct {
+	Accept bool
+	// Wildcard is "*", "*4" or "*6" if the rule matches any
+	// (IPv4 or IPv6) address. Otherwise Prefix is matched.
+	Wildcard string
+	Prefix   netip.Prefix
+	MinPort  uint16
+	MaxPort  uint16
+}
+
+// Policy is an exit policy: the first matching rule decides.
+type Policy []PolicyRule
+
+func parsePortRange(s string) (min, max uint16, err error) {
+	if s == "*" {
+		return 1, 65535, nil
+	}
+	bounds := strings.SplitN(s, "-", 2)
+	p, err := strconv.ParseUint(bounds[0], 10, 16)
+	if err != nil {
+		return 0, 0, err
+	}
+	min, max = uint16(p), uint16(p)
+	if len(bounds) == 2 {
+		p, err = strconv.ParseUint(bounds[1], 10, 16)
+		if err != nil {
+			return 0, 0, err
+		}
+		max = uint16(p)
+	}
+	if min > max {
+		return 0, 0, fmt.Errorf("Malformed port range: %s", s)
+	}
+	return min, max, nil
+}
+
+func parsePolicyPrefix(s string) (netip.Prefix, error) {
+	s = strings.Replace(strings.Replace(s, "[", "", 1), "]", "", 1)
+	parts := strings.SplitN(s, "/", 2)
+	addr, err := netip.ParseAddr(parts[0])
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	bits := addr.BitLen()
+	if len(parts) == 2 {
+		if n, err := strconv.Atoi(parts[1]); err == nil {
+			bits = n
+		} else {
+			/* IPv4 mask form like 255.0.0.0 */
+			mask := net.ParseIP(parts[1]).To4()
+			if mask == nil {
+				return netip.Prefix{}, fmt.Errorf("Malformed mask: %s", parts[1])
+			}
+			ones, size := net.IPMask(mask).Size()
+			if size == 0 {
+				return netip.Prefix{}, fmt.Errorf("Non-contiguous mask: %s", parts[1])
+			}
+			bits = ones
+		}
+	}
+	return addr.Prefix(bits)
+}
+
+// ParsePolicyRule parses rule like "accept 1.2.0.0/16:80-443".
+func ParsePolicyRule(line string) (rule PolicyRule, err error) {
+	fields := strings.Fields(line)
+	if len(fields) != 2 {
+		return rule, fmt.Errorf("Malformed policy rule: %s", line)
+	}
+	switch fields[0] {
+	case "accept", "accept6":
+		rule.Accept = true
+	case "reject", "reject6":
+	default:
+		return rule, fmt.Errorf("Malformed policy rule: %s", line)
+	}
+	colon := strings.LastIndex(fields[1], ":")
+	if colon < 0 {
+		return rule, fmt.Errorf("No port in policy rule: %s", line)
+	}
+	pattern := fields[1][:colon]
+	rule.MinPort, rule.MaxPort, err = parsePortRange(fields[1][colon+1:])
+	if err != nil {
+		return rule, err
+	}
+	switch pattern {
+	case "*", "*4", "*6":
+		rule.Wildcard = pattern
+	default:
+		rule.Prefix, err = parsePolicyPrefix(pattern)
+	}
+	return rule, err
+}
+
+// ParsePolicy parses accept and reject lines of a router
+// descriptor in data preserving their order.
+func ParsePolicy(data []byte) (policy Policy, err error) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "accept ") && !strings.HasPrefix(line, "reject ") {
+			continue
+		}
+		rule, err := ParsePolicyRule(line)
+		if err != nil {
+			return nil, err
+		}
+		policy = append(policy, rule)
+	}
+	return policy, scanner.Err()
+}
+
+func (rule PolicyRule) matchesAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	switch rule.Wildcard {
+	case "*":
+		return true
+	case "*4":
+		return addr.Is4()
+	case "*6":
+		return addr.Is6()
+	}
+	return rule.Prefix.Contains(addr)
+}
+
+// Matches reports whether the rule applies to addr and port.
+func (rule PolicyRule) Matches(addr netip.Addr, port uint16) bool {
+	return port >= rule.MinPort && port <= rule.MaxPort && rule.matchesAddr(addr)
+}
+
+func formatPortRange(min, max uint16) string {
+	switch {
+	case min == 1 && max == 65535:
+		return "*"
+	case min == max:
+		return strconv.Itoa(int(min))
+	default:
+		return fmt.Sprintf("%d-%d", min, max)
+	}
+}
+
+func (rule PolicyRule) String() string {
+	action := "reject"
+	if rule.Accept {
+		action = "accept"
+	}
+	pattern := rule.Wildcard
+	if pattern == "" {
+		addr := rule.Prefix.Addr().String()
+		if rule.Prefix.Addr().Is6() {
+			addr = "[" + addr + "]"
+		}
+		pattern = addr
+		if rule.Prefix.Bits() != rule.Prefix.Addr().BitLen() {
+			pattern += "/" + strconv.Itoa(rule.Prefix.Bits())
+		}
+	}
+	return action + " " + pattern + ":" + formatPortRange(rule.MinPort, rule.MaxPort)
+}
+
+// Allows reports whether the policy allows exiting to addr and port.
+// Connections that match no rule are allowed.
+func (policy Policy) Allows(addr netip.Addr, port uint16) bool {
+	for _, rule := range policy {
+		if rule.Matches(addr, port) {
+			return rule.Accept
+		}
+	}
+	return true
+}
+
+func (policy Policy) String() string {
+	var lines []string
+	for _, rule := range policy {
+		lines = append(lines, rule.String()+"\n")
+	}
+	return strings.Join(lines, "")
+}
+
+// PortRange is an inclusive range of ports.
+type PortRange struct {
+	Min uint16
+	Max uint16
+}
+
+// Contains reports whether port is in r.
+func (r PortRange) Contains(port uint16) bool {
+	return port >= r.Min && port <= r.Max
+}
+
+func (r PortRange) String() string {
+	if r.Min == r.Max {
+		return strconv.Itoa(int(r.Min))
+	}
+	return fmt.Sprintf("%d-%d", r.Min, r.Max)
+}
+
+// canonicalPortRanges returns sorted ranges with overlapping
+// and adjacent ones merged.
+func canonicalPortRanges(ranges []PortRange) (canonical []PortRange) {
+	sorted := append([]PortRange(nil), ranges...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Min < sorted[j].Min
+	})
+	for _, r := range sorted {
+		if n := len(canonical); n > 0 && uint32(r.Min) <= uint32(canonical[n-1].Max)+1 {
+			if r.Max > canonical[n-1].Max {
+				canonical[n-1].Max = r.Max
+			}
+			continue
+		}
+		canonical = append(canonical, r)
+	}
+	return canonical
+}
+
+// PolicySummary is a summary of exit policy like "accept 80,443"
+// from "p" lines of consensuses and microdescriptors.
+type PolicySummary struct {
+	Accept bool
+	Ports  []PortRange
+}
+
+func ParsePolicySummary(s string) (*PolicySummary, error) {
+	fields := strings.Fields(s)
+	if len(fields) != 2 {
+		return nil, fmt.Errorf("Malformed policy summary: %s", s)
+	}
+	ps := new(PolicySummary)
+	switch fields[0] {
+	case "accept":
+		ps.Accept = true
+	case "reject":
+	default:
+		return nil, fmt.Errorf("Malformed policy summary: %s", s)
+	}
+	for _, r := range strings.Split(fields[1], ",") {
+		min, max, err := parsePortRange(r)
+		if err != nil {
+			return nil, err
+		}
+		ps.Ports = append(ps.Ports, PortRange{min, max})
+	}
+	return ps, nil
+}
+
+// Allows reports whether exiting to port is allowed for most addresses.
+func (ps *PolicySummary) Allows(port uint16) bool {
+	for _, r := range ps.Ports {
+		if r.Contains(port) {
+			return ps.Accept
+		}
+	}
+	return !ps.Accept
+}
+
+func (ps *PolicySummary) String() string {
+	action := "reject"
+	if ps.Accept {
+		action = "accept"
+	}
+	var ranges []string
+	for _, r := range ps.Ports {
+		ranges = append(ranges, r.String())
+	}
+	return action + " " + strings.Join(ranges, ",")
+}
+
+// Exit6Policy is an IPv6 exit policy from "ipv6-policy" line
+// of a router descriptor like "accept 80,443,6660-6669".
+type Exit6Policy struct {
+	Accept bool
+	// Ports are sorted non-overlapping port ranges.
+	Ports []PortRange
+}
+
+// ParseExit6Policy parses arguments of "ipv6-policy" line.
+func ParseExit6Policy(s string) (*Exit6Policy, error) {
+	ps, err := ParsePolicySummary(s)
+	if err != nil {
+		return nil, err
+	}
+	return &Exit6Policy{Accept: ps.Accept, Ports: canonicalPortRanges(ps.Ports)}, nil
+}
+
+// Contains reports whether port is listed in the policy.
+func (p *Exit6Policy) Contains(port uint16) bool {
+	for _, r := range p.Ports {
+		if r.Contains(port) {
+			return true
+		}
+	}
+	return false
+}
+
+// Allows reports whether exiting to port over IPv6 is allowed.
+func (p *Exit6Policy) Allows(port uint16) bool {
+	return p.Contains(port) == p.Accept
+}
+
+// String returns canonical encoding of the policy.
+func (p *Exit6Policy) String() string {
+	ps := &PolicySummary{Accept: p.Accept, Ports: canonicalPortRanges(p.Ports)}
+	return ps.String()
+}
+
+// Bytes returns "ipv6-policy" line.
+func (p *Exit6Policy) Bytes() []byte {
+	return []byte("ipv6-policy " + p.String() + "\n")
+}
+
+// ParseORAddress parses address of "or-address" or "a" line like
+// "1.2.3.4:9001" or "[2001:db8::1]:9001". Hostnames are not allowed.
+func ParseORAddress(s string) (*net.TCPAddr, error) {
+	addrPort, err := netip.ParseAddrPort(s)
+	if err != nil {
+		return nil, fmt.Errorf("Malformed OR address: %s", s)
+	}
+	if addrPort.Port() == 0 {
+		return nil, fmt.Errorf("Zero port in OR address: %s", s)
+	}
+	return net.TCPAddrFromAddrPort(addrPort), nil
+}
@@ -0,0 +1,84 @@
+package onionutil
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestPolicy(t *testing.T) {
+	data := []byte("router test 1.2.3.4 9001 0 0\n" +
+		"reject 0.0.0.0/255.0.0.0:*\n" +
+		"accept 1.2.0.0/16:80-443\n" +
+		"reject [2001:db8::]/32:*\n" +
+		"accept *:443\n" +
+		"reject *:*\n")
+	policy, err := ParsePolicy(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(policy) != 5 {
+		t.Fatalf("wrong number of rules: %d", len(policy))
+	}
+	for _, test := range []struct {
+		addr    string
+		port    uint16
+		allowed bool
+	}{
+		{"0.1.2.3", 443, false},
+		{"1.2.3.4", 80, true},
+		{"1.2.3.4", 22, false},
+		{"2001:db8::1", 443, false},
+		{"2001:db9::1", 443, true},
+		{"8.8.8.8", 80, false},
+	} {
+		if policy.Allows(netip.MustParseAddr(test.addr), test.port) != test.allowed {
+			t.Fatalf("wrong decision for %s:%d", test.addr, test.port)
+		}
+	}
+	if policy.String() != "reject 0.0.0.0/8:*\naccept 1.2.0.0/16:80-443\n"+
+		"reject [2001:db8::]/32:*\naccept *:443\nreject *:*\n" {
+		t.Fatalf("wrong encoding: %q", policy.String())
+	}
+}
+
+func TestPolicySummary(t *testing.T) {
+	ps, err := ParsePolicySummary("accept 20-23,80,443")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ps.Allows(22) || !ps.Allows(443) || ps.Allows(8080) {
+		t.Fatal("wrong decision")
+	}
+	if ps.String() != "accept 20-23,80,443" {
+		t.Fatalf("wrong encoding: %q", ps.String())
+	}
+}
+
+func TestExit6Policy(t *testing.T) {
+	p, err := ParseExit6Policy("reject 25,1-24,119,443")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.String() != "reject 1-25,119,443" {
+		t.Fatalf("wrong canonical encoding: %s", p)
+	}
+	if !p.Contains(20) || p.Contains(80) || p.Allows(443) || !p.Allows(80) {
+		t.Fatal("wrong port matching")
+	}
+	if string(p.Bytes()) != "ipv6-policy reject 1-25,119,443\n" {
+		t.Fatalf("wrong line: %q", p.Bytes())
+	}
+}
+
+func TestParseORAddress(t *testing.T) {
+	if _, err := ParseORAddress("example.com:9001"); err == nil {
+		t.Fatal("hostname is accepted")
+	}
+	addr, err := ParseORAddress("[2001:db8::1]:443")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addr.IP.To4() != nil || addr.Port != 443 {
+		t.Fatalf("wrong address: %v", addr)
+	}
+}
@@ -0,0 +1,154 @@
+// protover.go - subprotocol versions of relays
+//
+// To the extent possible under law, Ivan Markin waived all copyright
+// and related or neighboring rights to this module of onionutil, using the creative
+// commons "cc0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package onionutil
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MaxProtocolVersion is the maximum subprotocol version
+// representable by Protover (like in Tor).
+const MaxProtocolVersion = 63
+
+// ProtoHSDirV2 is the HSDir subprotocol version of HSDirs
+// which store v2 onion service descriptors.
+const ProtoHSDirV2 = 1
+
+// Subprotocol versions required for v3 onion services.
+const (
+	ProtoHSDirV3   = 2
+	ProtoHSIntroV3 = 4
+	ProtoHSRendV3  = 2
+)
+
+// Protover is a set of supported subprotocol versions from
+// "proto" line of a router descriptor or "pr" line of
+// a consensus like "HSDir=1-2 Link=1-5". It maps subprotocol
+// names to bitmasks of supported versions.
+type Protover map[string]uint64
+
+func parseProtoVersion(s string) (uint, error) {
+	v, err := strconv.ParseUint(s, 10, 8)
+	if err != nil || v > MaxProtocolVersion {
+		return 0, fmt.Errorf("Malformed protocol version: %s", s)
+	}
+	return uint(v), nil
+}
+
+// ParseProtover parses a list of subprotocol versions.
+func ParseProtover(s string) (Protover, error) {
+	protover := make(Protover)
+	for _, entry := range strings.Fields(s) {
+		kv := strings.SplitN(entry, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("Malformed protocol entry: %s", entry)
+		}
+		if _, ok := protover[kv[0]]; ok {
+			return nil, fmt.Errorf("Duplicate protocol: %s", kv[0])
+		}
+		var versions uint64
+		if kv[1] != "" {
+			for _, r := range strings.Split(kv[1], ",") {
+				bounds := strings.SplitN(r, "-", 2)
+				min, err := parseProtoVersion(bounds[0])
+				if err != nil {
+					return nil, err
+				}
+				max := min
+				if len(bounds) == 2 {
+					max, err = parseProtoVersion(bounds[1])
+					if err != nil {
+						return nil, err
+					}
+				}
+				if min > max {
+					return nil, fmt.Errorf("Malformed protocol versions: %s", r)
+				}
+				for v := min; v <= max; v++ {
+					versions |= 1 << v
+				}
+			}
+		}
+		protover[kv[0]] = versions
+	}
+	return protover, nil
+}
+
+// Supports reports whether version of subprotocol proto is supported.
+func (p Protover) Supports(proto string, version uint) bool {
+	return version <= MaxProtocolVersion && p[proto]&(1<<version) != 0
+}
+
+// SupportsAll reports whether p supports all the versions of required.
+func (p Protover) SupportsAll(required Protover) bool {
+	for proto, versions := range required {
+		if p[proto]&versions != versions {
+			return false
+		}
+	}
+	return true
+}
+
+// SupportsHSDirV3 reports whether relay can be a v3 HSDir.
+func (p Protover) SupportsHSDirV3() bool {
+	return p.Supports("HSDir", ProtoHSDirV3)
+}
+
+// SupportsHSIntroV3 reports whether relay can be a v3 introduction point.
+func (p Protover) SupportsHSIntroV3() bool {
+	return p.Supports("HSIntro", ProtoHSIntroV3)
+}
+
+// SupportsHSRendV3 reports whether relay can be a v3 rendezvous point.
+func (p Protover) SupportsHSRendV3() bool {
+	return p.Supports("HSRend", ProtoHSRendV3)
+}
+
+func formatProtoVersions(versions uint64) string {
+	var ranges []string
+	for v := uint(0); v <= MaxProtocolVersion; v++ {
+		if versions&(1<<v) == 0 {
+			continue
+		}
+		min := v
+		for v < MaxProtocolVersion && versions&(1<<(v+1)) != 0 {
+			v++
+		}
+		if min == v {
+			ranges = append(ranges, strconv.Itoa(int(v)))
+		} else {
+			ranges = append(ranges, fmt.Sprintf("%d-%d", min, v))
+		}
+	}
+	return strings.Join(ranges, ",")
+}
+
+// String returns canonical encoding of p with subprotocols
+// in alphabetical order.
+func (p Protover) String() string {
+	var protos []string
+	for proto := range p {
+		protos = append(protos, proto)
+	}
+	sort.Strings(protos)
+	entries := make([]string, len(protos))
+	for i, proto := range protos {
+		entries[i] = proto + "=" + formatProtoVersions(p[proto])
+	}
+	return strings.Join(entries, " ")
+}
+
+// Protover returns subprotocol versions of the router.
+//
+// Deprecated: use Protocols which is parsed along with the entry.
+func (rs *RouterStatus) Protover() (Protover, error) {
+	return rs.Protocols, nil
+}
@@ -0,0 +1,35 @@
+// protover_test.go - tests for subprotocol versions
+//
+// To the extent possible under law, Ivan Markin waived all copyright
+// and related or neighboring rights to this module of onionutil, using the creative
+// commons "cc0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package onionutil
+
+import (
+	"testing"
+)
+
+func TestProtover(t *testing.T) {
+	p, err := ParseProtover("Link=1-5 HSIntro=3,4 HSDir=1 Relay=1-2,4 Padding=")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.String() != "HSDir=1 HSIntro=3-4 Link=1-5 Padding= Relay=1-2,4" {
+		t.Fatalf("wrong encoding: %s", p)
+	}
+	if !p.SupportsHSIntroV3() || p.SupportsHSDirV3() || p.Supports("Relay", 3) ||
+		p.Supports("Cons", 1) {
+		t.Fatal("wrong support checks")
+	}
+	required, _ := ParseProtover("Link=3-4 Relay=2")
+	if !p.SupportsAll(required) {
+		t.Fatal("required protocols are not supported")
+	}
+	for _, s := range []string{"Link=5-1", "Link=64", "Link=1 Link=2", "=1"} {
+		if _, err := ParseProtover(s); err == nil {
+			t.Fatalf("malformed %q is accepted", s)
+		}
+	}
+}
@@ -8,9 +8,12 @@
 package onionutil
 
 import (
+	"context"
 	"crypto/rsa"
 	"encoding/base64"
-	"log"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"net"
 	"reflect"
 	"strconv"
@@ -25,7 +28,12 @@ var (
 	documentType = "server-descriptor 1.0"
 )
 
-type Descriptor struct {
+// Descriptor is the former name of RouterDescriptor.
+// Deprecated: use RouterDescriptor.
+type Descriptor = RouterDescriptor
+
+// RouterDescriptor is a relay server descriptor.
+type RouterDescriptor struct {
 	Nickname        string
 	InternetAddress net.IP
 	ORPort          uint16
@@ -47,383 +55,501 @@ type Descriptor struct {
 	SigningKey            *rsa.PublicKey
 	HSDirVersions         []uint8
 	Contact               string
-	NTorOnionKey          Curve25519Pubkey
+	NTorOnionKey          NTorOnionKey
 	NTorOnionKeyCrossCert *Certificate
 	ExitPolicy            ExitPolicy
 	Exit6Policy           *Exit6Policy
 	CachesExtraInfo       bool
 	AllowSingleHopExits   bool
+	Family                []string
+	Protocols             Protover
+
+	// Policy is the exit policy with rules in the original order.
+	// It is filled by ParseRouterDescriptors only.
+	Policy Policy
+
+	// Digest is SHA1 digest of the signed part of the descriptor
+	// which is used to refer to it from network status documents.
+	Digest []byte
 
 	RouterSigEd25519 Ed25519Signature
 	RouterSignature  RSASignature
 }
 
 // TODO return a pointer to descs not descs themselves?
+// Deprecated: use ParseRouterDescriptors which also verifies signatures.
 func ParseServerDescriptors(descs_str []byte) (descs []Descriptor, rest string) {
 	docs, _rest := torparse.ParseTorDocument(descs_str)
 	for _, doc := range docs {
-		var desc Descriptor
-		if string(doc["@type"].FJoined()) != documentType {
-			log.Printf("Got a document that is not \"%s\"", documentType)
+		if string(doc.Entries["@type"].FJoined()) != documentType {
 			continue
 		}
-		if value, ok := doc["router"]; ok {
-			if !torparse.ExactlyOnce(value) {
-				goto Broken
-			}
-			routerF := value[0]
-			desc.Nickname = string(routerF[0])
-			desc.InternetAddress = net.ParseIP(string(routerF[1]))
-			ORPort, err := InetPortFromByteString(routerF[2])
-			if err != nil {
-				goto Broken
-			}
-			desc.ORPort = ORPort
-			SOCKSPort, err := InetPortFromByteString(routerF[3])
-			if err != nil {
-				goto Broken
-			}
-			desc.SOCKSPort = SOCKSPort
-			DirPort, err := InetPortFromByteString(routerF[4])
-			if err != nil {
-				goto Broken
-			}
-			desc.DirPort = DirPort
-			desc.ORAddrs = append(desc.ORAddrs,
-				net.TCPAddr{IP: desc.InternetAddress,
-					Port: int(ORPort)})
-		} else {
+		desc, err := parseRouterDescriptor(doc)
+		if err != nil {
+			// if saveBroken ...
+			continue
+		}
+		descs = append(descs, desc)
+	}
+
+	rest = string(_rest)
+	return descs, rest
+}
+
+var errBrokenDescriptor = errors.New("Broken router descriptor")
+
+func parseRouterDescriptor(doc torparse.TorDocument) (desc RouterDescriptor, err error) {
+	if value, ok := doc.Entries["router"]; ok {
+		if !torparse.ExactlyOnce(value) {
+			goto Broken
+		}
+		routerF := value[0]
+		desc.Nickname = string(routerF[0])
+		desc.InternetAddress = net.ParseIP(string(routerF[1]))
+		ORPort, err := InetPortFromByteString(routerF[2])
+		if err != nil {
+			goto Broken
+		}
+		desc.ORPort = ORPort
+		SOCKSPort, err := InetPortFromByteString(routerF[3])
+		if err != nil {
+			goto Broken
+		}
+		desc.SOCKSPort = SOCKSPort
+		DirPort, err := InetPortFromByteString(routerF[4])
+		if err != nil {
 			goto Broken
 		}
+		desc.DirPort = DirPort
+		desc.ORAddrs = append(desc.ORAddrs,
+			net.TCPAddr{IP: desc.InternetAddress,
+				Port: int(ORPort)})
+	} else {
+		goto Broken
+	}
 
-		if value, ok := doc["identity-ed25519"]; ok {
-			if !torparse.AtMostOnce(value) {
-				goto Broken
-			}
-			if len(value[0]) <= 0 {
-				goto Broken
-			}
-			cert, err := ParseCertFromBytes(value[0][0])
-			if err != nil {
-				goto Broken
-			}
-			desc.IdentityEd25519 = &cert
+	if value, ok := doc.Entries["identity-ed25519"]; ok {
+		if !torparse.AtMostOnce(value) {
+			goto Broken
+		}
+		if len(value[0]) <= 0 {
+			goto Broken
+		}
+		cert, err := ParseCertFromBytes(value[0][0])
+		if err != nil {
+			goto Broken
 		}
+		desc.IdentityEd25519 = &cert
+	}
 
-		if value, ok := doc["master-key-ed25519"]; ok {
-			if !torparse.AtMostOnce(value) {
-				goto Broken
-			}
-			var masterKey = make([]byte, Ed25519PubkeySize)
-			n, err := base64.RawStdEncoding.Decode(masterKey, value.FJoined())
-			if err != nil {
-				goto Broken
-			}
-			if n != Ed25519PubkeySize {
+	if value, ok := doc.Entries["master-key-ed25519"]; ok {
+		if !torparse.AtMostOnce(value) {
+			goto Broken
+		}
+		var masterKey = make([]byte, Ed25519PubkeySize)
+		n, err := base64.RawStdEncoding.Decode(masterKey, value.FJoined())
+		if err != nil {
+			goto Broken
+		}
+		if n != Ed25519PubkeySize {
+			goto Broken
+		}
+		if desc.IdentityEd25519 != nil {
+			signedWithEd25519Key := desc.IdentityEd25519.SigningKey()
+			if signedWithEd25519Key != nil &&
+				!reflect.DeepEqual(masterKey, []byte(signedWithEd25519Key)) {
 				goto Broken
 			}
-			signedWithEd25519Key, ok :=
-				desc.IdentityEd25519.Extensions[ExtType(0x04)]
-			if ok {
-				if !reflect.DeepEqual(masterKey, signedWithEd25519Key.Data) {
-					goto Broken
-				}
-			}
-			copy(desc.MasterKeyEd25519[:], masterKey)
 		}
+		copy(desc.MasterKeyEd25519[:], masterKey)
+	}
 
-		if value, ok := doc["bandwidth"]; ok {
-			if !torparse.ExactlyOnce(value) {
-				goto Broken
-			}
-			bandwidth, err := ParseBandwidthEntry(value[0])
-			if err != nil {
-				goto Broken
-			}
-			desc.Bandwidth = bandwidth
-		} else {
+	if value, ok := doc.Entries["bandwidth"]; ok {
+		if !torparse.ExactlyOnce(value) {
+			goto Broken
+		}
+		bandwidth, err := ParseBandwidthEntry(value[0])
+		if err != nil {
 			goto Broken
 		}
+		desc.Bandwidth = bandwidth
+	} else {
+		goto Broken
+	}
 
-		if value, ok := doc["platform"]; ok { //XXX: maybe slow
-			if !torparse.AtMostOnce(value) {
-				goto Broken
-			}
-			platform, err := ParsePlatformEntry(value[0])
-			if err != nil {
-				log.Printf("platerr: %v", err)
-				goto Broken
-			}
-			desc.Platform = platform
+	if value, ok := doc.Entries["platform"]; ok { //XXX: maybe slow
+		if !torparse.AtMostOnce(value) {
+			goto Broken
 		}
+		platform, err := ParsePlatformEntry(value[0])
+		if err != nil {
+			goto Broken
+		}
+		desc.Platform = platform
+	}
 
-		/* Dropping "protocols" field since it's *deprecated*  */
+	/* Dropping "protocols" field since it's *deprecated*  */
 
-		if value, ok := doc["published"]; ok {
-			if !torparse.ExactlyOnce(value) {
-				goto Broken
-			}
-			published, err := time.Parse(PublicationTimeFormat,
-				string(value.FJoined()))
-			if err != nil {
-				goto Broken
-			}
-			desc.Published = published
-		} else {
+	if value, ok := doc.Entries["proto"]; ok {
+		if !torparse.AtMostOnce(value) {
 			goto Broken
 		}
-
-		if value, ok := doc["fingerprint"]; ok {
-			if !torparse.AtMostOnce(value) {
-				goto Broken
-			}
-			fingerprint := string(value.FJoined())
-			desc.Fingerprint = strings.Replace(fingerprint, " ", "", -1)
+		protocols, err := ParseProtover(string(value[0].Joined()))
+		if err != nil {
+			goto Broken
 		}
+		desc.Protocols = protocols
+	}
 
-		if value, ok := doc["hibernating"]; ok {
-			if !torparse.AtMostOnce(value) {
-				goto Broken
-			}
-			desc.Hibernating = ok
+	if value, ok := doc.Entries["published"]; ok {
+		if !torparse.ExactlyOnce(value) {
+			goto Broken
+		}
+		published, err := time.Parse(PublicationTimeFormat,
+			string(value.FJoined()))
+		if err != nil {
+			goto Broken
 		}
+		desc.Published = published
+	} else {
+		goto Broken
+	}
 
-		if value, ok := doc["uptime"]; ok {
-			if !torparse.AtMostOnce(value) {
-				goto Broken
-			}
-			uptime, err := strconv.ParseUint(string(value.FJoined()), 10, 64)
-			if err != nil {
-				goto Broken
-			}
-			desc.Uptime = time.Duration(uptime) * time.Second
+	if value, ok := doc.Entries["fingerprint"]; ok {
+		if !torparse.AtMostOnce(value) {
+			goto Broken
+		}
+		fingerprint := string(value.FJoined())
+		if _, err := ParseFingerprint(fingerprint); err != nil {
+			goto Broken
 		}
+		desc.Fingerprint = strings.Replace(fingerprint, " ", "", -1)
+	}
 
-		if value, ok := doc["extra-info-digest"]; ok {
-			if !torparse.AtMostOnce(value) {
-				goto Broken
-			}
-			desc.ExtraInfoDigest = string(value[0][0])
-			/* Ignore extra data since it it not in dir-spec. *
-			/* See #16227. */
+	if value, ok := doc.Entries["hibernating"]; ok {
+		if !torparse.AtMostOnce(value) {
+			goto Broken
 		}
+		desc.Hibernating = ok
+	}
 
-		if value, ok := doc["onion-key"]; ok {
-			if !torparse.ExactlyOnce(value) {
-				goto Broken
-			}
-			OnionKey, _, err := pkcs1.DecodePublicKeyDER(value.FJoined())
-			if err != nil {
-				goto Broken
-			}
-			desc.OnionKey = OnionKey
-		} else {
+	if value, ok := doc.Entries["uptime"]; ok {
+		if !torparse.AtMostOnce(value) {
+			goto Broken
+		}
+		uptime, err := strconv.ParseUint(string(value.FJoined()), 10, 64)
+		if err != nil {
 			goto Broken
 		}
+		desc.Uptime = time.Duration(uptime) * time.Second
+	}
 
-		if value, ok := doc["signing-key"]; ok {
-			if !torparse.ExactlyOnce(value) {
-				goto Broken
-			}
-			SigningKey, _, err := pkcs1.DecodePublicKeyDER(value.FJoined())
-			if err != nil {
-				goto Broken
-			}
-			desc.SigningKey = SigningKey
-		} else {
+	if value, ok := doc.Entries["extra-info-digest"]; ok {
+		if !torparse.AtMostOnce(value) {
 			goto Broken
 		}
+		desc.ExtraInfoDigest = string(value[0][0])
+		/* Ignore extra data since it it not in dir-spec. *
+		/* See #16227. */
+	}
 
-		if value, ok := doc["onion-key-crosscert"]; ok {
-			crosscert := value.FJoined()
-			identityHash, err := RSAPubkeyHash(desc.SigningKey)
-			if err != nil {
-				goto Broken
-			}
-			crosscertData := append(identityHash,
-				desc.MasterKeyEd25519[:]...)
-			//hashed := Hash(crosscertData)
-			/* XXX(dir-spec): Whoo-sch! We do sign (arbitrary long) *
-			/* data without hashing it. Seriouly? */
-			if err := rsa.VerifyPKCS1v15(desc.OnionKey, 0, crosscertData, crosscert); err != nil {
-				goto Broken
-			}
-			desc.OnionKeyCrosscert = crosscert
-		} else if _, required := doc["identity-ed25519"]; required {
+	if value, ok := doc.Entries["onion-key"]; ok {
+		if !torparse.ExactlyOnce(value) {
+			goto Broken
+		}
+		OnionKey, _, err := pkcs1.DecodePublicKeyDER(value.FJoined())
+		if err != nil {
 			goto Broken
 		}
+		desc.OnionKey = OnionKey
+	} else {
+		goto Broken
+	}
 
-		if value, ok := doc["hidden-service-dir"]; ok {
-			if !torparse.AtMostOnce(value) {
-				goto Broken
-			}
-			if len(value[0]) == 0 {
-				desc.HSDirVersions = []uint8{2}
-			} else {
-				for _, version := range value[0] {
-					hsDescVersion, err := strconv.ParseUint(string(version), 10, 8)
-					if err != nil {
-						goto Broken
-					}
-					desc.HSDirVersions = append(desc.HSDirVersions, uint8(hsDescVersion))
-				}
-			}
+	if value, ok := doc.Entries["signing-key"]; ok {
+		if !torparse.ExactlyOnce(value) {
+			goto Broken
+		}
+		SigningKey, _, err := pkcs1.DecodePublicKeyDER(value.FJoined())
+		if err != nil {
+			goto Broken
 		}
+		desc.SigningKey = SigningKey
+	} else {
+		goto Broken
+	}
 
-		if value, ok := doc["contact"]; ok {
-			if !torparse.AtMostOnce(value) {
-				goto Broken
-			}
-			desc.Contact = string(value.FJoined())
-		} //else { continue } //XXX: slow everything down 10x
+	if value, ok := doc.Entries["onion-key-crosscert"]; ok {
+		crosscert := value.FJoined()
+		identityHash, err := RSAPubkeyHash(desc.SigningKey)
+		if err != nil {
+			goto Broken
+		}
+		crosscertData := append(identityHash,
+			desc.MasterKeyEd25519[:]...)
+		//hashed := Hash(crosscertData)
+		/* XXX(dir-spec): Whoo-sch! We do sign (arbitrary long) *
+		/* data without hashing it. Seriouly? */
+		if err := verifyPKCS1v15(desc.OnionKey, 0, crosscertData, crosscert); err != nil {
+			goto Broken
+		}
+		desc.OnionKeyCrosscert = crosscert
+	} else if _, required := doc.Entries["identity-ed25519"]; required {
+		goto Broken
+	}
 
-		if value, ok := doc["ntor-onion-key"]; ok {
-			if !torparse.AtMostOnce(value) {
-				goto Broken
-			}
-			/* XXX: why do we need +1 here? */
-			var NTorOnionKey = make([]byte, NTorOnionKeySize+1)
-			n, err := base64.StdEncoding.Decode(NTorOnionKey,
-				value.FJoined())
-			if err != nil {
-				n, err = base64.RawStdEncoding.Decode(NTorOnionKey,
-					value.FJoined())
+	if value, ok := doc.Entries["hidden-service-dir"]; ok {
+		if !torparse.AtMostOnce(value) {
+			goto Broken
+		}
+		if len(value[0]) == 0 {
+			desc.HSDirVersions = []uint8{2}
+		} else {
+			for _, version := range value[0] {
+				hsDescVersion, err := strconv.ParseUint(string(version), 10, 8)
 				if err != nil {
 					goto Broken
 				}
+				desc.HSDirVersions = append(desc.HSDirVersions, uint8(hsDescVersion))
 			}
-			if n != NTorOnionKeySize {
-				goto Broken
-			}
-			copy(desc.NTorOnionKey[:], NTorOnionKey)
-		} else if _, required := doc["identity-ed25519"]; required {
+		}
+	}
+
+	if value, ok := doc.Entries["contact"]; ok {
+		if !torparse.AtMostOnce(value) {
 			goto Broken
 		}
+		desc.Contact = string(value.FJoined())
+	} //else { continue } //XXX: slow everything down 10x
 
-		if value, ok := doc["ntor-onion-key-crosscert"]; ok {
-			if !torparse.AtMostOnce(value) {
-				goto Broken
-			}
-			ntorOnionKeyCrossCert, err := ParseCertFromBytes(value[0][1])
-			if err != nil {
-				goto Broken
-			}
-			switch string(value[0][0]) {
-			case "0":
-				ntorOnionKeyCrossCert.PubkeySign = false
-			case "1":
-				ntorOnionKeyCrossCert.PubkeySign = true
-			default:
-				goto Broken
-			}
-			/* TODO: Skipping verification since I've found no */
-			/* Curve25519->Ed25519 implementation in Go. */
-			desc.NTorOnionKeyCrossCert = &ntorOnionKeyCrossCert
-		} else if _, required := doc["identity-ed25519"]; required {
-			goto Broken
-		}
-		// XXX: It doesn't check exit policy validity
-		if entries, ok := doc["reject"]; ok {
-			for _, entry := range entries {
-				desc.ExitPolicy.Reject =
-					append(desc.ExitPolicy.Reject,
-						string(entry.Joined()))
-			}
+	if value, ok := doc.Entries["ntor-onion-key"]; ok {
+		if !torparse.AtMostOnce(value) {
+			goto Broken
 		}
-		// XXX: It doesn't check exit policy validity
-		if entries, ok := doc["accept"]; ok {
-			for _, entry := range entries {
-				desc.ExitPolicy.Accept =
-					append(desc.ExitPolicy.Accept,
-						string(entry.Joined()))
-			}
+		NTorOnionKey, err := ParseNTorOnionKey(value.FJoined())
+		if err != nil {
+			goto Broken
 		}
+		desc.NTorOnionKey = NTorOnionKey
+	} else if _, required := doc.Entries["identity-ed25519"]; required {
+		goto Broken
+	}
 
-		if entries, ok := doc["ipv6-policy"]; ok {
-			if !torparse.AtMostOnce(entries) {
-				goto Broken
-			}
-			var exit6Policy Exit6Policy
-			switch string(entries[0][0]) {
-			case "reject":
-				exit6Policy.Accept = false
-			case "accept":
-				exit6Policy.Accept = true
-			default:
-				goto Broken
-			}
+	if value, ok := doc.Entries["ntor-onion-key-crosscert"]; ok {
+		if !torparse.AtMostOnce(value) {
+			goto Broken
+		}
+		ntorOnionKeyCrossCert, err := ParseCertFromBytes(value[0][1])
+		if err != nil {
+			goto Broken
+		}
+		switch string(value[0][0]) {
+		case "0":
+			ntorOnionKeyCrossCert.PubkeySign = false
+		case "1":
+			ntorOnionKeyCrossCert.PubkeySign = true
+		default:
+			goto Broken
+		}
+		/* TODO: Skipping verification since I've found no */
+		/* Curve25519->Ed25519 implementation in Go. */
+		desc.NTorOnionKeyCrossCert = &ntorOnionKeyCrossCert
+	} else if _, required := doc.Entries["identity-ed25519"]; required {
+		goto Broken
+	}
+	// XXX: It doesn't check exit policy validity
+	if entries, ok := doc.Entries["reject"]; ok {
+		for _, entry := range entries {
+			desc.ExitPolicy.Reject =
+				append(desc.ExitPolicy.Reject,
+					string(entry.Joined()))
+		}
+	}
+	// XXX: It doesn't check exit policy validity
+	if entries, ok := doc.Entries["accept"]; ok {
+		for _, entry := range entries {
+			desc.ExitPolicy.Accept =
+				append(desc.ExitPolicy.Accept,
+					string(entry.Joined()))
+		}
+	}
 
-			for _, port := range entries[0][1:] {
-				exit6Policy.PortList =
-					append(exit6Policy.PortList, string(port))
-			}
-			desc.Exit6Policy = &exit6Policy
+	if entries, ok := doc.Entries["ipv6-policy"]; ok {
+		if !torparse.AtMostOnce(entries) {
+			goto Broken
+		}
+		exit6Policy, err := ParseExit6Policy(string(entries[0].Joined()))
+		if err != nil {
+			goto Broken
 		}
+		desc.Exit6Policy = exit6Policy
+	}
 
-		/* MESSY: Skipping "family" hoping that it will be nuked soon */
+	if value, ok := doc.Entries["family"]; ok {
+		if !torparse.AtMostOnce(value) {
+			goto Broken
+		}
+		for _, member := range value[0] {
+			desc.Family = append(desc.Family, string(member))
+		}
+	}
 
-		if value, ok := doc["router-sig-ed25519"]; ok {
-			if !torparse.AtMostOnce(value) {
-				goto Broken
-			}
-			copy(desc.RouterSigEd25519[:], value.FJoined())
-		} else if _, required := doc["identity-ed25519"]; required {
+	if value, ok := doc.Entries["router-sig-ed25519"]; ok {
+		if !torparse.AtMostOnce(value) {
 			goto Broken
 		}
-		if value, ok := doc["router-signature"]; ok {
-			if !torparse.ExactlyOnce(value) {
-				goto Broken
-			}
-			copy(desc.RouterSignature[:], value.FJoined())
-		} else {
+		if err := decodeBase64Fixed(desc.RouterSigEd25519[:], value.FJoined()); err != nil {
+			goto Broken
+		}
+	} else if _, required := doc.Entries["identity-ed25519"]; required {
+		goto Broken
+	}
+	if value, ok := doc.Entries["router-signature"]; ok {
+		if !torparse.ExactlyOnce(value) {
 			goto Broken
 		}
+		copy(desc.RouterSignature[:], value.FJoined())
+	} else {
+		goto Broken
+	}
 
-		/* Skipping "read-history" and "write-history" due to *
-		 * their nastyness. Sorry, too sensitive. */
+	/* Skipping "read-history" and "write-history" due to *
+	 * their nastyness. Sorry, too sensitive. */
 
-		/* Skip "eventdns" since it's obsolete */
+	/* Skip "eventdns" since it's obsolete */
 
-		if value, ok := doc["caches-extra-info"]; ok {
-			if !torparse.AtMostOnce(value) {
-				goto Broken
-			}
-			if len(value[0]) != 0 {
-				goto Broken
-			}
-			desc.CachesExtraInfo = true
+	if value, ok := doc.Entries["caches-extra-info"]; ok {
+		if !torparse.AtMostOnce(value) {
+			goto Broken
+		}
+		if len(value[0]) != 0 {
+			goto Broken
+		}
+		desc.CachesExtraInfo = true
+	}
+
+	if value, ok := doc.Entries["allow-single-hop-exits"]; ok {
+		if !torparse.AtMostOnce(value) {
+			goto Broken
 		}
+		if len(value[0]) != 0 {
+			goto Broken
+		}
+		desc.AllowSingleHopExits = true
+	}
 
-		if value, ok := doc["allow-single-hop-exits"]; ok {
-			if !torparse.AtMostOnce(value) {
+	if entries, ok := doc.Entries["or-address"]; ok {
+		for _, address := range entries {
+			if len(address) != 1 {
 				goto Broken
 			}
-			if len(value[0]) != 0 {
+			tcpAddr, err := ParseORAddress(string(address[0]))
+			if err != nil {
 				goto Broken
 			}
-			desc.AllowSingleHopExits = true
+			desc.ORAddrs = append(desc.ORAddrs,
+				*tcpAddr)
 		}
+	}
 
-		if entries, ok := doc["or-address"]; ok {
-			for _, address := range entries {
-				tcpAddr, err := net.ResolveTCPAddr("tcp",
-					string(address[0]))
-				if err != nil {
-					goto Broken
-				}
-				desc.ORAddrs = append(desc.ORAddrs,
-					*tcpAddr)
-			}
-		}
+	return desc, nil
+Broken:
+	return desc, errBrokenDescriptor
+}
 
+// Prefix of data signed by router-sig-ed25519 (dir-spec 2.1.1).
+var RouterSigEd25519Prefix = []byte("Tor router descriptor signature v1")
+
+// ParseRouterDescriptors parses server descriptors from data
+// and verifies their signatures. Annotations are ignored.
+// Broken and forged descriptors are skipped.
+func ParseRouterDescriptors(data []byte) (descs []RouterDescriptor) {
+	descs, _ = ParseRouterDescriptorsContext(context.Background(), data)
+	return descs
+}
+
+// ParseRouterDescriptorsContext is like ParseRouterDescriptors but
+// stops parsing once ctx is done and returns ctx.Err().
+func ParseRouterDescriptorsContext(ctx context.Context, data []byte) (descs []RouterDescriptor, err error) {
+	_, sections := splitSections(data, "router")
+	for _, section := range sections {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		desc, err := parseRouterDescriptorSection(section)
+		if err != nil {
+			continue
+		}
 		descs = append(descs, desc)
-		continue
-	Broken:
-		log.Printf("-broken-")
-		// if saveBroken ...
-		continue
 	}
+	return descs, nil
+}
 
-	rest = string(_rest)
-	return descs, rest
+// parseRouterDescriptorSection parses and verifies a single server
+// descriptor including its exit policy.
+func parseRouterDescriptorSection(section []byte) (desc RouterDescriptor, err error) {
+	docs, _ := torparse.ParseTorDocument(section)
+	if len(docs) != 1 {
+		return desc, errors.New("Malformed router descriptor")
+	}
+	desc, err = parseRouterDescriptor(docs[0])
+	if err != nil {
+		return desc, err
+	}
+	if err := desc.verify(docs[0]); err != nil {
+		return desc, err
+	}
+	desc.Policy, err = ParsePolicy(section)
+	return desc, err
+}
+
+// verify checks fingerprint, identity certificate and signatures
+// of desc which is parsed from doc.
+func (desc *RouterDescriptor) verify(doc torparse.TorDocument) error {
+	identityHash, err := RSAPubkeyHash(desc.SigningKey)
+	if err != nil {
+		return err
+	}
+	if desc.Fingerprint != "" &&
+		!strings.EqualFold(desc.Fingerprint, hex.EncodeToString(identityHash)) {
+		return fmt.Errorf("Fingerprint doesn't match signing key")
+	}
+
+	signed := doc.SignedPart("router-signature")
+	if signed == nil {
+		return fmt.Errorf("No router-signature")
+	}
+	desc.Digest = Hash(signed)
+	err = verifyPKCS1v15(desc.SigningKey, 0, desc.Digest,
+		desc.RouterSignature[:])
+	if err != nil {
+		return err
+	}
+
+	if desc.IdentityEd25519 == nil {
+		return nil
+	}
+	if err := desc.IdentityEd25519.Verify(nil); err != nil {
+		return err
+	}
+	edSigned := doc.SignedPart("router-sig-ed25519")
+	if edSigned == nil {
+		return fmt.Errorf("No router-sig-ed25519")
+	}
+	signingKey := desc.IdentityEd25519.CertifiedKey[:]
+	if VerifyWithPrefix(signingKey, SigPrefixRouterDescriptor, edSigned, desc.RouterSigEd25519[:]) != nil {
+		return signatureError("router-sig-ed25519")
+	}
+	return nil
+}
+
+// Verify checks signatures of a descriptor parsed by
+// ParseRouterDescriptors. Since signatures cover the original
+// encoding they are checked during parsing, so Verify only
+// checks that it had happened.
+func (desc *RouterDescriptor) Verify() error {
+	if desc.Digest == nil {
+		return fmt.Errorf("Descriptor signatures were not verified")
+	}
+	return nil
 }
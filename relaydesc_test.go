@@ -0,0 +1,131 @@
+package onionutil
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nogoegst/onionutil/pkcs1"
+	"golang.org/x/crypto/ed25519"
+)
+
+func pemRSAPublicKey(t *testing.T, pk *rsa.PublicKey) []byte {
+	der, err := pkcs1.EncodePublicKeyDER(pk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "RSA PUBLIC KEY", Bytes: der})
+}
+
+// makeRouterDescriptor returns a signed server descriptor with
+// freshly generated keys and the fingerprint of the relay.
+func makeRouterDescriptor(t *testing.T, nickname, extra string) ([]byte, string) {
+	identitySk, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	onionSk, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	masterPk, masterSk, _ := ed25519.GenerateKey(rand.Reader)
+	signingPk, signingSk, _ := ed25519.GenerateKey(rand.Reader)
+	ntorPk := make([]byte, NTorOnionKeySize)
+	rand.Read(ntorPk)
+
+	var certified Ed25519Pubkey
+	copy(certified[:], signingPk)
+	identityCert := NewCertificate(CertTypeIdentitySigning, certified,
+		time.Now().Add(24*time.Hour), masterPk)
+	identityCert.Sign(masterSk)
+
+	identityHash, err := RSAPubkeyHash(&identitySk.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crosscert, err := rsa.SignPKCS1v15(rand.Reader, onionSk, 0,
+		append(identityHash, masterPk...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fp := strings.ToUpper(hex.EncodeToString(identityHash))
+
+	w := new(bytes.Buffer)
+	fmt.Fprintf(w, "router %s 127.0.0.1 9001 0 0\n", nickname)
+	fmt.Fprintf(w, "identity-ed25519\n%s", pem.EncodeToMemory(
+		&pem.Block{Type: "ED25519 CERT", Bytes: identityCert.Bytes()}))
+	fmt.Fprintf(w, "master-key-ed25519 %s\n", base64.RawStdEncoding.EncodeToString(masterPk))
+	fmt.Fprintf(w, "platform Tor 0.3.5.7 on Linux\n")
+	fmt.Fprintf(w, "proto HSDir=1-2 HSIntro=3-4 Link=1-5\n")
+	fmt.Fprintf(w, "published 2019-01-01 00:00:00\n")
+	fmt.Fprintf(w, "fingerprint %s\n", fp)
+	fmt.Fprintf(w, "uptime 100\n")
+	fmt.Fprintf(w, "bandwidth 1000 2000 1500\n")
+	fmt.Fprintf(w, "onion-key\n%s", pemRSAPublicKey(t, &onionSk.PublicKey))
+	fmt.Fprintf(w, "signing-key\n%s", pemRSAPublicKey(t, &identitySk.PublicKey))
+	fmt.Fprintf(w, "onion-key-crosscert\n%s", pem.EncodeToMemory(
+		&pem.Block{Type: "CROSSCERT", Bytes: crosscert}))
+	fmt.Fprintf(w, "ntor-onion-key %s\n", base64.StdEncoding.EncodeToString(ntorPk))
+	fmt.Fprintf(w, "ntor-onion-key-crosscert 0\n%s", pem.EncodeToMemory(
+		&pem.Block{Type: "ED25519 CERT", Bytes: identityCert.Bytes()}))
+	w.WriteString(extra)
+	fmt.Fprintf(w, "reject *:*\n")
+	fmt.Fprintf(w, "router-sig-ed25519 ")
+	h := sha256.New()
+	h.Write(RouterSigEd25519Prefix)
+	h.Write(w.Bytes())
+	edSig := ed25519.Sign(signingSk, h.Sum(nil))
+	fmt.Fprintf(w, "%s\n", base64.RawStdEncoding.EncodeToString(edSig))
+	fmt.Fprintf(w, "router-signature\n")
+	sig, err := rsa.SignPKCS1v15(rand.Reader, identitySk, 0, Hash(w.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(pem.EncodeToMemory(&pem.Block{Type: "SIGNATURE", Bytes: sig}))
+	return w.Bytes(), fp
+}
+
+func TestParseRouterDescriptors(t *testing.T) {
+	first, fp := makeRouterDescriptor(t, "first", "family $0000000000000000000000000000000000000000\n")
+	second, _ := makeRouterDescriptor(t, "second",
+		"or-address [2001:db8::1]:9001\nipv6-policy accept 443,80-81,82\n")
+	data := append([]byte("@type server-descriptor 1.0\n"), first...)
+	data = append(data, "@type server-descriptor 1.0\n"...)
+	data = append(data, second...)
+
+	descs := ParseRouterDescriptors(data)
+	if len(descs) != 2 {
+		t.Fatalf("parsed %d descriptors instead of 2", len(descs))
+	}
+	desc := descs[0]
+	if desc.Nickname != "first" || desc.Fingerprint != fp {
+		t.Fatalf("wrong identity: %s %s", desc.Nickname, desc.Fingerprint)
+	}
+	if len(desc.Family) != 1 || desc.Bandwidth.Observed != 1500 ||
+		!desc.Protocols.SupportsHSDirV3() {
+		t.Fatal("descriptor is parsed incorrectly")
+	}
+	if err := desc.Verify(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(descs[1].ORAddrs) != 2 || descs[1].ORAddrs[1].String() != "[2001:db8::1]:9001" {
+		t.Fatalf("wrong OR addresses: %v", descs[1].ORAddrs)
+	}
+	if p := descs[1].Exit6Policy; p == nil || p.String() != "accept 80-82,443" || !p.Allows(81) {
+		t.Fatalf("wrong IPv6 exit policy: %v", p)
+	}
+
+	forged := bytes.Replace(first, []byte("uptime 100"), []byte("uptime 101"), 1)
+	if descs := ParseRouterDescriptors(forged); len(descs) != 0 {
+		t.Fatal("forged descriptor is accepted")
+	}
+}
@@ -0,0 +1,277 @@
+// relaykeys.go - Ed25519 key hierarchy of relays
+//
+// To the extent possible under law, Ivan Markin waived all copyright
+// and related or neighboring rights to this module of onionutil, using the creative
+// commons "cc0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package onionutil
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/ed25519"
+)
+
+// Names of Ed25519 key files in keys/ subdirectory of relay
+// DataDirectory.
+const (
+	MasterIDSecretKeyFilename = "ed25519_master_id_secret_key"
+	MasterIDPublicKeyFilename = "ed25519_master_id_public_key"
+	SigningSecretKeyFilename  = "ed25519_signing_secret_key"
+	SigningCertFilename       = "ed25519_signing_cert"
+)
+
+// Names of RSA and curve25519 key files in keys/ subdirectory
+// of relay DataDirectory. Previous onion keys are kept in files
+// with ".old" suffix.
+const (
+	SecretIDKeyFilename        = "secret_id_key"
+	SecretOnionKeyFilename     = "secret_onion_key"
+	SecretOnionKeyNTorFilename = "secret_onion_key_ntor"
+)
+
+// SigningCertFileTag is the tag of ed25519_signing_cert file.
+const SigningCertFileTag = "== ed25519v1-cert: type4 =="
+
+// NTorKeyFileTag is the tag of secret_onion_key_ntor file.
+const NTorKeyFileTag = "== c25519v1: onion =="
+
+// DefaultSigningKeyLifetime is the default lifetime of medium-term
+// signing keys (like SigningKeyLifetime option of Tor).
+const DefaultSigningKeyLifetime = 30 * 24 * time.Hour
+
+// RelayKeys is the Ed25519 key hierarchy of a relay: master
+// identity key, medium-term signing key and the certificate
+// of the signing key made with the identity key.
+type RelayKeys struct {
+	MasterID    Ed25519ExpandedKey
+	Signing     Ed25519ExpandedKey
+	SigningCert *Certificate
+}
+
+func generateExpandedKey(rand io.Reader) (esk Ed25519ExpandedKey, err error) {
+	_, sk, err := ed25519.GenerateKey(rand)
+	if err != nil {
+		return esk, err
+	}
+	esk = ExpandEd25519Key(sk)
+	Zeroize(sk)
+	return esk, nil
+}
+
+// GenerateRelayKeys generates master identity key and signing key
+// certified until expiration using rand as the entropy source.
+func GenerateRelayKeys(rand io.Reader, expiration time.Time) (*RelayKeys, error) {
+	master, err := generateExpandedKey(rand)
+	if err != nil {
+		return nil, err
+	}
+	keys := &RelayKeys{MasterID: master}
+	if err := keys.RotateSigningKey(rand, expiration); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// RotateSigningKey replaces the signing key with a new one certified
+// until expiration using rand as the entropy source.
+func (keys *RelayKeys) RotateSigningKey(rand io.Reader, expiration time.Time) error {
+	signing, err := generateExpandedKey(rand)
+	if err != nil {
+		return err
+	}
+	keys.Signing.Zeroize()
+	keys.Signing = signing
+	keys.SigningCert = NewSigningCert(&keys.MasterID, keys.SigningKey(), expiration)
+	return nil
+}
+
+// NewSigningCert returns certificate of type CertTypeIdentitySigning
+// of signing key pk made with master identity key master. The
+// certificate includes signed-with-ed25519-key extension.
+func NewSigningCert(master *Ed25519ExpandedKey, pk Ed25519Pubkey, expiration time.Time) *Certificate {
+	cert := NewCertificate(CertTypeIdentitySigning, pk, expiration, master.Public().(ed25519.PublicKey))
+	copy(cert.Signature[:], master.sign(cert.Body()))
+	return cert
+}
+
+// MasterIDKey returns the master identity public key.
+func (keys *RelayKeys) MasterIDKey() (pk Ed25519Pubkey) {
+	copy(pk[:], keys.MasterID.Public().(ed25519.PublicKey))
+	return pk
+}
+
+// SigningKey returns the signing public key.
+func (keys *RelayKeys) SigningKey() (pk Ed25519Pubkey) {
+	copy(pk[:], keys.Signing.Public().(ed25519.PublicKey))
+	return pk
+}
+
+// Verify checks that the signing certificate certifies the signing
+// key and is signed with the master identity key.
+func (keys *RelayKeys) Verify() error {
+	if keys.SigningCert == nil {
+		return errors.New("No signing certificate")
+	}
+	if keys.SigningCert.CertType != CertTypeIdentitySigning {
+		return errors.New("Wrong type of signing certificate")
+	}
+	if keys.SigningCert.CertifiedKey != keys.SigningKey() {
+		return errors.New("Signing certificate certifies another key")
+	}
+	master := keys.MasterIDKey()
+	return keys.SigningCert.Verify(master.PublicKey())
+}
+
+// Zeroize overwrites the private keys with zeros.
+func (keys *RelayKeys) Zeroize() {
+	keys.MasterID.Zeroize()
+	keys.Signing.Zeroize()
+}
+
+// EncodeSigningCert encodes cert in the format of Tor's
+// ed25519_signing_cert file.
+func EncodeSigningCert(cert *Certificate) []byte {
+	return append(keyFileTag(SigningCertFileTag), cert.Bytes()...)
+}
+
+func DecodeSigningCert(data []byte) (*Certificate, error) {
+	if len(data) < keyFileTagSize {
+		return nil, ErrTruncated
+	}
+	if _, err := decodeTaggedKey(data[:keyFileTagSize], SigningCertFileTag, 0); err != nil {
+		return nil, err
+	}
+	cert, err := ParseCertFromBytesStrict(data[keyFileTagSize:])
+	if err != nil {
+		return nil, err
+	}
+	return &cert, nil
+}
+
+// Save writes the key files into directory dir (keys/ subdirectory
+// of DataDirectory) which must exist.
+func (keys *RelayKeys) Save(dir string) error {
+	err := SaveSecretKeyFileV3(filepath.Join(dir, MasterIDSecretKeyFilename), &keys.MasterID)
+	if err != nil {
+		return err
+	}
+	master := keys.MasterIDKey()
+	err = SavePublicKeyFileV3(filepath.Join(dir, MasterIDPublicKeyFilename), master.PublicKey())
+	if err != nil {
+		return err
+	}
+	err = SaveSecretKeyFileV3(filepath.Join(dir, SigningSecretKeyFilename), &keys.Signing)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, SigningCertFilename), EncodeSigningCert(keys.SigningCert), 0600)
+}
+
+// LoadRelayKeys reads the key files from directory dir (keys/
+// subdirectory of DataDirectory) and verifies them. Relays with
+// offline master identity key are not supported.
+func LoadRelayKeys(dir string) (*RelayKeys, error) {
+	master, err := LoadSecretKeyFileV3(filepath.Join(dir, MasterIDSecretKeyFilename))
+	if err != nil {
+		return nil, err
+	}
+	signing, err := LoadSecretKeyFileV3(filepath.Join(dir, SigningSecretKeyFilename))
+	if err != nil {
+		return nil, err
+	}
+	keys := &RelayKeys{MasterID: *master, Signing: *signing}
+	data, err := ioutil.ReadFile(filepath.Join(dir, SigningCertFilename))
+	if err != nil {
+		return nil, err
+	}
+	if keys.SigningCert, err = DecodeSigningCert(data); err != nil {
+		return nil, err
+	}
+	if err := keys.Verify(); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// EncodeNTorKeypair encodes kp in the format of Tor's
+// secret_onion_key_ntor file.
+func EncodeNTorKeypair(kp *NTorKeypair) []byte {
+	data := append(keyFileTag(NTorKeyFileTag), kp.Private[:]...)
+	return append(data, kp.Public[:]...)
+}
+
+// DecodeNTorKeypair decodes ntor keypair in the format of Tor's
+// secret_onion_key_ntor file and checks that its parts match.
+func DecodeNTorKeypair(data []byte) (*NTorKeypair, error) {
+	key, err := decodeTaggedKey(data, NTorKeyFileTag, 2*Curve25519PubkeySize)
+	if err != nil {
+		return nil, err
+	}
+	kp := new(NTorKeypair)
+	copy(kp.Private[:], key[:32])
+	copy(kp.Public[:], key[32:])
+	var pk [32]byte
+	curve25519.ScalarBaseMult(&pk, &kp.Private)
+	if !bytes.Equal(pk[:], kp.Public[:]) {
+		kp.Zeroize()
+		return nil, errors.New("Public part of ntor key does not match private one")
+	}
+	return kp, nil
+}
+
+func LoadNTorKeypairFile(filename string) (*NTorKeypair, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return DecodeNTorKeypair(data)
+}
+
+func SaveNTorKeypairFile(filename string, kp *NTorKeypair) error {
+	return ioutil.WriteFile(filename, EncodeNTorKeypair(kp), 0600)
+}
+
+// RelayLegacyKeys are RSA identity key, TAP onion key and ntor
+// onion key of a relay.
+type RelayLegacyKeys struct {
+	Identity *rsa.PrivateKey
+	Onion    *rsa.PrivateKey
+	NTor     *NTorKeypair
+}
+
+// LoadRelayLegacyKeys reads secret_id_key, secret_onion_key and
+// secret_onion_key_ntor files from directory dir (keys/ subdirectory
+// of DataDirectory). Missing onion key files are skipped since
+// recent versions of Tor do not keep the TAP onion key.
+func LoadRelayLegacyKeys(dir string) (*RelayLegacyKeys, error) {
+	keys := new(RelayLegacyKeys)
+	var err error
+	keys.Identity, err = LoadPrivateKeyFileV2(filepath.Join(dir, SecretIDKeyFilename))
+	if err != nil {
+		return nil, err
+	}
+	keys.Onion, err = LoadPrivateKeyFileV2(filepath.Join(dir, SecretOnionKeyFilename))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	keys.NTor, err = LoadNTorKeypairFile(filepath.Join(dir, SecretOnionKeyNTorFilename))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// Fingerprint returns fingerprint of the identity key.
+func (keys *RelayLegacyKeys) Fingerprint() (Fingerprint, error) {
+	return NewFingerprint(&keys.Identity.PublicKey)
+}
@@ -0,0 +1,104 @@
+package onionutil
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRelayKeys(t *testing.T) {
+	expiration := time.Now().Add(DefaultSigningKeyLifetime)
+	keys, err := GenerateRelayKeys(rand.Reader, expiration)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := keys.Verify(); err != nil {
+		t.Fatal(err)
+	}
+	master := keys.MasterIDKey()
+	if !bytes.Equal(keys.SigningCert.SigningKey(), master[:]) {
+		t.Fatal("Signing certificate has no master identity key")
+	}
+
+	dir, err := ioutil.TempDir("", "relaykeys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := keys.Save(dir); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, SigningCertFilename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(data, []byte(SigningCertFileTag+"\x00")) {
+		t.Fatal("Wrong tag of signing certificate file")
+	}
+	loaded, err := LoadRelayKeys(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.MasterIDKey() != master || loaded.SigningKey() != keys.SigningKey() {
+		t.Fatal("Loaded keys differ from saved ones")
+	}
+
+	prev := keys.SigningKey()
+	if err := keys.RotateSigningKey(rand.Reader, expiration); err != nil {
+		t.Fatal(err)
+	}
+	if keys.SigningKey() == prev || keys.Verify() != nil {
+		t.Fatal("Signing key rotation failed")
+	}
+	keys.SigningCert = loaded.SigningCert
+	if err := keys.Verify(); err == nil {
+		t.Fatal("Certificate of another signing key has been accepted")
+	}
+}
+
+func TestLoadRelayLegacyKeys(t *testing.T) {
+	identity, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ntor, err := GenerateNTorKeypair(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "relaykeys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := SavePrivateKeyFileV2(filepath.Join(dir, SecretIDKeyFilename), identity); err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveNTorKeypairFile(filepath.Join(dir, SecretOnionKeyNTorFilename), ntor); err != nil {
+		t.Fatal(err)
+	}
+	keys, err := LoadRelayLegacyKeys(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys.Onion != nil || keys.NTor == nil || keys.NTor.Public != ntor.Public {
+		t.Fatal("Wrong onion keys have been loaded")
+	}
+	fp, err := keys.Fingerprint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, _ := NewFingerprint(&identity.PublicKey); fp != want {
+		t.Fatal("Wrong fingerprint of loaded identity key")
+	}
+
+	data := EncodeNTorKeypair(ntor)
+	data[len(data)-1] ^= 1
+	if _, err := DecodeNTorKeypair(data); err == nil {
+		t.Fatal("Mismatching ntor keypair has been accepted")
+	}
+}
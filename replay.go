@@ -0,0 +1,160 @@
+// replay.go - detection of replayed onion service descriptors
+//
+// To the extent possible under law, Ivan Markin waived all copyright
+// and related or neighboring rights to this module of onionutil, using the creative
+// commons "cc0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package onionutil
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var ErrDescriptorReplayed = errors.New("descriptor is replayed")
+
+// Freshness is the relation of a descriptor to the ones
+// with the same ID seen before.
+type Freshness int
+
+const (
+	// DescriptorUnseen means that no unexpired descriptor
+	// with the same ID was seen.
+	DescriptorUnseen Freshness = iota
+	// DescriptorFresher means that the descriptor is newer
+	// than the seen one.
+	DescriptorFresher
+	// DescriptorReplayed means that a descriptor with the same
+	// revision counter (v3) or publication time (v2) was seen.
+	DescriptorReplayed
+	// DescriptorStale means that a newer descriptor was seen.
+	DescriptorStale
+)
+
+var freshnessNames = []string{
+	DescriptorUnseen:   "unseen",
+	DescriptorFresher:  "fresher",
+	DescriptorReplayed: "replayed",
+	DescriptorStale:    "stale",
+}
+
+func (f Freshness) String() string {
+	if f < 0 || int(f) >= len(freshnessNames) {
+		return fmt.Sprintf("Freshness(%d)", int(f))
+	}
+	return freshnessNames[f]
+}
+
+// Accepted reports whether a descriptor should replace the seen one.
+func (f Freshness) Accepted() bool {
+	return f == DescriptorUnseen || f == DescriptorFresher
+}
+
+// Err returns ErrDescriptorReplayed or ErrDescriptorNotNewer for
+// descriptors which are not accepted and nil otherwise.
+func (f Freshness) Err() error {
+	switch f {
+	case DescriptorReplayed:
+		return ErrDescriptorReplayed
+	case DescriptorStale:
+		return ErrDescriptorNotNewer
+	}
+	return nil
+}
+
+type seenDescriptor struct {
+	revision uint64
+	expires  time.Time
+}
+
+// ReplayCache tracks IDs of descriptors along with their revisions
+// (revision counters of v3 descriptors or publication times of v2
+// ones) until the descriptors expire. IDs are the same as
+// of StoredDescriptor.
+type ReplayCache struct {
+	mu   sync.Mutex
+	seen map[string]seenDescriptor
+}
+
+func NewReplayCache() *ReplayCache {
+	return &ReplayCache{seen: make(map[string]seenDescriptor)}
+}
+
+func (c *ReplayCache) check(id string, revision uint64, now time.Time) Freshness {
+	s, ok := c.seen[id]
+	switch {
+	case !ok || now.After(s.expires):
+		return DescriptorUnseen
+	case revision > s.revision:
+		return DescriptorFresher
+	case revision == s.revision:
+		return DescriptorReplayed
+	default:
+		return DescriptorStale
+	}
+}
+
+// Check returns freshness of descriptor with ID id and revision
+// revision without recording it.
+func (c *ReplayCache) Check(id string, revision uint64) Freshness {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.check(id, revision, time.Now())
+}
+
+// Observe returns freshness of descriptor with ID id and revision
+// revision and records it until expires if it's accepted.
+func (c *ReplayCache) Observe(id string, revision uint64, expires time.Time) Freshness {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	f := c.check(id, revision, time.Now())
+	if f.Accepted() {
+		c.seen[id] = seenDescriptor{revision: revision, expires: expires}
+	}
+	return f
+}
+
+// ObserveV2 observes v2 descriptor desc which expires
+// DescriptorMaxAgeV2 after its publication.
+func (c *ReplayCache) ObserveV2(desc *OnionDescriptor) Freshness {
+	return c.Observe(Base32Encode(desc.DescID), uint64(desc.PublicationTime.Unix()),
+		desc.PublicationTime.Add(DescriptorMaxAgeV2))
+}
+
+// ObserveV3 observes v3 descriptor desc which expires
+// after its lifetime since now.
+func (c *ReplayCache) ObserveV3(desc *OnionDescriptorV3) Freshness {
+	return c.Observe(base64.StdEncoding.EncodeToString(desc.BlindedKey()),
+		desc.RevisionCounter, time.Now().Add(desc.Lifetime))
+}
+
+// ObserveStored observes stored descriptor sd.
+func (c *ReplayCache) ObserveStored(sd *StoredDescriptor) Freshness {
+	revision := sd.RevisionCounter
+	if sd.Version == 2 {
+		revision = uint64(sd.Published.Unix())
+	}
+	return c.Observe(sd.ID, revision, sd.Expires)
+}
+
+// Len returns number of tracked IDs including expired ones.
+func (c *ReplayCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.seen)
+}
+
+// Expire forgets all descriptors expired by now.
+func (c *ReplayCache) Expire(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for id, s := range c.seen {
+		if now.After(s.expires) {
+			delete(c.seen, id)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package onionutil
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReplayCache(t *testing.T) {
+	c := NewReplayCache()
+	expires := time.Now().Add(time.Hour)
+	for _, tc := range []struct {
+		id       string
+		revision uint64
+		want     Freshness
+	}{
+		{"a", 5, DescriptorUnseen},
+		{"a", 5, DescriptorReplayed},
+		{"a", 4, DescriptorStale},
+		{"a", 6, DescriptorFresher},
+		{"a", 5, DescriptorStale},
+		{"b", 1, DescriptorUnseen},
+	} {
+		if f := c.Observe(tc.id, tc.revision, expires); f != tc.want {
+			t.Fatalf("%s/%d: got %v, expected %v", tc.id, tc.revision, f, tc.want)
+		}
+	}
+	if f := c.Check("a", 7); f != DescriptorFresher {
+		t.Fatalf("got %v", f)
+	}
+	if f := c.Check("a", 7); f.Err() != nil {
+		t.Fatal("checked descriptor is recorded")
+	}
+	if err := c.Observe("a", 6, expires).Err(); err != ErrDescriptorReplayed {
+		t.Fatalf("got %v", err)
+	}
+
+	sd := &StoredDescriptor{ID: "v2", Version: 2, Published: time.Now(), Expires: expires}
+	c.ObserveStored(sd)
+	if f := c.ObserveStored(sd); f != DescriptorReplayed {
+		t.Fatalf("got %v", f)
+	}
+	c.Observe("old", 1, time.Now().Add(-time.Second))
+	if f := c.Observe("old", 1, expires); f != DescriptorUnseen {
+		t.Fatalf("expired descriptor is %v", f)
+	}
+	c.Expire(expires.Add(time.Second))
+	if c.Len() != 0 {
+		t.Fatalf("%d descriptors are left", c.Len())
+	}
+}
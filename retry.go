@@ -0,0 +1,179 @@
+// retry.go - retries, backoff and failover for network operations
+//
+// To the extent possible under law, Ivan Markin waived all copyright
+// and related or neighboring rights to this module of onionutil, using the creative
+// commons "cc0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package onionutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Attempt describes a single try of an operation against a target
+// (HSDir, directory mirror etc.).
+type Attempt struct {
+	// Number of the attempt starting from 1.
+	Number int
+	// Target the attempt was made against.
+	Target string
+	// Duration of the attempt.
+	Duration time.Duration
+	// Err is the result of the attempt.
+	Err error
+	// Backoff is the delay before the next attempt. It is zero
+	// if there will be no more attempts.
+	Backoff time.Duration
+}
+
+// RetryPolicy controls how operations are retried and how targets
+// are failed over.
+type RetryPolicy struct {
+	// MaxAttempts limits total number of attempts over all targets.
+	// Zero means one attempt per target.
+	MaxAttempts int
+	// InitialBackoff is the delay after the first failed attempt.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the delay between attempts.
+	MaxBackoff time.Duration
+	// Multiplier is applied to backoff after each failed attempt.
+	// Values less than 1 are treated as 1.
+	Multiplier float64
+	// Budget limits total time spent in all attempts and delays.
+	// Zero means no limit.
+	Budget time.Duration
+	// OnAttempt, if not nil, is called after each attempt.
+	OnAttempt func(Attempt)
+}
+
+// DefaultRetryPolicy is used by network clients unless another
+// policy is specified.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    6,
+	InitialBackoff: 1 * time.Second,
+	MaxBackoff:     30 * time.Second,
+	Multiplier:     2,
+	Budget:         2 * time.Minute,
+}
+
+var ErrRetryBudgetExceeded = errors.New("retry budget exceeded")
+
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e permanentError) Unwrap() error {
+	return e.err
+}
+
+// PermanentError marks err as the one that should not be retried
+// against any target. It may be wrapped by other errors.
+func PermanentError(err error) error {
+	return permanentError{err}
+}
+
+// Do calls op against targets in round-robin order until it
+// succeeds, attempts are exhausted or the budget is exceeded.
+// The error of the last attempt is returned.
+func (p *RetryPolicy) Do(targets []string, op func(target string) error) error {
+	return p.DoContext(context.Background(), targets,
+		func(ctx context.Context, target string) error {
+			return op(target)
+		})
+}
+
+// DoContext is like Do but stops retrying once ctx is done.
+// ctx is passed to op. If the policy has a budget, ctx passed
+// to op is cancelled once the budget is exceeded.
+func (p *RetryPolicy) DoContext(ctx context.Context, targets []string, op func(ctx context.Context, target string) error) error {
+	if len(targets) == 0 {
+		return errors.New("no targets to try")
+	}
+	maxAttempts := p.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = len(targets)
+	}
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+	parent := ctx
+	if p.Budget > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.Budget)
+		defer cancel()
+	}
+	/* Budget is exceeded if ctx is done but parent is not */
+	doneErr := func(err error) error {
+		ctxErr := parent.Err()
+		if ctxErr == nil {
+			ctxErr = ErrRetryBudgetExceeded
+		}
+		if err == nil {
+			return ctxErr
+		}
+		return fmt.Errorf("%w: %w", ctxErr, err)
+	}
+	start := time.Now()
+	backoff := p.InitialBackoff
+	var err error
+	for n := 1; n <= maxAttempts; n++ {
+		if ctx.Err() != nil {
+			return doneErr(err)
+		}
+		a := Attempt{Number: n, Target: targets[(n-1)%len(targets)]}
+		attemptStart := time.Now()
+		err = op(ctx, a.Target)
+		a.Duration = time.Since(attemptStart)
+		a.Err = err
+		var perr permanentError
+		if errors.As(err, &perr) {
+			if direct, ok := err.(permanentError); ok {
+				err = direct.err
+				a.Err = err
+			}
+			p.observe(a)
+			return err
+		}
+		if err == nil || n == maxAttempts {
+			p.observe(a)
+			return err
+		}
+		if ctx.Err() != nil {
+			p.observe(a)
+			return doneErr(err)
+		}
+		if p.MaxBackoff > 0 && backoff > p.MaxBackoff {
+			backoff = p.MaxBackoff
+		}
+		if p.Budget > 0 && time.Since(start)+backoff >= p.Budget {
+			p.observe(a)
+			return fmt.Errorf("%w: %w", ErrRetryBudgetExceeded, err)
+		}
+		a.Backoff = backoff
+		p.observe(a)
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return doneErr(err)
+		}
+		backoff = time.Duration(float64(backoff) * multiplier)
+	}
+	return err
+}
+
+func (p *RetryPolicy) observe(a Attempt) {
+	if p.OnAttempt != nil {
+		p.OnAttempt(a)
+	}
+}
@@ -0,0 +1,168 @@
+package onionutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyDoContext(t *testing.T) {
+	p := &RetryPolicy{MaxAttempts: 10, InitialBackoff: time.Hour}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	attempts := 0
+	start := time.Now()
+	err := p.DoContext(ctx, []string{"a", "b"}, func(ctx context.Context, target string) error {
+		attempts++
+		return errors.New("failed")
+	})
+	if err == nil || attempts != 1 {
+		t.Fatalf("expected single failed attempt, got %d: %v", attempts, err)
+	}
+	if time.Since(start) > time.Minute {
+		t.Fatal("backoff is not interrupted")
+	}
+}
+
+func TestRetryPolicyDo(t *testing.T) {
+	errFailed := errors.New("failed")
+	errFatal := errors.New("fatal")
+	ms := time.Millisecond
+	for _, tt := range []struct {
+		name    string
+		policy  RetryPolicy
+		targets []string
+		// results are returned by op in turn, the last one repeats.
+		results  []error
+		attempts []Attempt
+		err      error
+	}{
+		{
+			name:    "round-robin",
+			policy:  RetryPolicy{MaxAttempts: 5, InitialBackoff: ms},
+			targets: []string{"a", "b", "c"},
+			results: []error{errFailed},
+			attempts: []Attempt{
+				{Number: 1, Target: "a", Err: errFailed, Backoff: ms},
+				{Number: 2, Target: "b", Err: errFailed, Backoff: ms},
+				{Number: 3, Target: "c", Err: errFailed, Backoff: ms},
+				{Number: 4, Target: "a", Err: errFailed, Backoff: ms},
+				{Number: 5, Target: "b", Err: errFailed},
+			},
+			err: errFailed,
+		},
+		{
+			name:    "attempt per target",
+			policy:  RetryPolicy{InitialBackoff: ms},
+			targets: []string{"a", "b"},
+			results: []error{errFailed},
+			attempts: []Attempt{
+				{Number: 1, Target: "a", Err: errFailed, Backoff: ms},
+				{Number: 2, Target: "b", Err: errFailed},
+			},
+			err: errFailed,
+		},
+		{
+			name:    "capped backoff",
+			policy:  RetryPolicy{MaxAttempts: 6, InitialBackoff: ms, MaxBackoff: 5 * ms, Multiplier: 2},
+			targets: []string{"a"},
+			results: []error{errFailed},
+			attempts: []Attempt{
+				{Number: 1, Target: "a", Err: errFailed, Backoff: ms},
+				{Number: 2, Target: "a", Err: errFailed, Backoff: 2 * ms},
+				{Number: 3, Target: "a", Err: errFailed, Backoff: 4 * ms},
+				{Number: 4, Target: "a", Err: errFailed, Backoff: 5 * ms},
+				{Number: 5, Target: "a", Err: errFailed, Backoff: 5 * ms},
+				{Number: 6, Target: "a", Err: errFailed},
+			},
+			err: errFailed,
+		},
+		{
+			name:    "success",
+			policy:  RetryPolicy{MaxAttempts: 5, InitialBackoff: ms},
+			targets: []string{"a", "b"},
+			results: []error{errFailed, errFailed, nil},
+			attempts: []Attempt{
+				{Number: 1, Target: "a", Err: errFailed, Backoff: ms},
+				{Number: 2, Target: "b", Err: errFailed, Backoff: ms},
+				{Number: 3, Target: "a"},
+			},
+		},
+		{
+			name:    "permanent error",
+			policy:  RetryPolicy{MaxAttempts: 5, InitialBackoff: ms},
+			targets: []string{"a", "b"},
+			results: []error{errFailed, PermanentError(errFatal)},
+			attempts: []Attempt{
+				{Number: 1, Target: "a", Err: errFailed, Backoff: ms},
+				{Number: 2, Target: "b", Err: errFatal},
+			},
+			err: errFatal,
+		},
+		{
+			name:    "budget",
+			policy:  RetryPolicy{MaxAttempts: 5, InitialBackoff: 10 * ms, Multiplier: 10, Budget: 100 * ms},
+			targets: []string{"a", "b"},
+			results: []error{errFailed},
+			attempts: []Attempt{
+				{Number: 1, Target: "a", Err: errFailed, Backoff: 10 * ms},
+				{Number: 2, Target: "b", Err: errFailed},
+			},
+			err: ErrRetryBudgetExceeded,
+		},
+	} {
+		var attempts []Attempt
+		tt.policy.OnAttempt = func(a Attempt) {
+			a.Duration = 0
+			attempts = append(attempts, a)
+		}
+		n := 0
+		err := tt.policy.Do(tt.targets, func(target string) error {
+			err := tt.results[len(tt.results)-1]
+			if n < len(tt.results) {
+				err = tt.results[n]
+			}
+			n++
+			return err
+		})
+		if (tt.err == nil) != (err == nil) || !errors.Is(err, tt.err) {
+			t.Fatalf("%s: wrong error: %v", tt.name, err)
+		}
+		if !reflect.DeepEqual(attempts, tt.attempts) {
+			t.Fatalf("%s: wrong attempts: %+v", tt.name, attempts)
+		}
+	}
+}
+
+func TestRetryPolicyWrappedPermanentError(t *testing.T) {
+	errFatal := errors.New("fatal")
+	p := &RetryPolicy{MaxAttempts: 5, InitialBackoff: time.Millisecond}
+	attempts := 0
+	err := p.Do([]string{"a"}, func(target string) error {
+		attempts++
+		return fmt.Errorf("fetching from %s: %w", target, PermanentError(errFatal))
+	})
+	if attempts != 1 || !errors.Is(err, errFatal) {
+		t.Fatalf("wrapped permanent error is retried: %d attempts, %v", attempts, err)
+	}
+}
+
+func TestRetryPolicyBudgetCancelsOp(t *testing.T) {
+	p := &RetryPolicy{MaxAttempts: 5, InitialBackoff: time.Millisecond, Budget: 20 * time.Millisecond}
+	attempts := 0
+	start := time.Now()
+	err := p.DoContext(context.Background(), []string{"a"}, func(ctx context.Context, target string) error {
+		attempts++
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	if !errors.Is(err, ErrRetryBudgetExceeded) || attempts != 1 {
+		t.Fatalf("hung operation: %d attempts, %v", attempts, err)
+	}
+	if time.Since(start) > time.Minute {
+		t.Fatal("hung operation is not cancelled")
+	}
+}
@@ -0,0 +1,229 @@
+// routerstatus.go - router status entries of network status documents
+//
+// To the extent possible under law, Ivan Markin waived all copyright
+// and related or neighboring rights to this module of onionutil, using the creative
+// commons "cc0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package onionutil
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nogoegst/onionutil/torparse"
+)
+
+// RouterStatus is a router entry of a consensus.
+type RouterStatus struct {
+	Nickname string
+	// Identity is the RSA identity digest of the router.
+	Identity []byte
+	// Digest is the digest of router descriptor. It is empty
+	// in microdescriptor consensuses.
+	Digest          []byte
+	Published       time.Time
+	Address         net.IP
+	ORPort          uint16
+	DirPort         uint16
+	ORAddrs         []net.TCPAddr
+	Flags           Flags
+	Version         string
+	Protocols       Protover
+	Bandwidth       uint64
+	PolicySummary   *PolicySummary
+	MicrodescDigest []byte
+
+	// Measured is the bandwidth measured by bandwidth
+	// authorities (in votes only).
+	Measured uint64
+	// Unmeasured is set if Bandwidth is not based on
+	// measurements of bandwidth authorities.
+	Unmeasured bool
+}
+
+func parseRouterStatusEntry(rE torparse.TorEntry, microdesc bool) (rs RouterStatus, err error) {
+	n := 8
+	if microdesc {
+		n = 7
+	}
+	if len(rE) != n {
+		return rs, fmt.Errorf("Wrong number of router status arguments")
+	}
+	rs.Nickname = string(rE[0])
+	rs.Identity, err = decodeBase64(rE[1])
+	if err != nil {
+		return rs, err
+	}
+	i := 2
+	if !microdesc {
+		rs.Digest, err = decodeBase64(rE[2])
+		if err != nil {
+			return rs, err
+		}
+		i++
+	}
+	rs.Published, err = parseDocumentTime(rE[i : i+2])
+	if err != nil {
+		return rs, err
+	}
+	rs.Address = net.ParseIP(string(rE[i+2]))
+	if rs.Address == nil {
+		return rs, fmt.Errorf("Invalid router address")
+	}
+	rs.ORPort, err = InetPortFromByteString(rE[i+3])
+	if err != nil {
+		return rs, err
+	}
+	rs.DirPort, err = InetPortFromByteString(rE[i+4])
+	if err != nil {
+		return rs, err
+	}
+	rs.ORAddrs = append(rs.ORAddrs, net.TCPAddr{IP: rs.Address, Port: int(rs.ORPort)})
+	return rs, nil
+}
+
+// parseRouterStatusItem fills a field of rs from an item
+// of a router status entry.
+func parseRouterStatusItem(rs *RouterStatus, field string, content torparse.TorEntry) error {
+	switch field {
+	case "a":
+		if len(content) != 1 {
+			return fmt.Errorf("Malformed \"a\" line")
+		}
+		addr, err := ParseORAddress(string(content[0]))
+		if err != nil {
+			return err
+		}
+		rs.ORAddrs = append(rs.ORAddrs, *addr)
+	case "s":
+		for _, flag := range content {
+			f, _ := FlagByName(string(flag))
+			rs.Flags |= f
+		}
+	case "v":
+		rs.Version = string(content.Joined())
+	case "pr":
+		protocols, err := ParseProtover(string(content.Joined()))
+		if err != nil {
+			return err
+		}
+		rs.Protocols = protocols
+	case "w":
+		weights, err := parseKeywordArgs(content)
+		if err != nil {
+			return err
+		}
+		rs.Bandwidth = uint64(weights["Bandwidth"])
+		rs.Measured = uint64(weights["Measured"])
+		rs.Unmeasured = weights["Unmeasured"] == 1
+	case "p":
+		summary, err := ParsePolicySummary(string(content.Joined()))
+		if err != nil {
+			return err
+		}
+		rs.PolicySummary = summary
+	case "m":
+		if len(content) < 1 {
+			return fmt.Errorf("Malformed \"m\" line")
+		}
+		digest, err := decodeBase64(content[0])
+		if err != nil {
+			return err
+		}
+		rs.MicrodescDigest = digest
+	}
+	return nil
+}
+
+// ParseRouterStatus parses a single router status entry starting
+// with "r" line of a full or microdescriptor consensus.
+func ParseRouterStatus(data []byte) (*RouterStatus, error) {
+	var rs *RouterStatus
+	line := 1
+	for {
+		field, content, rest, err := torparse.ParseOutNextField(data)
+		if err != nil {
+			break
+		}
+		itemLine := line
+		line += bytes.Count(data[:len(data)-len(rest)], []byte("\n"))
+		data = rest
+		if rs == nil {
+			if field != "r" {
+				return nil, fmt.Errorf("Router status entry doesn't start with \"r\" line")
+			}
+			status, err := parseRouterStatusEntry(content, len(content) == 7)
+			if err != nil {
+				return nil, &ParseError{Line: itemLine, Keyword: field, Err: err}
+			}
+			rs = &status
+			continue
+		}
+		if field == "r" {
+			return nil, fmt.Errorf("More than one router status entry")
+		}
+		if err := parseRouterStatusItem(rs, field, content); err != nil {
+			return nil, &ParseError{Line: itemLine, Keyword: field, Err: err}
+		}
+	}
+	if rs == nil {
+		return nil, fmt.Errorf("Empty router status entry")
+	}
+	return rs, nil
+}
+
+// Encode returns encoding of the router status entry as in
+// consensuses. It's of a microdescriptor consensus if Digest is
+// empty. Unknown flags and items are not preserved.
+func (rs *RouterStatus) Encode() ([]byte, error) {
+	r := []string{rs.Nickname, base64.RawStdEncoding.EncodeToString(rs.Identity)}
+	if len(rs.Digest) != 0 {
+		r = append(r, base64.RawStdEncoding.EncodeToString(rs.Digest))
+	}
+	r = append(r, strings.Fields(rs.Published.UTC().Format(PublicationTimeFormat))...)
+	r = append(r, rs.Address.String(), strconv.Itoa(int(rs.ORPort)), strconv.Itoa(int(rs.DirPort)))
+	d := torparse.NewDocument()
+	d.Item("r", r...)
+	for i, addr := range rs.ORAddrs {
+		/* The first one is from "r" line */
+		if i == 0 && addr.IP.Equal(rs.Address) && addr.Port == int(rs.ORPort) {
+			continue
+		}
+		d.Item("a", addr.String())
+	}
+	if len(rs.MicrodescDigest) != 0 {
+		d.Item("m", base64.RawStdEncoding.EncodeToString(rs.MicrodescDigest))
+	}
+	d.Item("s", rs.Flags.Names()...)
+	if rs.Version != "" {
+		d.Item("v", strings.Fields(rs.Version)...)
+	}
+	if len(rs.Protocols) != 0 {
+		d.Item("pr", strings.Fields(rs.Protocols.String())...)
+	}
+	w := []string{"Bandwidth=" + strconv.FormatUint(rs.Bandwidth, 10)}
+	if rs.Measured != 0 {
+		w = append(w, "Measured="+strconv.FormatUint(rs.Measured, 10))
+	}
+	if rs.Unmeasured {
+		w = append(w, "Unmeasured=1")
+	}
+	d.Item("w", w...)
+	if rs.PolicySummary != nil {
+		d.Item("p", strings.Fields(rs.PolicySummary.String())...)
+	}
+	return d.Bytes()
+}
+
+// Bytes returns encoding of the router status entry or nil
+// if it can't be encoded.
+func (rs *RouterStatus) Bytes() []byte {
+	b, _ := rs.Encode()
+	return b
+}
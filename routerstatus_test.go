@@ -0,0 +1,64 @@
+package onionutil
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRouterStatusBytes(t *testing.T) {
+	for _, entry := range []string{
+		`r CalyxInstitute14 ABG9JIWtRdmE7EFZyI/AZuXjMA4 2019-01-02 02:42:37 162.247.74.201 443 80
+a [2620:18c:0:192::201]:443
+m 8ufHyjrelQdkOk9G2hA8ZzuV9ZrvKPmJzPyMdnrGfdc
+s Exit Fast Guard HSDir Running Stable V2Dir Valid
+v Tor 0.3.4.9
+w Bandwidth=8770
+`,
+		`r seele AAoQ1DAR6kkoo19hBAX5K0QztNw HoeI3tr4gKe7zkFwvD4qiKxDdSw 2019-01-02 00:20:24 67.174.243.193 9001 0
+s Running Stable V2Dir Valid
+v Tor 0.3.5.7
+pr Cons=1-2 Desc=1-2 HSDir=1-2
+w Bandwidth=30 Unmeasured=1
+p accept 80,443
+`,
+	} {
+		rs, err := ParseRouterStatus([]byte(entry))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(rs.Bytes(), []byte(entry)) {
+			t.Fatalf("wrong encoding:\n%s", rs.Bytes())
+		}
+	}
+	rs, err := ParseRouterStatus([]byte("r seele AAoQ1DAR6kkoo19hBAX5K0QztNw HoeI3tr4gKe7zkFwvD4qiKxDdSw 2019-01-02 00:20:24 67.174.243.193 9001 0\ns Exit HSDir\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rs.Digest) != 20 || !rs.Flags.Has(FlagHSDir) || rs.ORPort != 9001 {
+		t.Fatalf("wrong router status: %+v", rs)
+	}
+	rs, err = ParseRouterStatus([]byte("r seele AAoQ1DAR6kkoo19hBAX5K0QztNw 2019-01-02 00:20:24 67.174.243.193 9001 0\n" +
+		"pr HSDir=2,1 Cons=1-2\nw Bandwidth=30\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rs.Protocols.SupportsHSDirV3() {
+		t.Fatalf("wrong protocols: %v", rs.Protocols)
+	}
+	canonical := "r seele AAoQ1DAR6kkoo19hBAX5K0QztNw 2019-01-02 00:20:24 67.174.243.193 9001 0\n" +
+		"s\npr Cons=1-2 HSDir=1-2\nw Bandwidth=30\n"
+	if string(rs.Bytes()) != canonical {
+		t.Fatalf("wrong encoding:\n%s", rs.Bytes())
+	}
+	if _, err := ParseRouterStatus([]byte("r seele AAoQ1DAR6kkoo19hBAX5K0QztNw 2019-01-02 00:20:24 67.174.243.193 9001 0\n" +
+		"pr HSDir=2-1\n")); err == nil {
+		t.Fatal("malformed \"pr\" line is accepted")
+	}
+	rs.Nickname = "bad nickname"
+	if _, err := rs.Encode(); err == nil {
+		t.Fatal("invalid nickname is encoded")
+	}
+	if _, err := ParseRouterStatus([]byte("s Exit\n")); err == nil {
+		t.Fatal("entry without \"r\" line is accepted")
+	}
+}
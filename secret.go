@@ -0,0 +1,97 @@
+// secret.go - handling of secret key material
+//
+// To the extent possible under law, Ivan Markin waived all copyright
+// and related or neighboring rights to this module of onionutil, using the creative
+// commons "cc0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package onionutil
+
+import (
+	"crypto/rsa"
+	"crypto/subtle"
+	"math/big"
+)
+
+// SecretKey is a container of secret key material which
+// is able to wipe it from memory.
+type SecretKey []byte
+
+// NewSecretKey copies b into a new SecretKey.
+func NewSecretKey(b []byte) SecretKey {
+	return SecretKey(append([]byte(nil), b...))
+}
+
+// Zeroize overwrites the key with zeros.
+func (sk SecretKey) Zeroize() {
+	Zeroize(sk)
+}
+
+// Equal compares the key with other in constant time.
+func (sk SecretKey) Equal(other []byte) bool {
+	return ConstantTimeEqual(sk, other)
+}
+
+// Zeroize overwrites b with zeros.
+func Zeroize(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+// ConstantTimeEqual compares a and b in time which
+// depends only on their lengths.
+func ConstantTimeEqual(a, b []byte) bool {
+	return subtle.ConstantTimeCompare(a, b) == 1
+}
+
+func zeroizeBigInt(n *big.Int) {
+	if n == nil {
+		return
+	}
+	words := n.Bits()
+	for i := range words {
+		words[i] = 0
+	}
+	n.SetInt64(0)
+}
+
+// ZeroizeRSAPrivateKey overwrites private parts of sk with zeros.
+// sk must not be used afterwards. Copies of the key made internally
+// by crypto/rsa are out of reach.
+func ZeroizeRSAPrivateKey(sk *rsa.PrivateKey) {
+	zeroizeBigInt(sk.D)
+	for _, p := range sk.Primes {
+		zeroizeBigInt(p)
+	}
+	zeroizeBigInt(sk.Precomputed.Dp)
+	zeroizeBigInt(sk.Precomputed.Dq)
+	zeroizeBigInt(sk.Precomputed.Qinv)
+	for _, crt := range sk.Precomputed.CRTValues {
+		zeroizeBigInt(crt.Exp)
+		zeroizeBigInt(crt.Coeff)
+	}
+}
+
+// Zeroize overwrites esk with zeros.
+func (esk *Ed25519ExpandedKey) Zeroize() {
+	Zeroize(esk[:])
+}
+
+// Zeroize overwrites the private key with zeros.
+func (key *ClientAuthKeyV3) Zeroize() {
+	Zeroize(key.Private[:])
+}
+
+// Zeroize overwrites cookie with zeros.
+func (cookie *DescriptorCookie) Zeroize() {
+	Zeroize(cookie[:])
+}
+
+// Zeroize overwrites the cookie and the private key of the client.
+func (client *ClientAuthV2) Zeroize() {
+	client.Cookie.Zeroize()
+	if client.Key != nil {
+		ZeroizeRSAPrivateKey(client.Key)
+	}
+}
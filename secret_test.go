@@ -0,0 +1,27 @@
+package onionutil
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+)
+
+func TestZeroize(t *testing.T) {
+	sk := NewSecretKey([]byte{1, 2, 3})
+	if !sk.Equal([]byte{1, 2, 3}) || sk.Equal([]byte{1, 2}) {
+		t.Fatal("wrong comparison")
+	}
+	sk.Zeroize()
+	if !sk.Equal([]byte{0, 0, 0}) {
+		t.Fatal("key is not zeroized")
+	}
+
+	rsaSk, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ZeroizeRSAPrivateKey(rsaSk)
+	if rsaSk.D.Sign() != 0 || rsaSk.Primes[0].Sign() != 0 {
+		t.Fatal("RSA key is not zeroized")
+	}
+}
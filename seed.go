@@ -0,0 +1,115 @@
+// seed.go - deterministic derivation of onion service keys
+//
+// To the extent possible under law, Ivan Markin waived all copyright
+// and related or neighboring rights to this module of onionutil, using the creative
+// commons "cc0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package onionutil
+
+import (
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"strings"
+
+	"golang.org/x/crypto/ed25519"
+	"golang.org/x/crypto/sha3"
+)
+
+// WARNING: anyone who knows the seed or the passphrase of a service
+// derives its key and is able to impersonate the service. Since onion
+// addresses are public, guesses of passphrases can be checked offline
+// without any rate limits, so only long randomly generated passphrases
+// (like diceware ones of 8+ words) are safe to use.
+
+// Parameters of key derivation.
+const (
+	// MinSeedSize is the minimum size of seeds in bytes.
+	MinSeedSize = 32
+	// MinPassphraseLength is the minimum length of passphrases
+	// in characters.
+	MinPassphraseLength = 32
+	// PassphraseIterations is the number of PBKDF2-HMAC-SHA512
+	// iterations used to stretch passphrases.
+	PassphraseIterations = 1 << 20
+)
+
+var (
+	seedKeyPrefixV3      = []byte("onionutil onion service key v3")
+	passphraseSaltPrefix = []byte("onionutil passphrase")
+	errShortSeed         = errors.New("Seed is too short")
+	errShortPassphrase   = errors.New("Passphrase is too short")
+)
+
+// pbkdf2 is PBKDF2 (RFC 8018) with HMAC-SHA512 returning
+// a single block of 64 bytes.
+func pbkdf2(password, salt []byte, iterations int) []byte {
+	prf := hmac.New(sha512.New, password)
+	prf.Write(salt)
+	prf.Write([]byte{0, 0, 0, 1})
+	u := prf.Sum(nil)
+	t := append([]byte{}, u...)
+	for i := 1; i < iterations; i++ {
+		prf.Reset()
+		prf.Write(u)
+		u = prf.Sum(u[:0])
+		for j := range t {
+			t[j] ^= u[j]
+		}
+	}
+	Zeroize(u)
+	return t
+}
+
+// DeriveOnionKeyV3 derives v3 onion service key number index from
+// high-entropy secret seed (at least MinSeedSize random bytes).
+// Different indices give unrelated keys so a single seed may be
+// backed up for many services. See the warning above.
+func DeriveOnionKeyV3(seed []byte, index uint32) (ed25519.PrivateKey, error) {
+	if len(seed) < MinSeedSize {
+		return nil, errShortSeed
+	}
+	var indexBytes [4]byte
+	binary.BigEndian.PutUint32(indexBytes[:], index)
+	h := sha3.NewShake256()
+	h.Write(seedKeyPrefixV3)
+	h.Write(indexBytes[:])
+	h.Write(seed)
+	keySeed := make([]byte, ed25519.SeedSize)
+	defer Zeroize(keySeed)
+	h.Read(keySeed)
+	return ed25519.NewKeyFromSeed(keySeed), nil
+}
+
+// normalizePassphrase collapses whitespace of passphrase so that
+// mnemonics are not sensitive to spacing and line breaks.
+func normalizePassphrase(passphrase string) string {
+	return strings.Join(strings.Fields(passphrase), " ")
+}
+
+// DerivePassphraseSeed stretches passphrase (like a mnemonic) into
+// a seed for DeriveOnionKeyV3 using PBKDF2-HMAC-SHA512 with
+// PassphraseIterations iterations. salt should be unique to the user
+// (e.g. their name) so guesses can't be checked against many
+// services at once. See the warning above.
+func DerivePassphraseSeed(passphrase string, salt []byte) ([]byte, error) {
+	passphrase = normalizePassphrase(passphrase)
+	if len([]rune(passphrase)) < MinPassphraseLength {
+		return nil, errShortPassphrase
+	}
+	s := append(append([]byte{}, passphraseSaltPrefix...), salt...)
+	return pbkdf2([]byte(passphrase), s, PassphraseIterations), nil
+}
+
+// DeriveOnionKeyV3FromPassphrase derives v3 onion service key number
+// index from passphrase and salt (see DerivePassphraseSeed).
+func DeriveOnionKeyV3FromPassphrase(passphrase string, salt []byte, index uint32) (ed25519.PrivateKey, error) {
+	seed, err := DerivePassphraseSeed(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	defer Zeroize(seed)
+	return DeriveOnionKeyV3(seed, index)
+}
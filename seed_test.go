@@ -0,0 +1,38 @@
+package onionutil
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func TestPBKDF2(t *testing.T) {
+	/* RFC 6070 style vector for HMAC-SHA512 */
+	dk := pbkdf2([]byte("password"), []byte("salt"), 2)
+	expected := "e1d9c16aa681708a45f5c7c4e215ceb66e011a2e9f0040713f18aefdb866d53cf76cab2868a39b9f7840edce4fef5a82be67335c77a6068e04112754f27ccf4e"
+	if hex.EncodeToString(dk) != expected {
+		t.Fatalf("wrong derived key: %x", dk)
+	}
+}
+
+func TestDeriveOnionKeyV3(t *testing.T) {
+	seed := bytes.Repeat([]byte{7}, MinSeedSize)
+	sk0, err := DeriveOnionKeyV3(seed, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, _ := DeriveOnionKeyV3(seed, 0)
+	if !bytes.Equal(sk0, again) {
+		t.Fatal("derivation is not deterministic")
+	}
+	sk1, _ := DeriveOnionKeyV3(seed, 1)
+	if bytes.Equal(sk0, sk1) {
+		t.Fatal("keys of different indices are equal")
+	}
+	if _, err := DeriveOnionKeyV3(seed[1:], 0); err == nil {
+		t.Fatal("short seed is accepted")
+	}
+	if _, err := DerivePassphraseSeed("correct horse battery staple", nil); err == nil {
+		t.Fatal("short passphrase is accepted")
+	}
+}
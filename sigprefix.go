@@ -0,0 +1,70 @@
+// sigprefix.go - Ed25519 signatures with Tor domain separation
+//
+// To the extent possible under law, Ivan Markin waived all copyright
+// and related or neighboring rights to this module of onionutil, using the creative
+// commons "cc0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package onionutil
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+// SignaturePrefix is a way Tor frames data signed with Ed25519 keys
+// for a particular purpose.
+type SignaturePrefix struct {
+	// Prefix is prepended to signed data.
+	Prefix []byte
+	// Digest is set if SHA-256 digest of the prefixed data
+	// is signed rather than the data itself.
+	Digest bool
+}
+
+// Signature prefixes used by Tor.
+var (
+	// SigPrefixCertificate is of Ed25519 certificates
+	// (cert-spec 2.1) which are signed as is.
+	SigPrefixCertificate = SignaturePrefix{}
+	// SigPrefixDescriptorV3 is of v3 onion service descriptors
+	// (rend-spec-v3 2.4).
+	SigPrefixDescriptorV3 = SignaturePrefix{Prefix: DescSigPrefixV3}
+	// SigPrefixRouterDescriptor is of router-sig-ed25519
+	// of server descriptors (dir-spec 2.1.1).
+	SigPrefixRouterDescriptor = SignaturePrefix{Prefix: RouterSigEd25519Prefix, Digest: true}
+	// SigPrefixEstablishIntro is of ESTABLISH_INTRO cells
+	// (rend-spec-v3 3.1.1).
+	SigPrefixEstablishIntro = SignaturePrefix{Prefix: []byte("Tor establish-intro cell v1")}
+)
+
+// Message returns the message which is actually signed for data.
+func (p SignaturePrefix) Message(data []byte) []byte {
+	msg := append(append([]byte{}, p.Prefix...), data...)
+	if p.Digest {
+		digest := sha256.Sum256(msg)
+		return digest[:]
+	}
+	return msg
+}
+
+// SignWithPrefix signs data framed according to prefix
+// with signer which is ed25519.PrivateKey or *Ed25519ExpandedKey.
+func SignWithPrefix(signer crypto.Signer, prefix SignaturePrefix, data []byte) ([]byte, error) {
+	return signer.Sign(rand.Reader, prefix.Message(data), crypto.Hash(0))
+}
+
+// VerifyWithPrefix checks signature sig of data framed according
+// to prefix made with key pk.
+func VerifyWithPrefix(pk ed25519.PublicKey, prefix SignaturePrefix, data, sig []byte) error {
+	if len(pk) != ed25519.PublicKeySize {
+		return signatureError("wrong public key length")
+	}
+	if !ed25519.Verify(pk, prefix.Message(data), sig) {
+		return signatureError("Ed25519 signature")
+	}
+	return nil
+}
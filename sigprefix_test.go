@@ -0,0 +1,39 @@
+package onionutil
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"testing"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+func TestSignWithPrefix(t *testing.T) {
+	pk, sk, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := []byte("router example\n")
+	sig, err := SignWithPrefix(sk, SigPrefixRouterDescriptor, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256(append(append([]byte{}, RouterSigEd25519Prefix...), data...))
+	if !ed25519.Verify(pk, digest[:], sig) {
+		t.Fatal("signature is not of prefixed digest")
+	}
+	if err := VerifyWithPrefix(pk, SigPrefixRouterDescriptor, data, sig); err != nil {
+		t.Fatal(err)
+	}
+	if VerifyWithPrefix(pk, SigPrefixDescriptorV3, data, sig) == nil {
+		t.Fatal("signature with another prefix is accepted")
+	}
+
+	sig, err = SignWithPrefix(sk, SigPrefixDescriptorV3, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ed25519.Verify(pk, append(append([]byte{}, DescSigPrefixV3...), data...), sig) {
+		t.Fatal("signature is not of prefixed data")
+	}
+}
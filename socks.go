@@ -0,0 +1,260 @@
+// socks.go - dial through Tor SOCKS port
+//
+// To the extent possible under law, Ivan Markin waived all copyright
+// and related or neighboring rights to this module of onionutil, using the creative
+// commons "cc0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package onionutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultSOCKSAddr is the default address of Tor SOCKS port.
+const DefaultSOCKSAddr = "127.0.0.1:9050"
+
+const (
+	socksVersion5          = 0x05
+	socksAuthNone          = 0x00
+	socksAuthPassword      = 0x02
+	socksAuthPasswordVer   = 0x01
+	socksCmdConnect        = 0x01
+	socksAddrIPv4          = 0x01
+	socksAddrDomain        = 0x03
+	socksAddrIPv6          = 0x04
+	socksReplySucceeded    = 0x00
+	socksMaxCredentialSize = 255
+)
+
+// SOCKSError is an error reply of SOCKS5 server including Tor's
+// extended errors for onion services (prop304).
+type SOCKSError byte
+
+const (
+	SOCKSGeneralFailure         SOCKSError = 0x01
+	SOCKSNotAllowed             SOCKSError = 0x02
+	SOCKSNetworkUnreachable     SOCKSError = 0x03
+	SOCKSHostUnreachable        SOCKSError = 0x04
+	SOCKSConnectionRefused      SOCKSError = 0x05
+	SOCKSTTLExpired             SOCKSError = 0x06
+	SOCKSCommandNotSupported    SOCKSError = 0x07
+	SOCKSAddressNotSupported    SOCKSError = 0x08
+	SOCKSOnionDescNotFound      SOCKSError = 0xf0
+	SOCKSOnionDescInvalid       SOCKSError = 0xf1
+	SOCKSOnionIntroFailed       SOCKSError = 0xf2
+	SOCKSOnionRendFailed        SOCKSError = 0xf3
+	SOCKSOnionMissingClientAuth SOCKSError = 0xf4
+	SOCKSOnionWrongClientAuth   SOCKSError = 0xf5
+	SOCKSOnionBadAddress        SOCKSError = 0xf6
+	SOCKSOnionIntroTimedOut     SOCKSError = 0xf7
+)
+
+var socksErrorStrings = map[SOCKSError]string{
+	SOCKSGeneralFailure:         "general SOCKS server failure",
+	SOCKSNotAllowed:             "connection not allowed by ruleset",
+	SOCKSNetworkUnreachable:     "network unreachable",
+	SOCKSHostUnreachable:        "host unreachable",
+	SOCKSConnectionRefused:      "connection refused",
+	SOCKSTTLExpired:             "TTL expired",
+	SOCKSCommandNotSupported:    "command not supported",
+	SOCKSAddressNotSupported:    "address type not supported",
+	SOCKSOnionDescNotFound:      "onion service descriptor can not be found",
+	SOCKSOnionDescInvalid:       "onion service descriptor is invalid",
+	SOCKSOnionIntroFailed:       "onion service introduction failed",
+	SOCKSOnionRendFailed:        "onion service rendezvous failed",
+	SOCKSOnionMissingClientAuth: "onion service missing client authorization",
+	SOCKSOnionWrongClientAuth:   "onion service wrong client authorization",
+	SOCKSOnionBadAddress:        "onion service invalid address",
+	SOCKSOnionIntroTimedOut:     "onion service introduction timed out",
+}
+
+func (e SOCKSError) Error() string {
+	if s, ok := socksErrorStrings[e]; ok {
+		return "SOCKS error: " + s
+	}
+	return fmt.Sprintf("Unknown SOCKS error 0x%02x", byte(e))
+}
+
+// SOCKSDialer dials TCP connections through Tor SOCKS5 port.
+type SOCKSDialer struct {
+	// ProxyAddr is the address of SOCKS port. If empty,
+	// DefaultSOCKSAddr is used.
+	ProxyAddr string
+	// Username and Password are sent to the proxy if not empty.
+	// Tor puts streams with different credentials on different
+	// circuits (IsolateSOCKSAuth).
+	Username string
+	Password string
+	// Dialer is used to connect to the proxy. If nil,
+	// zero net.Dialer is used.
+	Dialer *net.Dialer
+}
+
+// Isolated returns copy of d which streams are isolated from streams
+// of dialers with other tags.
+func (d *SOCKSDialer) Isolated(tag string) *SOCKSDialer {
+	isolated := *d
+	isolated.Username = tag
+	isolated.Password = tag
+	return &isolated
+}
+
+func (d *SOCKSDialer) Dial(network, addr string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, addr)
+}
+
+// DialContext connects to addr through the proxy. Onion addresses
+// are validated before connecting.
+func (d *SOCKSDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+	default:
+		return nil, fmt.Errorf("Unsupported network %s", network)
+	}
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid port %s", portStr)
+	}
+	if strings.HasSuffix(strings.ToLower(host), ".onion") {
+		if _, err := ParseOnionAddress(host); err != nil {
+			return nil, err
+		}
+	}
+	if len(host) > 255 {
+		return nil, errors.New("Host name is too long")
+	}
+	if len(d.Username) > socksMaxCredentialSize || len(d.Password) > socksMaxCredentialSize {
+		return nil, errors.New("SOCKS credentials are too long")
+	}
+	proxyAddr := d.ProxyAddr
+	if proxyAddr == "" {
+		proxyAddr = DefaultSOCKSAddr
+	}
+	dialer := d.Dialer
+	if dialer == nil {
+		dialer = new(net.Dialer)
+	}
+	conn, err := dialer.DialContext(ctx, "tcp", proxyAddr)
+	if err != nil {
+		return nil, err
+	}
+	/* Interrupt the handshake if ctx is done */
+	done := make(chan struct{})
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		select {
+		case <-ctx.Done():
+			conn.SetDeadline(time.Unix(1, 0))
+		case <-done:
+		}
+	}()
+	err = d.handshake(conn, host, uint16(port))
+	close(done)
+	<-exited
+	if err != nil {
+		conn.Close()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+func (d *SOCKSDialer) handshake(conn net.Conn, host string, port uint16) error {
+	method := byte(socksAuthNone)
+	if d.Username != "" || d.Password != "" {
+		method = socksAuthPassword
+	}
+	if _, err := conn.Write([]byte{socksVersion5, 1, method}); err != nil {
+		return err
+	}
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return err
+	}
+	if reply[0] != socksVersion5 {
+		return errors.New("Unexpected SOCKS version")
+	}
+	if reply[1] != method {
+		return errors.New("No acceptable SOCKS authentication method")
+	}
+	if method == socksAuthPassword {
+		req := []byte{socksAuthPasswordVer, byte(len(d.Username))}
+		req = append(req, d.Username...)
+		req = append(req, byte(len(d.Password)))
+		req = append(req, d.Password...)
+		if _, err := conn.Write(req); err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(conn, reply); err != nil {
+			return err
+		}
+		if reply[1] != 0x00 {
+			return errors.New("SOCKS authentication failed")
+		}
+	}
+
+	req := []byte{socksVersion5, socksCmdConnect, 0x00}
+	if ip := net.ParseIP(host); ip == nil {
+		req = append(req, socksAddrDomain, byte(len(host)))
+		req = append(req, host...)
+	} else if ip4 := ip.To4(); ip4 != nil {
+		req = append(req, socksAddrIPv4)
+		req = append(req, ip4...)
+	} else {
+		req = append(req, socksAddrIPv6)
+		req = append(req, ip.To16()...)
+	}
+	req = append(req, byte(port>>8), byte(port))
+	if _, err := conn.Write(req); err != nil {
+		return err
+	}
+
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return err
+	}
+	if header[0] != socksVersion5 {
+		return errors.New("Unexpected SOCKS version")
+	}
+	if header[1] != socksReplySucceeded {
+		return SOCKSError(header[1])
+	}
+	var addrLen int
+	switch header[3] {
+	case socksAddrIPv4:
+		addrLen = net.IPv4len
+	case socksAddrIPv6:
+		addrLen = net.IPv6len
+	case socksAddrDomain:
+		if _, err := io.ReadFull(conn, header[:1]); err != nil {
+			return err
+		}
+		addrLen = int(header[0])
+	default:
+		return errors.New("Unknown address type in SOCKS reply")
+	}
+	bound := make([]byte, addrLen+2)
+	if _, err := io.ReadFull(conn, bound); err != nil {
+		return err
+	}
+	return nil
+}
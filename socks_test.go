@@ -0,0 +1,71 @@
+package onionutil
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+)
+
+// serveSOCKS accepts one connection and replies with rep after
+// reading the CONNECT request. It sends the request to reqs.
+func serveSOCKS(t *testing.T, l net.Listener, rep byte, reqs chan<- []byte) {
+	conn, err := l.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	greeting := make([]byte, 3)
+	io.ReadFull(conn, greeting)
+	conn.Write([]byte{5, greeting[2]})
+	if greeting[2] == socksAuthPassword {
+		b := make([]byte, 2)
+		io.ReadFull(conn, b)
+		user := make([]byte, b[1]+1)
+		io.ReadFull(conn, user)
+		pass := make([]byte, user[len(user)-1])
+		io.ReadFull(conn, pass)
+		conn.Write([]byte{1, 0})
+	}
+	header := make([]byte, 5)
+	io.ReadFull(conn, header)
+	req := make([]byte, int(header[4])+2)
+	io.ReadFull(conn, req)
+	reqs <- append(header, req...)
+	conn.Write([]byte{5, rep, 0, socksAddrIPv4, 0, 0, 0, 0, 0, 0})
+	conn.Write([]byte("hello"))
+}
+
+func TestSOCKSDialer(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	reqs := make(chan []byte, 1)
+	go serveSOCKS(t, l, socksReplySucceeded, reqs)
+
+	d := (&SOCKSDialer{ProxyAddr: l.Addr().String()}).Isolated("tag")
+	addr := "duskgytldkxiuqc6.onion"
+	conn, err := d.Dial("tcp", addr+":80")
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := <-reqs
+	if !bytes.Equal(req[5:len(req)-2], []byte(addr)) || req[len(req)-1] != 80 {
+		t.Fatalf("wrong CONNECT request %x", req)
+	}
+	greeting := make([]byte, 5)
+	if _, err := io.ReadFull(conn, greeting); err != nil || string(greeting) != "hello" {
+		t.Fatalf("wrong data through proxy: %q %v", greeting, err)
+	}
+	conn.Close()
+
+	go serveSOCKS(t, l, byte(SOCKSOnionDescNotFound), reqs)
+	if _, err := d.Dial("tcp", addr+":80"); err != SOCKSOnionDescNotFound {
+		t.Fatalf("expected SOCKSOnionDescNotFound, got %v", err)
+	}
+	if _, err := d.Dial("tcp", "notanonion.onion:80"); err == nil {
+		t.Fatal("invalid onion address accepted")
+	}
+}
@@ -0,0 +1,163 @@
+// srv.go - shared random values
+//
+// To the extent possible under law, Ivan Markin waived all copyright
+// and related or neighboring rights to this module of onionutil, using the creative
+// commons "cc0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package onionutil
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/nogoegst/onionutil/torparse"
+	"golang.org/x/crypto/sha3"
+)
+
+var DisasterSRVPrefix = []byte("shared-random-disaster")
+
+// SRProtocolRunLength is the length of shared randomness protocol run.
+// A new SRV is published at the start of each run (00:00 UTC).
+const SRProtocolRunLength = 24 * time.Hour
+
+// InPeriodBetweenTPAndSRV reports whether validAfter falls in between
+// the start of a time period and the next shared random value
+// (rend-spec-v3 2.2.4.1).
+func InPeriodBetweenTPAndSRV(validAfter time.Time) bool {
+	tpStart := TimePeriodStart(TimePeriodNumV3(validAfter))
+	srvStart := validAfter.Truncate(SRProtocolRunLength)
+	return !tpStart.Before(srvStart)
+}
+
+// HSDirSRV returns shared random value that clients use to compute
+// HSDir indices for time period of consensus c: the current SRV
+// after the start of time period and the previous one after a new
+// SRV is published. Disaster SRV is used if it is missing.
+func (c *Consensus) HSDirSRV() []byte {
+	srv := c.SharedRandPrevious
+	if InPeriodBetweenTPAndSRV(c.ValidAfter) {
+		srv = c.SharedRandCurrent
+	}
+	if srv == nil {
+		return DisasterSRVAt(c.ValidAfter)
+	}
+	return srv.Value
+}
+
+// DisasterSRV calculates the fallback shared random value which is
+// used when consensus doesn't contain one. periodLength is the
+// length of time period in minutes and periodNum is the number of
+// time period.
+func DisasterSRV(periodLength, periodNum uint64) []byte {
+	h := sha3.New256()
+	h.Write(DisasterSRVPrefix)
+	binary.Write(h, binary.BigEndian, periodLength)
+	binary.Write(h, binary.BigEndian, periodNum)
+	return h.Sum(nil)
+}
+
+// DisasterSRVAt calculates disaster SRV for the default length
+// time period that t falls in.
+func DisasterSRVAt(t time.Time) []byte {
+	periodLength := uint64(TimePeriodLengthV3 / time.Minute)
+	return DisasterSRV(periodLength, TimePeriodNumV3(t))
+}
+
+// Shared randomness commit-and-reveal parameters (srv-spec 3).
+const (
+	SRCommitVersion   = 1
+	SRDigestAlgorithm = "sha3-256"
+	srTimestampLength = 8
+	srDigestLength    = 32
+)
+
+// SRCommit is a commitment of a directory authority
+// to a random value ("shared-rand-commit" line of a vote).
+type SRCommit struct {
+	Version   int
+	Algorithm string
+	// Identity is the fingerprint of authority's v3 identity key.
+	Identity []byte
+	// Timestamp is the commit timestamp.
+	Timestamp time.Time
+	// HashedReveal is H(REVEAL) from the commit.
+	HashedReveal []byte
+	// Commit and Reveal are base64-encoded values as they appear
+	// in a vote. Reveal is empty during the commit phase.
+	Commit string
+	Reveal string
+}
+
+func ParseSRCommitEntry(commitE torparse.TorEntry) (commit *SRCommit, err error) {
+	if len(commitE) != 4 && len(commitE) != 5 {
+		return nil, fmt.Errorf("Wrong number of shared-rand-commit arguments")
+	}
+	commit = &SRCommit{
+		Algorithm: string(commitE[1]),
+		Commit:    string(commitE[3]),
+	}
+	commit.Version, err = strconv.Atoi(string(commitE[0]))
+	if err != nil {
+		return nil, err
+	}
+	if commit.Version != SRCommitVersion {
+		return nil, fmt.Errorf("Unsupported commit version %d", commit.Version)
+	}
+	if commit.Algorithm != SRDigestAlgorithm {
+		return nil, fmt.Errorf("Unsupported commit algorithm %s", commit.Algorithm)
+	}
+	commit.Identity, err = hex.DecodeString(string(commitE[2]))
+	if err != nil {
+		return nil, err
+	}
+	ts, hashedReveal, err := decodeSRValue(commit.Commit)
+	if err != nil {
+		return nil, err
+	}
+	commit.Timestamp, commit.HashedReveal = ts, hashedReveal
+	if len(commitE) == 5 {
+		commit.Reveal = string(commitE[4])
+	}
+	return commit, nil
+}
+
+// decodeSRValue decodes base64(INT_8(TIMESTAMP) || H(...)).
+func decodeSRValue(v string) (ts time.Time, digest []byte, err error) {
+	b, err := base64.StdEncoding.DecodeString(v)
+	if err != nil {
+		return ts, nil, err
+	}
+	if len(b) != srTimestampLength+srDigestLength {
+		return ts, nil, errors.New("Wrong length of commit value")
+	}
+	ts = time.Unix(int64(binary.BigEndian.Uint64(b[:srTimestampLength])), 0)
+	return ts, b[srTimestampLength:], nil
+}
+
+// Verify checks that the reveal matches the commitment: the
+// timestamps are the same and the hash of the encoded reveal
+// equals to the committed one.
+func (c *SRCommit) Verify() error {
+	if c.Reveal == "" {
+		return errors.New("Commit has no reveal")
+	}
+	ts, _, err := decodeSRValue(c.Reveal)
+	if err != nil {
+		return err
+	}
+	if !ts.Equal(c.Timestamp) {
+		return errors.New("Reveal timestamp doesn't match the commit")
+	}
+	hashedReveal := DigestSHA3_256.Sum([]byte(c.Reveal))
+	if !bytes.Equal(hashedReveal, c.HashedReveal) {
+		return errors.New("Reveal doesn't match the commit")
+	}
+	return nil
+}
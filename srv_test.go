@@ -0,0 +1,187 @@
+package onionutil
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/nogoegst/onionutil/torparse"
+)
+
+func TestTimePeriod(t *testing.T) {
+	validAfter := time.Date(2016, 4, 13, 11, 0, 0, 0, time.UTC)
+	/* Example from rend-spec-v3 2.2.1 */
+	if tp := GetTimePeriod(validAfter); tp != 16903 {
+		t.Fatalf("wrong time period: %d", tp)
+	}
+	if start := TimePeriodStart(16903); !start.Equal(time.Date(2016, 4, 12, 12, 0, 0, 0, time.UTC)) {
+		t.Fatalf("wrong time period start: %v", start)
+	}
+	if InPeriodBetweenTPAndSRV(validAfter) {
+		t.Fatal("11:00 is not between time period and SRV")
+	}
+	if !InPeriodBetweenTPAndSRV(validAfter.Add(2 * time.Hour)) {
+		t.Fatal("13:00 is between time period and SRV")
+	}
+
+	c := &Consensus{
+		ValidAfter:         validAfter,
+		SharedRandPrevious: &SharedRandomValue{Value: []byte("previous")},
+		SharedRandCurrent:  &SharedRandomValue{Value: []byte("current")},
+	}
+	if !bytes.Equal(c.HSDirSRV(), []byte("previous")) {
+		t.Fatal("previous SRV is expected")
+	}
+	c.ValidAfter = validAfter.Add(2 * time.Hour)
+	if !bytes.Equal(c.HSDirSRV(), []byte("current")) {
+		t.Fatal("current SRV is expected")
+	}
+}
+
+func TestHSDirSRVBetweenTPAndSRV(t *testing.T) {
+	day := time.Date(2016, 4, 13, 0, 0, 0, 0, time.UTC)
+	c := &Consensus{
+		SharedRandPrevious: &SharedRandomValue{Value: []byte("previous")},
+		SharedRandCurrent:  &SharedRandomValue{Value: []byte("current")},
+	}
+	for _, tt := range []struct {
+		validAfter time.Time
+		srv        string
+	}{
+		{day, "previous"},
+		{day.Add(12*time.Hour - time.Second), "previous"},
+		{day.Add(12 * time.Hour), "current"},
+		{day.Add(23 * time.Hour), "current"},
+		{day.Add(24 * time.Hour), "previous"},
+	} {
+		c.ValidAfter = tt.validAfter
+		if srv := c.HSDirSRV(); !bytes.Equal(srv, []byte(tt.srv)) {
+			t.Fatalf("%v: %s SRV is expected, got %s", tt.validAfter, tt.srv, srv)
+		}
+	}
+}
+
+/*
+ * Tor tests disaster SRVs only against its own computation, so
+ * expected values are calculated with hashlib of Python from the
+ * formula of rend-spec-v3 2.2.4.1.
+ */
+func TestDisasterSRV(t *testing.T) {
+	for _, tt := range []struct {
+		periodNum uint64
+		srv       string
+	}{
+		{1, "f8a4948707653837fa44abb5bbc75a12f6f101e7f8faf699b9715f4965d3507d"},
+		{2, "c17966df8b4834638e1b7bf38944c4995b92e89749d1623e417a44938d08fd67"},
+		{16903, "e7a6d7d2d9de116d1d8b5d49cdf3d070555a0fa60950ca6844ebcb88828b9f53"},
+		{16904, "1863c9ceea4187efceb917ddcaf804752a59d4e09cee129e0435758c71021886"},
+	} {
+		if !bytes.Equal(DisasterSRV(1440, tt.periodNum), mustDecodeHex(t, tt.srv)) {
+			t.Fatalf("wrong disaster SRV for time period %d", tt.periodNum)
+		}
+	}
+
+	validAfter := time.Date(2016, 4, 13, 11, 0, 0, 0, time.UTC)
+	if !bytes.Equal(DisasterSRVAt(validAfter), DisasterSRV(1440, 16903)) {
+		t.Fatal("wrong disaster SRV at 11:00")
+	}
+	if !bytes.Equal(DisasterSRVAt(validAfter.Add(2*time.Hour)), DisasterSRV(1440, 16904)) {
+		t.Fatal("wrong disaster SRV at 13:00")
+	}
+
+	c := &Consensus{ValidAfter: validAfter}
+	if !bytes.Equal(c.HSDirSRV(), DisasterSRV(1440, 16903)) {
+		t.Fatal("disaster SRV is expected without SRVs")
+	}
+	c.SharedRandCurrent = &SharedRandomValue{Value: []byte("current")}
+	if !bytes.Equal(c.HSDirSRV(), DisasterSRV(1440, 16903)) {
+		t.Fatal("disaster SRV is expected without previous SRV")
+	}
+	c.ValidAfter = validAfter.Add(2 * time.Hour)
+	if !bytes.Equal(c.HSDirSRV(), []byte("current")) {
+		t.Fatal("current SRV is expected between time period and SRV")
+	}
+	c.SharedRandCurrent = nil
+	c.SharedRandPrevious = &SharedRandomValue{Value: []byte("previous")}
+	if !bytes.Equal(c.HSDirSRV(), DisasterSRV(1440, 16904)) {
+		t.Fatal("disaster SRV is expected without current SRV")
+	}
+}
+
+/*
+ * Reveal is base64(INT_8(1466508418) || H(RN)) with RN of bytes
+ * 0..31 and commit is base64(INT_8(1466508418) || H(REVEAL)) as in
+ * srv-spec 2.2, calculated with hashlib of Python.
+ */
+const (
+	testSRIdentity = "FA2C9C56A09E0B6A2C9D3C0E6C0E0D9F4E6B2A11"
+	testSRCommit   = "AAAAAFdpJIJitEGNSQU7PMyNqNLGNhDr87H9YMm0eJqJaz/7Vy9gPQ=="
+	testSRReveal   = "AAAAAFdpJIIFCkhzO9XCdWupXFgozIPuFvq808CGiFt3RPhKD54NlA=="
+)
+
+func parseSRCommitLine(line string) (*SRCommit, error) {
+	return ParseSRCommitEntry(torparse.TorEntry(bytes.Fields([]byte(line))))
+}
+
+func TestParseSRCommitEntry(t *testing.T) {
+	commit, err := parseSRCommitLine("1 sha3-256 " + testSRIdentity + " " + testSRCommit + " " + testSRReveal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if commit.Version != 1 || commit.Algorithm != "sha3-256" ||
+		!bytes.Equal(commit.Identity, mustDecodeHex(t, testSRIdentity)) ||
+		!commit.Timestamp.Equal(time.Unix(1466508418, 0)) ||
+		len(commit.HashedReveal) != 32 ||
+		commit.Commit != testSRCommit || commit.Reveal != testSRReveal {
+		t.Fatalf("wrong commit: %+v", commit)
+	}
+	if err := commit.Verify(); err != nil {
+		t.Fatal(err)
+	}
+
+	commit, err = parseSRCommitLine("1 sha3-256 " + testSRIdentity + " " + testSRCommit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if commit.Reveal != "" {
+		t.Fatal("commit has reveal")
+	}
+	if err := commit.Verify(); err == nil {
+		t.Fatal("commit without reveal is verified")
+	}
+
+	for _, line := range []string{
+		"1 sha3-256 " + testSRIdentity,
+		"1 sha3-256 " + testSRIdentity + " " + testSRCommit + " " + testSRReveal + " extra",
+		"2 sha3-256 " + testSRIdentity + " " + testSRCommit,
+		"x sha3-256 " + testSRIdentity + " " + testSRCommit,
+		"1 sha256 " + testSRIdentity + " " + testSRCommit,
+		"1 sha3-256 nothex " + testSRCommit,
+		"1 sha3-256 " + testSRIdentity + " AAAAAFdpJII=",
+		"1 sha3-256 " + testSRIdentity + " !!!",
+	} {
+		if _, err := parseSRCommitLine(line); err == nil {
+			t.Fatalf("invalid commit is parsed: %s", line)
+		}
+	}
+}
+
+func TestSRCommitVerifyMismatch(t *testing.T) {
+	for _, reveal := range []string{
+		/* Reveal of another random number */
+		"AAAAAFdpJIII12uz1HfW86XybLZsaRSGVHrPm7rGz6v7oweEyBWuRQ==",
+		/* Reveal with a different timestamp */
+		"AAAAAFdpJIMFCkhzO9XCdWupXFgozIPuFvq808CGiFt3RPhKD54NlA==",
+		/* Commit in place of reveal */
+		testSRCommit,
+		"AAAAAFdpJII=",
+	} {
+		commit, err := parseSRCommitLine("1 sha3-256 " + testSRIdentity + " " + testSRCommit + " " + reveal)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := commit.Verify(); err == nil {
+			t.Fatalf("mismatched reveal is verified: %s", reveal)
+		}
+	}
+}
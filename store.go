@@ -0,0 +1,159 @@
+// store.go - storage of onion service descriptors
+//
+// To the extent possible under law, Ivan Markin waived all copyright
+// and related or neighboring rights to this module of onionutil, using the creative
+// commons "cc0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package onionutil
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+var ErrDescriptorNotFound = errors.New("descriptor not found")
+
+// StoredDescriptor is a descriptor in its original encoding
+// along with metadata needed to serve it.
+type StoredDescriptor struct {
+	// ID is the descriptor ID in base32 (v2) or the blinded
+	// key in base64 (v3).
+	ID        string
+	Version   int
+	Published time.Time
+	Expires   time.Time
+	Raw       []byte
+
+	// RevisionCounter is the revision counter of v3 descriptor.
+	RevisionCounter uint64
+}
+
+// DescriptorStore is a storage of descriptors keyed by their IDs.
+// Get returns ErrDescriptorNotFound if there is no unexpired
+// descriptor with a given ID.
+type DescriptorStore interface {
+	Get(id string) (*StoredDescriptor, error)
+	Put(sd *StoredDescriptor) error
+}
+
+// MemoryStore is a DescriptorStore that keeps descriptors in memory.
+type MemoryStore struct {
+	mu    sync.Mutex
+	descs map[string]*StoredDescriptor
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{descs: make(map[string]*StoredDescriptor)}
+}
+
+func (s *MemoryStore) Get(id string) (*StoredDescriptor, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sd, ok := s.descs[id]
+	if !ok {
+		return nil, ErrDescriptorNotFound
+	}
+	if !sd.Expires.IsZero() && time.Now().After(sd.Expires) {
+		delete(s.descs, id)
+		return nil, ErrDescriptorNotFound
+	}
+	return sd, nil
+}
+
+func (s *MemoryStore) Put(sd *StoredDescriptor) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.descs[sd.ID] = sd
+	return nil
+}
+
+// Expire removes all expired descriptors from the store.
+func (s *MemoryStore) Expire(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, sd := range s.descs {
+		if !sd.Expires.IsZero() && now.After(sd.Expires) {
+			delete(s.descs, id)
+		}
+	}
+}
+
+// newStoreAEAD returns AES-256-GCM under 32-byte key.
+func newStoreAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != 32 {
+		return nil, errors.New("Encryption key must be 32 bytes long")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealBlob encrypts data with a random nonce which is prepended
+// to the ciphertext.
+func sealBlob(aead cipher.AEAD, data, ad []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, data, ad), nil
+}
+
+// openBlob decrypts blob produced by sealBlob.
+func openBlob(aead cipher.AEAD, blob, ad []byte) ([]byte, error) {
+	ns := aead.NonceSize()
+	if len(blob) < ns+aead.Overhead() {
+		return nil, errors.New("Encrypted blob is too short")
+	}
+	return aead.Open(nil, blob[:ns], blob[ns:], ad)
+}
+
+// EncryptedStore is a DescriptorStore that encrypts descriptors
+// with AES-256-GCM before passing them to the underlying store.
+// Descriptor IDs and metadata are stored in plaintext and IDs
+// are authenticated along with the descriptors.
+type EncryptedStore struct {
+	store DescriptorStore
+	aead  cipher.AEAD
+}
+
+// NewEncryptedStore returns store which encrypts descriptors
+// under 32-byte key before storing them in store.
+func NewEncryptedStore(store DescriptorStore, key []byte) (*EncryptedStore, error) {
+	aead, err := newStoreAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	return &EncryptedStore{store: store, aead: aead}, nil
+}
+
+func (s *EncryptedStore) Get(id string) (*StoredDescriptor, error) {
+	sd, err := s.store.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := openBlob(s.aead, sd.Raw, []byte(sd.ID))
+	if err != nil {
+		return nil, err
+	}
+	plain := *sd
+	plain.Raw = raw
+	return &plain, nil
+}
+
+func (s *EncryptedStore) Put(sd *StoredDescriptor) error {
+	raw, err := sealBlob(s.aead, sd.Raw, []byte(sd.ID))
+	if err != nil {
+		return err
+	}
+	sealed := *sd
+	sealed.Raw = raw
+	return s.store.Put(&sealed)
+}
@@ -0,0 +1,83 @@
+package onionutil
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+	"time"
+)
+
+func newTestStoreKey(t *testing.T) []byte {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestEncryptedStore(t *testing.T) {
+	raw := []byte("rendezvous-service-descriptor 6iedtc4w36h35ln3ntklmbiawjhgdjud\n")
+	sd := &StoredDescriptor{
+		ID:      "6iedtc4w36h35ln3ntklmbiawjhgdjud",
+		Version: 2,
+		Expires: time.Now().Add(time.Hour),
+		Raw:     raw,
+	}
+	backend := NewMemoryStore()
+	key := newTestStoreKey(t)
+	s, err := NewEncryptedStore(backend, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put(sd); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(sd.Raw, raw) {
+		t.Fatal("Put modifies descriptor")
+	}
+	sealed, err := backend.Get(sd.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(sealed.Raw, raw[:20]) {
+		t.Fatal("descriptor is stored in plaintext")
+	}
+	got, err := s.Get(sd.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got.Raw, raw) || got.Version != 2 || !got.Expires.Equal(sd.Expires) {
+		t.Fatalf("wrong descriptor: %+v", got)
+	}
+	if _, err := s.Get("nonexistent"); err != ErrDescriptorNotFound {
+		t.Fatalf("wrong error for missing descriptor: %v", err)
+	}
+
+	wrongKey, err := NewEncryptedStore(backend, newTestStoreKey(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := wrongKey.Get(sd.ID); err == nil {
+		t.Fatal("descriptor is decrypted with wrong key")
+	}
+
+	// Ciphertext moved under another ID must not be accepted.
+	swapped := *sealed
+	swapped.ID = "sy6pwrgfxo5hokwa4pzpfdl3drfxsd4h"
+	backend.Put(&swapped)
+	if _, err := s.Get(swapped.ID); err == nil {
+		t.Fatal("descriptor is decrypted under swapped ID")
+	}
+
+	truncated := *sealed
+	truncated.ID = "truncated"
+	truncated.Raw = sealed.Raw[:8]
+	backend.Put(&truncated)
+	if _, err := s.Get(truncated.ID); err == nil {
+		t.Fatal("truncated descriptor is decrypted")
+	}
+
+	if _, err := NewEncryptedStore(backend, key[:16]); err == nil {
+		t.Fatal("short key is accepted")
+	}
+}
@@ -1,4 +1,42 @@
-rendezvous-service-descriptor 6iedtc4w36h35ln3ntklmbiawjhgdjud
+// descriptors.go - known descriptors
+//
+// To the extent possible under law, Ivan Markin waived all copyright
+// and related or neighboring rights to this module of onionutil, using the creative
+// commons "cc0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package testvectors
+
+import (
+	"time"
+)
+
+// DescriptorV2 is a v2 onion service descriptor along with
+// its expected properties.
+type DescriptorV2 struct {
+	Data             string
+	OnionAddress     string
+	Fingerprint      string
+	DescID           string
+	SecretIDPart     string
+	PublicationTime  time.Time
+	ProtocolVersions []int
+}
+
+// ServiceDescriptorV2 is a descriptor of hartwellnogoegst.onion
+// as served by HSDirs. It contains an unknown field
+// "new-shiny-field" and an extra empty line at the end.
+var ServiceDescriptorV2 = DescriptorV2{
+	Data:             serviceDescriptorV2,
+	OnionAddress:     "hartwellnogoegst",
+	Fingerprint:      "38233B116B6B8CE21A53327212DDCA249C1AC8FB",
+	DescID:           "6iedtc4w36h35ln3ntklmbiawjhgdjud",
+	SecretIDPart:     "tvoxg732caicyulsvpu4wh7lkw3jqqsa",
+	PublicationTime:  time.Date(2016, 6, 21, 20, 0, 0, 0, time.UTC),
+	ProtocolVersions: []int{2, 3},
+}
+
+const serviceDescriptorV2 = `rendezvous-service-descriptor 6iedtc4w36h35ln3ntklmbiawjhgdjud
 version 2
 permanent-key
 -----BEGIN RSA PUBLIC KEY-----
@@ -98,3 +136,4 @@ y7aowFYh6RkQcw8pi8705hznaDs9mTStEZCezGFSU6a0G8flXNQI4dWLR0LZJwUA
 aCd/6IQDJ/wxdTQh5PJOiywEQ0CxOuQ5k9yViCcsqts=
 -----END SIGNATURE-----
 
+`
@@ -0,0 +1,165 @@
+// testvectors.go - test vectors from specifications and Tor
+//
+// To the extent possible under law, Ivan Markin waived all copyright
+// and related or neighboring rights to this module of onionutil, using the creative
+// commons "cc0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+// Package testvectors provides known keys, addresses, certificates
+// and documents along with their expected properties. The source of
+// each set of vectors is noted in its comment.
+package testvectors
+
+import (
+	"time"
+)
+
+// Ed25519Vector is an ed25519 key with a signature of Message.
+// All the fields are hex-encoded.
+type Ed25519Vector struct {
+	Seed      string
+	PublicKey string
+	Message   string
+	Signature string
+}
+
+// Ed25519Vectors are from RFC 8032 7.1 (TEST 1 and TEST 2).
+var Ed25519Vectors = []Ed25519Vector{
+	{
+		Seed:      "9d61b19deffd5a60ba844af492ec2cc44449c5697b326919703bac031cae7f60",
+		PublicKey: "d75a980182b10ab7d54bfed3c964073a0ee172f3daa62325af021a68f707511a",
+		Message:   "",
+		Signature: "e5564300c360ac729086e2cc806e828a84877f1eb8e5d974d873e065224901555fb8821590a33bacc61e39701cf9b46bd25bf5f0595bbe24655141438e7a100b",
+	},
+	{
+		Seed:      "4ccd089b28ff96da9db6c346ec114e0f5b8a319f35aba624da8cf6ed4fb8a6fb",
+		PublicKey: "3d4017c3e843895a92b70aa74d1b7ebc9c982ccf2ec4968cc0cd55f12af4660c",
+		Message:   "72",
+		Signature: "92a009a9f0d4cab8720e820b5f642540a2b27b5416503f8fb3762223ebdb69da085ac1e43e15996e458f3613d0f11d8c387b2eaeb4302aeeb00d291612bb0c00",
+	},
+}
+
+// OnionKeyV3 is a hex-encoded ed25519 public key
+// with its v3 onion address.
+type OnionKeyV3 struct {
+	PublicKey string
+	Address   string
+}
+
+// OnionKeysV3 are from little-t-tor's test_hs_common.c.
+var OnionKeysV3 = []OnionKeyV3{
+	{
+		PublicKey: "d75a980182b10ab7d54bfed3c964073a0ee172f3daa62325af021a68f707511a",
+		Address:   "25njqamcweflpvkl73j4szahhihoc4xt3ktcgjnpaingr5yhkenl5sid",
+	},
+}
+
+// OnionAddressesV3 are valid v3 onion addresses
+// from rend-spec-v3 A.2.
+var OnionAddressesV3 = []string{
+	"pg6mmjiyjmcrsslvykfwnntlaru7p5svn6y2ymmju6nubxndf4pscryd",
+	"sp3k262uwy4r2k3ycr5awluarykdpag6a7y33jxop4cs2lu5uz5sseqd",
+	"xa4r2iadxm55fbnqgwwi5mymqdcofiu3w6rpbtqn7b2dyn7mgwj64jyd",
+}
+
+// Curve25519Vector is a hex-encoded curve25519 private key
+// with its public key.
+type Curve25519Vector struct {
+	Private string
+	Public  string
+}
+
+// Curve25519Vectors are keys of Alice and Bob from RFC 7748 6.1.
+var Curve25519Vectors = []Curve25519Vector{
+	{
+		Private: "77076d0a7318a57d3c16c17251b26645df4c2f87ebc0992ab177fba51db92c2a",
+		Public:  "8520f0098930a754748b7ddcb43ef75a0dbf3a0d26381af4eba4a98eaa9b4e6a",
+	},
+	{
+		Private: "5dab087e624a8a4b79e17f8b83800ee66f3bb1292618b6fd1c2f8b27ff88e0eb",
+		Public:  "de9edb7d7b7dc1b4d35b61c2ece435373f8343c85b78674dadfc7e146f882b4f",
+	},
+}
+
+// RSAKeyVector is a PEM-encoded RSA public key with the
+// hex-encoded SHA1 fingerprint of its PKCS#1 DER encoding.
+type RSAKeyVector struct {
+	PublicKey   string
+	Fingerprint string
+}
+
+// RSAKeyVectors are 1024-bit keys. The first one is the permanent
+// key of ServiceDescriptorV2 which has a non-default public exponent,
+// the others are generated and fingerprinted with openssl.
+var RSAKeyVectors = []RSAKeyVector{
+	{
+		PublicKey: `-----BEGIN RSA PUBLIC KEY-----
+MIGKAoGBANGR+vb53PN4uwLUoFKxsjC1QhD2n+SzligN2hJkAyT36Ke3B8bnga8d
+wyDFSvSB6AXHZaOA1TCqMu7ROc+aQMbPGLEM2+LS7OEJuUC9aAJslzy16MxGQYbt
+cmtPvUyLGxV4Bmbdyl6pVck1MA5KnF8gP6C85ytfS/c4LTnyOu4RAgQfNLBp
+-----END RSA PUBLIC KEY-----
+`,
+		Fingerprint: "38233B116B6B8CE21A53327212DDCA249C1AC8FB",
+	},
+	{
+		PublicKey: `-----BEGIN RSA PUBLIC KEY-----
+MIGJAoGBANUAM7Rpwp3d8Tl3mxZX7uuxw5jpjdRjhrcIwHmiqodca4DVqWwz52MT
+3luQjSkAPn1Txw/UIZkUfbb03Z5b2irf5+cJb4+TfFFgXizDuL7TAQOuBVzuDwY5
+lIOyrqY1ZXk17Gm12QFXhIsDwGJatseDjH20/+ljVSOIPLdXWtYDAgMBAAE=
+-----END RSA PUBLIC KEY-----
+`,
+		Fingerprint: "A75232ABF76644B225C7A25238AC07F30AEB91F0",
+	},
+	{
+		PublicKey: `-----BEGIN RSA PUBLIC KEY-----
+MIGJAoGBALBZLHMH3AJ4YtU2fdwVnearqZR5e17D8AKB+yeZ25b4nZ4DXuk/DSTW
+R0eeN60eCHrEGwXNq9kAT/nVC0WzalXQYlInpeEEMsKK/Ld7jqwfOEy4gcOf8rbY
+Pp6FTX/Gitc840c+BniyJzvKiSDnbAwMx/Q7TZDiwPzYT45iXDQXAgMBAAE=
+-----END RSA PUBLIC KEY-----
+`,
+		Fingerprint: "D998AAD178AF1620379ECE06A6F89564406E00EC",
+	},
+}
+
+// Ed25519CertVector is a hex-encoded Ed25519 certificate of Tor
+// (cert-spec) along with its expected fields.
+type Ed25519CertVector struct {
+	Cert         string
+	CertType     byte
+	Expiration   time.Time
+	CertifiedKey string
+	// SigningKey is the key in the signed-with-ed25519-key
+	// extension, empty if there is none.
+	SigningKey string
+	// Signer is the public key that verifies the certificate.
+	Signer string
+}
+
+// Ed25519CertVectors certify the keys of Ed25519Vectors with each
+// other. They are assembled by the rules of cert-spec 2.1 and signed
+// with openssl.
+var Ed25519CertVectors = []Ed25519CertVector{
+	{
+		Cert:         "010800066ba0013d4017c3e843895a92b70aa74d1b7ebc9c982ccf2ec4968cc0cd55f12af4660c0100200400d75a980182b10ab7d54bfed3c964073a0ee172f3daa62325af021a68f707511adb876429ea04ce294b596f128da94a7a61f084f0cad1613191e9cb7f7be6b072e321040b9021e1e1c9d8009e8b2d1826276cab7d03a466ed09e3aa65eba34601",
+		CertType:     0x08,
+		Expiration:   time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC),
+		CertifiedKey: "3d4017c3e843895a92b70aa74d1b7ebc9c982ccf2ec4968cc0cd55f12af4660c",
+		SigningKey:   "d75a980182b10ab7d54bfed3c964073a0ee172f3daa62325af021a68f707511a",
+		Signer:       "d75a980182b10ab7d54bfed3c964073a0ee172f3daa62325af021a68f707511a",
+	},
+	{
+		Cert:         "010400066ba001d75a980182b10ab7d54bfed3c964073a0ee172f3daa62325af021a68f707511a01002004003d4017c3e843895a92b70aa74d1b7ebc9c982ccf2ec4968cc0cd55f12af4660cde1603d6e4249bd4fea3b119ab14eac4f5b3a96e231b160924285c48d0dd848568ea3434b3af39f099700da1bc0fd428cdf3cc1a1cb6c3e18a1dd376f110f40a",
+		CertType:     0x04,
+		Expiration:   time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC),
+		CertifiedKey: "d75a980182b10ab7d54bfed3c964073a0ee172f3daa62325af021a68f707511a",
+		SigningKey:   "3d4017c3e843895a92b70aa74d1b7ebc9c982ccf2ec4968cc0cd55f12af4660c",
+		Signer:       "3d4017c3e843895a92b70aa74d1b7ebc9c982ccf2ec4968cc0cd55f12af4660c",
+	},
+	{
+		Cert:         "010a00066ba0013d4017c3e843895a92b70aa74d1b7ebc9c982ccf2ec4968cc0cd55f12af4660c0080d3c00d1d47696dd9bf399e9f81c9e60a8051031f42be25946efcfa35cc88ebe348faf8d43083634a9b511015f83dccdece9e496cf5125806652defb0128508",
+		CertType:     0x0a,
+		Expiration:   time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC),
+		CertifiedKey: "3d4017c3e843895a92b70aa74d1b7ebc9c982ccf2ec4968cc0cd55f12af4660c",
+		Signer:       "d75a980182b10ab7d54bfed3c964073a0ee172f3daa62325af021a68f707511a",
+	},
+}
@@ -0,0 +1,114 @@
+// timeperiod.go - time periods of onion service descriptors
+//
+// To the extent possible under law, Ivan Markin waived all copyright
+// and related or neighboring rights to this module of onionutil, using the creative
+// commons "cc0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package onionutil
+
+import (
+	"time"
+)
+
+// TimePeriodLengthV2 is the length of v2 time periods (rend-spec 1.3).
+const TimePeriodLengthV2 = 24 * time.Hour
+
+// timePeriodOffsetV2 returns offset of v2 time periods of service
+// with permanent ID permID which spreads descriptor rotations
+// of different services over the day.
+func timePeriodOffsetV2(permID []byte) int64 {
+	length := int64(TimePeriodLengthV2 / time.Second)
+	return int64(permID[0]) * length / 256
+}
+
+// TimePeriodV2 returns number of v2 time period of service
+// with permanent ID permID that t falls in.
+func TimePeriodV2(permID []byte, t time.Time) uint32 {
+	length := int64(TimePeriodLengthV2 / time.Second)
+	return uint32((t.Unix() + timePeriodOffsetV2(permID)) / length)
+}
+
+// TimePeriodStartV2 returns start time of v2 time period periodNum
+// of service with permanent ID permID.
+func TimePeriodStartV2(permID []byte, periodNum uint32) time.Time {
+	length := int64(TimePeriodLengthV2 / time.Second)
+	return time.Unix(int64(periodNum)*length-timePeriodOffsetV2(permID), 0).UTC()
+}
+
+// NextRotationV2 returns time after t when descriptor IDs of service
+// with permanent ID permID change.
+func NextRotationV2(permID []byte, t time.Time) time.Time {
+	return TimePeriodStartV2(permID, TimePeriodV2(permID, t)+1)
+}
+
+// Default v3 time period parameters (rend-spec-v3 2.2.1).
+const (
+	TimePeriodLengthV3         = 24 * time.Hour
+	TimePeriodRotationOffsetV3 = 12 * time.Hour
+)
+
+// TimePeriods are v3 time periods of length Length which start
+// RotationOffset after the start of a day. Both are rounded
+// down to minutes.
+type TimePeriods struct {
+	Length         time.Duration
+	RotationOffset time.Duration
+}
+
+// DefaultTimePeriodsV3 are the time periods of the Tor network.
+// Test networks may use shorter ones (hsdir-interval parameter).
+var DefaultTimePeriodsV3 = TimePeriods{
+	Length:         TimePeriodLengthV3,
+	RotationOffset: TimePeriodRotationOffsetV3,
+}
+
+// LengthMinutes returns length of time periods in minutes as used
+// in key blinding and disaster SRV.
+func (tp TimePeriods) LengthMinutes() uint64 {
+	return uint64(tp.Length / time.Minute)
+}
+
+// Num returns number of time period that t falls in.
+func (tp TimePeriods) Num(t time.Time) uint64 {
+	minutes := t.Unix() / 60
+	offset := int64(tp.RotationOffset / time.Minute)
+	return uint64((minutes - offset) / int64(tp.LengthMinutes()))
+}
+
+// Start returns start time of time period periodNum.
+func (tp TimePeriods) Start(periodNum uint64) time.Time {
+	start := time.Duration(periodNum)*tp.Length.Truncate(time.Minute) +
+		tp.RotationOffset.Truncate(time.Minute)
+	return time.Unix(int64(start/time.Second), 0).UTC()
+}
+
+// NextRotation returns start time of time period after the one
+// that t falls in.
+func (tp TimePeriods) NextRotation(t time.Time) time.Time {
+	return tp.Start(tp.Num(t) + 1)
+}
+
+// TimePeriodNumV3 returns number of the default length time period
+// that t falls in.
+func TimePeriodNumV3(t time.Time) uint64 {
+	return DefaultTimePeriodsV3.Num(t)
+}
+
+// GetTimePeriod returns number of the default length time period
+// that consensus with valid-after time validAfter falls in.
+func GetTimePeriod(validAfter time.Time) uint64 {
+	return TimePeriodNumV3(validAfter)
+}
+
+// TimePeriodStart returns start time of the default length
+// time period periodNum.
+func TimePeriodStart(periodNum uint64) time.Time {
+	return DefaultTimePeriodsV3.Start(periodNum)
+}
+
+// NextRotation returns time after t when blinded keys of v3 onion
+// services change so publishers have to upload new descriptors.
+func NextRotation(t time.Time) time.Time {
+	return DefaultTimePeriodsV3.NextRotation(t)
+}
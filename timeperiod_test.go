@@ -0,0 +1,40 @@
+package onionutil
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimePeriodV2(t *testing.T) {
+	permID := []byte{0x80, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+	now := time.Date(2017, 3, 1, 15, 0, 0, 0, time.UTC)
+	next := NextRotationV2(permID, now)
+	/* Services with permID[0] = 0x80 rotate at noon */
+	if want := time.Date(2017, 3, 2, 12, 0, 0, 0, time.UTC); !next.Equal(want) {
+		t.Fatalf("Wrong next rotation: %v", next)
+	}
+	tp := TimePeriodV2(permID, now)
+	if TimePeriodV2(permID, next.Add(-time.Second)) != tp || TimePeriodV2(permID, next) != tp+1 {
+		t.Fatal("Time period does not change at the rotation")
+	}
+	if start := TimePeriodStartV2(permID, tp); !start.Equal(next.Add(-TimePeriodLengthV2)) {
+		t.Fatalf("Wrong time period start: %v", start)
+	}
+}
+
+func TestTimePeriodsV3(t *testing.T) {
+	validAfter := time.Date(2016, 4, 13, 11, 0, 0, 0, time.UTC)
+	if next := NextRotation(validAfter); !next.Equal(time.Date(2016, 4, 13, 12, 0, 0, 0, time.UTC)) {
+		t.Fatalf("Wrong next rotation: %v", next)
+	}
+	tp := TimePeriods{Length: 2 * time.Hour, RotationOffset: 30 * time.Minute}
+	if n := tp.Num(validAfter); n != 16904*12+5 {
+		t.Fatalf("Wrong time period: %d", n)
+	}
+	if next := tp.NextRotation(validAfter); !next.Equal(time.Date(2016, 4, 13, 12, 30, 0, 0, time.UTC)) {
+		t.Fatalf("Wrong next rotation: %v", next)
+	}
+	if tp.LengthMinutes() != 120 {
+		t.Fatal("Wrong length of time period")
+	}
+}
@@ -0,0 +1,330 @@
+// cert.go - Ed25519 certificates of Tor
+//
+// To the extent possible under law, Ivan Markin waived all copyright
+// and related or neighboring rights to this module of onionutil, using the creative
+// commons "cc0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+// Package torcert implements Ed25519 certificates of Tor
+// (cert-spec) which certify relay and onion service keys.
+package torcert
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/nogoegst/onionutil/internal/torerr"
+	"github.com/nogoegst/onionutil/torkeys"
+	"golang.org/x/crypto/ed25519"
+)
+
+// Errors which are wrapped by returned errors.
+var (
+	ErrBadSignature = torerr.ErrBadSignature
+	ErrTruncated    = torerr.ErrTruncated
+	ErrTrailingData = torerr.ErrTrailingData
+)
+
+type ExtType byte
+
+const (
+	// ExtSignedWithEd25519Key carries the key that signed a certificate.
+	ExtSignedWithEd25519Key ExtType = 0x04
+)
+
+// ExtFlagAffectsValidation is set on extensions which must be
+// understood to validate a certificate.
+const ExtFlagAffectsValidation = 0x01
+
+type Extension struct {
+	Type  ExtType
+	Flags byte
+	Data  []byte
+}
+
+/*
+type CertKeyType byte
+
+const (
+	RESERVED0 CertKeyType	= 0x00
+	RESERVED1		= 0x01
+	RESERVED2		= 0x02
+	RESERVED3		= 0x03
+
+*/
+
+const CertVersion = 1
+
+// Certificate types (cert-spec A.1).
+const (
+	CertTypeIdentitySigning    = 0x04
+	CertTypeSigningLink        = 0x05
+	CertTypeSigningAuth        = 0x06
+	CertTypeHSDescSigning      = 0x08
+	CertTypeHSIntroAuth        = 0x09
+	CertTypeNTorOnionCrosscert = 0x0a
+	CertTypeHSNTorEncCrosscert = 0x0b
+)
+
+// CertKeyTypeEd25519 denotes that the certified key is an Ed25519 key.
+const CertKeyTypeEd25519 = 0x01
+
+type Certificate struct {
+	Version        uint8
+	CertType       byte
+	ExpirationDate time.Time
+	CertKeyType    byte
+	CertifiedKey   torkeys.Ed25519Pubkey
+	NExtensions    uint8
+	Extensions     map[ExtType]Extension
+	Signature      torkeys.Ed25519Signature
+	PubkeySign     bool
+	// body is the signed part of a parsed certificate as it was
+	// encoded. Extensions may be in any order there.
+	body []byte
+}
+
+// certHeaderSize is the size of certificate fields before extensions.
+const certHeaderSize = 1 + 1 + 4 + 1 + torkeys.Ed25519PubkeySize + 1
+
+// Parse parses certificate binCert ignoring any data after
+// the signature. It returns ErrTruncated if binCert is too short.
+func Parse(binCert []byte) (cert Certificate, err error) {
+	cert, _, err = parseCert(binCert)
+	return cert, err
+}
+
+// ParseStrict is like Parse but returns ErrTrailingData if there
+// is data after the signature.
+func ParseStrict(binCert []byte) (cert Certificate, err error) {
+	cert, rest, err := parseCert(binCert)
+	if err == nil && len(rest) != 0 {
+		err = ErrTrailingData
+	}
+	return cert, err
+}
+
+func parseCert(binCert []byte) (cert Certificate, rest []byte, err error) {
+	if len(binCert) < certHeaderSize {
+		return cert, nil, ErrTruncated
+	}
+	i := 0 /* Index */
+	cert.Version = uint8(binCert[i])
+	if cert.Version != CertVersion {
+		return cert, nil, fmt.Errorf("Unsupported certificate version %d", cert.Version)
+	}
+	i += 1
+	cert.CertType = binCert[i]
+	i += 1
+	expirationHours := binary.BigEndian.Uint32(binCert[i : i+4])
+	i += 4
+	expirationDuration := time.Duration(expirationHours) * time.Hour
+	expirationIntDate := int64(expirationDuration.Seconds())
+	cert.ExpirationDate = time.Unix(expirationIntDate, 0)
+	cert.CertKeyType = binCert[i]
+	i += 1
+	copy(cert.CertifiedKey[:], binCert[i:i+torkeys.Ed25519PubkeySize])
+	i += torkeys.Ed25519PubkeySize
+	cert.NExtensions = uint8(binCert[i])
+	i += 1
+	cert.Extensions = make(map[ExtType]Extension)
+	for e := 0; e < int(cert.NExtensions); e++ {
+		var extension Extension
+		if len(binCert)-i < 4 {
+			return cert, nil, ErrTruncated
+		}
+		extLength := int(binary.BigEndian.Uint16(binCert[i : i+2]))
+		i += 2
+		extension.Type = ExtType(binCert[i])
+		i += 1
+		extension.Flags = binCert[i]
+		i += 1
+		if len(binCert)-i < extLength {
+			return cert, nil, ErrTruncated
+		}
+		extension.Data = binCert[i : i+extLength]
+		i += extLength
+		/* We assume that there are no duplicates by ExtType */
+		cert.Extensions[extension.Type] = extension
+	}
+	if len(binCert)-i < torkeys.Ed25519SignatureSize {
+		return cert, nil, ErrTruncated
+	}
+	cert.body = append([]byte{}, binCert[:i]...)
+	copy(cert.Signature[:], binCert[i:i+torkeys.Ed25519SignatureSize])
+	i += torkeys.Ed25519SignatureSize
+	return cert, binCert[i:], nil
+}
+
+// New returns unsigned certificate of type certType
+// for key certified that expires at expiration. If signingKey
+// is not nil it's included into the certificate as
+// signed-with-ed25519-key extension.
+func New(certType byte, certified torkeys.Ed25519Pubkey, expiration time.Time, signingKey ed25519.PublicKey) *Certificate {
+	cert := &Certificate{
+		Version:        CertVersion,
+		CertType:       certType,
+		ExpirationDate: expiration,
+		CertKeyType:    CertKeyTypeEd25519,
+		CertifiedKey:   certified,
+		Extensions:     make(map[ExtType]Extension),
+	}
+	if signingKey != nil {
+		cert.Extensions[ExtSignedWithEd25519Key] = Extension{
+			Type:  ExtSignedWithEd25519Key,
+			Flags: 0,
+			Data:  []byte(signingKey),
+		}
+		cert.NExtensions = 1
+	}
+	return cert
+}
+
+// Body returns encoding of the certificate without the signature.
+// Extensions are encoded in order of their types.
+func (cert *Certificate) Body() []byte {
+	w := new(bytes.Buffer)
+	w.WriteByte(cert.Version)
+	w.WriteByte(cert.CertType)
+	expirationHours := uint32(cert.ExpirationDate.Unix() / 3600)
+	binary.Write(w, binary.BigEndian, expirationHours)
+	w.WriteByte(cert.CertKeyType)
+	w.Write(cert.CertifiedKey[:])
+	var extTypes []int
+	for extType := range cert.Extensions {
+		extTypes = append(extTypes, int(extType))
+	}
+	sort.Ints(extTypes)
+	w.WriteByte(uint8(len(extTypes)))
+	for _, extType := range extTypes {
+		ext := cert.Extensions[ExtType(extType)]
+		binary.Write(w, binary.BigEndian, uint16(len(ext.Data)))
+		w.WriteByte(byte(ext.Type))
+		w.WriteByte(ext.Flags)
+		w.Write(ext.Data)
+	}
+	return w.Bytes()
+}
+
+// signedBody returns the signed part of the certificate: the original
+// one for parsed certificates and Body() otherwise.
+func (cert *Certificate) signedBody() []byte {
+	if cert.body != nil {
+		return cert.body
+	}
+	return cert.Body()
+}
+
+// Bytes returns binary encoding of the certificate. Parsed
+// certificates are encoded exactly as they were.
+func (cert *Certificate) Bytes() []byte {
+	return append(append([]byte{}, cert.signedBody()...), cert.Signature[:]...)
+}
+
+// SigningKey returns the key from signed-with-ed25519-key extension
+// or nil if there is no such extension.
+func (cert *Certificate) SigningKey() ed25519.PublicKey {
+	ext, ok := cert.Extensions[ExtSignedWithEd25519Key]
+	if !ok || len(ext.Data) != ed25519.PublicKeySize {
+		return nil
+	}
+	return ed25519.PublicKey(ext.Data)
+}
+
+// Verify checks signature of the certificate. If the certificate
+// has signed-with-ed25519-key extension the key from it is used
+// and signingKey (if any) must match it. Certificates with unknown
+// extensions that affect validation are rejected.
+func (cert *Certificate) Verify(signingKey ed25519.PublicKey) error {
+	for extType, ext := range cert.Extensions {
+		if extType != ExtSignedWithEd25519Key &&
+			ext.Flags&ExtFlagAffectsValidation != 0 {
+			return fmt.Errorf("Unknown certificate extension %d", extType)
+		}
+	}
+	if embedded := cert.SigningKey(); embedded != nil {
+		if signingKey != nil && !bytes.Equal(signingKey, embedded) {
+			return torerr.Signature("certificate is signed with another key")
+		}
+		signingKey = embedded
+	}
+	if len(signingKey) != ed25519.PublicKeySize {
+		return fmt.Errorf("No valid key to verify certificate")
+	}
+	if !ed25519.Verify(signingKey, cert.signedBody(), cert.Signature[:]) {
+		return torerr.Signature("certificate")
+	}
+	return nil
+}
+
+// Expired reports whether the certificate is expired at time now.
+func (cert *Certificate) Expired(now time.Time) bool {
+	return !now.Before(cert.ExpirationDate)
+}
+
+// Sign signs the certificate with private key sk.
+func (cert *Certificate) Sign(sk ed25519.PrivateKey) {
+	cert.NExtensions = uint8(len(cert.Extensions))
+	cert.body = nil
+	copy(cert.Signature[:], ed25519.Sign(sk, cert.Body()))
+}
+
+// MarshalBinary returns the binary encoding of the certificate
+// as in Tor documents.
+func (cert *Certificate) MarshalBinary() ([]byte, error) {
+	return cert.Bytes(), nil
+}
+
+func (cert *Certificate) UnmarshalBinary(data []byte) error {
+	c, err := ParseStrict(data)
+	if err != nil {
+		return err
+	}
+	*cert = c
+	return nil
+}
+
+type certificateJSON struct {
+	Type         byte      `json:"type"`
+	Expiration   time.Time `json:"expiration"`
+	KeyType      byte      `json:"key_type"`
+	CertifiedKey []byte    `json:"certified_key"`
+	SigningKey   []byte    `json:"signing_key,omitempty"`
+	// Raw is the binary encoding which is used by UnmarshalJSON.
+	Raw []byte `json:"raw"`
+}
+
+// MarshalJSON encodes main fields of the certificate for
+// information along with its binary encoding in base64.
+func (cert *Certificate) MarshalJSON() ([]byte, error) {
+	j := certificateJSON{
+		Type:         cert.CertType,
+		Expiration:   cert.ExpirationDate.UTC(),
+		KeyType:      cert.CertKeyType,
+		CertifiedKey: cert.CertifiedKey[:],
+		SigningKey:   cert.SigningKey(),
+		Raw:          cert.Bytes(),
+	}
+	return json.Marshal(j)
+}
+
+func (cert *Certificate) UnmarshalJSON(data []byte) error {
+	var j certificateJSON
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+	if len(j.Raw) == 0 {
+		return errors.New("No raw certificate")
+	}
+	c, err := ParseStrict(j.Raw)
+	if err != nil {
+		return err
+	}
+	*cert = c
+	return nil
+}
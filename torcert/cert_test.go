@@ -0,0 +1,73 @@
+package torcert
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nogoegst/onionutil/torkeys"
+	"golang.org/x/crypto/ed25519"
+)
+
+func TestParseStrict(t *testing.T) {
+	pk, sk, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var certified torkeys.Ed25519Pubkey
+	copy(certified[:], pk)
+	cert := New(CertTypeHSDescSigning, certified, time.Now().Add(time.Hour), pk)
+	cert.Sign(sk)
+	data := cert.Bytes()
+	if _, err := ParseStrict(append(data, 0)); !errors.Is(err, ErrTrailingData) {
+		t.Fatalf("trailing data: %v", err)
+	}
+	if _, err := Parse(data[:len(data)-1]); !errors.Is(err, ErrTruncated) {
+		t.Fatalf("truncated certificate: %v", err)
+	}
+	parsed, err := ParseStrict(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := parsed.Verify(pk); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifyOriginalEncoding(t *testing.T) {
+	pk, sk, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var certified torkeys.Ed25519Pubkey
+	copy(certified[:], pk)
+	expiration := uint32(time.Now().Add(time.Hour).Unix() / 3600)
+	/* Extensions out of order of their types */
+	body := []byte{CertVersion, CertTypeHSDescSigning}
+	body = append(body, byte(expiration>>24), byte(expiration>>16), byte(expiration>>8), byte(expiration))
+	body = append(body, CertKeyTypeEd25519)
+	body = append(body, certified[:]...)
+	body = append(body, 2)
+	body = append(body, 0, 1, 0x07, 0, 0xff)
+	body = append(body, 0, 32, byte(ExtSignedWithEd25519Key), 0)
+	body = append(body, pk...)
+	data := append(body, ed25519.Sign(sk, body)...)
+
+	cert, err := ParseStrict(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cert.Verify(pk); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(cert.Bytes(), data) {
+		t.Fatal("parsed certificate is encoded differently")
+	}
+
+	data[0] = 2
+	if _, err := Parse(data); err == nil {
+		t.Fatal("certificate of unknown version is accepted")
+	}
+}
@@ -0,0 +1,213 @@
+// keys.go - fixed-size public keys and signatures of Tor
+//
+// To the extent possible under law, Ivan Markin waived all copyright
+// and related or neighboring rights to this module of onionutil, using the creative
+// commons "cc0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+// Package torkeys implements fixed-size Ed25519 and Curve25519
+// public keys and signatures as they appear in Tor documents
+// and certificates.
+package torkeys
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"github.com/nogoegst/onionutil/internal/edwards25519"
+	"github.com/nogoegst/onionutil/internal/encoding"
+	"golang.org/x/crypto/ed25519"
+)
+
+const Ed25519PubkeySize = 32
+const Ed25519SignatureSize = 64
+const Curve25519PubkeySize = 32
+const RSAPubkeySize = 128
+const RSASignatureSize = 128
+
+type Ed25519Pubkey [Ed25519PubkeySize]byte
+type Ed25519Signature [Ed25519SignatureSize]byte
+type Curve25519Pubkey [Curve25519PubkeySize]byte
+type RSASignature [RSASignatureSize]byte
+
+var (
+	ErrZeroKey         = errors.New("key is all-zero")
+	ErrNonCanonicalKey = errors.New("key encoding is not canonical")
+	ErrInvalidKey      = errors.New("key is not a valid curve point")
+	ErrSmallOrderKey   = errors.New("key is a small-order point")
+	ErrTorsionKey      = errors.New("key has a torsion component")
+)
+
+// Validate checks that pk is a canonically encoded point of the
+// prime-order subgroup of edwards25519.
+func (pk Ed25519Pubkey) Validate() error {
+	if pk == (Ed25519Pubkey{}) {
+		return ErrZeroKey
+	}
+	p, err := new(edwards25519.Point).SetBytes(pk[:])
+	switch err {
+	case nil:
+	case edwards25519.ErrNonCanonical:
+		return ErrNonCanonicalKey
+	default:
+		return ErrInvalidKey
+	}
+	if p.IsSmallOrder() {
+		return ErrSmallOrderKey
+	}
+	if !p.IsTorsionFree() {
+		return ErrTorsionKey
+	}
+	return nil
+}
+
+/* Little-endian u-coordinates of Curve25519 points of small order */
+var curve25519SmallOrder = [][]byte{
+	{0x01},
+	{0xe0, 0xeb, 0x7a, 0x7c, 0x3b, 0x41, 0xb8, 0xae,
+		0x16, 0x56, 0xe3, 0xfa, 0xf1, 0x9f, 0xc4, 0x6a,
+		0xda, 0x09, 0x8d, 0xeb, 0x9c, 0x32, 0xb1, 0xfd,
+		0x86, 0x62, 0x05, 0x16, 0x5f, 0x49, 0xb8, 0x00},
+	{0x5f, 0x9c, 0x95, 0xbc, 0xa3, 0x50, 0x8c, 0x24,
+		0xb1, 0xd0, 0xb1, 0x55, 0x9c, 0x83, 0xef, 0x5b,
+		0x04, 0x44, 0x5c, 0xc4, 0x58, 0x1c, 0x8e, 0x86,
+		0xd8, 0x22, 0x4e, 0xdd, 0xd0, 0x9f, 0x11, 0x57},
+	{0xec, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+		0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+		0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+		0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x7f},
+}
+
+// Validate checks that pk is a canonically encoded Curve25519
+// u-coordinate which is not a point of small order.
+func (pk Curve25519Pubkey) Validate() error {
+	if pk == (Curve25519Pubkey{}) {
+		return ErrZeroKey
+	}
+	if pk[31]&0x80 != 0 {
+		return ErrNonCanonicalKey
+	}
+	if edwards25519.ScalarFromBytes(pk[:]).Cmp(edwards25519.Prime) >= 0 {
+		return ErrNonCanonicalKey
+	}
+	for _, so := range curve25519SmallOrder {
+		u := make([]byte, Curve25519PubkeySize)
+		copy(u, so)
+		if bytes.Equal(pk[:], u) {
+			return ErrSmallOrderKey
+		}
+	}
+	return nil
+}
+
+// Ed25519PubkeyFromBytes returns Ed25519 public key stored in b.
+func Ed25519PubkeyFromBytes(b []byte) (pk Ed25519Pubkey, err error) {
+	if len(b) != Ed25519PubkeySize {
+		return pk, fmt.Errorf("Wrong length of Ed25519 key: %d", len(b))
+	}
+	copy(pk[:], b)
+	return pk, nil
+}
+
+// ParseEd25519Pubkey parses Ed25519 public key encoded in base64
+// with or without padding.
+func ParseEd25519Pubkey(s string) (pk Ed25519Pubkey, err error) {
+	err = encoding.DecodeBase64Fixed(pk[:], []byte(s))
+	return pk, err
+}
+
+// ParseEd25519PubkeyBase32 parses Ed25519 public key encoded
+// in base32.
+func ParseEd25519PubkeyBase32(s string) (pk Ed25519Pubkey, err error) {
+	b, err := encoding.Base32DecodeStrict(s, Ed25519PubkeySize)
+	if err != nil {
+		return pk, err
+	}
+	copy(pk[:], b)
+	return pk, nil
+}
+
+// String returns base64 encoding of pk without padding
+// (like in Tor documents).
+func (pk Ed25519Pubkey) String() string {
+	return base64.RawStdEncoding.EncodeToString(pk[:])
+}
+
+// Base32 returns lowercase base32 encoding of pk without padding.
+func (pk Ed25519Pubkey) Base32() string {
+	return encoding.Base32EncodeUnpadded(pk[:])
+}
+
+// PublicKey returns pk as ed25519.PublicKey.
+func (pk Ed25519Pubkey) PublicKey() ed25519.PublicKey {
+	return ed25519.PublicKey(append([]byte(nil), pk[:]...))
+}
+
+// Curve25519 returns Curve25519 public key birationally equivalent
+// to pk. The sign of pk is lost.
+func (pk Ed25519Pubkey) Curve25519() (Curve25519Pubkey, error) {
+	var cpk Curve25519Pubkey
+	p, err := new(edwards25519.Point).SetBytes(pk[:])
+	if err != nil {
+		return cpk, ErrInvalidKey
+	}
+	u, err := p.Montgomery()
+	if err != nil {
+		return cpk, ErrInvalidKey
+	}
+	copy(cpk[:], u)
+	return cpk, nil
+}
+
+// Curve25519PubkeyFromBytes returns Curve25519 public key stored in b.
+func Curve25519PubkeyFromBytes(b []byte) (pk Curve25519Pubkey, err error) {
+	if len(b) != Curve25519PubkeySize {
+		return pk, fmt.Errorf("Wrong length of Curve25519 key: %d", len(b))
+	}
+	copy(pk[:], b)
+	return pk, nil
+}
+
+// ParseCurve25519Pubkey parses Curve25519 public key encoded
+// in base64 with or without padding.
+func ParseCurve25519Pubkey(s string) (pk Curve25519Pubkey, err error) {
+	err = encoding.DecodeBase64Fixed(pk[:], []byte(s))
+	return pk, err
+}
+
+// ParseCurve25519PubkeyBase32 parses Curve25519 public key encoded
+// in base32.
+func ParseCurve25519PubkeyBase32(s string) (pk Curve25519Pubkey, err error) {
+	b, err := encoding.Base32DecodeStrict(s, Curve25519PubkeySize)
+	if err != nil {
+		return pk, err
+	}
+	copy(pk[:], b)
+	return pk, nil
+}
+
+// String returns base64 encoding of pk with padding (like
+// "ntor-onion-key" lines).
+func (pk Curve25519Pubkey) String() string {
+	return base64.StdEncoding.EncodeToString(pk[:])
+}
+
+// Base32 returns lowercase base32 encoding of pk without padding
+// (like in client authorization files).
+func (pk Curve25519Pubkey) Base32() string {
+	return encoding.Base32EncodeUnpadded(pk[:])
+}
+
+// Ed25519 returns Ed25519 public key birationally equivalent
+// to pk with sign bit signBit.
+func (pk Curve25519Pubkey) Ed25519(signBit byte) (Ed25519Pubkey, error) {
+	var epk Ed25519Pubkey
+	p, err := new(edwards25519.Point).SetMontgomery(pk[:], signBit)
+	if err != nil {
+		return epk, ErrInvalidKey
+	}
+	copy(epk[:], p.Bytes())
+	return epk, nil
+}
@@ -0,0 +1,120 @@
+// pem.go - PEM encoded objects of documents
+//
+// To the extent possible under law, Ivan Markin waived all copyright
+// and related or neighboring rights to this module of onionutil, using the creative
+// commons "cc0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package torparse
+
+import (
+	"bytes"
+	"encoding/pem"
+	"errors"
+	"fmt"
+)
+
+// Types of objects which appear in Tor documents.
+const (
+	ObjectRSAPublicKey = "RSA PUBLIC KEY"
+	ObjectSignature    = "SIGNATURE"
+	ObjectMessage      = "MESSAGE"
+	ObjectEd25519Cert  = "ED25519 CERT"
+)
+
+// KnownObjectTypes are the object types which parsers of this
+// module expect.
+var KnownObjectTypes = []string{
+	ObjectRSAPublicKey,
+	ObjectSignature,
+	ObjectMessage,
+	ObjectEd25519Cert,
+}
+
+// PEMBlock is a PEM encoded object found in data.
+type PEMBlock struct {
+	Type  string
+	Bytes []byte
+	// Offset is the position of "-----BEGIN" line in data and
+	// End is the position right after "-----END" line.
+	Offset int
+	End    int
+	// Line is the number of "-----BEGIN" line (starting from 1).
+	Line int
+}
+
+// FindPEMBlocks returns all well-formed PEM blocks in data in order
+// of their appearance. If blockType is not empty only blocks of that
+// type are returned. Blocks with headers are skipped as Tor never
+// uses them.
+func FindPEMBlocks(data []byte, blockType string) []PEMBlock {
+	var blocks []PEMBlock
+	pos, line := 0, 1
+	for pos < len(data) {
+		beginLine, next, _ := nextLine(data, pos)
+		if !bytes.HasPrefix(beginLine, objectBegin) || !bytes.HasSuffix(beginLine, objectTail) ||
+			len(beginLine) < len(objectBegin)+len(objectTail) {
+			pos, line = next, line+1
+			continue
+		}
+		t := beginLine[len(objectBegin) : len(beginLine)-len(objectTail)]
+		endLine := append(append(append([]byte(nil), objectEnd...), t...), objectTail...)
+		i := bytes.Index(data[next:], endLine)
+		if i < 0 {
+			pos, line = next, line+1
+			continue
+		}
+		_, end, _ := nextLine(data, next+i)
+		/* Limit data to the block so a malformed one isn't skipped */
+		block, _ := pem.Decode(data[pos:end])
+		if block == nil {
+			pos, line = next, line+1
+			continue
+		}
+		if len(block.Headers) == 0 && (blockType == "" || block.Type == blockType) {
+			blocks = append(blocks, PEMBlock{
+				Type:   block.Type,
+				Bytes:  block.Bytes,
+				Offset: pos,
+				End:    end,
+				Line:   line,
+			})
+		}
+		line += bytes.Count(data[pos:end], []byte("\n"))
+		pos = end
+	}
+	return blocks
+}
+
+// CheckObjectType checks that objType is one of types or, if types
+// are not given, one of KnownObjectTypes.
+func CheckObjectType(objType string, types ...string) error {
+	if len(types) == 0 {
+		types = KnownObjectTypes
+	}
+	for _, t := range types {
+		if objType == t {
+			return nil
+		}
+	}
+	return fmt.Errorf("Unexpected object type %s", objType)
+}
+
+// DecodePEMBlock decodes the only PEM block in data which must be
+// of type blockType. Surrounding whitespace is allowed.
+func DecodePEMBlock(data []byte, blockType string) ([]byte, error) {
+	block, rest := pem.Decode(bytes.TrimSpace(data))
+	if block == nil {
+		return nil, errors.New("No valid PEM block found")
+	}
+	if err := CheckObjectType(block.Type, blockType); err != nil {
+		return nil, err
+	}
+	if len(block.Headers) != 0 {
+		return nil, errors.New("Unexpected PEM headers")
+	}
+	if len(rest) != 0 {
+		return nil, errors.New("Trailing data after PEM block")
+	}
+	return block.Bytes, nil
+}
@@ -0,0 +1,298 @@
+// strict.go - strict parsing of documents according to dir-spec
+//
+// To the extent possible under law, Ivan Markin waived all copyright
+// and related or neighboring rights to this module of onionutil, using the creative
+// commons "cc0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package torparse
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Occurrence specifies how many times an item may appear in a document.
+type Occurrence int
+
+const (
+	OccurAnyNumber Occurrence = iota
+	OccurOnce
+	OccurAtMostOnce
+	OccurAtLeastOnce
+)
+
+// ObjectRule specifies whether an item carries an object.
+type ObjectRule int
+
+const (
+	ObjectForbidden ObjectRule = iota
+	ObjectOptional
+	ObjectRequired
+)
+
+// KeywordRule describes an item of a document (dir-spec 1.2).
+type KeywordRule struct {
+	MinArgs int
+	// MaxArgs is the maximum number of arguments.
+	// Negative value means no limit.
+	MaxArgs    int
+	Occurrence Occurrence
+	Object     ObjectRule
+	// ObjectType is the required type of the object if not empty.
+	ObjectType string
+	// AtStart and AtEnd require the item to be the first
+	// or the last item of the document.
+	AtStart bool
+	AtEnd   bool
+}
+
+// Grammar maps keywords to their rules.
+type Grammar map[string]KeywordRule
+
+// SyntaxError is a violation of document format. Line is
+// the number of line (starting from 1) where the violation is
+// found or 0 if it's related to the whole document.
+type SyntaxError struct {
+	Line    int
+	Keyword string
+	Msg     string
+}
+
+func (e *SyntaxError) Error() string {
+	if e.Line == 0 {
+		return e.Msg
+	}
+	return fmt.Sprintf("Line %d: %s", e.Line, e.Msg)
+}
+
+// SyntaxErrors are all violations found in a document.
+type SyntaxErrors []*SyntaxError
+
+func (errs SyntaxErrors) Error() string {
+	msgs := make([]string, len(errs))
+	for i, err := range errs {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+var (
+	objectBegin = []byte("-----BEGIN ")
+	objectEnd   = []byte("-----END ")
+	objectTail  = []byte("-----")
+)
+
+func isKeywordChar(c byte) bool {
+	return c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' ||
+		c >= '0' && c <= '9' || c == '-'
+}
+
+func validKeyword(kw []byte) bool {
+	if len(kw) == 0 || kw[0] == '-' {
+		return false
+	}
+	for _, c := range kw {
+		if !isKeywordChar(c) {
+			return false
+		}
+	}
+	return true
+}
+
+func validObjectType(t []byte) bool {
+	for _, kw := range bytes.Split(t, []byte(" ")) {
+		if !validKeyword(kw) {
+			return false
+		}
+	}
+	return true
+}
+
+func validArgument(arg []byte) bool {
+	if len(arg) == 0 {
+		return false
+	}
+	for _, c := range arg {
+		if c <= ' ' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// nextLine returns line of data starting at pos without the newline
+// and position of the next line.
+func nextLine(data []byte, pos int) (line []byte, next int, ok bool) {
+	i := bytes.IndexByte(data[pos:], '\n')
+	if i < 0 {
+		return data[pos:], len(data), false
+	}
+	return data[pos : pos+i], pos + i + 1, true
+}
+
+// parseObject parses object at pos which line number is lineNo.
+func parseObject(data []byte, pos, lineNo int) (objType string, obj []byte, next, lastLine int, serr *SyntaxError) {
+	line, pos, ok := nextLine(data, pos)
+	if !ok || !bytes.HasSuffix(line, objectTail) || len(line) < len(objectBegin)+len(objectTail) {
+		return "", nil, pos, lineNo, &SyntaxError{Line: lineNo, Msg: "Malformed object begin line"}
+	}
+	t := line[len(objectBegin) : len(line)-len(objectTail)]
+	if !validObjectType(t) {
+		return "", nil, pos, lineNo, &SyntaxError{Line: lineNo, Msg: fmt.Sprintf("Invalid object type %q", t)}
+	}
+	objType = string(t)
+	endLine := string(objectEnd) + objType + string(objectTail)
+	var b64 []byte
+	for {
+		lineNo++
+		line, pos, ok = nextLine(data, pos)
+		if bytes.HasPrefix(line, objectEnd) {
+			if !ok {
+				return "", nil, pos, lineNo, &SyntaxError{Line: lineNo, Msg: "Missing newline at end of document"}
+			}
+			if string(line) != endLine {
+				return "", nil, pos, lineNo, &SyntaxError{Line: lineNo, Msg: "Object end line doesn't match begin line"}
+			}
+			break
+		}
+		if !ok {
+			return "", nil, pos, lineNo, &SyntaxError{Line: lineNo, Msg: "Unterminated object"}
+		}
+		b64 = append(b64, line...)
+	}
+	obj, err := base64.StdEncoding.DecodeString(string(b64))
+	if err != nil {
+		return "", nil, pos, lineNo, &SyntaxError{Line: lineNo, Msg: "Malformed base64 in object"}
+	}
+	return objType, obj, pos, lineNo, nil
+}
+
+// ParseTorDocumentStrict parses a single document in data checking
+// that it conforms to the meta-format of dir-spec 1.2 and to grammar.
+// Keywords not present in grammar are accepted. If grammar is nil
+// only the meta-format is checked. All the violations found are
+// returned as SyntaxErrors.
+func ParseTorDocumentStrict(data []byte, grammar Grammar) (TorDocument, error) {
+	doc := newTorDocument()
+	doc.Raw = data
+	var errs SyntaxErrors
+	fail := func(line int, kw string, format string, args ...interface{}) {
+		errs = append(errs, &SyntaxError{Line: line, Keyword: kw, Msg: fmt.Sprintf(format, args...)})
+	}
+	firstLine := make(map[string]int)
+	lineNo := 0
+	pos := 0
+	for pos < len(data) {
+		start := pos
+		lineNo++
+		itemLine := lineNo
+		if bytes.HasPrefix(data[pos:], objectBegin) {
+			fail(lineNo, "", "Object without keyword line")
+			_, _, next, lastLine, serr := parseObject(data, pos, lineNo)
+			if serr != nil {
+				errs = append(errs, serr)
+				break
+			}
+			pos, lineNo = next, lastLine
+			continue
+		}
+		line, next, ok := nextLine(data, pos)
+		if !ok {
+			fail(lineNo, "", "Missing newline at end of document")
+			break
+		}
+		pos = next
+		fields := bytes.Split(line, []byte(" "))
+		kw := string(fields[0])
+		if !validKeyword(fields[0]) {
+			fail(lineNo, kw, "Invalid keyword %q", kw)
+		}
+		args := fields[1:]
+		for _, arg := range args {
+			if !validArgument(arg) {
+				fail(lineNo, kw, "Invalid argument of %s", kw)
+				break
+			}
+		}
+		content := TorEntry(args)
+		var objType string
+		hasObject := bytes.HasPrefix(data[pos:], objectBegin)
+		if hasObject {
+			var obj []byte
+			var serr *SyntaxError
+			objType, obj, pos, lineNo, serr = parseObject(data, pos, lineNo+1)
+			if serr != nil {
+				serr.Keyword = kw
+				errs = append(errs, serr)
+				break
+			}
+			content = append(content, obj)
+		}
+		doc.append(TorItem{
+			Keyword: kw,
+			Content: content,
+			Offset:  start,
+			Raw:     data[start:pos],
+		})
+		if _, ok := firstLine[kw]; !ok {
+			firstLine[kw] = itemLine
+		}
+
+		rule, known := grammar[kw]
+		if !known {
+			continue
+		}
+		if len(args) < rule.MinArgs {
+			fail(itemLine, kw, "%s requires at least %d arguments", kw, rule.MinArgs)
+		}
+		if rule.MaxArgs >= 0 && len(args) > rule.MaxArgs {
+			fail(itemLine, kw, "%s allows at most %d arguments", kw, rule.MaxArgs)
+		}
+		switch {
+		case rule.Object == ObjectRequired && !hasObject:
+			fail(itemLine, kw, "%s requires an object", kw)
+		case rule.Object == ObjectForbidden && hasObject:
+			fail(itemLine, kw, "%s must not have an object", kw)
+		case hasObject && rule.ObjectType != "" && objType != rule.ObjectType:
+			fail(itemLine, kw, "%s requires object of type %s", kw, rule.ObjectType)
+		}
+		if rule.AtStart && len(doc.Items) != 1 {
+			fail(itemLine, kw, "%s must be at start", kw)
+		}
+	}
+
+	keywords := make([]string, 0, len(grammar))
+	for kw := range grammar {
+		keywords = append(keywords, kw)
+	}
+	sort.Strings(keywords)
+	for _, kw := range keywords {
+		rule := grammar[kw]
+		n := len(doc.Entries[kw])
+		switch rule.Occurrence {
+		case OccurOnce:
+			if n != 1 {
+				fail(firstLine[kw], kw, "%s must appear exactly once", kw)
+			}
+		case OccurAtMostOnce:
+			if n > 1 {
+				fail(firstLine[kw], kw, "%s must appear at most once", kw)
+			}
+		case OccurAtLeastOnce:
+			if n < 1 {
+				fail(0, kw, "%s must appear at least once", kw)
+			}
+		}
+		if rule.AtEnd && n > 0 && doc.Items[len(doc.Items)-1].Keyword != kw {
+			fail(firstLine[kw], kw, "%s must be at end", kw)
+		}
+	}
+	if len(errs) != 0 {
+		return doc, errs
+	}
+	return doc, nil
+}
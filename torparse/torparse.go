@@ -17,7 +17,105 @@ type TorEntry [][]byte
 type TorEntries []TorEntry
 type TorEntriesMap map[string]TorEntries
 
-type TorDocument TorEntriesMap
+// TorItem is a single item of a document: a keyword line with
+// arguments and an optional object appended to Content.
+type TorItem struct {
+	Keyword string
+	Content TorEntry
+	// Offset is the position of the item in Raw of the document.
+	Offset int
+	// Raw is the exact encoding of the item including
+	// its object and the trailing newline.
+	Raw []byte
+}
+
+// TorDocument is a parsed document. Items keep the order of the
+// document and Entries allow lookup of (repeated) items by keyword.
+type TorDocument struct {
+	Items   []TorItem
+	Entries TorEntriesMap
+	// Raw is the exact encoding of the document.
+	Raw []byte
+}
+
+func newTorDocument() TorDocument {
+	return TorDocument{Entries: make(TorEntriesMap)}
+}
+
+func (doc *TorDocument) append(item TorItem) {
+	doc.Items = append(doc.Items, item)
+	doc.Entries[item.Keyword] = append(doc.Entries[item.Keyword], item.Content)
+}
+
+// SignedPart returns the part of the document from its beginning
+// through the keyword of the first item with keyword and the
+// following space or newline. This is the range covered by
+// signatures of most documents (e.g. "router-signature\n" or
+// "directory-signature "). It returns nil if there is no such item.
+func (doc TorDocument) SignedPart(keyword string) []byte {
+	for _, item := range doc.Items {
+		if item.Keyword != keyword {
+			continue
+		}
+		end := item.Offset + len(keyword) + 1
+		if end > len(doc.Raw) {
+			return nil
+		}
+		return doc.Raw[:end]
+	}
+	return nil
+}
+
+// Preceding returns the part of the document before the first item
+// with keyword, i.e. through the newline which ends the previous
+// item. This is the range covered by signatures of v3 onion service
+// descriptors. It returns nil if there is no such item.
+func (doc TorDocument) Preceding(keyword string) []byte {
+	for _, item := range doc.Items {
+		if item.Keyword == keyword && item.Offset <= len(doc.Raw) {
+			return doc.Raw[:item.Offset]
+		}
+	}
+	return nil
+}
+
+// Line returns the number of the line (starting from 1) where
+// the first item with keyword begins or 0 if there is no such item.
+func (doc TorDocument) Line(keyword string) int {
+	for _, item := range doc.Items {
+		if item.Keyword == keyword && item.Offset <= len(doc.Raw) {
+			return bytes.Count(doc.Raw[:item.Offset], []byte("\n")) + 1
+		}
+	}
+	return 0
+}
+
+// Get returns all entries of keyword in order of appearance.
+func (doc TorDocument) Get(keyword string) TorEntries {
+	return doc.Entries[keyword]
+}
+
+// First returns the first entry of keyword.
+func (doc TorDocument) First(keyword string) (TorEntry, bool) {
+	entries := doc.Entries[keyword]
+	if len(entries) == 0 {
+		return nil, false
+	}
+	return entries[0], true
+}
+
+// Keywords returns keywords of the document in order of their
+// first appearance.
+func (doc TorDocument) Keywords() (keywords []string) {
+	seen := make(map[string]bool)
+	for _, item := range doc.Items {
+		if !seen[item.Keyword] {
+			seen[item.Keyword] = true
+			keywords = append(keywords, item.Keyword)
+		}
+	}
+	return keywords
+}
 
 func (te TorEntry) Joined() (joined []byte) {
 	for index, subentry := range te {
@@ -37,7 +135,12 @@ func AtMostOnce(e TorEntries) bool {
 	return len(e) <= 1
 }
 
+// FJoined returns the first entry joined or nil if there are
+// no entries.
 func (entries TorEntries) FJoined() (joined []byte) {
+	if len(entries) == 0 {
+		return nil
+	}
 	return entries[0].Joined()
 }
 
@@ -61,7 +164,11 @@ func ParseOutNextField(data []byte) (field string, content TorEntry, rest []byte
 	content = sp_split[1:]
 	/* test if we have pem data now. if so append to previous field */
 	if bytes.HasPrefix(rest, pemStart) {
-		block, pem_rest := pem.Decode(data)
+		block, pem_rest := pem.Decode(rest)
+		if block == nil {
+			return field, content, data,
+				fmt.Errorf("Malformed object of %s", field)
+		}
 		content = append(content, block.Bytes)
 		rest = pem_rest
 	}
@@ -70,33 +177,47 @@ func ParseOutNextField(data []byte) (field string, content TorEntry, rest []byte
 
 // TODO: trim/skip empty strings/separators
 func ParseTorDocument(doc_data []byte) (docs []TorDocument, rest []byte) {
-	var doc TorDocument
+	var doc *TorDocument
 	var field string
 	var content TorEntry
 	var firstField string
 
 	var parse_err error
+	orig := doc_data
+	pos, docStart := 0, 0
 	for {
+		itemData := doc_data
 		field, content, doc_data, parse_err = ParseOutNextField(doc_data)
 		//log.Printf("parsed: %v : %v", field, content)
 		if parse_err != nil {
 			//log.Printf("Error parsing document: %v", parse_err)
 			break
 		}
+		itemLen := len(itemData) - len(doc_data)
 		if firstField == "" { /* We're just in the begining - doc name */
 			firstField = field
 		}
 		if field == firstField {
 			if doc != nil {
 				/* Append previous doc */
-				docs = append(docs, doc)
+				doc.Raw = orig[docStart:pos]
+				docs = append(docs, *doc)
 			}
-			doc = make(TorDocument)
+			newDoc := newTorDocument()
+			doc = &newDoc
+			docStart = pos
 		}
-		doc[field] = append(doc[field], content)
+		doc.append(TorItem{
+			Keyword: field,
+			Content: content,
+			Offset:  pos - docStart,
+			Raw:     itemData[:itemLen],
+		})
+		pos += itemLen
 	}
 	if doc != nil {
-		docs = append(docs, doc) /* Append a doc */
+		doc.Raw = orig[docStart:pos]
+		docs = append(docs, *doc) /* Append a doc */
 	}
 
 	return docs, doc_data
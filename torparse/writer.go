@@ -0,0 +1,100 @@
+// writer.go - write documents in Tor's meta-format
+//
+// To the extent possible under law, Ivan Markin waived all copyright
+// and related or neighboring rights to this module of onionutil, using the creative
+// commons "cc0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package torparse
+
+import (
+	"bytes"
+	"encoding/pem"
+	"errors"
+	"fmt"
+)
+
+// Document builds a document item by item (dir-spec 1.2).
+// The first invalid keyword, argument or object makes
+// the document invalid and is reported by Bytes.
+type Document struct {
+	buf   bytes.Buffer
+	items int
+	err   error
+}
+
+func NewDocument() *Document {
+	return new(Document)
+}
+
+// Item appends keyword line with arguments args.
+func (d *Document) Item(keyword string, args ...string) *Document {
+	if d.err != nil {
+		return d
+	}
+	if !validKeyword([]byte(keyword)) {
+		d.err = fmt.Errorf("Invalid keyword %q", keyword)
+		return d
+	}
+	for _, arg := range args {
+		if !validArgument([]byte(arg)) {
+			d.err = fmt.Errorf("Invalid argument %q of %s", arg, keyword)
+			return d
+		}
+	}
+	d.buf.WriteString(keyword)
+	for _, arg := range args {
+		d.buf.WriteByte(' ')
+		d.buf.WriteString(arg)
+	}
+	d.buf.WriteByte('\n')
+	d.items++
+	return d
+}
+
+// Object appends object of type objType with data
+// to the last item.
+func (d *Document) Object(objType string, data []byte) *Document {
+	if d.err != nil {
+		return d
+	}
+	if d.items == 0 {
+		d.err = fmt.Errorf("Object %s without keyword line", objType)
+		return d
+	}
+	if !validObjectType([]byte(objType)) {
+		d.err = fmt.Errorf("Invalid object type %q", objType)
+		return d
+	}
+	d.err = pem.Encode(&d.buf, &pem.Block{Type: objType, Bytes: data})
+	return d
+}
+
+// ItemObject appends keyword line without arguments followed
+// by an object.
+func (d *Document) ItemObject(keyword, objType string, data []byte) *Document {
+	return d.Item(keyword).Object(objType, data)
+}
+
+// AppendRaw appends already encoded items.
+func (d *Document) AppendRaw(b []byte) *Document {
+	if d.err != nil {
+		return d
+	}
+	if len(b) > 0 && b[len(b)-1] != '\n' {
+		d.err = errors.New("Raw items are not terminated with newline")
+		return d
+	}
+	d.buf.Write(b)
+	d.items++
+	return d
+}
+
+// Bytes returns encoding of the document or the first error
+// encountered while building it.
+func (d *Document) Bytes() ([]byte, error) {
+	if d.err != nil {
+		return nil, d.err
+	}
+	return d.buf.Bytes(), nil
+}
@@ -0,0 +1,136 @@
+// vanity.go - search for onion keys with vanity addresses
+//
+// To the extent possible under law, Ivan Markin waived all copyright
+// and related or neighboring rights to this module of onionutil, using the creative
+// commons "cc0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package onionutil
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const base32Alphabet = "abcdefghijklmnopqrstuvwxyz234567"
+
+// VanityPrefix returns a matcher of onion addresses starting
+// with prefix.
+func VanityPrefix(prefix string) (func(onionAddress string) bool, error) {
+	prefix = strings.ToLower(prefix)
+	for _, c := range prefix {
+		if !strings.ContainsRune(base32Alphabet, c) {
+			return nil, fmt.Errorf("Character %q never appears in onion addresses", c)
+		}
+	}
+	return func(onionAddress string) bool {
+		return strings.HasPrefix(onionAddress, prefix)
+	}, nil
+}
+
+// VanityRegexp returns a matcher of onion addresses matching re.
+func VanityRegexp(re *regexp.Regexp) func(onionAddress string) bool {
+	return re.MatchString
+}
+
+// VanitySearch is a search for onion key whose address is matched
+// by Match.
+type VanitySearch struct {
+	// Version is the onion address version as in GenerateOnionKey.
+	Version string
+	Match   func(onionAddress string) bool
+	// Workers is the number of goroutines generating keys.
+	// Defaults to the number of CPUs.
+	Workers int
+	// Rand is the entropy source which must be safe for concurrent
+	// use. Defaults to crypto/rand.Reader.
+	Rand io.Reader
+	// Progress is called every ProgressInterval (defaults
+	// to one second) with the number of keys tried so far.
+	Progress         func(tried uint64)
+	ProgressInterval time.Duration
+}
+
+type vanityResult struct {
+	sk           crypto.PrivateKey
+	onionAddress string
+	err          error
+}
+
+// Run searches until a matching key is found or ctx is done.
+// It returns the key and its onion address.
+func (s *VanitySearch) Run(ctx context.Context) (crypto.PrivateKey, string, error) {
+	if s.Match == nil {
+		return nil, "", fmt.Errorf("No matcher is specified")
+	}
+	workers := s.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	rnd := s.Rand
+	if rnd == nil {
+		rnd = rand.Reader
+	}
+	interval := s.ProgressInterval
+	if interval <= 0 {
+		interval = time.Second
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	var tried uint64
+	results := make(chan vanityResult, workers)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				sk, err := GenerateOnionKey(rnd, s.Version)
+				if err != nil {
+					results <- vanityResult{err: err}
+					return
+				}
+				onionAddress, err := OnionAddress(sk)
+				if err != nil {
+					results <- vanityResult{err: err}
+					return
+				}
+				atomic.AddUint64(&tried, 1)
+				if s.Match(onionAddress) {
+					results <- vanityResult{sk, onionAddress, nil}
+					return
+				}
+			}
+		}()
+	}
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+
+	var progress <-chan time.Time
+	if s.Progress != nil {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		progress = ticker.C
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, "", ctx.Err()
+		case <-progress:
+			s.Progress(atomic.LoadUint64(&tried))
+		case r := <-results:
+			return r.sk, r.onionAddress, r.err
+		}
+	}
+}
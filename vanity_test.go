@@ -0,0 +1,28 @@
+package onionutil
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestVanitySearch(t *testing.T) {
+	match, err := VanityPrefix("A")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &VanitySearch{Version: "3", Match: match, Workers: 2}
+	sk, onionAddress, err := s.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(onionAddress, "a") {
+		t.Fatalf("address %s does not match", onionAddress)
+	}
+	if addr, _ := OnionAddress(sk); addr != onionAddress {
+		t.Fatal("address does not correspond to the key")
+	}
+	if _, err := VanityPrefix("onion1"); err == nil {
+		t.Fatal("impossible prefix is accepted")
+	}
+}
@@ -0,0 +1,175 @@
+package onionutil
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"encoding/hex"
+	"testing"
+
+	"github.com/nogoegst/onionutil/pkcs1"
+	"github.com/nogoegst/onionutil/testvectors"
+	"github.com/nogoegst/onionutil/torcert"
+	"github.com/nogoegst/onionutil/torparse"
+	"golang.org/x/crypto/ed25519"
+)
+
+func mustDecodeHex(t *testing.T, s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestVectorsEd25519(t *testing.T) {
+	for i, v := range testvectors.Ed25519Vectors {
+		sk := ed25519.NewKeyFromSeed(mustDecodeHex(t, v.Seed))
+		esk := ExpandEd25519Key(sk)
+		pk := esk.Public().(ed25519.PublicKey)
+		if !bytes.Equal(pk, mustDecodeHex(t, v.PublicKey)) {
+			t.Fatalf("%d: wrong public key", i)
+		}
+		sig := esk.sign(mustDecodeHex(t, v.Message))
+		if !bytes.Equal(sig, mustDecodeHex(t, v.Signature)) {
+			t.Fatalf("%d: wrong signature", i)
+		}
+	}
+}
+
+func TestVectorsOnionAddressV3(t *testing.T) {
+	for _, v := range testvectors.OnionKeysV3 {
+		addr, err := OnionAddressV3(ed25519.PublicKey(mustDecodeHex(t, v.PublicKey)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if addr != v.Address {
+			t.Fatalf("got %s, expected %s", addr, v.Address)
+		}
+	}
+	for _, addr := range testvectors.OnionAddressesV3 {
+		if !OnionAddressIsValidV3(addr) {
+			t.Fatalf("%s is not valid", addr)
+		}
+	}
+}
+
+func TestVectorsCurve25519(t *testing.T) {
+	for i, v := range testvectors.Curve25519Vectors {
+		kp, err := GenerateNTorKeypair(bytes.NewReader(mustDecodeHex(t, v.Private)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(kp.Public[:], mustDecodeHex(t, v.Public)) {
+			t.Fatalf("%d: wrong public key", i)
+		}
+	}
+}
+
+func TestVectorsDescriptorV2(t *testing.T) {
+	v := testvectors.ServiceDescriptorV2
+	results, _ := ParseOnionDescriptors([]byte(v.Data))
+	if len(results) != 1 || results[0].Err != nil {
+		t.Fatalf("wrong results: %+v", results)
+	}
+	desc := results[0].Desc
+	addr, err := OnionAddressV2(desc.PermanentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fp, err := NewFingerprint(desc.PermanentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	switch {
+	case addr != v.OnionAddress:
+		t.Fatalf("wrong onion address %s", addr)
+	case fp.String() != v.Fingerprint:
+		t.Fatalf("wrong fingerprint %s", fp)
+	case Base32Encode(desc.DescID) != v.DescID:
+		t.Fatal("wrong descriptor ID")
+	case Base32Encode(desc.SecretIDPart) != v.SecretIDPart:
+		t.Fatal("wrong secret-id-part")
+	case !desc.PublicationTime.Equal(v.PublicationTime):
+		t.Fatal("wrong publication-time")
+	case len(desc.ProtocolVersions) != len(v.ProtocolVersions):
+		t.Fatal("wrong protocol-versions")
+	}
+}
+
+func TestVectorsRSAFingerprint(t *testing.T) {
+	for i, v := range testvectors.RSAKeyVectors {
+		der, err := torparse.DecodePEMBlock([]byte(v.PublicKey), "RSA PUBLIC KEY")
+		if err != nil {
+			t.Fatal(err)
+		}
+		pk, _, err := pkcs1.DecodePublicKeyDER(der)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fp, err := NewFingerprint(pk)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fp.String() != v.Fingerprint {
+			t.Fatalf("%d: wrong fingerprint %s", i, fp)
+		}
+		if !bytes.Equal(mustRSAPubkeyHash(t, pk), mustDecodeHex(t, v.Fingerprint)) {
+			t.Fatalf("%d: wrong public key hash", i)
+		}
+	}
+	if testvectors.RSAKeyVectors[0].Fingerprint != testvectors.ServiceDescriptorV2.Fingerprint {
+		t.Fatal("fingerprint doesn't match the descriptor")
+	}
+}
+
+func mustRSAPubkeyHash(t *testing.T, pk *rsa.PublicKey) []byte {
+	hash, err := RSAPubkeyHash(pk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hash
+}
+
+func TestVectorsEd25519Cert(t *testing.T) {
+	seeds := make(map[string]string)
+	for _, v := range testvectors.Ed25519Vectors {
+		seeds[v.PublicKey] = v.Seed
+	}
+	for i, v := range testvectors.Ed25519CertVectors {
+		data := mustDecodeHex(t, v.Cert)
+		cert, err := torcert.ParseStrict(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch {
+		case cert.CertType != v.CertType:
+			t.Fatalf("%d: wrong certificate type %d", i, cert.CertType)
+		case !cert.ExpirationDate.Equal(v.Expiration):
+			t.Fatalf("%d: wrong expiration date %v", i, cert.ExpirationDate)
+		case !bytes.Equal(cert.CertifiedKey[:], mustDecodeHex(t, v.CertifiedKey)):
+			t.Fatalf("%d: wrong certified key", i)
+		case !bytes.Equal(cert.SigningKey(), mustDecodeHex(t, v.SigningKey)):
+			t.Fatalf("%d: wrong signing key", i)
+		case !bytes.Equal(cert.Bytes(), data):
+			t.Fatalf("%d: wrong encoding", i)
+		}
+		signer := ed25519.PublicKey(mustDecodeHex(t, v.Signer))
+		if err := cert.Verify(signer); err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		other := ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize)).Public().(ed25519.PublicKey)
+		if err := cert.Verify(other); err == nil {
+			t.Fatalf("%d: certificate is verified with another key", i)
+		}
+
+		var signingKey ed25519.PublicKey
+		if v.SigningKey != "" {
+			signingKey = signer
+		}
+		generated := torcert.New(v.CertType, cert.CertifiedKey, v.Expiration, signingKey)
+		generated.Sign(ed25519.NewKeyFromSeed(mustDecodeHex(t, seeds[v.Signer])))
+		if !bytes.Equal(generated.Bytes(), data) {
+			t.Fatalf("%d: generated certificate differs", i)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+// verify.go - concurrent verification of document collections
+//
+// To the extent possible under law, Ivan Markin waived all copyright
+// and related or neighboring rights to this module of onionutil, using the creative
+// commons "cc0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package onionutil
+
+import (
+	"runtime"
+	"sync"
+	"time"
+)
+
+// Verifier is implemented by documents that are able to check
+// their signatures and internal consistency.
+type Verifier interface {
+	Verify() error
+}
+
+// VerifyResult is the outcome of verification of a single document.
+type VerifyResult struct {
+	// Index is the position of the document in the input.
+	Index int
+	Doc   Verifier
+	Err   error
+}
+
+// VerifyAll verifies docs using workers goroutines (GOMAXPROCS if
+// workers is not positive). Results are returned in the order of docs.
+func VerifyAll(docs []Verifier, workers int) []VerifyResult {
+	in := make(chan Verifier)
+	go func() {
+		for _, doc := range docs {
+			in <- doc
+		}
+		close(in)
+	}()
+	results := make([]VerifyResult, len(docs))
+	for r := range VerifyStream(in, workers) {
+		results[r.Index] = r
+	}
+	return results
+}
+
+// VerifyOnionDescriptors is a shorthand for VerifyAll on descs.
+func VerifyOnionDescriptors(descs []OnionDescriptor, workers int) []VerifyResult {
+	docs := make([]Verifier, len(descs))
+	for i := range descs {
+		docs[i] = &descs[i]
+	}
+	return VerifyAll(docs, workers)
+}
+
+// descriptorV3Verifier verifies a v3 descriptor against the blinded
+// key from its signing key certificate at time now.
+type descriptorV3Verifier struct {
+	desc *OnionDescriptorV3
+	now  time.Time
+}
+
+func (v descriptorV3Verifier) Verify() error {
+	return v.desc.VerifySignature(v.desc.BlindedKey(), v.now)
+}
+
+// VerifyOnionDescriptorsV3 is like VerifyOnionDescriptors but for v3
+// descriptors. It checks the chain from the blinded key embedded in
+// the signing key certificate to the descriptor signature and that
+// the certificate is not expired at now. Results are to be matched
+// with descs by Index.
+func VerifyOnionDescriptorsV3(descs []*OnionDescriptorV3, now time.Time, workers int) []VerifyResult {
+	docs := make([]Verifier, len(descs))
+	for i, desc := range descs {
+		docs[i] = descriptorV3Verifier{desc, now}
+	}
+	return VerifyAll(docs, workers)
+}
+
+// VerifyStream verifies documents received from docs using workers
+// goroutines and sends results as soon as they are ready. Index of
+// a result is the sequence number of the document in docs.
+// The returned channel is closed after docs is closed and drained.
+func VerifyStream(docs <-chan Verifier, workers int) <-chan VerifyResult {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	type job struct {
+		index int
+		doc   Verifier
+	}
+	jobs := make(chan job)
+	out := make(chan VerifyResult)
+	go func() {
+		i := 0
+		for doc := range docs {
+			jobs <- job{i, doc}
+			i++
+		}
+		close(jobs)
+	}()
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				out <- VerifyResult{Index: j.index, Doc: j.doc, Err: j.doc.Verify()}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+	return out
+}
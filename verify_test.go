@@ -0,0 +1,155 @@
+package onionutil
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nogoegst/onionutil/testvectors"
+	"golang.org/x/crypto/ed25519"
+)
+
+type testVerifier struct {
+	err error
+}
+
+func (v *testVerifier) Verify() error {
+	return v.err
+}
+
+func TestVerifyAll(t *testing.T) {
+	errInvalid := errors.New("invalid")
+	docs := make([]Verifier, 100)
+	for i := range docs {
+		v := &testVerifier{}
+		if i%7 == 0 {
+			v.err = errInvalid
+		}
+		docs[i] = v
+	}
+	for _, workers := range []int{0, 1, 4, 200} {
+		results := VerifyAll(docs, workers)
+		if len(results) != len(docs) {
+			t.Fatalf("%d workers: %d results", workers, len(results))
+		}
+		for i, r := range results {
+			if r.Index != i || r.Doc != docs[i] {
+				t.Fatalf("%d workers: result %d is out of order", workers, i)
+			}
+			if (i%7 == 0) != (r.Err == errInvalid) {
+				t.Fatalf("%d workers: wrong error of document %d: %v", workers, i, r.Err)
+			}
+		}
+	}
+	if results := VerifyAll(nil, 2); len(results) != 0 {
+		t.Fatalf("results for no documents: %v", results)
+	}
+}
+
+func TestVerifyStream(t *testing.T) {
+	docs := make([]Verifier, 50)
+	in := make(chan Verifier)
+	go func() {
+		for i := range docs {
+			docs[i] = &testVerifier{}
+			in <- docs[i]
+		}
+		close(in)
+	}()
+	seen := make(map[int]bool)
+	for r := range VerifyStream(in, 3) {
+		if seen[r.Index] {
+			t.Fatalf("duplicate result %d", r.Index)
+		}
+		seen[r.Index] = true
+		if r.Doc != docs[r.Index] || r.Err != nil {
+			t.Fatalf("wrong result %d", r.Index)
+		}
+	}
+	if len(seen) != len(docs) {
+		t.Fatalf("%d results for %d documents", len(seen), len(docs))
+	}
+}
+
+func TestVerifyOnionDescriptors(t *testing.T) {
+	results, _ := ParseOnionDescriptors([]byte(testvectors.ServiceDescriptorV2.Data))
+	if len(results) != 1 || results[0].Err != nil {
+		t.Fatalf("wrong results: %+v", results)
+	}
+	sk, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	generated, err := GenerateDescriptorSet(sk, nil, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	descs := []OnionDescriptor{*results[0].Desc, *generated[0], *generated[1], *generated[0]}
+	descs[2].Signature = append([]byte{}, descs[2].Signature...)
+	descs[2].Signature[0] ^= 1
+	descs[3].DescID = generated[1].DescID
+
+	verified := VerifyOnionDescriptors(descs, 2)
+	for i, wantErr := range []bool{false, false, true, true} {
+		if (verified[i].Err != nil) != wantErr {
+			t.Fatalf("wrong result of descriptor %d: %v", i, verified[i].Err)
+		}
+	}
+}
+
+func TestVerifyOnionDescriptorsV3(t *testing.T) {
+	_, identitySk, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blindedKey := BlindPrivateKey(ExpandEd25519Key(identitySk), 1, 1440)
+	otherBlindedKey := BlindPrivateKey(ExpandEd25519Key(identitySk), 2, 1440)
+	signingPk, signingSk, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	descV3 := func(revision uint64) *OnionDescriptorV3 {
+		desc := &OnionDescriptorV3{
+			Version:         DescVersionV3,
+			Lifetime:        DescLifetimeV3,
+			RevisionCounter: revision,
+			Superencrypted:  []byte("superencrypted"),
+		}
+		desc.CertifySigningKey(&blindedKey, signingPk, now.Add(time.Hour))
+		if err := desc.Sign(signingSk); err != nil {
+			t.Fatal(err)
+		}
+		return desc
+	}
+	parsed, err := ParseOnionDescriptorV3(descV3(1).Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := descV3(2)
+	tampered.RevisionCounter = 3
+	/* Certificate claims another blinded key than the one that signed it */
+	forged := descV3(4)
+	forged.SigningKeyCert.Extensions[ExtSignedWithEd25519Key] = Extension{
+		Type: ExtSignedWithEd25519Key,
+		Data: otherBlindedKey.Public().(ed25519.PublicKey),
+	}
+	noCert := descV3(5)
+	noCert.SigningKeyCert = nil
+	descs := []*OnionDescriptorV3{parsed, descV3(6), tampered, forged, noCert}
+
+	results := VerifyOnionDescriptorsV3(descs, now, 2)
+	for i, wantErr := range []bool{false, false, true, true, true} {
+		if results[i].Index != i || (results[i].Err != nil) != wantErr {
+			t.Fatalf("wrong result of descriptor %d: %v", i, results[i].Err)
+		}
+	}
+	results = VerifyOnionDescriptorsV3(descs[:2], now.Add(2*time.Hour), 0)
+	for i, r := range results {
+		if r.Err == nil {
+			t.Fatalf("descriptor %d with expired certificate is verified", i)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+// watcher.go - track onion service descriptors via control port events
+//
+// To the extent possible under law, Ivan Markin waived all copyright
+// and related or neighboring rights to this module of onionutil, using the creative
+// commons "cc0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package onionutil
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WatcherEvents is the list of control port events that
+// DescriptorWatcher consumes. It is meant to be used
+// as "SETEVENTS " + WatcherEvents.
+const WatcherEvents = "HS_DESC HS_DESC_CONTENT"
+
+// HSDescEvent is a parsed HS_DESC control port event.
+type HSDescEvent struct {
+	Action   string
+	Address  string
+	AuthType string
+	HSDir    string
+	DescID   string
+	// Args holds optional KEY=VALUE arguments (REASON, REPLICA etc.).
+	Args map[string]string
+}
+
+// ParseHSDescEvent parses line of HS_DESC event without "650 " prefix.
+func ParseHSDescEvent(line string) (*HSDescEvent, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 5 || fields[0] != "HS_DESC" {
+		return nil, fmt.Errorf("Not a valid HS_DESC event")
+	}
+	ev := &HSDescEvent{
+		Action:   fields[1],
+		Address:  fields[2],
+		AuthType: fields[3],
+		HSDir:    fields[4],
+		Args:     make(map[string]string),
+	}
+	for _, f := range fields[5:] {
+		if kv := strings.SplitN(f, "=", 2); len(kv) == 2 {
+			ev.Args[kv[0]] = kv[1]
+		} else if ev.DescID == "" {
+			ev.DescID = f
+		}
+	}
+	return ev, nil
+}
+
+// WatchedDescriptor is a descriptor received by DescriptorWatcher.
+// Descriptor is set for v2 descriptors and DescriptorV3 for v3 ones.
+type WatchedDescriptor struct {
+	Address      string
+	DescID       string
+	HSDir        string
+	Descriptor   *OnionDescriptor
+	DescriptorV3 *OnionDescriptorV3
+	Raw          []byte
+	Received     time.Time
+}
+
+// sameDescriptor reports whether wd and other are copies of the same
+// descriptor. Replicas of v2 descriptors differ in IDs and signatures,
+// so their payload is compared. v3 descriptors are the same on all
+// HSDirs within a time period.
+func (wd *WatchedDescriptor) sameDescriptor(other *WatchedDescriptor) bool {
+	switch {
+	case wd.Descriptor != nil && other.Descriptor != nil:
+		return wd.Descriptor.PublicationTime.Equal(other.Descriptor.PublicationTime) &&
+			bytes.Equal(wd.Descriptor.IntropointsBlock, other.Descriptor.IntropointsBlock)
+	case wd.DescriptorV3 != nil && other.DescriptorV3 != nil:
+		return bytes.Equal(wd.DescriptorV3.BlindedKey(), other.DescriptorV3.BlindedKey()) &&
+			wd.DescriptorV3.RevisionCounter == other.DescriptorV3.RevisionCounter
+	}
+	return false
+}
+
+// supersedes reports whether wd may replace old which is not the
+// same descriptor. It follows the replacement rules of
+// DescriptorCache for descriptors of the same time period.
+func (wd *WatchedDescriptor) supersedes(old *WatchedDescriptor) bool {
+	var sd, oldSD StoredDescriptor
+	switch {
+	case wd.Descriptor != nil && old.Descriptor != nil:
+		sd = StoredDescriptor{Version: 2, Published: wd.Descriptor.PublicationTime}
+		oldSD = StoredDescriptor{Version: 2, Published: old.Descriptor.PublicationTime}
+	case wd.DescriptorV3 != nil && old.DescriptorV3 != nil &&
+		bytes.Equal(wd.DescriptorV3.BlindedKey(), old.DescriptorV3.BlindedKey()):
+		sd = StoredDescriptor{Version: 3, RevisionCounter: wd.DescriptorV3.RevisionCounter}
+		oldSD = StoredDescriptor{Version: 3, RevisionCounter: old.DescriptorV3.RevisionCounter}
+	default:
+		return true
+	}
+	return checkReplacement(&oldSD, &sd) == nil
+}
+
+// DescriptorChange is delivered to subscribers when the current
+// descriptor of an address changes. Old is nil for the first
+// descriptor of an address.
+type DescriptorChange struct {
+	Old *WatchedDescriptor
+	New *WatchedDescriptor
+}
+
+// DescriptorWatcher consumes HS_DESC and HS_DESC_CONTENT events,
+// keeps the current descriptor for each address and notifies
+// subscribers when it changes. Copies older than the current
+// descriptor are ignored.
+type DescriptorWatcher struct {
+	mu          sync.Mutex
+	current     map[string]*WatchedDescriptor
+	subscribers []func(DescriptorChange)
+	eventSubs   []func(*HSDescEvent)
+}
+
+func NewDescriptorWatcher() *DescriptorWatcher {
+	return &DescriptorWatcher{
+		current: make(map[string]*WatchedDescriptor),
+	}
+}
+
+// Subscribe registers fn to be called on every descriptor change.
+func (w *DescriptorWatcher) Subscribe(fn func(DescriptorChange)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.subscribers = append(w.subscribers, fn)
+}
+
+// SubscribeEvents registers fn to be called on every HS_DESC event.
+func (w *DescriptorWatcher) SubscribeEvents(fn func(*HSDescEvent)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.eventSubs = append(w.eventSubs, fn)
+}
+
+// Current returns the last received copy of current descriptor
+// for address.
+func (w *DescriptorWatcher) Current(address string) (*WatchedDescriptor, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	wd, ok := w.current[address]
+	return wd, ok
+}
+
+// Watch reads control port messages from r until it fails or
+// returns EOF. r is expected to be a control connection
+// which has already been set up to receive WatcherEvents.
+// Messages other than the events are skipped.
+func (w *DescriptorWatcher) Watch(r io.Reader) error {
+	tr := textproto.NewReader(bufio.NewReader(r))
+	for {
+		line, err := tr.ReadLine()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		switch {
+		case strings.HasPrefix(line, "650+HS_DESC_CONTENT "):
+			content, err := tr.ReadDotBytes()
+			if err != nil {
+				return err
+			}
+			w.handleContent(strings.TrimPrefix(line, "650+"), content)
+		case strings.HasPrefix(line, "650 HS_DESC "):
+			ev, err := ParseHSDescEvent(strings.TrimPrefix(line, "650 "))
+			if err != nil {
+				continue
+			}
+			w.handleEvent(ev)
+		}
+	}
+}
+
+func (w *DescriptorWatcher) handleEvent(ev *HSDescEvent) {
+	w.mu.Lock()
+	subs := append([]func(*HSDescEvent){}, w.eventSubs...)
+	w.mu.Unlock()
+	for _, fn := range subs {
+		fn(ev)
+	}
+}
+
+func (w *DescriptorWatcher) handleContent(line string, content []byte) {
+	fields := strings.Fields(line)
+	if len(fields) < 4 || len(content) == 0 {
+		return
+	}
+	wd := &WatchedDescriptor{
+		Address:  fields[1],
+		DescID:   fields[2],
+		HSDir:    fields[3],
+		Raw:      content,
+		Received: time.Now(),
+	}
+	if bytes.HasPrefix(content, []byte("hs-descriptor ")) {
+		desc, err := ParseOnionDescriptorV3(content)
+		if err != nil {
+			return
+		}
+		wd.DescriptorV3 = desc
+	} else {
+		results, _ := ParseOnionDescriptors(content)
+		if len(results) != 1 || results[0].Err != nil {
+			return
+		}
+		wd.Descriptor = results[0].Desc
+	}
+
+	w.mu.Lock()
+	old := w.current[wd.Address]
+	if old != nil && wd.sameDescriptor(old) {
+		w.current[wd.Address] = wd
+		w.mu.Unlock()
+		return
+	}
+	if old != nil && !wd.supersedes(old) {
+		/* Stale copy from a lagging HSDir */
+		w.mu.Unlock()
+		return
+	}
+	w.current[wd.Address] = wd
+	subs := append([]func(DescriptorChange){}, w.subscribers...)
+	w.mu.Unlock()
+
+	for _, fn := range subs {
+		fn(DescriptorChange{Old: old, New: wd})
+	}
+}
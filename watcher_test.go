@@ -0,0 +1,213 @@
+package onionutil
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nogoegst/onionutil/testvectors"
+	"golang.org/x/crypto/ed25519"
+)
+
+func TestParseHSDescEvent(t *testing.T) {
+	ev, err := ParseHSDescEvent("HS_DESC RECEIVED hartwellnogoegst NO_AUTH " +
+		"$67B7E7AA6E8C8E9CC3EB28D01E32D61AB90BA431~nick 6iedtc4w36h35ln3ntklmbiawjhgdjud")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ev.Action != "RECEIVED" || ev.Address != "hartwellnogoegst" || ev.AuthType != "NO_AUTH" ||
+		ev.HSDir != "$67B7E7AA6E8C8E9CC3EB28D01E32D61AB90BA431~nick" ||
+		ev.DescID != "6iedtc4w36h35ln3ntklmbiawjhgdjud" || len(ev.Args) != 0 {
+		t.Fatalf("wrong event: %+v", ev)
+	}
+	ev, err = ParseHSDescEvent("HS_DESC FAILED hartwellnogoegst NO_AUTH " +
+		"$67B7E7AA6E8C8E9CC3EB28D01E32D61AB90BA431 6iedtc4w36h35ln3ntklmbiawjhgdjud REASON=NOT_FOUND")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ev.DescID != "6iedtc4w36h35ln3ntklmbiawjhgdjud" || ev.Args["REASON"] != "NOT_FOUND" {
+		t.Fatalf("wrong event: %+v", ev)
+	}
+	ev, err = ParseHSDescEvent("HS_DESC REQUESTED hartwellnogoegst NO_AUTH UNKNOWN")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ev.HSDir != "UNKNOWN" || ev.DescID != "" {
+		t.Fatalf("wrong event: %+v", ev)
+	}
+	for _, line := range []string{
+		"HS_DESC RECEIVED hartwellnogoegst NO_AUTH",
+		"HS_DESC_CONTENT hartwellnogoegst 6iedtc4w36h35ln3ntklmbiawjhgdjud $67B7E7AA6E8C8E9CC3EB28D01E32D61AB90BA431",
+	} {
+		if _, err := ParseHSDescEvent(line); err == nil {
+			t.Fatalf("invalid event is parsed: %s", line)
+		}
+	}
+}
+
+// controlContent encodes descriptor as data of a control port reply.
+func controlContent(desc []byte) string {
+	var b strings.Builder
+	for _, line := range strings.SplitAfter(strings.TrimRight(string(desc), "\n"), "\n") {
+		if strings.HasPrefix(line, ".") {
+			b.WriteString(".")
+		}
+		b.WriteString(strings.TrimSuffix(line, "\n") + "\r\n")
+	}
+	return b.String() + ".\r\n"
+}
+
+func TestDescriptorWatcher(t *testing.T) {
+	sk, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var newer OnionDescriptor
+	newer.InitDefaults()
+	newer.IntropointsBlock = []byte("introduction-point\n")
+	if err := newer.FullSign(sk); err != nil {
+		t.Fatal(err)
+	}
+
+	_, identitySk, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blindedKey := BlindPrivateKey(ExpandEd25519Key(identitySk), 1, 1440)
+	signingPk, signingSk, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	descV3 := &OnionDescriptorV3{
+		Version:         DescVersionV3,
+		Lifetime:        DescLifetimeV3,
+		RevisionCounter: 1,
+		Superencrypted:  []byte("superencrypted"),
+	}
+	descV3.CertifySigningKey(&blindedKey, signingPk, time.Now().Add(time.Hour))
+	if err := descV3.Sign(signingSk); err != nil {
+		t.Fatal(err)
+	}
+
+	const addrV2 = "hartwellnogoegst"
+	const addrV3 = "pg6mmjiyjmcrsslvykfwnntlaru7p5svn6y2ymmju6nubxndf4pscryd"
+	const hsdir1 = "$67B7E7AA6E8C8E9CC3EB28D01E32D61AB90BA431~hsdir1"
+	const hsdir2 = "$9695DFC35FFEB861329B9F1AB04C46397020CE31~hsdir2"
+	v2 := []byte(testvectors.ServiceDescriptorV2.Data)
+	transcript := "250 OK\r\n" +
+		"650 HS_DESC REQUESTED " + addrV2 + " NO_AUTH " + hsdir1 + " 6iedtc4w36h35ln3ntklmbiawjhgdjud\r\n" +
+		"650 HS_DESC RECEIVED " + addrV2 + " NO_AUTH " + hsdir1 + " 6iedtc4w36h35ln3ntklmbiawjhgdjud\r\n" +
+		"650+HS_DESC_CONTENT " + addrV2 + " 6iedtc4w36h35ln3ntklmbiawjhgdjud " + hsdir1 + "\r\n" +
+		controlContent(v2) + "650 OK\r\n" +
+		"650+HS_DESC_CONTENT " + addrV2 + " 6iedtc4w36h35ln3ntklmbiawjhgdjud " + hsdir2 + "\r\n" +
+		controlContent(v2) + "650 OK\r\n" +
+		"650+HS_DESC_CONTENT " + addrV2 + " " + Base32Encode(newer.DescID) + " " + hsdir1 + "\r\n" +
+		controlContent(newer.Bytes()) + "650 OK\r\n" +
+		"650 HS_DESC FAILED " + addrV3 + " NO_AUTH " + hsdir1 + " REASON=NOT_FOUND\r\n" +
+		"650+HS_DESC_CONTENT " + addrV3 + " blindedkey " + hsdir1 + "\r\n" +
+		controlContent(descV3.Bytes()) + "650 OK\r\n" +
+		"650+HS_DESC_CONTENT " + addrV3 + " blindedkey " + hsdir2 + "\r\n" +
+		controlContent(descV3.Bytes()) + "650 OK\r\n"
+
+	w := NewDescriptorWatcher()
+	var events []*HSDescEvent
+	var changes []DescriptorChange
+	w.SubscribeEvents(func(ev *HSDescEvent) { events = append(events, ev) })
+	w.Subscribe(func(c DescriptorChange) { changes = append(changes, c) })
+	if err := w.Watch(strings.NewReader(transcript)); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(events) != 3 || events[2].Args["REASON"] != "NOT_FOUND" {
+		t.Fatalf("wrong events: %v", events)
+	}
+	if len(changes) != 3 {
+		t.Fatalf("%d changes, expected 3", len(changes))
+	}
+	if changes[0].Old != nil || changes[0].New.Descriptor == nil ||
+		!changes[0].New.Descriptor.PublicationTime.Equal(testvectors.ServiceDescriptorV2.PublicationTime) {
+		t.Fatal("wrong first v2 descriptor")
+	}
+	if changes[1].Old == nil || changes[1].New.Descriptor == nil ||
+		changes[1].Old.HSDir != hsdir2 {
+		t.Fatal("wrong change of v2 descriptor")
+	}
+	if changes[2].Old != nil || changes[2].New.DescriptorV3 == nil ||
+		changes[2].New.DescriptorV3.RevisionCounter != 1 {
+		t.Fatal("wrong v3 descriptor")
+	}
+	current, ok := w.Current(addrV3)
+	if !ok || current.HSDir != hsdir2 || current.DescriptorV3 == nil {
+		t.Fatal("current v3 descriptor is not updated")
+	}
+}
+
+func TestDescriptorWatcherStale(t *testing.T) {
+	sk, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var newer OnionDescriptor
+	newer.InitDefaults()
+	if err := newer.FullSign(sk); err != nil {
+		t.Fatal(err)
+	}
+
+	_, identitySk, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blindedKey := BlindPrivateKey(ExpandEd25519Key(identitySk), 1, 1440)
+	signingPk, signingSk, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	descV3 := func(revision uint64) []byte {
+		desc := &OnionDescriptorV3{
+			Version:         DescVersionV3,
+			Lifetime:        DescLifetimeV3,
+			RevisionCounter: revision,
+			Superencrypted:  []byte("superencrypted"),
+		}
+		desc.CertifySigningKey(&blindedKey, signingPk, time.Now().Add(time.Hour))
+		if err := desc.Sign(signingSk); err != nil {
+			t.Fatal(err)
+		}
+		return desc.Bytes()
+	}
+
+	const addrV2 = "hartwellnogoegst"
+	const addrV3 = "pg6mmjiyjmcrsslvykfwnntlaru7p5svn6y2ymmju6nubxndf4pscryd"
+	const hsdir1 = "$67B7E7AA6E8C8E9CC3EB28D01E32D61AB90BA431~hsdir1"
+	const hsdir2 = "$9695DFC35FFEB861329B9F1AB04C46397020CE31~hsdir2"
+	transcript := "650+HS_DESC_CONTENT " + addrV2 + " " + Base32Encode(newer.DescID) + " " + hsdir1 + "\r\n" +
+		controlContent(newer.Bytes()) + "650 OK\r\n" +
+		/* Stale HSDir returns descriptor published in 2016 */
+		"650+HS_DESC_CONTENT " + addrV2 + " 6iedtc4w36h35ln3ntklmbiawjhgdjud " + hsdir2 + "\r\n" +
+		controlContent([]byte(testvectors.ServiceDescriptorV2.Data)) + "650 OK\r\n" +
+		"650+HS_DESC_CONTENT " + addrV3 + " blindedkey " + hsdir1 + "\r\n" +
+		controlContent(descV3(2)) + "650 OK\r\n" +
+		"650+HS_DESC_CONTENT " + addrV3 + " blindedkey " + hsdir2 + "\r\n" +
+		controlContent(descV3(1)) + "650 OK\r\n"
+
+	w := NewDescriptorWatcher()
+	var changes []DescriptorChange
+	w.Subscribe(func(c DescriptorChange) { changes = append(changes, c) })
+	if err := w.Watch(strings.NewReader(transcript)); err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 2 {
+		t.Fatalf("%d changes, expected 2", len(changes))
+	}
+	current, ok := w.Current(addrV2)
+	if !ok || current.HSDir != hsdir1 ||
+		!current.Descriptor.PublicationTime.Equal(newer.PublicationTime) {
+		t.Fatal("older v2 descriptor replaced the current one")
+	}
+	current, ok = w.Current(addrV3)
+	if !ok || current.HSDir != hsdir1 || current.DescriptorV3.RevisionCounter != 2 {
+		t.Fatal("older v3 revision replaced the current one")
+	}
+}
@@ -0,0 +1,121 @@
+// weights.go - bandwidth weights for path selection
+//
+// To the extent possible under law, Ivan Markin waived all copyright
+// and related or neighboring rights to this module of onionutil, using the creative
+// commons "cc0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package onionutil
+
+import (
+	"fmt"
+)
+
+// DefaultWeightScale is the default value of "bwweightscale"
+// consensus parameter.
+const DefaultWeightScale = 10000
+
+// BandwidthWeights are weights from "bandwidth-weights" line of
+// a consensus (dir-spec 3.8.3). The first letter after "W" is
+// the position (g - guard, m - middle, e - exit, b - directory
+// request) and the second one is the class of a router (g - Guard,
+// e - Exit, d - Guard and Exit, m - neither). Wgb, Wmb, Web and
+// Wdb are applied for directory requests.
+type BandwidthWeights struct {
+	Wgg, Wgm, Wgd      int
+	Wmg, Wmm, Wme, Wmd int
+	Weg, Wem, Wee, Wed int
+	Wbg, Wbm, Wbe, Wbd int
+	Wgb, Wmb, Web, Wdb int
+}
+
+func (bw *BandwidthWeights) fields() map[string]*int {
+	return map[string]*int{
+		"Wgg": &bw.Wgg, "Wgm": &bw.Wgm, "Wgd": &bw.Wgd,
+		"Wmg": &bw.Wmg, "Wmm": &bw.Wmm, "Wme": &bw.Wme, "Wmd": &bw.Wmd,
+		"Weg": &bw.Weg, "Wem": &bw.Wem, "Wee": &bw.Wee, "Wed": &bw.Wed,
+		"Wbg": &bw.Wbg, "Wbm": &bw.Wbm, "Wbe": &bw.Wbe, "Wbd": &bw.Wbd,
+		"Wgb": &bw.Wgb, "Wmb": &bw.Wmb, "Web": &bw.Web, "Wdb": &bw.Wdb,
+	}
+}
+
+// ParseBandwidthWeights converts parsed "bandwidth-weights"
+// arguments into BandwidthWeights. All the weights must be present.
+func ParseBandwidthWeights(weights map[string]int) (*BandwidthWeights, error) {
+	bw := new(BandwidthWeights)
+	for name, field := range bw.fields() {
+		value, ok := weights[name]
+		if !ok {
+			return nil, fmt.Errorf("Missing bandwidth weight %s", name)
+		}
+		*field = value
+	}
+	return bw, nil
+}
+
+// Weights returns typed bandwidth weights of the consensus.
+func (c *Consensus) Weights() (*BandwidthWeights, error) {
+	if c.BandwidthWeights == nil {
+		return nil, fmt.Errorf("Consensus has no bandwidth-weights")
+	}
+	return ParseBandwidthWeights(c.BandwidthWeights)
+}
+
+// WeightScale returns "bwweightscale" parameter of the consensus.
+func (c *Consensus) WeightScale() int {
+	if scale, ok := c.Params["bwweightscale"]; ok && scale > 0 {
+		return scale
+	}
+	return DefaultWeightScale
+}
+
+// Position is a position of a router in a circuit.
+type Position byte
+
+const (
+	PositionGuard  Position = 'g'
+	PositionMiddle Position = 'm'
+	PositionExit   Position = 'e'
+	// PositionDir is used to pick a directory cache.
+	PositionDir Position = 'b'
+)
+
+// Weight returns the weight of a router with guard and exit flags
+// as given at position pos.
+func (bw *BandwidthWeights) Weight(pos Position, guard, exit bool) int {
+	var weights [4]int /* Guard, Exit, Guard and Exit, neither */
+	switch pos {
+	case PositionGuard:
+		weights = [4]int{bw.Wgg, 0, bw.Wgd, bw.Wgm}
+	case PositionMiddle:
+		weights = [4]int{bw.Wmg, bw.Wme, bw.Wmd, bw.Wmm}
+	case PositionExit:
+		weights = [4]int{bw.Weg, bw.Wee, bw.Wed, bw.Wem}
+	case PositionDir:
+		weights = [4]int{bw.Wbg, bw.Wbe, bw.Wbd, bw.Wbm}
+	default:
+		return 0
+	}
+	switch {
+	case guard && exit:
+		return weights[2]
+	case guard:
+		return weights[0]
+	case exit:
+		return weights[1]
+	default:
+		return weights[3]
+	}
+}
+
+// WeightedBandwidth returns bandwidth of rs weighted for position pos
+// with weight scale scale. Routers with BadExit flag are not
+// considered exits.
+func (bw *BandwidthWeights) WeightedBandwidth(rs *RouterStatus, pos Position, scale int) float64 {
+	if scale <= 0 {
+		scale = DefaultWeightScale
+	}
+	guard := rs.Flags.Has(FlagGuard)
+	exit := rs.Flags.Has(FlagExit) && !rs.Flags.Has(FlagBadExit)
+	return float64(rs.Bandwidth) * float64(bw.Weight(pos, guard, exit)) / float64(scale)
+}
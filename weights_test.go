@@ -0,0 +1,46 @@
+package onionutil
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestBandwidthWeights(t *testing.T) {
+	data := bytes.Replace(testConsensus,
+		[]byte("bandwidth-weights Wbd=0 Wbe=0 Wbg=4149 Wbm=10000\n"),
+		[]byte("bandwidth-weights Wbd=0 Wbe=0 Wbg=4149 Wbm=10000 Wdb=10000 Web=10000 Wed=10000 Wee=10000 Weg=10000 Wem=10000 Wgb=10000 Wgd=0 Wgg=5851 Wgm=5851 Wmb=10000 Wmd=0 Wme=0 Wmg=4149 Wmm=10000\n"), 1)
+	data = bytes.Replace(data, []byte("w Bandwidth=30\n"), []byte("w Bandwidth=30 Unmeasured=1\n"), 1)
+	c, err := ParseConsensus(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.Routers[0].Unmeasured || c.Routers[1].Unmeasured {
+		t.Fatal("Unmeasured is not parsed")
+	}
+	bw, err := c.Weights()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bw.Wgg != 5851 || bw.Wmg != 4149 || bw.Wdb != 10000 {
+		t.Fatalf("wrong weights: %+v", bw)
+	}
+	if c.WeightScale() != DefaultWeightScale {
+		t.Fatal("wrong weight scale")
+	}
+	/* CalyxInstitute14 is Guard and Exit */
+	r := &c.Routers[1]
+	if w := bw.WeightedBandwidth(r, PositionGuard, c.WeightScale()); w != 0 {
+		t.Fatalf("wrong guard weighted bandwidth %v", w)
+	}
+	if w := bw.WeightedBandwidth(r, PositionExit, c.WeightScale()); w != 8770 {
+		t.Fatalf("wrong exit weighted bandwidth %v", w)
+	}
+	if bw.Weight(PositionGuard, true, false) != 5851 || bw.Weight(PositionMiddle, false, false) != 10000 {
+		t.Fatal("wrong weights for position")
+	}
+
+	c.BandwidthWeights = map[string]int{"Wbd": 0}
+	if _, err := c.Weights(); err == nil {
+		t.Fatal("incomplete weights are accepted")
+	}
+}